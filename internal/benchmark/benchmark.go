@@ -185,6 +185,10 @@ func (r *Runner) runCase(c Case) Result {
 	// Set up recording
 	rec := &recorder{}
 	s.OnMessage = func(msg wire.Message) {
+		// Only final messages count; streaming updates are superseded
+		if msg.IsStreaming() {
+			return
+		}
 		rec.messages = append(rec.messages, msg)
 	}
 	s.OnToolCall = func(tc tools.ToolCall) {
@@ -4,6 +4,7 @@ package config
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -67,11 +68,23 @@ max_retries_per_step = 5
 max_ralph_iterations = 10
 reserved_context_size = 10000
 
+[tool_output]
+max_chars = 20000
+max_line_length = 1000
+
 [providers.test]
 type = "kimi"
 base_url = "https://api.example.com"
 api_key = "test-key"
 
+[providers.test.retry]
+max_retries = 2
+max_retry_after_ms = 30000
+
+[providers.test.rate_limit]
+requests_per_minute = 50
+tokens_per_minute = 40000
+
 [models.test-model]
 provider = "test"
 model = "kimi-k2.5"
@@ -115,6 +128,10 @@ max_context_size = 100000
 		t.Errorf("Expected MaxRalphIterations to be 10, got %d", cfg.LoopControl.MaxRalphIterations)
 	}
 
+	if cfg.ToolOutput.MaxChars != 20000 || cfg.ToolOutput.MaxLineLength != 1000 {
+		t.Errorf("Unexpected tool_output: %+v", cfg.ToolOutput)
+	}
+
 	// Check providers
 	if len(cfg.Providers) != 1 {
 		t.Errorf("Expected 1 provider, got %d", len(cfg.Providers))
@@ -133,6 +150,14 @@ max_context_size = 100000
 		t.Errorf("Expected base_url 'https://api.example.com', got %s", provider.BaseURL)
 	}
 
+	if provider.Retry == nil || provider.Retry.MaxRetries != 2 || provider.Retry.MaxRetryAfterMs != 30000 {
+		t.Errorf("Unexpected retry config: %+v", provider.Retry)
+	}
+
+	if provider.RateLimit == nil || provider.RateLimit.RequestsPerMinute != 50 || provider.RateLimit.TokensPerMinute != 40000 {
+		t.Errorf("Unexpected rate_limit: %+v", provider.RateLimit)
+	}
+
 	// Check models
 	if len(cfg.Models) != 1 {
 		t.Errorf("Expected 1 model, got %d", len(cfg.Models))
@@ -216,3 +241,178 @@ func TestDefaultConfigPath(t *testing.T) {
 		t.Error("Expected non-empty default config path")
 	}
 }
+
+func TestConfig_SandboxFor(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[sandbox]
+enabled = true
+writable_paths = ["~/.cache/go-build"]
+
+[providers.local]
+type = "openai"
+
+[providers.remote]
+type = "openai"
+
+[providers.remote.sandbox]
+enabled = true
+network = true
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	if sb := cfg.SandboxFor("local"); !sb.Enabled || sb.Network || len(sb.WritablePaths) != 1 {
+		t.Errorf("provider without settings should use the global sandbox, got %+v", sb)
+	}
+	if sb := cfg.SandboxFor("remote"); !sb.Enabled || !sb.Network || len(sb.WritablePaths) != 0 {
+		t.Errorf("provider settings should replace the global sandbox, got %+v", sb)
+	}
+	if sb := DefaultConfig().SandboxFor("openai"); sb.Enabled {
+		t.Error("the sandbox should be off by default")
+	}
+}
+
+func TestWorkspace_DenyPatterns(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[workspace]
+extra_dirs = ["~/notes"]
+deny = []
+read_only = true
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	ws := cfg.Workspace
+	if !ws.ReadOnly || len(ws.ExtraDirs) != 1 || ws.ExtraDirs[0] != "~/notes" {
+		t.Errorf("unexpected workspace settings: %+v", ws)
+	}
+	if patterns := ws.DenyPatterns(); len(patterns) != 0 {
+		t.Errorf("an empty deny list should turn the defaults off, got %v", patterns)
+	}
+	if patterns := DefaultConfig().Workspace.DenyPatterns(); len(patterns) != len(DefaultDenyPatterns) {
+		t.Errorf("expected the default deny patterns, got %v", patterns)
+	}
+}
+
+func TestLoadConfig_MCPServers(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+[mcp_servers.files]
+command = "npx"
+args = ["-y", "@modelcontextprotocol/server-filesystem", "."]
+env = { DEBUG = "1" }
+
+[mcp_servers.internal]
+url = "https://tools.example.com/mcp"
+headers = { Authorization = "Bearer x" }
+timeout = 10
+disabled = true
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	files := cfg.MCPServers["files"]
+	if files.Command != "npx" || len(files.Args) != 3 || files.Env["DEBUG"] != "1" {
+		t.Errorf("unexpected stdio server: %+v", files)
+	}
+	internal := cfg.MCPServers["internal"]
+	if internal.URL != "https://tools.example.com/mcp" || internal.Headers["Authorization"] != "Bearer x" ||
+		internal.Timeout != 10 || !internal.Disabled {
+		t.Errorf("unexpected HTTP server: %+v", internal)
+	}
+}
+
+func TestConfig_ResolveModel(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.toml")
+	content := `
+default_provider = "openai"
+default_model = "fast"
+
+[providers.openai]
+type = "openai"
+base_url = "https://api.openai.com/v1"
+organization = "org-1"
+
+[providers.gateway]
+type = "anthropic"
+base_url = "https://gateway.example.com/v1"
+timeout = 30
+headers = { X-Team = "agents" }
+
+[models.fast]
+provider = "gateway"
+model = "claude-haiku-4-5"
+temperature = 1
+max_tokens = 4096
+extra_body = { metadata = { user_id = "ci" } }
+
+[models.gpt-4o]
+max_context_size = 128000
+top_p = 0.9
+
+[models.broken]
+provider = "nope"
+
+[models.tiny]
+max_context_size = 32000
+`
+	if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write test config: %v", err)
+	}
+	cfg, err := LoadConfig(configPath)
+	if err != nil {
+		t.Fatalf("Failed to load config: %v", err)
+	}
+
+	r, err := cfg.ResolveModel(cfg.DefaultModel)
+	if err != nil {
+		t.Fatalf("ResolveModel failed: %v", err)
+	}
+	if r.ProviderName != "gateway" || r.Provider.Timeout != 30 || r.Provider.Headers["X-Team"] != "agents" {
+		t.Errorf("the model's provider should be used, got %+v", r)
+	}
+	m := r.Model
+	if m.Model != "claude-haiku-4-5" || m.Temperature == nil || *m.Temperature != 1 || m.MaxTokens != 4096 || m.TopP != nil {
+		t.Errorf("unexpected model settings: %+v", m)
+	}
+	if meta, ok := m.ExtraBody["metadata"].(map[string]any); !ok || meta["user_id"] != "ci" {
+		t.Errorf("unexpected extra body: %v", m.ExtraBody)
+	}
+
+	// Entries without a provider, and unknown names, use the default one
+	if r, err := cfg.ResolveModel("gpt-4o"); err != nil || r.ProviderName != "openai" || r.Model.Model != "gpt-4o" ||
+		r.Model.MaxContextSize != 128000 || *r.Model.TopP != 0.9 || r.Provider.Organization != "org-1" {
+		t.Errorf("unexpected resolution %+v, %v", r, err)
+	}
+	if r, err := cfg.ResolveModel("o3"); err != nil || r.ProviderName != "openai" || r.Model.Model != "o3" {
+		t.Errorf("unexpected resolution %+v, %v", r, err)
+	}
+	if _, err := cfg.ResolveModel("broken"); err == nil || !strings.Contains(err.Error(), `"nope"`) {
+		t.Errorf("an unknown provider should fail, got %v", err)
+	}
+	// The default reserved_context_size does not fit in the window
+	if _, err := cfg.ResolveModel("tiny"); err == nil || !strings.Contains(err.Error(), "reserved_context_size (50000)") {
+		t.Errorf("a window smaller than the reserved size should fail, got %v", err)
+	}
+	cfg.LoopControl.ReservedContextSize = 8000
+	if _, err := cfg.ResolveModel("tiny"); err != nil {
+		t.Errorf("ResolveModel failed: %v", err)
+	}
+}
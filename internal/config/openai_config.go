@@ -21,13 +21,27 @@ type Config struct {
 	Providers       map[string]ProviderConfig `toml:"providers"`
 	Models          map[string]ModelConfig    `toml:"models"`
 	LoopControl     LoopControl               `toml:"loop_control"`
+	ToolOutput      ToolOutput                `toml:"tool_output"`
+	Sandbox         Sandbox                   `toml:"sandbox"`
+	Workspace       Workspace                 `toml:"workspace"`
+	MCPServers      map[string]MCPServer      `toml:"mcp_servers"`
 }
 
-// ModelConfig represents a model configuration.
+// ModelConfig represents a model configuration. The key of the entry in
+// Config.Models is the name default_model refers to.
 type ModelConfig struct {
-	Provider       string `toml:"provider"`
-	Model          string `toml:"model"`
+	Provider       string `toml:"provider"` // Provider name; default_provider if empty
+	Model          string `toml:"model"`    // Model name sent to the API; the key if empty
 	MaxContextSize int    `toml:"max_context_size"`
+
+	// Sampling settings; unset values leave the API defaults
+	Temperature *float64 `toml:"temperature,omitempty"`
+	TopP        *float64 `toml:"top_p,omitempty"`
+	MaxTokens   int      `toml:"max_tokens,omitempty"`
+
+	// ExtraBody fields are added to every request body, e.g. to turn on
+	// features of an API that have no setting here
+	ExtraBody map[string]any `toml:"extra_body,omitempty"`
 }
 
 // ProviderConfig represents an API provider configuration.
@@ -50,9 +64,20 @@ type ProviderConfig struct {
 
 	// Custom headers to add to requests
 	Headers map[string]string `toml:"headers,omitempty"`
-	
+
+	// OpenAI organization and project IDs, sent as the OpenAI-Organization
+	// and OpenAI-Project headers
+	Organization string `toml:"organization,omitempty"`
+	Project      string `toml:"project,omitempty"`
+
 	// Retry configuration for this provider
 	Retry *RetryConfig `toml:"retry,omitempty"`
+
+	// Client-side rate limit, shared by all requests to this provider
+	RateLimit *RateLimit `toml:"rate_limit,omitempty"`
+
+	// Sandbox replaces the global sandbox settings while this provider is used
+	Sandbox *Sandbox `toml:"sandbox,omitempty"`
 }
 
 // GetAPIKey retrieves the API key. It checks the direct APIKey field first,
@@ -85,13 +110,70 @@ type LoopControl struct {
 	ReservedContextSize int `toml:"reserved_context_size"`
 }
 
+// ToolOutput limits the tool output sent to the model. Zero values keep the
+// built-in limits.
+type ToolOutput struct {
+	MaxChars      int `toml:"max_chars"`
+	MaxLineLength int `toml:"max_line_length"`
+}
+
+// Sandbox configures the sandbox for shell commands. When enabled, only the
+// work directory, the temp directory and WritablePaths are writable.
+type Sandbox struct {
+	Enabled       bool     `toml:"enabled"`
+	Network       bool     `toml:"network"`        // Allow network access
+	WritablePaths []string `toml:"writable_paths"` // Extra writable directories; "~/" is expanded
+}
+
+// DefaultDenyPatterns are the paths file tools may not access unless the
+// workspace config sets its own deny list.
+var DefaultDenyPatterns = []string{".env", "*.pem", ".git/"}
+
+// Workspace confines the paths file tools may access to the work directory
+// and ExtraDirs.
+type Workspace struct {
+	ExtraDirs []string `toml:"extra_dirs"` // Extra accessible directories; "~/" is expanded
+	Deny      []string `toml:"deny"`       // Glob patterns of denied paths; unset means DefaultDenyPatterns
+	ReadOnly  bool     `toml:"read_only"`  // File tools may not write anything
+}
+
+// DenyPatterns returns the deny patterns in effect. An empty deny list
+// turns the defaults off.
+func (w Workspace) DenyPatterns() []string {
+	if w.Deny == nil {
+		return DefaultDenyPatterns
+	}
+	return w.Deny
+}
+
+// MCPServer describes an MCP server whose tools the agent may use. Set
+// Command to launch a stdio server, or URL to connect to a streamable HTTP
+// one.
+type MCPServer struct {
+	Command  string            `toml:"command"`
+	Args     []string          `toml:"args"`
+	Env      map[string]string `toml:"env"` // Added to the environment of the command
+	URL      string            `toml:"url"`
+	Headers  map[string]string `toml:"headers"`  // Sent with every HTTP request
+	Timeout  int               `toml:"timeout"`  // Seconds per request; 0 means 60
+	Disabled bool              `toml:"disabled"` // Keep the definition without connecting
+}
+
 // RetryConfig contains retry strategy configuration for LLM requests.
 type RetryConfig struct {
-	MaxRetries       int `toml:"max_retries"`         // 最大重试次数，默认 3
-	InitialWaitMs    int `toml:"initial_wait_ms"`     // 初始等待时间（毫秒），默认 300
-	MaxWaitMs        int `toml:"max_wait_ms"`         // 最大等待时间（毫秒），默认 5000
-	ExponentialBase  float64 `toml:"exponential_base"`  // 指数基数，默认 2.0
-	JitterMs         int `toml:"jitter_ms"`           // 抖动范围（毫秒），默认 500
+	MaxRetries      int     `toml:"max_retries"`        // 最大重试次数，默认 3
+	InitialWaitMs   int     `toml:"initial_wait_ms"`    // 初始等待时间（毫秒），默认 300
+	MaxWaitMs       int     `toml:"max_wait_ms"`        // 最大等待时间（毫秒），默认 5000
+	ExponentialBase float64 `toml:"exponential_base"`   // 指数基数，默认 2.0
+	JitterMs        int     `toml:"jitter_ms"`          // 抖动范围（毫秒），默认 500
+	MaxRetryAfterMs int     `toml:"max_retry_after_ms"` // 服务端指定等待时间的上限（毫秒），默认 60000
+}
+
+// RateLimit limits the requests sent to a provider by this process. Zero
+// values leave a limit off.
+type RateLimit struct {
+	RequestsPerMinute int `toml:"requests_per_minute"`
+	TokensPerMinute   int `toml:"tokens_per_minute"`
 }
 
 // DefaultConfig returns a default configuration.
@@ -114,6 +196,12 @@ func DefaultConfig() *Config {
 				EnvKey:  "ANTHROPIC_API_KEY",
 				Timeout: 60,
 			},
+			"gemini": {
+				Type:    "gemini",
+				BaseURL: "https://generativelanguage.googleapis.com/v1beta",
+				EnvKey:  "GEMINI_API_KEY",
+				Timeout: 60,
+			},
 			"custom": {
 				Type:    "openai",
 				BaseURL: "https://your-api-endpoint.com/v1",
@@ -123,9 +211,10 @@ func DefaultConfig() *Config {
 		},
 		Models: map[string]ModelConfig{},
 		LoopControl: LoopControl{
-			MaxStepsPerTurn:    100,
-			MaxRetriesPerStep:  3,
-			MaxRalphIterations: 3,
+			MaxStepsPerTurn:     100,
+			MaxRetriesPerStep:   3,
+			MaxRalphIterations:  3,
+			ReservedContextSize: 50000,
 		},
 	}
 }
@@ -200,6 +289,67 @@ func (c *Config) GetProvider(name string) (ProviderConfig, bool) {
 	return provider, ok
 }
 
+// GetModel returns a model by name.
+func (c *Config) GetModel(name string) (ModelConfig, bool) {
+	model, ok := c.Models[name]
+	return model, ok
+}
+
+// ResolvedModel is a model with the provider that serves it.
+type ResolvedModel struct {
+	Name         string // The name that was resolved
+	Model        ModelConfig
+	ProviderName string
+	Provider     ProviderConfig
+}
+
+// ResolveModel finds the settings and the provider of a model. A name with
+// an entry in Models uses that entry; other names are sent as they are to
+// the default provider. The provider is empty when none is configured.
+func (c *Config) ResolveModel(name string) (ResolvedModel, error) {
+	r := ResolvedModel{Name: name, ProviderName: c.DefaultProvider}
+	if model, ok := c.Models[name]; ok {
+		r.Model = model
+		if model.Provider != "" {
+			r.ProviderName = model.Provider
+		}
+	}
+	if r.Model.Model == "" {
+		r.Model.Model = name
+	}
+	if size, reserved := r.Model.MaxContextSize, c.ReservedContextSize(); size > 0 && reserved >= size {
+		return r, fmt.Errorf("model %q: reserved_context_size (%d) must be smaller than max_context_size (%d)",
+			name, reserved, size)
+	}
+	if r.ProviderName == "" {
+		return r, nil
+	}
+	provider, ok := c.Providers[r.ProviderName]
+	if !ok {
+		return r, fmt.Errorf("model %q: unknown provider %q", name, r.ProviderName)
+	}
+	r.Provider = provider
+	return r, nil
+}
+
+// ReservedContextSize returns the number of tokens kept free for the next
+// response, falling back to the default when the config does not set it.
+func (c *Config) ReservedContextSize() int {
+	if c.LoopControl.ReservedContextSize > 0 {
+		return c.LoopControl.ReservedContextSize
+	}
+	return DefaultConfig().LoopControl.ReservedContextSize
+}
+
+// SandboxFor returns the sandbox settings in effect for a provider: its own
+// settings when it has any, otherwise the global ones.
+func (c *Config) SandboxFor(provider string) Sandbox {
+	if p, ok := c.Providers[provider]; ok && p.Sandbox != nil {
+		return *p.Sandbox
+	}
+	return c.Sandbox
+}
+
 // GetDefaultProvider returns the default provider configuration.
 func (c *Config) GetDefaultProvider() (ProviderConfig, bool) {
 	return c.GetProvider(c.DefaultProvider)
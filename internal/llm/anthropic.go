@@ -0,0 +1,486 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	anthropicVersion   = "2023-06-01"
+	anthropicMaxTokens = 8192 // The Messages API requires a limit; Config.MaxTokens replaces it
+)
+
+// AnthropicClient is a client for the Anthropic Messages API. The system
+// prompt goes in its own field, tool calls and results become tool_use and
+// tool_result blocks, and responses are mapped back to OpenAI-style ones.
+type AnthropicClient struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+	options    requestOptions
+}
+
+// NewAnthropicClient creates a new Anthropic client. BaseURL includes the
+// version, e.g. "https://api.anthropic.com/v1".
+func NewAnthropicClient(cfg Config) *AnthropicClient {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 120 * time.Second
+	}
+
+	return &AnthropicClient{
+		baseURL: cfg.BaseURL,
+		apiKey:  cfg.APIKey,
+		model:   cfg.Model,
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		options: newRequestOptions(cfg, nil),
+	}
+}
+
+// anthropicRequest is the body of a Messages API request.
+type anthropicRequest struct {
+	Model       string             `json:"model"`
+	MaxTokens   int                `json:"max_tokens"`
+	System      string             `json:"system,omitempty"`
+	Messages    []anthropicMessage `json:"messages"`
+	Tools       []anthropicTool    `json:"tools,omitempty"`
+	Stream      bool               `json:"stream,omitempty"`
+	Temperature *float64           `json:"temperature,omitempty"`
+	TopP        *float64           `json:"top_p,omitempty"`
+}
+
+// anthropicMessage is a message of the Messages API. Roles alternate
+// between user and assistant.
+type anthropicMessage struct {
+	Role    string           `json:"role"`
+	Content []anthropicBlock `json:"content"`
+}
+
+// anthropicBlock is a content block: text, image, tool_use or tool_result.
+type anthropicBlock struct {
+	Type      string           `json:"type"`
+	Text      string           `json:"text,omitempty"`
+	Source    *anthropicSource `json:"source,omitempty"`      // image
+	ID        string           `json:"id,omitempty"`          // tool_use
+	Name      string           `json:"name,omitempty"`        // tool_use
+	Input     json.RawMessage  `json:"input,omitempty"`       // tool_use
+	ToolUseID string           `json:"tool_use_id,omitempty"` // tool_result
+	Content   string           `json:"content,omitempty"`     // tool_result
+	IsError   bool             `json:"is_error,omitempty"`    // tool_result
+}
+
+// anthropicSource is the data of an image block.
+type anthropicSource struct {
+	Type      string `json:"type"` // "base64" or "url"
+	MediaType string `json:"media_type,omitempty"`
+	Data      string `json:"data,omitempty"`
+	URL       string `json:"url,omitempty"`
+}
+
+// anthropicTool is a tool definition.
+type anthropicTool struct {
+	Name        string          `json:"name"`
+	Description string          `json:"description,omitempty"`
+	InputSchema json.RawMessage `json:"input_schema"`
+}
+
+// anthropicResponse is a Messages API response, also sent at the start of
+// a stream.
+type anthropicResponse struct {
+	ID         string           `json:"id"`
+	Model      string           `json:"model"`
+	Content    []anthropicBlock `json:"content"`
+	StopReason string           `json:"stop_reason"`
+	Usage      anthropicUsage   `json:"usage"`
+}
+
+// anthropicUsage is the token usage of a request.
+type anthropicUsage struct {
+	InputTokens              int `json:"input_tokens"`
+	OutputTokens             int `json:"output_tokens"`
+	CacheCreationInputTokens int `json:"cache_creation_input_tokens"`
+	CacheReadInputTokens     int `json:"cache_read_input_tokens"`
+}
+
+// toUsage counts cached input as prompt tokens, as OpenAI does.
+func (u anthropicUsage) toUsage() Usage {
+	prompt := u.InputTokens + u.CacheCreationInputTokens + u.CacheReadInputTokens
+	return Usage{PromptTokens: prompt, CompletionTokens: u.OutputTokens, TotalTokens: prompt + u.OutputTokens}
+}
+
+// anthropicError is the body of an error response and of error events.
+type anthropicError struct {
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// anthropicErrorStatus gives errors reported inside a stream the status the
+// same error has as a response, so the retry rules apply to both.
+var anthropicErrorStatus = map[string]int{
+	"invalid_request_error": http.StatusBadRequest,
+	"authentication_error":  http.StatusUnauthorized,
+	"permission_error":      http.StatusForbidden,
+	"not_found_error":       http.StatusNotFound,
+	"request_too_large":     http.StatusRequestEntityTooLarge,
+	"rate_limit_error":      http.StatusTooManyRequests,
+	"api_error":             http.StatusInternalServerError,
+	"overloaded_error":      529,
+}
+
+// anthropicStopReason maps a stop reason to an OpenAI finish reason.
+func anthropicStopReason(reason string) string {
+	switch reason {
+	case "end_turn", "stop_sequence", "pause_turn":
+		return "stop"
+	case "max_tokens":
+		return "length"
+	case "tool_use":
+		return "tool_calls"
+	case "refusal":
+		return "content_filter"
+	}
+	return reason
+}
+
+// ChatWithTools sends a Messages API request with tool definitions.
+func (c *AnthropicClient) ChatWithTools(ctx context.Context, messages []Message, tools []ToolDef) (*ChatResponse, error) {
+	resp, err := c.post(ctx, c.buildRequest(messages, tools, false))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var ar anthropicResponse
+	if err := json.NewDecoder(resp.Body).Decode(&ar); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+
+	msg := Message{Role: "assistant"}
+	var text strings.Builder
+	for _, block := range ar.Content {
+		switch block.Type {
+		case "text":
+			text.WriteString(block.Text)
+		case "tool_use":
+			msg.ToolCalls = append(msg.ToolCalls, ToolCallInfo{
+				ID:       block.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: block.Name, Arguments: string(block.Input)},
+			})
+		}
+	}
+	msg.Content = text.String()
+
+	return &ChatResponse{
+		ID:      ar.ID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   ar.Model,
+		Choices: []Choice{{Message: msg, FinishReason: anthropicStopReason(ar.StopReason)}},
+		Usage:   ar.Usage.toUsage(),
+	}, nil
+}
+
+// Chat sends a Messages API request.
+func (c *AnthropicClient) Chat(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	return c.ChatWithTools(ctx, messages, nil)
+}
+
+// ChatStream sends a streaming Messages API request.
+func (c *AnthropicClient) ChatStream(ctx context.Context, messages []Message) (<-chan ChatResponse, <-chan error) {
+	return c.ChatStreamWithTools(ctx, messages, nil)
+}
+
+// ChatStreamWithTools sends a streaming Messages API request with tool
+// definitions. Stream events are converted to OpenAI-style chunks.
+func (c *AnthropicClient) ChatStreamWithTools(ctx context.Context, messages []Message, tools []ToolDef) (<-chan ChatResponse, <-chan error) {
+	responseChan := make(chan ChatResponse)
+	errorChan := make(chan error, 1)
+
+	go func() {
+		defer close(responseChan)
+		defer close(errorChan)
+
+		resp, err := c.post(ctx, c.buildRequest(messages, tools, true))
+		if err != nil {
+			errorChan <- err
+			return
+		}
+		defer resp.Body.Close()
+		if err := readAnthropicStream(resp.Body, responseChan); err != nil {
+			errorChan <- err
+		}
+	}()
+
+	return responseChan, errorChan
+}
+
+// buildRequest converts messages and tools to a Messages API request.
+func (c *AnthropicClient) buildRequest(messages []Message, tools []ToolDef, stream bool) anthropicRequest {
+	system, converted := toAnthropicMessages(messages)
+	req := anthropicRequest{
+		Model:       c.model,
+		MaxTokens:   anthropicMaxTokens,
+		System:      system,
+		Messages:    converted,
+		Stream:      stream,
+		Temperature: c.options.temperature,
+		TopP:        c.options.topP,
+	}
+	if c.options.maxTokens > 0 {
+		req.MaxTokens = c.options.maxTokens
+	}
+	for _, t := range tools {
+		req.Tools = append(req.Tools, anthropicTool{
+			Name:        t.Function.Name,
+			Description: t.Function.Description,
+			InputSchema: t.Function.Parameters,
+		})
+	}
+	return req
+}
+
+// post sends a request and returns the response if it succeeded.
+func (c *AnthropicClient) post(ctx context.Context, reqBody anthropicRequest) (*http.Response, error) {
+	jsonBody, err := c.options.marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, "POST", c.baseURL+"/messages", bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Api-Key", c.apiKey)
+	req.Header.Set("Anthropic-Version", anthropicVersion)
+	if reqBody.Stream {
+		req.Header.Set("Accept", "text/event-stream")
+	}
+	c.options.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: string(body), RawBody: string(body), Header: resp.Header}
+		var ae anthropicError
+		if json.Unmarshal(body, &ae) == nil && ae.Error.Message != "" {
+			apiErr.Message = fmt.Sprintf("%s: %s", ae.Error.Type, ae.Error.Message)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// toAnthropicMessages splits off the system prompt and converts the rest of
+// the messages. Tool results become tool_result blocks of a user message,
+// and consecutive messages of the same role are merged, since roles must
+// alternate.
+func toAnthropicMessages(messages []Message) (string, []anthropicMessage) {
+	var (
+		system []string
+		out    []anthropicMessage
+	)
+	for _, m := range messages {
+		var (
+			role   = "user"
+			blocks []anthropicBlock
+		)
+		switch m.Role {
+		case "system":
+			if text := messageText(m); text != "" {
+				system = append(system, text)
+			}
+			continue
+		case "assistant":
+			role = "assistant"
+			if m.Content != "" {
+				blocks = append(blocks, anthropicBlock{Type: "text", Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				input := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(input) {
+					input = json.RawMessage("{}")
+				}
+				blocks = append(blocks, anthropicBlock{Type: "tool_use", ID: tc.ID, Name: tc.Function.Name, Input: input})
+			}
+		case "tool":
+			blocks = append(blocks, anthropicBlock{Type: "tool_result", ToolUseID: m.ToolCallID, Content: m.Content, IsError: m.IsError})
+		default:
+			blocks = userBlocks(m)
+		}
+		if len(blocks) == 0 {
+			continue
+		}
+
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Content = append(out[n-1].Content, blocks...)
+		} else {
+			out = append(out, anthropicMessage{Role: role, Content: blocks})
+		}
+	}
+	return strings.Join(system, "\n\n"), out
+}
+
+// messageText returns the text of a message, multipart or not.
+func messageText(m Message) string {
+	if len(m.Parts) > 0 {
+		return partsText(m.Parts)
+	}
+	return m.Content
+}
+
+// userBlocks converts the content of a user message. Images in data URLs
+// are sent as base64 sources, others by URL.
+func userBlocks(m Message) []anthropicBlock {
+	if len(m.Parts) == 0 {
+		if m.Content == "" {
+			return nil
+		}
+		return []anthropicBlock{{Type: "text", Text: m.Content}}
+	}
+
+	var blocks []anthropicBlock
+	for _, p := range m.Parts {
+		switch {
+		case p.Type == "text" && p.Text != "":
+			blocks = append(blocks, anthropicBlock{Type: "text", Text: p.Text})
+		case p.Type == "image_url" && p.ImageURL != nil:
+			url := p.ImageURL.URL
+			source := &anthropicSource{Type: "url", URL: url}
+			if rest, ok := strings.CutPrefix(url, "data:"); ok {
+				if meta, data, ok := strings.Cut(rest, ","); ok && strings.HasSuffix(meta, ";base64") {
+					source = &anthropicSource{Type: "base64", MediaType: strings.TrimSuffix(meta, ";base64"), Data: data}
+				}
+			}
+			blocks = append(blocks, anthropicBlock{Type: "image", Source: source})
+		}
+	}
+	return blocks
+}
+
+// anthropicEvent is a server-sent event of a streaming response. Which
+// fields are set depends on the type.
+type anthropicEvent struct {
+	Type         string            `json:"type"`
+	Message      anthropicResponse `json:"message"`       // message_start
+	Index        int               `json:"index"`         // content_block_*
+	ContentBlock anthropicBlock    `json:"content_block"` // content_block_start
+	Delta        struct {
+		Type        string `json:"type"`
+		Text        string `json:"text"`         // text_delta
+		PartialJSON string `json:"partial_json"` // input_json_delta
+		StopReason  string `json:"stop_reason"`  // message_delta
+	} `json:"delta"`
+	Usage anthropicUsage `json:"usage"` // message_delta
+	Error struct {
+		Type    string `json:"type"`
+		Message string `json:"message"`
+	} `json:"error"`
+}
+
+// readAnthropicStream converts the events of a streaming response to
+// OpenAI-style chunks: text deltas, tool call fragments indexed by tool
+// call, and a last chunk with the finish reason and usage.
+func readAnthropicStream(body io.Reader, responseChan chan<- ChatResponse) error {
+	var (
+		id, model string
+		usage     anthropicUsage
+		toolIndex = map[int]int{}  // Tool call index by block index
+		hasInput  = map[int]bool{} // Tool calls that received arguments
+	)
+	chunk := func(delta Message, finishReason string) ChatResponse {
+		return ChatResponse{
+			ID:      id,
+			Object:  "chat.completion.chunk",
+			Model:   model,
+			Choices: []Choice{{Delta: delta, FinishReason: finishReason}},
+		}
+	}
+
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var ev anthropicEvent
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &ev); err != nil {
+			continue // Skip malformed events
+		}
+
+		switch ev.Type {
+		case "message_start":
+			id, model, usage = ev.Message.ID, ev.Message.Model, ev.Message.Usage
+		case "content_block_start":
+			if ev.ContentBlock.Type != "tool_use" {
+				continue
+			}
+			index := len(toolIndex)
+			toolIndex[ev.Index] = index
+			responseChan <- chunk(Message{Role: "assistant", ToolCalls: []ToolCallInfo{{
+				Index:    &index,
+				ID:       ev.ContentBlock.ID,
+				Type:     "function",
+				Function: FunctionCall{Name: ev.ContentBlock.Name},
+			}}}, "")
+		case "content_block_delta":
+			switch ev.Delta.Type {
+			case "text_delta":
+				responseChan <- chunk(Message{Role: "assistant", Content: ev.Delta.Text}, "")
+			case "input_json_delta":
+				index, ok := toolIndex[ev.Index]
+				if !ok || ev.Delta.PartialJSON == "" {
+					continue
+				}
+				hasInput[ev.Index] = true
+				responseChan <- chunk(Message{Role: "assistant", ToolCalls: []ToolCallInfo{{
+					Index:    &index,
+					Function: FunctionCall{Arguments: ev.Delta.PartialJSON},
+				}}}, "")
+			}
+		case "content_block_stop":
+			// Tools without parameters get no input deltas
+			if index, ok := toolIndex[ev.Index]; ok && !hasInput[ev.Index] {
+				responseChan <- chunk(Message{Role: "assistant", ToolCalls: []ToolCallInfo{{
+					Index:    &index,
+					Function: FunctionCall{Arguments: "{}"},
+				}}}, "")
+			}
+		case "message_delta":
+			usage.OutputTokens = ev.Usage.OutputTokens
+			final := chunk(Message{Role: "assistant"}, anthropicStopReason(ev.Delta.StopReason))
+			final.Usage = usage.toUsage()
+			responseChan <- final
+		case "message_stop":
+			return nil
+		case "error":
+			status := anthropicErrorStatus[ev.Error.Type]
+			msg := fmt.Sprintf("%s: %s", ev.Error.Type, ev.Error.Message)
+			return &APIError{StatusCode: status, Message: msg, RawBody: data}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading stream: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// anthropicServer serves a recorded response from testdata/anthropic and
+// passes each request body to check.
+func anthropicServer(t *testing.T, status int, fixture string, check func(req anthropicRequest)) *AnthropicClient {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "anthropic", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/messages" {
+			t.Errorf("expected /messages, got %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Api-Key") != "test-key" || r.Header.Get("Anthropic-Version") != anthropicVersion {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		var req anthropicRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if check != nil {
+			check(req)
+		}
+		if strings.HasSuffix(fixture, ".txt") {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return NewAnthropicClient(Config{BaseURL: server.URL, APIKey: "test-key", Model: "claude-sonnet-4-5"})
+}
+
+func TestAnthropic_ToolUse(t *testing.T) {
+	client := anthropicServer(t, http.StatusOK, "tool_use.json", func(req anthropicRequest) {
+		if req.Model != "claude-sonnet-4-5" || req.MaxTokens != anthropicMaxTokens || req.Stream {
+			t.Errorf("unexpected request: %+v", req)
+		}
+		if len(req.Tools) != 1 || req.Tools[0].Name != "file" || len(req.Tools[0].InputSchema) == 0 {
+			t.Errorf("unexpected tools: %+v", req.Tools)
+		}
+	})
+
+	tools := []ToolDef{{Type: "function", Function: FunctionDef{
+		Name:       "file",
+		Parameters: json.RawMessage(`{"type":"object"}`),
+	}}}
+	resp, err := client.ChatWithTools(context.Background(), []Message{{Role: "user", Content: "read a.txt"}}, tools)
+	if err != nil {
+		t.Fatalf("ChatWithTools failed: %v", err)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "I'll check the file." {
+		t.Errorf("unexpected choice: %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %+v", choice.Message.ToolCalls)
+	}
+	tc := choice.Message.ToolCalls[0]
+	if tc.ID != "toolu_01A09q90qw90lq917835lq9" || tc.Function.Name != "file" ||
+		!strings.Contains(tc.Function.Arguments, `"path": "a.txt"`) {
+		t.Errorf("unexpected tool call: %+v", tc)
+	}
+	if resp.Usage.PromptTokens != 512 || resp.Usage.CompletionTokens != 57 || resp.Usage.TotalTokens != 569 {
+		t.Errorf("cached input should count as prompt tokens: %+v", resp.Usage)
+	}
+}
+
+func TestAnthropic_MessageConversion(t *testing.T) {
+	messages := []Message{
+		{Role: "system", Content: "You are helpful."},
+		{Role: "system", Content: "Be brief."},
+		NewMultipartMessage("user", TextPart("What is this?"), ImagePart("image/png", []byte("png"))),
+		{Role: "assistant", ToolCalls: []ToolCallInfo{
+			{ID: "t1", Type: "function", Function: FunctionCall{Name: "glob", Arguments: `{"pattern":"*"}`}},
+			{ID: "t2", Type: "function", Function: FunctionCall{Name: "todo", Arguments: ""}},
+		}},
+		{Role: "tool", ToolCallID: "t1", Content: "a.go"},
+		{Role: "tool", ToolCallID: "t2", Content: "Error: permission denied", IsError: true},
+		{Role: "user", Content: "Thanks"},
+	}
+
+	system, converted := toAnthropicMessages(messages)
+	if system != "You are helpful.\n\nBe brief." {
+		t.Errorf("unexpected system prompt %q", system)
+	}
+	if len(converted) != 3 {
+		t.Fatalf("expected user, assistant and user messages, got %+v", converted)
+	}
+
+	user := converted[0].Content
+	if len(user) != 2 || user[1].Type != "image" || user[1].Source.Type != "base64" ||
+		user[1].Source.MediaType != "image/png" || user[1].Source.Data != "cG5n" {
+		t.Errorf("unexpected user content: %+v", user)
+	}
+	calls := converted[1].Content
+	if len(calls) != 2 || calls[0].Type != "tool_use" || string(calls[1].Input) != "{}" {
+		t.Errorf("unexpected tool uses: %+v", calls)
+	}
+	// Tool results and the next user message share one user message
+	results := converted[2].Content
+	if converted[2].Role != "user" || len(results) != 3 || results[0].ToolUseID != "t1" ||
+		results[1].Type != "tool_result" || results[0].IsError || !results[1].IsError || results[2].Text != "Thanks" {
+		t.Errorf("unexpected tool results: %+v", results)
+	}
+}
+
+func TestAnthropic_Stream(t *testing.T) {
+	client := anthropicServer(t, http.StatusOK, "stream.txt", func(req anthropicRequest) {
+		if !req.Stream || req.MaxTokens != 1024 {
+			t.Errorf("expected a streaming request with the configured max_tokens, got %+v", req)
+		}
+	})
+	client.options.maxTokens = 1024
+
+	chunks, errs := client.ChatStreamWithTools(context.Background(), []Message{{Role: "user", Content: "list"}}, nil)
+	acc := NewStreamAccumulator()
+	for chunk := range chunks {
+		acc.Add(chunk)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+
+	msg := acc.Message()
+	if msg.Content != "Let me look." || acc.FinishReason() != "tool_calls" {
+		t.Errorf("unexpected message %q, finish reason %q", msg.Content, acc.FinishReason())
+	}
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", msg.ToolCalls)
+	}
+	if msg.ToolCalls[0].Function.Name != "glob" || msg.ToolCalls[0].Function.Arguments != `{"pattern": "*.go"}` {
+		t.Errorf("unexpected first tool call: %+v", msg.ToolCalls[0])
+	}
+	if msg.ToolCalls[1].ID != "toolu_01GRVwN4VgCUBSoczWYJuCvD" || msg.ToolCalls[1].Function.Arguments != "{}" {
+		t.Errorf("a tool call without input should get empty arguments: %+v", msg.ToolCalls[1])
+	}
+	if u := acc.Usage(); u.PromptTokens != 472 || u.CompletionTokens != 89 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+}
+
+func TestAnthropic_StreamError(t *testing.T) {
+	client := anthropicServer(t, http.StatusOK, "stream_error.txt", nil)
+
+	chunks, errs := client.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	for range chunks {
+	}
+	var apiErr *APIError
+	if err := <-errs; !errors.As(err, &apiErr) || apiErr.StatusCode != 529 || !apiErr.IsRetryable() {
+		t.Errorf("an overloaded error event should be a retryable APIError, got %v", err)
+	}
+}
+
+func TestAnthropic_HTTPError(t *testing.T) {
+	client := anthropicServer(t, http.StatusBadRequest, "error.json", nil)
+
+	_, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusBadRequest {
+		t.Fatalf("expected an APIError, got %v", err)
+	}
+	if !strings.HasPrefix(apiErr.Message, "invalid_request_error: messages: roles must alternate") || apiErr.IsRetryable() {
+		t.Errorf("unexpected error: %+v", apiErr)
+	}
+}
+
+func TestNewProvider(t *testing.T) {
+	for typ, want := range map[string]string{"": "*llm.Client", "custom": "*llm.Client", ProviderAnthropic: "*llm.AnthropicClient", ProviderGemini: "*llm.GeminiClient"} {
+		p, err := NewProvider(typ, Config{})
+		if err != nil {
+			t.Fatalf("NewProvider(%q) failed: %v", typ, err)
+		}
+		if got := fmt.Sprintf("%T", p); got != want {
+			t.Errorf("NewProvider(%q) = %s, want %s", typ, got, want)
+		}
+	}
+	if _, err := NewProvider("palm", Config{}); err == nil {
+		t.Error("unknown provider types should fail")
+	}
+}
@@ -5,6 +5,7 @@ import (
 	"bufio"
 	"bytes"
 	"context"
+	"encoding/base64"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -19,6 +20,7 @@ type Client struct {
 	apiKey     string
 	model      string
 	httpClient *http.Client
+	options    requestOptions
 }
 
 // Config represents the client configuration.
@@ -27,6 +29,22 @@ type Config struct {
 	APIKey  string
 	Model   string
 	Timeout time.Duration
+
+	// Headers are sent with every request and replace built-in headers of
+	// the same name, for gateways that need their own
+	Headers map[string]string
+	// Organization and Project select the OpenAI organization and project
+	// billed; other APIs ignore them
+	Organization string
+	Project      string
+
+	// Sampling settings of the model; unset values leave the API defaults
+	Temperature *float64
+	TopP        *float64
+	MaxTokens   int
+	// ExtraBody fields are added to every request body, replacing fields
+	// of the same name
+	ExtraBody map[string]any
 }
 
 // NewClient creates a new LLM client.
@@ -43,6 +61,10 @@ func NewClient(cfg Config) *Client {
 		httpClient: &http.Client{
 			Timeout: timeout,
 		},
+		options: newRequestOptions(cfg, map[string]string{
+			"OpenAI-Organization": cfg.Organization,
+			"OpenAI-Project":      cfg.Project,
+		}),
 	}
 }
 
@@ -60,7 +82,9 @@ type FunctionDef struct {
 }
 
 // ToolCallInfo represents a tool call returned by the LLM.
+// Index is only set on streaming deltas, where it identifies the call a fragment belongs to.
 type ToolCallInfo struct {
+	Index    *int         `json:"index,omitempty"`
 	ID       string       `json:"id"`
 	Type     string       `json:"type"`
 	Function FunctionCall `json:"function"`
@@ -76,8 +100,89 @@ type FunctionCall struct {
 type Message struct {
 	Role       string         `json:"role"`
 	Content    string         `json:"content"`
+	Parts      []ContentPart  `json:"-"` // Multimodal content, sent instead of Content when set
 	ToolCalls  []ToolCallInfo `json:"tool_calls,omitempty"`
 	ToolCallID string         `json:"tool_call_id,omitempty"`
+	IsError    bool           `json:"-"` // Result of a failed tool call, flagged where the API supports it
+}
+
+// ContentPart is one part of multimodal message content.
+type ContentPart struct {
+	Type     string    `json:"type"` // "text" or "image_url"
+	Text     string    `json:"text,omitempty"`
+	ImageURL *ImageURL `json:"image_url,omitempty"`
+}
+
+// ImageURL references an image; local images are sent as base64 data URLs.
+type ImageURL struct {
+	URL    string `json:"url"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// TextPart returns a text content part.
+func TextPart(text string) ContentPart {
+	return ContentPart{Type: "text", Text: text}
+}
+
+// ImagePart returns an image content part holding data as a data URL.
+func ImagePart(mimeType string, data []byte) ContentPart {
+	url := "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(data)
+	return ContentPart{Type: "image_url", ImageURL: &ImageURL{URL: url}}
+}
+
+// NewMultipartMessage returns a message with multimodal content. Content is
+// set to the text of the parts, for code that only handles text.
+func NewMultipartMessage(role string, parts ...ContentPart) Message {
+	return Message{Role: role, Content: partsText(parts), Parts: parts}
+}
+
+// partsText joins the text parts of multimodal content.
+func partsText(parts []ContentPart) string {
+	var texts []string
+	for _, part := range parts {
+		if part.Type == "text" {
+			texts = append(texts, part.Text)
+		}
+	}
+	return strings.Join(texts, "\n")
+}
+
+// MarshalJSON encodes Parts, when set, as the content array.
+func (m Message) MarshalJSON() ([]byte, error) {
+	type message Message
+	if len(m.Parts) == 0 {
+		return json.Marshal(message(m))
+	}
+	return json.Marshal(struct {
+		message
+		Content []ContentPart `json:"content"`
+	}{message(m), m.Parts})
+}
+
+// UnmarshalJSON accepts the content as a string or as an array of parts.
+func (m *Message) UnmarshalJSON(data []byte) error {
+	type message Message
+	var raw struct {
+		message
+		Content json.RawMessage `json:"content"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*m = Message(raw.message)
+	content := bytes.TrimSpace(raw.Content)
+	switch {
+	case len(content) == 0 || string(content) == "null":
+		return nil
+	case content[0] == '[':
+		if err := json.Unmarshal(content, &m.Parts); err != nil {
+			return err
+		}
+		m.Content = partsText(m.Parts)
+		return nil
+	default:
+		return json.Unmarshal(content, &m.Content)
+	}
 }
 
 // ChatRequest represents a chat completion request.
@@ -85,40 +190,75 @@ type ChatRequest struct {
 	Model       string    `json:"model"`
 	Messages    []Message `json:"messages"`
 	Stream      bool      `json:"stream,omitempty"`
-	Temperature float64   `json:"temperature,omitempty"`
+	Temperature *float64  `json:"temperature,omitempty"`
+	TopP        *float64  `json:"top_p,omitempty"`
 	MaxTokens   int       `json:"max_tokens,omitempty"`
 	Tools       []ToolDef `json:"tools,omitempty"`
 }
 
+// newRequest returns a request for the configured model and settings.
+func (c *Client) newRequest(messages []Message, tools []ToolDef, stream bool) ChatRequest {
+	return ChatRequest{
+		Model:       c.model,
+		Messages:    messages,
+		Stream:      stream,
+		Temperature: c.options.temperature,
+		TopP:        c.options.topP,
+		MaxTokens:   c.options.maxTokens,
+		Tools:       tools,
+	}
+}
+
 // ChatResponse represents a chat completion response.
 type ChatResponse struct {
-	ID      string `json:"id"`
-	Object  string `json:"object"`
-	Created int64  `json:"created"`
-	Model   string `json:"model"`
-	Choices []struct {
-		Index        int     `json:"index"`
-		Message      Message `json:"message"`
-		Delta        Message `json:"delta"`
-		FinishReason string  `json:"finish_reason"`
-	} `json:"choices"`
-	Usage struct {
-		PromptTokens     int `json:"prompt_tokens"`
-		CompletionTokens int `json:"completion_tokens"`
-		TotalTokens      int `json:"total_tokens"`
-	} `json:"usage"`
+	ID      string   `json:"id"`
+	Object  string   `json:"object"`
+	Created int64    `json:"created"`
+	Model   string   `json:"model"`
+	Choices []Choice `json:"choices"`
+	Usage   Usage    `json:"usage"`
 }
 
-// ChatWithTools sends a chat completion request with tool definitions.
-func (c *Client) ChatWithTools(ctx context.Context, messages []Message, tools []ToolDef) (*ChatResponse, error) {
-	reqBody := ChatRequest{
-		Model:    c.model,
-		Messages: messages,
-		Stream:   false,
-		Tools:    tools,
+// Choice is a choice of a ChatResponse: Message in responses, Delta in
+// streaming chunks. It is an alias, so literals of the struct type work too.
+type Choice = struct {
+	Index        int     `json:"index"`
+	Message      Message `json:"message"`
+	Delta        Message `json:"delta"`
+	FinishReason string  `json:"finish_reason"`
+}
+
+// Usage represents token usage reported by the API.
+type Usage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+	TotalTokens      int `json:"total_tokens"`
+}
+
+// imageTokens is the estimated token count of an image.
+const imageTokens = 1000
+
+// EstimateTokens roughly estimates the token count of messages (~4 chars per
+// token, plus imageTokens per image).
+func EstimateTokens(messages []Message) int {
+	chars, images := 0, 0
+	for _, msg := range messages {
+		chars += len(msg.Content)
+		for _, tc := range msg.ToolCalls {
+			chars += len(tc.Function.Name) + len(tc.Function.Arguments)
+		}
+		for _, part := range msg.Parts {
+			if part.ImageURL != nil {
+				images++
+			}
+		}
 	}
+	return chars/4 + images*imageTokens
+}
 
-	return c.sendRequest(ctx, reqBody)
+// ChatWithTools sends a chat completion request with tool definitions.
+func (c *Client) ChatWithTools(ctx context.Context, messages []Message, tools []ToolDef) (*ChatResponse, error) {
+	return c.sendRequest(ctx, c.newRequest(messages, tools, false))
 }
 
 // Chat sends a chat completion request.
@@ -146,14 +286,7 @@ func (c *Client) ChatStreamWithTools(ctx context.Context, messages []Message, to
 		defer close(responseChan)
 		defer close(errorChan)
 
-		reqBody := ChatRequest{
-			Model:    c.model,
-			Messages: messages,
-			Stream:   true,
-			Tools:    tools,
-		}
-
-		if err := c.sendStreamRequest(ctx, reqBody, responseChan); err != nil {
+		if err := c.sendStreamRequest(ctx, c.newRequest(messages, tools, true), responseChan); err != nil {
 			errorChan <- err
 		}
 	}()
@@ -163,7 +296,7 @@ func (c *Client) ChatStreamWithTools(ctx context.Context, messages []Message, to
 
 // sendRequest sends a non-streaming request.
 func (c *Client) sendRequest(ctx context.Context, reqBody ChatRequest) (*ChatResponse, error) {
-	jsonBody, err := json.Marshal(reqBody)
+	jsonBody, err := c.options.marshal(reqBody)
 	if err != nil {
 		return nil, fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -175,6 +308,7 @@ func (c *Client) sendRequest(ctx context.Context, reqBody ChatRequest) (*ChatRes
 
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	c.options.setHeaders(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -188,6 +322,7 @@ func (c *Client) sendRequest(ctx context.Context, reqBody ChatRequest) (*ChatRes
 			StatusCode: resp.StatusCode,
 			Message:    string(body),
 			RawBody:    string(body),
+			Header:     resp.Header,
 		}
 	}
 
@@ -201,7 +336,7 @@ func (c *Client) sendRequest(ctx context.Context, reqBody ChatRequest) (*ChatRes
 
 // sendStreamRequest sends a streaming request.
 func (c *Client) sendStreamRequest(ctx context.Context, reqBody ChatRequest, responseChan chan<- ChatResponse) error {
-	jsonBody, err := json.Marshal(reqBody)
+	jsonBody, err := c.options.marshal(reqBody)
 	if err != nil {
 		return fmt.Errorf("failed to marshal request: %w", err)
 	}
@@ -214,6 +349,7 @@ func (c *Client) sendStreamRequest(ctx context.Context, reqBody ChatRequest, res
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Authorization", "Bearer "+c.apiKey)
 	req.Header.Set("Accept", "text/event-stream")
+	c.options.setHeaders(req)
 
 	resp, err := c.httpClient.Do(req)
 	if err != nil {
@@ -227,11 +363,27 @@ func (c *Client) sendStreamRequest(ctx context.Context, reqBody ChatRequest, res
 			StatusCode: resp.StatusCode,
 			Message:    string(body),
 			RawBody:    string(body),
+			Header:     resp.Header,
+		}
+	}
+
+	// Some gateways ignore stream=true and answer with a regular JSON body;
+	// replay it as a single chunk so callers can treat both the same way
+	if strings.HasPrefix(resp.Header.Get("Content-Type"), "application/json") {
+		var chatResp ChatResponse
+		if err := json.NewDecoder(resp.Body).Decode(&chatResp); err != nil {
+			return fmt.Errorf("failed to decode response: %w", err)
+		}
+		for i := range chatResp.Choices {
+			chatResp.Choices[i].Delta = chatResp.Choices[i].Message
 		}
+		responseChan <- chatResp
+		return nil
 	}
 
 	// Read SSE stream
 	scanner := bufio.NewScanner(resp.Body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
 	for scanner.Scan() {
 		line := scanner.Text()
 		if !strings.HasPrefix(line, "data: ") {
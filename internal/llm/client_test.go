@@ -532,3 +532,111 @@ func TestChatStreamWithTools_Success(t *testing.T) {
 		t.Errorf("expected 'I'll help you.', got %q", content.String())
 	}
 }
+
+func TestChatStream_JSONFallback(t *testing.T) {
+	server, client := mockServer(t, func(w http.ResponseWriter, r *http.Request) {
+		// Gateway ignores stream=true and returns a regular completion
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"id":"1","choices":[{"message":{"role":"assistant","content":"plain"},"finish_reason":"stop"}],"usage":{"prompt_tokens":3,"completion_tokens":1,"total_tokens":4}}`)
+	})
+	defer server.Close()
+
+	respCh, errCh := client.ChatStream(context.Background(), []Message{
+		{Role: "user", Content: "Hi"},
+	})
+
+	var chunks []ChatResponse
+	for chunk := range respCh {
+		chunks = append(chunks, chunk)
+	}
+	if err := <-errCh; err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(chunks) != 1 {
+		t.Fatalf("expected 1 replayed chunk, got %d", len(chunks))
+	}
+	if chunks[0].Choices[0].Delta.Content != "plain" {
+		t.Errorf("expected message replayed as delta, got %q", chunks[0].Choices[0].Delta.Content)
+	}
+	if chunks[0].Usage.TotalTokens != 4 {
+		t.Errorf("expected usage to be preserved, got %+v", chunks[0].Usage)
+	}
+}
+
+func TestMessage_MultipartJSON(t *testing.T) {
+	msg := NewMultipartMessage("user", TextPart("what is this?"), ImagePart("image/png", []byte("png")))
+	if msg.Content != "what is this?" {
+		t.Errorf("Content should hold the text parts, got %q", msg.Content)
+	}
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("marshal failed: %v", err)
+	}
+	want := `{"role":"user","content":[{"type":"text","text":"what is this?"},` +
+		`{"type":"image_url","image_url":{"url":"data:image/png;base64,cG5n"}}]}`
+	if string(data) != want {
+		t.Errorf("got %s\nwant %s", data, want)
+	}
+
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("unmarshal failed: %v", err)
+	}
+	if decoded.Content != "what is this?" || len(decoded.Parts) != 2 || decoded.Parts[1].ImageURL.URL != "data:image/png;base64,cG5n" {
+		t.Errorf("round trip lost content: %+v", decoded)
+	}
+
+	// Plain messages keep string content
+	data, _ = json.Marshal(Message{Role: "tool", Content: "ok", ToolCallID: "call_1"})
+	if string(data) != `{"role":"tool","content":"ok","tool_call_id":"call_1"}` {
+		t.Errorf("unexpected plain message JSON: %s", data)
+	}
+	if err := json.Unmarshal([]byte(`{"role":"assistant","content":null}`), &decoded); err != nil || decoded.Content != "" || decoded.Parts != nil {
+		t.Errorf("null content should decode as empty: %+v, %v", decoded, err)
+	}
+}
+
+func TestClient_RequestOptions(t *testing.T) {
+	temperature := 0.0
+	var body map[string]any
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Gateway-Key") != "g" || r.Header.Get("OpenAI-Organization") != "org-1" ||
+			r.Header.Get("OpenAI-Project") != "" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if r.Header.Get("Authorization") != "Bearer override" {
+			t.Errorf("custom headers should replace built-in ones, got %q", r.Header.Get("Authorization"))
+		}
+		json.NewDecoder(r.Body).Decode(&body)
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"}}]}`)
+	}))
+	defer server.Close()
+
+	client := NewClient(Config{
+		BaseURL:      server.URL,
+		APIKey:       "test-key",
+		Model:        "test-model",
+		Timeout:      5 * time.Second,
+		Headers:      map[string]string{"X-Gateway-Key": "g", "Authorization": "Bearer override"},
+		Organization: "org-1",
+		Temperature:  &temperature,
+		MaxTokens:    100,
+		ExtraBody:    map[string]any{"reasoning_effort": "low", "max_tokens": 200},
+	})
+	if client.httpClient.Timeout != 5*time.Second {
+		t.Errorf("expected 5s timeout, got %v", client.httpClient.Timeout)
+	}
+	if _, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}}); err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+
+	if v, ok := body["temperature"]; !ok || v != 0.0 {
+		t.Errorf("a zero temperature should be sent, got %v", body)
+	}
+	if _, ok := body["top_p"]; ok {
+		t.Errorf("unset settings should be left out, got %v", body)
+	}
+	if body["reasoning_effort"] != "low" || body["max_tokens"] != 200.0 || body["model"] != "test-model" {
+		t.Errorf("extra body fields should be added and win, got %v", body)
+	}
+}
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -16,6 +18,7 @@ type APIError struct {
 	StatusCode int
 	Message    string
 	RawBody    string
+	Header     http.Header // 响应头，含 Retry-After 与 x-ratelimit-* 限流信息
 }
 
 // Error 返回错误信息
@@ -33,13 +36,56 @@ func (e *APIError) IsRetryable() bool {
 		http.StatusInternalServerError,    // 500
 		http.StatusBadGateway,            // 502
 		http.StatusServiceUnavailable,    // 503
-		http.StatusGatewayTimeout:        // 504
+		http.StatusGatewayTimeout,        // 504
+		529:                              // Anthropic 过载（overloaded_error）
 		return true
 	default:
 		return false
 	}
 }
 
+// RetryAfter 返回服务端要求的重试等待时间，没有要求时返回 0。
+// 依次读取 retry-after-ms、Retry-After（秒数或 HTTP 日期），
+// 再取已耗尽的 x-ratelimit-remaining-* 对应的 x-ratelimit-reset-* 中较长者
+func (e *APIError) RetryAfter() time.Duration {
+	if e.Header == nil {
+		return 0
+	}
+	if ms, err := strconv.ParseFloat(e.Header.Get("Retry-After-Ms"), 64); err == nil && ms >= 0 {
+		return time.Duration(ms * float64(time.Millisecond))
+	}
+	if v := e.Header.Get("Retry-After"); v != "" {
+		if secs, err := strconv.ParseFloat(v, 64); err == nil && secs >= 0 {
+			return time.Duration(secs * float64(time.Second))
+		}
+		if t, err := http.ParseTime(v); err == nil {
+			return max(time.Until(t), 0)
+		}
+	}
+
+	var wait time.Duration
+	for _, limit := range []string{"requests", "tokens"} {
+		if e.Header.Get("X-Ratelimit-Remaining-"+limit) != "0" {
+			continue
+		}
+		if d := parseResetDuration(e.Header.Get("X-Ratelimit-Reset-" + limit)); d > wait {
+			wait = d
+		}
+	}
+	return wait
+}
+
+// parseResetDuration 解析 x-ratelimit-reset-* 的值，如 "1s"、"6m0s" 或秒数
+func parseResetDuration(v string) time.Duration {
+	if d, err := time.ParseDuration(v); err == nil && d > 0 {
+		return d
+	}
+	if secs, err := strconv.ParseFloat(v, 64); err == nil && secs > 0 {
+		return time.Duration(secs * float64(time.Second))
+	}
+	return 0
+}
+
 // NetworkError 表示网络连接错误
 type NetworkError struct {
 	Op  string
@@ -93,6 +139,32 @@ func (e *EmptyResponseError) IsRetryable() bool {
 	return true
 }
 
+// SafetyError 表示请求或回复被模型的安全策略拦截
+type SafetyError struct {
+	Reason     string   // 拦截原因，如 SAFETY、PROHIBITED_CONTENT
+	Categories []string // 触发拦截的类别，如 HARM_CATEGORY_DANGEROUS_CONTENT
+	Prompt     bool     // 为 true 时拦截的是请求，否则是回复
+}
+
+// Error 返回错误信息
+func (e *SafetyError) Error() string {
+	target := "response"
+	if e.Prompt {
+		target = "prompt"
+	}
+	msg := fmt.Sprintf("%s blocked by safety filters (%s)", target, e.Reason)
+	if len(e.Categories) > 0 {
+		msg += ": " + strings.Join(e.Categories, ", ")
+	}
+	return msg
+}
+
+// IsRetryable 判断错误是否可重试
+func (e *SafetyError) IsRetryable() bool {
+	// 相同的请求会再次被拦截
+	return false
+}
+
 // RetryableError 接口，用于判断错误是否可重试
 type RetryableError interface {
 	error
@@ -0,0 +1,563 @@
+package llm
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// GeminiClient is a client for the Gemini generateContent API. Messages
+// become contents of user and model turns, tools become function
+// declarations, and tool calls and results become functionCall and
+// functionResponse parts. Blocked prompts and answers are reported as
+// SafetyError.
+type GeminiClient struct {
+	baseURL    string
+	apiKey     string
+	model      string
+	httpClient *http.Client
+	options    requestOptions
+
+	// Thought signatures of the function calls by call ID; models that
+	// think require them back with the calls of the current turn. Only the
+	// most recent maxSignatures are kept, oldest first in signatureIDs
+	mu           sync.Mutex
+	signatures   map[string]string
+	signatureIDs []string
+}
+
+// maxSignatures bounds the thought signatures a GeminiClient keeps. Calls
+// from turns long past are sent without theirs, which the API accepts.
+const maxSignatures = 1024
+
+// NewGeminiClient creates a new Gemini client. BaseURL includes the
+// version, e.g. "https://generativelanguage.googleapis.com/v1beta".
+func NewGeminiClient(cfg Config) *GeminiClient {
+	timeout := cfg.Timeout
+	if timeout == 0 {
+		timeout = 120 * time.Second
+	}
+
+	return &GeminiClient{
+		baseURL: cfg.BaseURL,
+		apiKey:  cfg.APIKey,
+		model:   strings.TrimPrefix(cfg.Model, "models/"),
+		httpClient: &http.Client{
+			Timeout: timeout,
+		},
+		options:    newRequestOptions(cfg, nil),
+		signatures: make(map[string]string),
+	}
+}
+
+// geminiRequest is the body of a generateContent request.
+type geminiRequest struct {
+	Contents          []geminiContent   `json:"contents"`
+	SystemInstruction *geminiContent    `json:"systemInstruction,omitempty"`
+	Tools             []geminiTool      `json:"tools,omitempty"`
+	GenerationConfig  *geminiGeneration `json:"generationConfig,omitempty"`
+}
+
+// geminiGeneration holds the sampling settings of a request.
+type geminiGeneration struct {
+	Temperature     *float64 `json:"temperature,omitempty"`
+	TopP            *float64 `json:"topP,omitempty"`
+	MaxOutputTokens int      `json:"maxOutputTokens,omitempty"`
+}
+
+// geminiContent is a turn of the conversation: role "user" or "model".
+type geminiContent struct {
+	Role  string       `json:"role,omitempty"`
+	Parts []geminiPart `json:"parts"`
+}
+
+// geminiPart is a part of a turn; one of its fields is set.
+type geminiPart struct {
+	Text             string                  `json:"text,omitempty"`
+	Thought          bool                    `json:"thought,omitempty"`
+	ThoughtSignature string                  `json:"thoughtSignature,omitempty"`
+	InlineData       *geminiBlob             `json:"inlineData,omitempty"`
+	FileData         *geminiFile             `json:"fileData,omitempty"`
+	FunctionCall     *geminiFunctionCall     `json:"functionCall,omitempty"`
+	FunctionResponse *geminiFunctionResponse `json:"functionResponse,omitempty"`
+}
+
+// geminiBlob is inline data, such as an image.
+type geminiBlob struct {
+	MimeType string `json:"mimeType"`
+	Data     string `json:"data"`
+}
+
+// geminiFile is data referenced by URI.
+type geminiFile struct {
+	MimeType string `json:"mimeType,omitempty"`
+	FileURI  string `json:"fileUri"`
+}
+
+// geminiFunctionCall is a tool call of the model.
+type geminiFunctionCall struct {
+	ID   string          `json:"id,omitempty"`
+	Name string          `json:"name"`
+	Args json.RawMessage `json:"args,omitempty"`
+}
+
+// geminiFunctionResponse is the result of a tool call. Response must be an
+// object; the result goes in its "output" field.
+type geminiFunctionResponse struct {
+	ID       string         `json:"id,omitempty"`
+	Name     string         `json:"name"`
+	Response map[string]any `json:"response"`
+}
+
+// geminiTool holds the function declarations.
+type geminiTool struct {
+	FunctionDeclarations []geminiFunctionDeclaration `json:"functionDeclarations"`
+}
+
+// geminiFunctionDeclaration is a tool definition. The parameters are sent
+// as JSON Schema, which, unlike the OpenAPI subset of "parameters", accepts
+// any schema a tool may have.
+type geminiFunctionDeclaration struct {
+	Name                 string          `json:"name"`
+	Description          string          `json:"description,omitempty"`
+	ParametersJSONSchema json.RawMessage `json:"parametersJsonSchema,omitempty"`
+}
+
+// geminiResponse is a generateContent response, or a chunk of a stream.
+type geminiResponse struct {
+	Candidates     []geminiCandidate `json:"candidates"`
+	PromptFeedback struct {
+		BlockReason   string               `json:"blockReason"`
+		SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+	} `json:"promptFeedback"`
+	UsageMetadata geminiUsage  `json:"usageMetadata"`
+	ModelVersion  string       `json:"modelVersion"`
+	ResponseID    string       `json:"responseId"`
+	Error         *geminiError `json:"error"` // Errors inside a stream
+}
+
+// geminiCandidate is an answer of the model.
+type geminiCandidate struct {
+	Content       geminiContent        `json:"content"`
+	FinishReason  string               `json:"finishReason"`
+	SafetyRatings []geminiSafetyRating `json:"safetyRatings"`
+}
+
+// geminiSafetyRating is the rating of a prompt or answer in a harm category.
+type geminiSafetyRating struct {
+	Category    string `json:"category"`
+	Probability string `json:"probability"`
+	Blocked     bool   `json:"blocked"`
+}
+
+// geminiUsage is the token usage of a request.
+type geminiUsage struct {
+	PromptTokenCount     int `json:"promptTokenCount"`
+	CandidatesTokenCount int `json:"candidatesTokenCount"`
+	ThoughtsTokenCount   int `json:"thoughtsTokenCount"`
+	TotalTokenCount      int `json:"totalTokenCount"`
+}
+
+// toUsage counts thinking as completion tokens, as OpenAI does.
+func (u geminiUsage) toUsage() Usage {
+	completion := u.CandidatesTokenCount + u.ThoughtsTokenCount
+	return Usage{PromptTokens: u.PromptTokenCount, CompletionTokens: completion, TotalTokens: u.TotalTokenCount}
+}
+
+// geminiError is the error of an error response.
+type geminiError struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+	Status  string `json:"status"`
+}
+
+// geminiBlockReasons are the finish reasons of answers withheld by the
+// safety filters or the recitation check.
+var geminiBlockReasons = map[string]bool{
+	"SAFETY":             true,
+	"RECITATION":         true,
+	"BLOCKLIST":          true,
+	"PROHIBITED_CONTENT": true,
+	"SPII":               true,
+	"IMAGE_SAFETY":       true,
+}
+
+// blocked returns the SafetyError of a blocked prompt or answer, or nil.
+func (r *geminiResponse) blocked() error {
+	if reason := r.PromptFeedback.BlockReason; reason != "" {
+		return &SafetyError{Reason: reason, Categories: blockedCategories(r.PromptFeedback.SafetyRatings), Prompt: true}
+	}
+	if len(r.Candidates) > 0 && geminiBlockReasons[r.Candidates[0].FinishReason] {
+		c := r.Candidates[0]
+		return &SafetyError{Reason: c.FinishReason, Categories: blockedCategories(c.SafetyRatings)}
+	}
+	return nil
+}
+
+// blockedCategories returns the harm categories that caused a block.
+func blockedCategories(ratings []geminiSafetyRating) []string {
+	var categories []string
+	for _, r := range ratings {
+		if r.Blocked || r.Probability == "HIGH" {
+			categories = append(categories, r.Category)
+		}
+	}
+	return categories
+}
+
+// geminiFinishReason maps a finish reason to an OpenAI one. Gemini finishes
+// with STOP after function calls too.
+func geminiFinishReason(reason string, toolCalls bool) string {
+	switch {
+	case reason == "":
+		return ""
+	case toolCalls && reason == "STOP":
+		return "tool_calls"
+	case reason == "STOP":
+		return "stop"
+	case reason == "MAX_TOKENS":
+		return "length"
+	case geminiBlockReasons[reason]:
+		return "content_filter"
+	}
+	return strings.ToLower(reason)
+}
+
+// ChatWithTools sends a generateContent request with tool definitions.
+func (c *GeminiClient) ChatWithTools(ctx context.Context, messages []Message, tools []ToolDef) (*ChatResponse, error) {
+	resp, err := c.post(ctx, "generateContent", c.buildRequest(messages, tools))
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	var gr geminiResponse
+	if err := json.NewDecoder(resp.Body).Decode(&gr); err != nil {
+		return nil, fmt.Errorf("failed to decode response: %w", err)
+	}
+	if err := gr.blocked(); err != nil {
+		return nil, err
+	}
+	if len(gr.Candidates) == 0 {
+		return nil, &EmptyResponseError{Message: "no candidates"}
+	}
+
+	candidate := gr.Candidates[0]
+	msg := Message{Role: "assistant"}
+	var text strings.Builder
+	for _, part := range candidate.Content.Parts {
+		switch {
+		case part.FunctionCall != nil:
+			msg.ToolCalls = append(msg.ToolCalls, c.toolCall(part))
+		case part.Text != "" && !part.Thought:
+			text.WriteString(part.Text)
+		}
+	}
+	msg.Content = text.String()
+
+	return &ChatResponse{
+		ID:      gr.ResponseID,
+		Object:  "chat.completion",
+		Created: time.Now().Unix(),
+		Model:   gr.ModelVersion,
+		Choices: []Choice{{Message: msg, FinishReason: geminiFinishReason(candidate.FinishReason, len(msg.ToolCalls) > 0)}},
+		Usage:   gr.UsageMetadata.toUsage(),
+	}, nil
+}
+
+// Chat sends a generateContent request.
+func (c *GeminiClient) Chat(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	return c.ChatWithTools(ctx, messages, nil)
+}
+
+// ChatStream sends a streamGenerateContent request.
+func (c *GeminiClient) ChatStream(ctx context.Context, messages []Message) (<-chan ChatResponse, <-chan error) {
+	return c.ChatStreamWithTools(ctx, messages, nil)
+}
+
+// ChatStreamWithTools sends a streamGenerateContent request with tool
+// definitions. Response chunks are converted to OpenAI-style chunks.
+func (c *GeminiClient) ChatStreamWithTools(ctx context.Context, messages []Message, tools []ToolDef) (<-chan ChatResponse, <-chan error) {
+	responseChan := make(chan ChatResponse)
+	errorChan := make(chan error, 1)
+
+	go func() {
+		defer close(responseChan)
+		defer close(errorChan)
+
+		resp, err := c.post(ctx, "streamGenerateContent?alt=sse", c.buildRequest(messages, tools))
+		if err != nil {
+			errorChan <- err
+			return
+		}
+		defer resp.Body.Close()
+		if err := c.readStream(resp.Body, responseChan); err != nil {
+			errorChan <- err
+		}
+	}()
+
+	return responseChan, errorChan
+}
+
+// toolCall converts a functionCall part, giving it an ID if it has none
+// and keeping its thought signature.
+func (c *GeminiClient) toolCall(part geminiPart) ToolCallInfo {
+	fc := part.FunctionCall
+	id := fc.ID
+	if id == "" {
+		id = "call_" + strings.ToLower(rand.Text()[:16])
+	}
+	if part.ThoughtSignature != "" {
+		c.keepSignature(id, part.ThoughtSignature)
+	}
+	args := "{}"
+	if len(fc.Args) > 0 && string(fc.Args) != "null" {
+		args = string(fc.Args)
+	}
+	return ToolCallInfo{ID: id, Type: "function", Function: FunctionCall{Name: fc.Name, Arguments: args}}
+}
+
+// keepSignature stores the thought signature of a call, dropping the oldest
+// one when maxSignatures are kept.
+func (c *GeminiClient) keepSignature(id, signature string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, ok := c.signatures[id]; !ok {
+		c.signatureIDs = append(c.signatureIDs, id)
+		if len(c.signatureIDs) > maxSignatures {
+			delete(c.signatures, c.signatureIDs[0])
+			c.signatureIDs = c.signatureIDs[1:]
+		}
+	}
+	c.signatures[id] = signature
+}
+
+// buildRequest converts messages and tools to a generateContent request.
+func (c *GeminiClient) buildRequest(messages []Message, tools []ToolDef) geminiRequest {
+	system, contents := c.toGeminiContents(messages)
+	req := geminiRequest{Contents: contents}
+	if o := c.options; o.temperature != nil || o.topP != nil || o.maxTokens > 0 {
+		req.GenerationConfig = &geminiGeneration{Temperature: o.temperature, TopP: o.topP, MaxOutputTokens: o.maxTokens}
+	}
+	if system != "" {
+		req.SystemInstruction = &geminiContent{Parts: []geminiPart{{Text: system}}}
+	}
+	if len(tools) > 0 {
+		decls := make([]geminiFunctionDeclaration, len(tools))
+		for i, t := range tools {
+			decls[i] = geminiFunctionDeclaration{
+				Name:                 t.Function.Name,
+				Description:          t.Function.Description,
+				ParametersJSONSchema: t.Function.Parameters,
+			}
+		}
+		req.Tools = []geminiTool{{FunctionDeclarations: decls}}
+	}
+	return req
+}
+
+// post sends a request to a method of the model and returns the response
+// if it succeeded.
+func (c *GeminiClient) post(ctx context.Context, method string, reqBody geminiRequest) (*http.Response, error) {
+	jsonBody, err := c.options.marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+
+	url := fmt.Sprintf("%s/models/%s:%s", c.baseURL, c.model, method)
+	req, err := http.NewRequestWithContext(ctx, "POST", url, bytes.NewBuffer(jsonBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Goog-Api-Key", c.apiKey)
+	c.options.setHeaders(req)
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		apiErr := &APIError{StatusCode: resp.StatusCode, Message: string(body), RawBody: string(body), Header: resp.Header}
+		// Errors come as an object, or as an array of one
+		var ge struct {
+			Error geminiError `json:"error"`
+		}
+		var list []struct {
+			Error geminiError `json:"error"`
+		}
+		if json.Unmarshal(body, &ge) != nil && json.Unmarshal(body, &list) == nil && len(list) > 0 {
+			ge = list[0]
+		}
+		if ge.Error.Message != "" {
+			apiErr.Message = fmt.Sprintf("%s: %s", ge.Error.Status, ge.Error.Message)
+		}
+		return nil, apiErr
+	}
+	return resp, nil
+}
+
+// toGeminiContents splits off the system prompt and converts the rest of
+// the messages. Tool results become functionResponse parts of a user turn,
+// named after their calls, and consecutive messages of the same role are
+// merged.
+func (c *GeminiClient) toGeminiContents(messages []Message) (string, []geminiContent) {
+	var (
+		system []string
+		out    []geminiContent
+		names  = map[string]string{} // Function names by call ID
+	)
+	for _, m := range messages {
+		var (
+			role  = "user"
+			parts []geminiPart
+		)
+		switch m.Role {
+		case "system":
+			if text := messageText(m); text != "" {
+				system = append(system, text)
+			}
+			continue
+		case "assistant":
+			role = "model"
+			if m.Content != "" {
+				parts = append(parts, geminiPart{Text: m.Content})
+			}
+			for _, tc := range m.ToolCalls {
+				names[tc.ID] = tc.Function.Name
+				args := json.RawMessage(tc.Function.Arguments)
+				if !json.Valid(args) {
+					args = json.RawMessage("{}")
+				}
+				c.mu.Lock()
+				signature := c.signatures[tc.ID]
+				c.mu.Unlock()
+				parts = append(parts, geminiPart{
+					ThoughtSignature: signature,
+					FunctionCall:     &geminiFunctionCall{ID: tc.ID, Name: tc.Function.Name, Args: args},
+				})
+			}
+		case "tool":
+			parts = append(parts, geminiPart{FunctionResponse: &geminiFunctionResponse{
+				ID:       m.ToolCallID,
+				Name:     names[m.ToolCallID],
+				Response: map[string]any{"output": m.Content},
+			}})
+		default:
+			parts = geminiUserParts(m)
+		}
+		if len(parts) == 0 {
+			continue
+		}
+
+		if n := len(out); n > 0 && out[n-1].Role == role {
+			out[n-1].Parts = append(out[n-1].Parts, parts...)
+		} else {
+			out = append(out, geminiContent{Role: role, Parts: parts})
+		}
+	}
+	return strings.Join(system, "\n\n"), out
+}
+
+// geminiUserParts converts the content of a user message. Images in data
+// URLs are sent inline, others by URI.
+func geminiUserParts(m Message) []geminiPart {
+	if len(m.Parts) == 0 {
+		if m.Content == "" {
+			return nil
+		}
+		return []geminiPart{{Text: m.Content}}
+	}
+
+	var parts []geminiPart
+	for _, p := range m.Parts {
+		switch {
+		case p.Type == "text" && p.Text != "":
+			parts = append(parts, geminiPart{Text: p.Text})
+		case p.Type == "image_url" && p.ImageURL != nil:
+			url := p.ImageURL.URL
+			part := geminiPart{FileData: &geminiFile{FileURI: url}}
+			if rest, ok := strings.CutPrefix(url, "data:"); ok {
+				if meta, data, ok := strings.Cut(rest, ","); ok && strings.HasSuffix(meta, ";base64") {
+					part = geminiPart{InlineData: &geminiBlob{MimeType: strings.TrimSuffix(meta, ";base64"), Data: data}}
+				}
+			}
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
+
+// readStream converts the chunks of a streaming response to OpenAI-style
+// chunks: text deltas, one chunk per complete function call, and a last
+// chunk with the finish reason and usage. A block ends the stream with a
+// SafetyError.
+func (c *GeminiClient) readStream(body io.Reader, responseChan chan<- ChatResponse) error {
+	toolCalls := 0
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		data, ok := strings.CutPrefix(scanner.Text(), "data:")
+		if !ok {
+			continue
+		}
+		var gr geminiResponse
+		if err := json.Unmarshal([]byte(strings.TrimSpace(data)), &gr); err != nil {
+			continue // Skip malformed chunks
+		}
+		if gr.Error != nil {
+			msg := fmt.Sprintf("%s: %s", gr.Error.Status, gr.Error.Message)
+			return &APIError{StatusCode: gr.Error.Code, Message: msg, RawBody: data}
+		}
+		if err := gr.blocked(); err != nil {
+			return err
+		}
+		if len(gr.Candidates) == 0 {
+			continue
+		}
+
+		chunk := func(delta Message, finishReason string) ChatResponse {
+			return ChatResponse{
+				ID:      gr.ResponseID,
+				Object:  "chat.completion.chunk",
+				Model:   gr.ModelVersion,
+				Choices: []Choice{{Delta: delta, FinishReason: finishReason}},
+			}
+		}
+		candidate := gr.Candidates[0]
+		for _, part := range candidate.Content.Parts {
+			switch {
+			case part.FunctionCall != nil:
+				// Function calls arrive whole
+				index := toolCalls
+				toolCalls++
+				tc := c.toolCall(part)
+				tc.Index = &index
+				responseChan <- chunk(Message{Role: "assistant", ToolCalls: []ToolCallInfo{tc}}, "")
+			case part.Text != "" && !part.Thought:
+				responseChan <- chunk(Message{Role: "assistant", Content: part.Text}, "")
+			}
+		}
+		if candidate.FinishReason != "" {
+			final := chunk(Message{Role: "assistant"}, geminiFinishReason(candidate.FinishReason, toolCalls > 0))
+			final.Usage = gr.UsageMetadata.toUsage()
+			responseChan <- final
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return fmt.Errorf("error reading stream: %w", err)
+	}
+	return nil
+}
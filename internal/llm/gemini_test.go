@@ -0,0 +1,241 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// geminiServer serves a recorded response from testdata/gemini and passes
+// each request's method and body to check.
+func geminiServer(t *testing.T, status int, fixture string, check func(method string, req geminiRequest)) *GeminiClient {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "gemini", fixture))
+	if err != nil {
+		t.Fatal(err)
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		model, method, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/models/"), ":")
+		if model != "gemini-2.5-flash" {
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+		if r.Header.Get("X-Goog-Api-Key") != "test-key" {
+			t.Errorf("unexpected headers: %v", r.Header)
+		}
+		if method == "streamGenerateContent" && r.URL.Query().Get("alt") != "sse" {
+			t.Error("streams should be requested as SSE")
+		}
+		var req geminiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Errorf("invalid request body: %v", err)
+		}
+		if check != nil {
+			check(method, req)
+		}
+		if strings.HasSuffix(fixture, ".txt") {
+			w.Header().Set("Content-Type", "text/event-stream")
+		} else {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(status)
+		w.Write(data)
+	}))
+	t.Cleanup(server.Close)
+	return NewGeminiClient(Config{BaseURL: server.URL, APIKey: "test-key", Model: "models/gemini-2.5-flash"})
+}
+
+func TestGemini_FunctionCall(t *testing.T) {
+	client := geminiServer(t, http.StatusOK, "function_call.json", func(method string, req geminiRequest) {
+		if method != "generateContent" {
+			t.Errorf("unexpected method %s", method)
+		}
+		if len(req.Tools) != 1 || len(req.Tools[0].FunctionDeclarations) != 1 ||
+			req.Tools[0].FunctionDeclarations[0].Name != "file" || len(req.Tools[0].FunctionDeclarations[0].ParametersJSONSchema) == 0 {
+			t.Errorf("unexpected tools: %+v", req.Tools)
+		}
+		if req.SystemInstruction == nil || req.SystemInstruction.Parts[0].Text != "Be brief." {
+			t.Errorf("unexpected system instruction: %+v", req.SystemInstruction)
+		}
+	})
+
+	tools := []ToolDef{{Type: "function", Function: FunctionDef{
+		Name:       "file",
+		Parameters: json.RawMessage(`{"type":"object","additionalProperties":false}`),
+	}}}
+	messages := []Message{{Role: "system", Content: "Be brief."}, {Role: "user", Content: "read a.txt"}}
+	resp, err := client.ChatWithTools(context.Background(), messages, tools)
+	if err != nil {
+		t.Fatalf("ChatWithTools failed: %v", err)
+	}
+
+	choice := resp.Choices[0]
+	if choice.FinishReason != "tool_calls" || choice.Message.Content != "Let me read it." {
+		t.Errorf("unexpected choice: %+v", choice)
+	}
+	if len(choice.Message.ToolCalls) != 1 {
+		t.Fatalf("expected 1 tool call, got %+v", choice.Message.ToolCalls)
+	}
+	tc := choice.Message.ToolCalls[0]
+	if tc.ID == "" || tc.Function.Name != "file" || !strings.Contains(tc.Function.Arguments, `"path": "a.txt"`) {
+		t.Errorf("unexpected tool call: %+v", tc)
+	}
+	if resp.Usage.PromptTokens != 120 || resp.Usage.CompletionTokens != 60 || resp.Usage.TotalTokens != 180 {
+		t.Errorf("thinking should count as completion tokens: %+v", resp.Usage)
+	}
+
+	// The next request sends the call back with its signature, and the
+	// result named after it
+	_, contents := client.toGeminiContents([]Message{
+		{Role: "user", Content: "read a.txt"},
+		choice.Message,
+		{Role: "tool", ToolCallID: tc.ID, Content: "hello"},
+	})
+	if len(contents) != 3 || contents[1].Role != "model" {
+		t.Fatalf("unexpected contents: %+v", contents)
+	}
+	call := contents[1].Parts[1]
+	if call.FunctionCall == nil || call.ThoughtSignature != "CiIBVKhc7oDb0Z3Uzw==" {
+		t.Errorf("the thought signature should be sent back: %+v", call)
+	}
+	result := contents[2].Parts[0].FunctionResponse
+	if contents[2].Role != "user" || result == nil || result.Name != "file" || result.Response["output"] != "hello" {
+		t.Errorf("unexpected function response: %+v", contents[2])
+	}
+}
+
+func TestGemini_SignaturesBounded(t *testing.T) {
+	client := NewGeminiClient(Config{})
+	for i := range maxSignatures + 10 {
+		client.toolCall(geminiPart{
+			ThoughtSignature: fmt.Sprintf("sig-%d", i),
+			FunctionCall:     &geminiFunctionCall{ID: fmt.Sprintf("call_%d", i), Name: "file"},
+		})
+	}
+	if len(client.signatures) != maxSignatures || len(client.signatureIDs) != maxSignatures {
+		t.Fatalf("expected %d signatures, got %d", maxSignatures, len(client.signatures))
+	}
+	if _, ok := client.signatures["call_9"]; ok {
+		t.Error("the oldest signatures should be dropped")
+	}
+	if sig := client.signatures[fmt.Sprintf("call_%d", maxSignatures+9)]; sig != fmt.Sprintf("sig-%d", maxSignatures+9) {
+		t.Errorf("the newest signature should be kept, got %q", sig)
+	}
+}
+
+func TestGemini_ContentConversion(t *testing.T) {
+	client := NewGeminiClient(Config{})
+	_, contents := client.toGeminiContents([]Message{
+		NewMultipartMessage("user", TextPart("What is this?"), ImagePart("image/png", []byte("png"))),
+		{Role: "assistant", ToolCalls: []ToolCallInfo{
+			{ID: "c1", Type: "function", Function: FunctionCall{Name: "glob", Arguments: `{"pattern":"*"}`}},
+			{ID: "c2", Type: "function", Function: FunctionCall{Name: "todo", Arguments: "not json"}},
+		}},
+		{Role: "tool", ToolCallID: "c1", Content: "a.go"},
+		{Role: "tool", ToolCallID: "c2", Content: "done"},
+		{Role: "user", Content: "Thanks"},
+	})
+	if len(contents) != 3 {
+		t.Fatalf("expected user, model and user turns, got %+v", contents)
+	}
+
+	image := contents[0].Parts[1].InlineData
+	if image == nil || image.MimeType != "image/png" || image.Data != "cG5n" {
+		t.Errorf("unexpected image part: %+v", contents[0].Parts[1])
+	}
+	if args := contents[1].Parts[1].FunctionCall.Args; string(args) != "{}" {
+		t.Errorf("invalid arguments should be sent as {}, got %s", args)
+	}
+	// Function responses and the next user message share one turn
+	parts := contents[2].Parts
+	if len(parts) != 3 || parts[1].FunctionResponse.Name != "todo" || parts[2].Text != "Thanks" {
+		t.Errorf("unexpected last turn: %+v", parts)
+	}
+}
+
+func TestGemini_Stream(t *testing.T) {
+	client := geminiServer(t, http.StatusOK, "stream.txt", func(method string, req geminiRequest) {
+		if method != "streamGenerateContent" {
+			t.Errorf("unexpected method %s", method)
+		}
+	})
+
+	chunks, errs := client.ChatStreamWithTools(context.Background(), []Message{{Role: "user", Content: "list"}}, nil)
+	acc := NewStreamAccumulator()
+	for chunk := range chunks {
+		acc.Add(chunk)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+
+	msg := acc.Message()
+	if msg.Content != "I'll look for Go files." || acc.FinishReason() != "tool_calls" {
+		t.Errorf("thoughts should be skipped: message %q, finish reason %q", msg.Content, acc.FinishReason())
+	}
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %+v", msg.ToolCalls)
+	}
+	if msg.ToolCalls[0].Function.Name != "glob" || msg.ToolCalls[0].Function.Arguments != `{"pattern": "**/*.go"}` {
+		t.Errorf("unexpected first tool call: %+v", msg.ToolCalls[0])
+	}
+	if msg.ToolCalls[1].ID == msg.ToolCalls[0].ID || msg.ToolCalls[1].Function.Arguments != "{}" {
+		t.Errorf("unexpected second tool call: %+v", msg.ToolCalls[1])
+	}
+	if u := acc.Usage(); u.PromptTokens != 95 || u.CompletionTokens != 55 || u.TotalTokens != 150 {
+		t.Errorf("unexpected usage: %+v", u)
+	}
+}
+
+func TestGemini_SafetyBlocks(t *testing.T) {
+	client := geminiServer(t, http.StatusOK, "prompt_blocked.json", nil)
+	_, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	var safetyErr *SafetyError
+	if !errors.As(err, &safetyErr) || !safetyErr.Prompt || safetyErr.Reason != "PROHIBITED_CONTENT" {
+		t.Fatalf("expected a prompt SafetyError, got %v", err)
+	}
+	if IsRetryableError(err) || !strings.Contains(err.Error(), "HARM_CATEGORY_DANGEROUS_CONTENT") {
+		t.Errorf("unexpected error %q", err)
+	}
+
+	client = geminiServer(t, http.StatusOK, "stream_blocked.txt", nil)
+	chunks, errs := client.ChatStream(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	for range chunks {
+	}
+	err = <-errs
+	if !errors.As(err, &safetyErr) || safetyErr.Prompt || safetyErr.Reason != "SAFETY" ||
+		len(safetyErr.Categories) != 1 || safetyErr.Categories[0] != "HARM_CATEGORY_DANGEROUS_CONTENT" {
+		t.Errorf("expected a response SafetyError, got %v", err)
+	}
+}
+
+func TestGemini_HTTPError(t *testing.T) {
+	client := geminiServer(t, http.StatusTooManyRequests, "error.json", nil)
+
+	_, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || !apiErr.IsRetryable() {
+		t.Fatalf("expected a retryable APIError, got %v", err)
+	}
+	if !strings.HasPrefix(apiErr.Message, "RESOURCE_EXHAUSTED: You exceeded your current quota") {
+		t.Errorf("unexpected message %q", apiErr.Message)
+	}
+}
+
+func TestGemini_GenerationConfig(t *testing.T) {
+	topP := 0.5
+	client := NewGeminiClient(Config{Model: "gemini-2.5-flash", TopP: &topP, MaxTokens: 1024})
+	req := client.buildRequest([]Message{{Role: "user", Content: "hi"}}, nil)
+	if gc := req.GenerationConfig; gc == nil || *gc.TopP != 0.5 || gc.MaxOutputTokens != 1024 || gc.Temperature != nil {
+		t.Errorf("unexpected generation config: %+v", req.GenerationConfig)
+	}
+	if req := NewGeminiClient(Config{}).buildRequest(nil, nil); req.GenerationConfig != nil {
+		t.Error("no settings should send no generation config")
+	}
+}
@@ -0,0 +1,111 @@
+package llm
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"net/http"
+)
+
+// Provider types, as set in ProviderConfig.Type.
+const (
+	ProviderOpenAI    = "openai"
+	ProviderKimi      = "kimi" // The Moonshot API, which is OpenAI-compatible
+	ProviderAnthropic = "anthropic"
+	ProviderGemini    = "gemini"
+)
+
+// Provider is a chat model API. Implementations translate the OpenAI-style
+// messages, tool definitions and responses of this package to and from
+// their own wire format, so callers need not know which API is used.
+type Provider interface {
+	Chat(ctx context.Context, messages []Message) (*ChatResponse, error)
+	ChatWithTools(ctx context.Context, messages []Message, tools []ToolDef) (*ChatResponse, error)
+	// ChatStream and ChatStreamWithTools send OpenAI-style chunks, which
+	// StreamAccumulator assembles.
+	ChatStream(ctx context.Context, messages []Message) (<-chan ChatResponse, <-chan error)
+	ChatStreamWithTools(ctx context.Context, messages []Message, tools []ToolDef) (<-chan ChatResponse, <-chan error)
+}
+
+var (
+	_ Provider = (*Client)(nil)
+	_ Provider = (*AnthropicClient)(nil)
+	_ Provider = (*GeminiClient)(nil)
+	_ Provider = (*RetryableClient)(nil)
+)
+
+// OpenAICompatible reports whether a provider type speaks the OpenAI API.
+func OpenAICompatible(providerType string) bool {
+	switch providerType {
+	case "", ProviderOpenAI, ProviderKimi, "custom":
+		return true
+	}
+	return false
+}
+
+// NewProvider creates the client for a provider type. An empty type, "kimi"
+// and "custom" mean an OpenAI-compatible API.
+func NewProvider(providerType string, cfg Config) (Provider, error) {
+	switch {
+	case OpenAICompatible(providerType):
+		return NewClient(cfg), nil
+	case providerType == ProviderAnthropic:
+		return NewAnthropicClient(cfg), nil
+	case providerType == ProviderGemini:
+		return NewGeminiClient(cfg), nil
+	}
+	return nil, fmt.Errorf("unknown provider type %q (supported: %s, %s, %s)",
+		providerType, ProviderOpenAI, ProviderAnthropic, ProviderGemini)
+}
+
+// requestOptions are the settings of Config that every client applies to
+// its requests in the same way.
+type requestOptions struct {
+	headers     map[string]string
+	temperature *float64
+	topP        *float64
+	maxTokens   int
+	extraBody   map[string]any
+}
+
+// newRequestOptions takes the options from cfg. The client's own headers,
+// such as the OpenAI organization, are sent when set, unless cfg.Headers
+// replaces them.
+func newRequestOptions(cfg Config, headers map[string]string) requestOptions {
+	all := make(map[string]string)
+	for name, value := range headers {
+		if value != "" {
+			all[name] = value
+		}
+	}
+	maps.Copy(all, cfg.Headers)
+	return requestOptions{
+		headers:     all,
+		temperature: cfg.Temperature,
+		topP:        cfg.TopP,
+		maxTokens:   cfg.MaxTokens,
+		extraBody:   cfg.ExtraBody,
+	}
+}
+
+// setHeaders sets the custom headers of a request.
+func (o requestOptions) setHeaders(req *http.Request) {
+	for name, value := range o.headers {
+		req.Header.Set(name, value)
+	}
+}
+
+// marshal encodes a request body with the extra body fields added.
+func (o requestOptions) marshal(body any) ([]byte, error) {
+	data, err := json.Marshal(body)
+	if err != nil || len(o.extraBody) == 0 {
+		return data, err
+	}
+	var fields map[string]any
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, err
+	}
+	maps.Copy(fields, o.extraBody)
+	return json.Marshal(fields)
+}
@@ -0,0 +1,127 @@
+package llm
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// RateLimiter 是客户端限流器，用每分钟请求数和每分钟 token 数两个令牌桶
+// 限制请求速率。同一个 RateLimiter 可由多个 RetryableClient 共享，
+// 从而约束所有 Soul 对同一 provider 的总请求量。nil 表示不限流
+type RateLimiter struct {
+	mu       sync.Mutex
+	requests *bucket
+	tokens   *bucket
+	now      func() time.Time
+}
+
+// bucket 是一个令牌桶，令牌可以透支，透支后的请求需要等到令牌补足
+type bucket struct {
+	capacity  float64
+	available float64
+	rate      float64 // 每秒补充的令牌数
+	last      time.Time
+}
+
+// NewRateLimiter 创建限流器，参数为 0 表示不限制该项；两项都为 0 时返回 nil
+func NewRateLimiter(requestsPerMinute, tokensPerMinute int) *RateLimiter {
+	if requestsPerMinute <= 0 && tokensPerMinute <= 0 {
+		return nil
+	}
+	l := &RateLimiter{now: time.Now}
+	l.requests = newBucket(requestsPerMinute, l.now())
+	l.tokens = newBucket(tokensPerMinute, l.now())
+	return l
+}
+
+// newBucket 创建每分钟补充 perMinute 个令牌、初始为满的令牌桶
+func newBucket(perMinute int, now time.Time) *bucket {
+	if perMinute <= 0 {
+		return nil
+	}
+	return &bucket{
+		capacity:  float64(perMinute),
+		available: float64(perMinute),
+		rate:      float64(perMinute) / 60,
+		last:      now,
+	}
+}
+
+// take 取出 n 个令牌，返回令牌补足前需要等待的时间
+func (b *bucket) take(now time.Time, n float64) time.Duration {
+	if b == nil {
+		return 0
+	}
+	b.available = min(b.capacity, b.available+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+	b.available -= n
+	if b.available >= 0 {
+		return 0
+	}
+	return time.Duration(-b.available / b.rate * float64(time.Second))
+}
+
+// put 归还 n 个令牌（n 为负时再取出）
+func (b *bucket) put(n float64) {
+	if b != nil {
+		b.available = min(b.capacity, b.available+n)
+	}
+}
+
+// Reserve 为一个预计消耗 tokens 个 token 的请求预留令牌，
+// 返回发送请求前需要等待的时间
+func (l *RateLimiter) Reserve(tokens int) time.Duration {
+	if l == nil {
+		return 0
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	now := l.now()
+	return max(l.requests.take(now, 1), l.tokens.take(now, float64(tokens)))
+}
+
+// Cancel 归还未发送的请求预留的令牌
+func (l *RateLimiter) Cancel(tokens int) {
+	if l == nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.requests.put(1)
+	l.tokens.put(float64(tokens))
+}
+
+// Record 按实际用量修正预留的 token 数；actual 为 0 表示用量未知，保留预估值
+func (l *RateLimiter) Record(estimated, actual int) {
+	if l == nil || actual <= 0 {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.tokens.put(float64(estimated - actual))
+}
+
+// Wait 预留令牌并等待到可以发送请求；等待超过 notifyAfter 时先调用 notify。
+// ctx 取消时归还令牌并返回错误
+func (l *RateLimiter) Wait(ctx context.Context, tokens int, notify func(wait time.Duration)) error {
+	wait := l.Reserve(tokens)
+	if wait <= 0 {
+		return nil
+	}
+	if notify != nil && wait >= notifyAfter {
+		notify(wait)
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		l.Cancel(tokens)
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// notifyAfter 是需要告知用户的最短限流等待时间，更短的等待不打扰用户
+const notifyAfter = time.Second
@@ -0,0 +1,76 @@
+package llm
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testLimiter returns a limiter with a clock the test advances by hand.
+func testLimiter(rpm, tpm int) (*RateLimiter, *time.Time) {
+	now := time.Unix(0, 0)
+	l := NewRateLimiter(rpm, tpm)
+	l.now = func() time.Time { return now }
+	l.requests = newBucket(rpm, now)
+	l.tokens = newBucket(tpm, now)
+	return l, &now
+}
+
+func TestNewRateLimiter_Disabled(t *testing.T) {
+	l := NewRateLimiter(0, 0)
+	if l != nil {
+		t.Fatalf("expected no limiter, got %+v", l)
+	}
+	// A nil limiter never waits
+	if wait := l.Reserve(1000); wait != 0 {
+		t.Errorf("nil limiter should not wait, got %v", wait)
+	}
+	l.Cancel(1000)
+	l.Record(1000, 10)
+	if err := l.Wait(context.Background(), 1000, nil); err != nil {
+		t.Errorf("nil limiter Wait failed: %v", err)
+	}
+}
+
+func TestRateLimiter_Requests(t *testing.T) {
+	l, now := testLimiter(2, 0)
+
+	if l.Reserve(100) != 0 || l.Reserve(100) != 0 {
+		t.Fatal("requests within the limit should not wait")
+	}
+	if wait := l.Reserve(100); wait != 30*time.Second {
+		t.Errorf("third request should wait for one refill, got %v", wait)
+	}
+
+	// The refunded request frees its slot as time passes
+	l.Cancel(100)
+	*now = now.Add(30 * time.Second)
+	if wait := l.Reserve(100); wait != 0 {
+		t.Errorf("expected a refilled slot, got %v", wait)
+	}
+}
+
+func TestRateLimiter_Tokens(t *testing.T) {
+	l, now := testLimiter(0, 6000)
+
+	if wait := l.Reserve(5000); wait != 0 {
+		t.Fatalf("first request should not wait, got %v", wait)
+	}
+	if wait := l.Reserve(2000); wait != 10*time.Second {
+		t.Errorf("expected to wait for 1000 tokens, got %v", wait)
+	}
+
+	// The first request used far fewer tokens than estimated
+	l.Record(5000, 1000)
+	*now = now.Add(time.Second)
+	if wait := l.Reserve(3000); wait != 0 {
+		t.Errorf("recorded usage should return unused tokens, got %v", wait)
+	}
+
+	// Refills never exceed a minute's worth of tokens
+	*now = now.Add(time.Hour)
+	l.Reserve(6000)
+	if wait := l.Reserve(600); wait != 6*time.Second {
+		t.Errorf("expected the bucket capped at capacity, got %v", wait)
+	}
+}
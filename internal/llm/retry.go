@@ -16,6 +16,7 @@ type RetryConfig struct {
 	MaxWait          time.Duration // 最大等待时间，默认 5s
 	ExponentialBase  float64       // 指数基数，默认 2
 	Jitter           time.Duration // 抖动范围，默认 500ms
+	MaxRetryAfter    time.Duration // 服务端指定等待时间的上限，默认 60s；要求更久时不再重试
 }
 
 // DefaultRetryConfig 返回默认重试配置
@@ -26,6 +27,7 @@ func DefaultRetryConfig() *RetryConfig {
 		MaxWait:          5 * time.Second,
 		ExponentialBase:  2.0,
 		Jitter:           500 * time.Millisecond,
+		MaxRetryAfter:    60 * time.Second,
 	}
 }
 
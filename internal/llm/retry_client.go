@@ -3,6 +3,7 @@ package llm
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"time"
 
@@ -16,16 +17,19 @@ type Logger interface {
 	Warn(format string, args ...interface{})
 }
 
-// RetryableClient 包装 LLMClient 添加重试功能
+// RetryableClient 包装任意 Provider 添加重试功能。服务端通过 Retry-After
+// 或限流响应头指定等待时间时按其等待，否则指数退避；设置了 RateLimiter 时
+// 每个请求先经过限流
 type RetryableClient struct {
-	inner      *Client
-	config     *RetryConfig
-	logger     Logger
+	inner   Provider
+	config  *RetryConfig
+	logger  Logger
+	limiter *RateLimiter
 }
 
 // NewRetryableClient 创建带重试功能的客户端
 func NewRetryableClient(
-	inner *Client,
+	inner Provider,
 	config *RetryConfig,
 	logger Logger,
 ) *RetryableClient {
@@ -33,75 +37,106 @@ func NewRetryableClient(
 		config = DefaultRetryConfig()
 	}
 	return &RetryableClient{
-		inner:      inner,
-		config:     config,
-		logger:     logger,
+		inner:  inner,
+		config: config,
+		logger: logger,
 	}
 }
 
+// SetRateLimiter 设置限流器，多个客户端可共享同一个限流器
+func (c *RetryableClient) SetRateLimiter(limiter *RateLimiter) {
+	c.limiter = limiter
+}
+
 // ChatWithTools 带重试的聊天调用
 func (c *RetryableClient) ChatWithTools(
 	ctx context.Context,
 	messages []Message,
 	tools []ToolDef,
 ) (*ChatResponse, error) {
-	var lastErr error
-
-	for attempt := 0; attempt <= c.config.MaxRetries; attempt++ {
-		// 检查上下文是否已取消
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		default:
+	estimate := EstimateTokens(messages)
+	for attempt := 0; ; attempt++ {
+		if err := c.throttle(ctx, estimate); err != nil {
+			return nil, err
 		}
 
 		// 执行调用
 		resp, err := c.inner.ChatWithTools(ctx, messages, tools)
 		if err == nil {
+			c.limiter.Record(estimate, resp.Usage.TotalTokens)
 			if attempt > 0 && c.logger != nil {
 				c.logger.Info("LLM request succeeded after %d retry(s)", attempt)
 			}
 			return resp, nil
 		}
 
-		lastErr = err
-
-		// 检查是否应该重试
-		if !IsRetryableError(err) {
-			if c.logger != nil {
-				c.logger.Debug("Non-retryable error, aborting: %v", err)
-			}
+		if err := c.backoff(ctx, attempt, err); err != nil {
 			return nil, err
 		}
+	}
+}
 
-		// 如果是最后一次尝试，不再等待
-		if attempt >= c.config.MaxRetries {
-			break
-		}
-
-		// 计算等待时间
-		waitTime := ExponentialBackoff(
-			attempt,
-			c.config.InitialWait,
-			c.config.MaxWait,
-			c.config.ExponentialBase,
-			c.config.Jitter,
-		)
+// throttle 检查上下文并等待限流器放行
+func (c *RetryableClient) throttle(ctx context.Context, estimate int) error {
+	// 检查上下文是否已取消
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return c.limiter.Wait(ctx, estimate, func(wait time.Duration) {
+		notifyRetry(ctx, RetryEvent{MaxRetries: c.config.MaxRetries, Wait: wait})
+	})
+}
 
+// backoff 处理第 attempt 次尝试（从 0 开始）的错误：可以重试时通知调用方并
+// 等待后返回 nil，否则返回最终的错误
+func (c *RetryableClient) backoff(ctx context.Context, attempt int, err error) error {
+	// 检查是否应该重试
+	if !IsRetryableError(err) {
 		if c.logger != nil {
-			c.logger.Info("Retrying LLM request (attempt %d/%d) after %v: %v",
-				attempt+1, c.config.MaxRetries, waitTime, err)
+			c.logger.Debug("Non-retryable error, aborting: %v", err)
 		}
+		return err
+	}
+
+	// 如果是最后一次尝试，不再等待
+	if attempt >= c.config.MaxRetries {
+		return fmt.Errorf("max retries (%d) exceeded: %w", c.config.MaxRetries, err)
+	}
 
-		// 等待
-		select {
-		case <-ctx.Done():
-			return nil, ctx.Err()
-		case <-time.After(waitTime):
+	// 计算等待时间：优先使用服务端指定的时间
+	waitTime := ExponentialBackoff(
+		attempt,
+		c.config.InitialWait,
+		c.config.MaxWait,
+		c.config.ExponentialBase,
+		c.config.Jitter,
+	)
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		if retryAfter := apiErr.RetryAfter(); retryAfter > 0 {
+			if c.config.MaxRetryAfter > 0 && retryAfter > c.config.MaxRetryAfter {
+				return fmt.Errorf("server asked to retry after %v, longer than the %v limit: %w",
+					retryAfter.Round(time.Second), c.config.MaxRetryAfter, err)
+			}
+			waitTime = retryAfter
 		}
 	}
 
-	return nil, fmt.Errorf("max retries (%d) exceeded: %w", c.config.MaxRetries, lastErr)
+	if c.logger != nil {
+		c.logger.Info("Retrying LLM request (attempt %d/%d) after %v: %v",
+			attempt+1, c.config.MaxRetries, waitTime, err)
+	}
+	notifyRetry(ctx, RetryEvent{Attempt: attempt + 1, MaxRetries: c.config.MaxRetries, Wait: waitTime, Err: err})
+
+	// 等待
+	timer := time.NewTimer(waitTime)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
 }
 
 // Chat 带重试的普通聊天调用
@@ -117,20 +152,115 @@ func (c *RetryableClient) ChatStream(
 	ctx context.Context,
 	messages []Message,
 ) (<-chan ChatResponse, <-chan error) {
-	// 流式调用的重试比较复杂，暂时委托给内部客户端
-	// 后续可以考虑实现断点续传的重试机制
-	return c.inner.ChatStream(ctx, messages)
+	return c.ChatStreamWithTools(ctx, messages, nil)
 }
 
-// ChatStreamWithTools 带重试的流式聊天调用（支持工具）
+// ChatStreamWithTools 带重试的流式聊天调用（支持工具）。
+// 只有在收到第一个 chunk 之前失败的请求会重试，否则调用方会收到重复的内容
 func (c *RetryableClient) ChatStreamWithTools(
 	ctx context.Context,
 	messages []Message,
 	tools []ToolDef,
 ) (<-chan ChatResponse, <-chan error) {
-	// 流式调用的重试比较复杂，暂时委托给内部客户端
-	// 后续可以考虑实现断点续传的重试机制
-	return c.inner.ChatStreamWithTools(ctx, messages, tools)
+	responseChan := make(chan ChatResponse)
+	errorChan := make(chan error, 1)
+
+	go func() {
+		defer close(responseChan)
+		defer close(errorChan)
+
+		estimate := EstimateTokens(messages)
+		for attempt := 0; ; attempt++ {
+			if err := c.throttle(ctx, estimate); err != nil {
+				errorChan <- err
+				return
+			}
+
+			chunks, errs := c.inner.ChatStreamWithTools(ctx, messages, tools)
+			forwarded, usage := false, 0
+			for chunk := range chunks {
+				if chunk.Usage.TotalTokens > 0 {
+					usage = chunk.Usage.TotalTokens
+				}
+				select {
+				case responseChan <- chunk:
+					forwarded = true
+				case <-ctx.Done():
+					// 读完剩余的 chunk，避免内部客户端阻塞
+					go func() {
+						for range chunks {
+						}
+					}()
+					errorChan <- ctx.Err()
+					return
+				}
+			}
+
+			err := <-errs
+			if err == nil {
+				c.limiter.Record(estimate, usage)
+				if attempt > 0 && c.logger != nil {
+					c.logger.Info("LLM request succeeded after %d retry(s)", attempt)
+				}
+				return
+			}
+			if forwarded {
+				errorChan <- err
+				return
+			}
+			if err := c.backoff(ctx, attempt, err); err != nil {
+				errorChan <- err
+				return
+			}
+		}
+	}()
+
+	return responseChan, errorChan
+}
+
+// RetryEvent 描述一次重试或限流等待，通过 WithRetryNotifier 通知调用方
+type RetryEvent struct {
+	Attempt    int           // 第几次重试，从 1 开始；限流等待时为 0
+	MaxRetries int           // 最大重试次数
+	Wait       time.Duration // 重试或发送前的等待时间
+	Err        error         // 触发重试的错误；限流等待时为 nil
+}
+
+// Reason 返回等待原因的简短描述，如 "rate limited"
+func (e RetryEvent) Reason() string {
+	var apiErr *APIError
+	switch {
+	case e.Err == nil:
+		return "client rate limit reached"
+	case errors.As(e.Err, &apiErr) && apiErr.StatusCode == 429:
+		return "rate limited"
+	case apiErr != nil && (apiErr.StatusCode == 503 || apiErr.StatusCode == 529):
+		return "overloaded"
+	case apiErr != nil:
+		return "server error"
+	case isTimeoutError(e.Err):
+		return "request timed out"
+	}
+	var emptyErr *EmptyResponseError
+	if errors.As(e.Err, &emptyErr) {
+		return "empty response"
+	}
+	return "connection error"
+}
+
+type retryNotifierKey struct{}
+
+// WithRetryNotifier 返回一个 context，在其下发出的请求每次重试或等待限流前
+// 调用 fn。共享同一客户端的多个 Soul 各自收到自己请求的通知
+func WithRetryNotifier(ctx context.Context, fn func(RetryEvent)) context.Context {
+	return context.WithValue(ctx, retryNotifierKey{}, fn)
+}
+
+// notifyRetry 调用 WithRetryNotifier 设置的函数
+func notifyRetry(ctx context.Context, e RetryEvent) {
+	if fn, _ := ctx.Value(retryNotifierKey{}).(func(RetryEvent)); fn != nil {
+		fn(e)
+	}
 }
 
 // Ensure RetryableClient implements the same interface as Client (including streaming methods)
@@ -154,6 +284,7 @@ func RetryConfigFromProvider(provider *config.ProviderConfig) *RetryConfig {
 		MaxWait:         time.Duration(retry.MaxWaitMs) * time.Millisecond,
 		ExponentialBase: retry.ExponentialBase,
 		Jitter:          time.Duration(retry.JitterMs) * time.Millisecond,
+		MaxRetryAfter:   time.Duration(retry.MaxRetryAfterMs) * time.Millisecond,
 	}
 
 	// 设置默认值
@@ -169,6 +300,9 @@ func RetryConfigFromProvider(provider *config.ProviderConfig) *RetryConfig {
 	if cfg.ExponentialBase <= 1 {
 		cfg.ExponentialBase = DefaultRetryConfig().ExponentialBase
 	}
+	if cfg.MaxRetryAfter <= 0 {
+		cfg.MaxRetryAfter = DefaultRetryConfig().MaxRetryAfter
+	}
 
 	return cfg
 }
@@ -0,0 +1,207 @@
+package llm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAPIError_RetryAfter(t *testing.T) {
+	tests := []struct {
+		name   string
+		header http.Header
+		want   time.Duration
+	}{
+		{"none", nil, 0},
+		{"milliseconds", http.Header{"Retry-After-Ms": {"1500"}, "Retry-After": {"9"}}, 1500 * time.Millisecond},
+		{"seconds", http.Header{"Retry-After": {"12"}}, 12 * time.Second},
+		{"date in the past", http.Header{"Retry-After": {"Wed, 21 Oct 2015 07:28:00 GMT"}}, 0},
+		{"exhausted limits", http.Header{
+			"X-Ratelimit-Remaining-Requests": {"0"},
+			"X-Ratelimit-Reset-Requests":     {"2s"},
+			"X-Ratelimit-Remaining-Tokens":   {"0"},
+			"X-Ratelimit-Reset-Tokens":       {"6m0s"},
+		}, 6 * time.Minute},
+		{"remaining limit", http.Header{
+			"X-Ratelimit-Remaining-Requests": {"10"},
+			"X-Ratelimit-Reset-Requests":     {"2s"},
+		}, 0},
+		{"invalid", http.Header{"Retry-After": {"soon"}}, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := &APIError{StatusCode: http.StatusTooManyRequests, Header: tt.header}
+			if got := err.RetryAfter(); got != tt.want {
+				t.Errorf("RetryAfter() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// retryServer answers the first failures requests with 429 and the given
+// headers, then with a text response.
+func retryServer(t *testing.T, failures int, header http.Header) (*Client, *int) {
+	t.Helper()
+	calls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if calls <= failures {
+			for name, values := range header {
+				w.Header()[name] = values
+			}
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"rate limit exceeded"}}`)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		fmt.Fprint(w, `{"choices":[{"message":{"role":"assistant","content":"ok"},"finish_reason":"stop"}],"usage":{"total_tokens":7}}`)
+	}))
+	t.Cleanup(server.Close)
+	return NewClient(Config{BaseURL: server.URL, APIKey: "test-key", Model: "test"}), &calls
+}
+
+func testRetryConfig() *RetryConfig {
+	return &RetryConfig{
+		MaxRetries:      2,
+		InitialWait:     time.Millisecond,
+		MaxWait:         time.Millisecond,
+		ExponentialBase: 2,
+		MaxRetryAfter:   time.Second,
+	}
+}
+
+func TestRetryableClient_HonorsRetryAfter(t *testing.T) {
+	inner, calls := retryServer(t, 1, http.Header{"Retry-After-Ms": {"50"}})
+	client := NewRetryableClient(inner, testRetryConfig(), nil)
+
+	var events []RetryEvent
+	ctx := WithRetryNotifier(context.Background(), func(e RetryEvent) {
+		events = append(events, e)
+	})
+	start := time.Now()
+	resp, err := client.Chat(ctx, []Message{{Role: "user", Content: "hi"}})
+	if err != nil {
+		t.Fatalf("Chat failed: %v", err)
+	}
+	if resp.Choices[0].Message.Content != "ok" || *calls != 2 {
+		t.Errorf("expected a successful retry, got %+v after %d calls", resp, *calls)
+	}
+	if elapsed := time.Since(start); elapsed < 50*time.Millisecond {
+		t.Errorf("retried after %v, before the server-directed delay", elapsed)
+	}
+	if len(events) != 1 || events[0].Attempt != 1 || events[0].MaxRetries != 2 ||
+		events[0].Wait != 50*time.Millisecond || events[0].Reason() != "rate limited" {
+		t.Errorf("unexpected retry events: %+v", events)
+	}
+}
+
+func TestRetryableClient_RetryAfterTooLong(t *testing.T) {
+	inner, calls := retryServer(t, 1, http.Header{"Retry-After": {"120"}})
+	client := NewRetryableClient(inner, testRetryConfig(), nil)
+
+	_, err := client.Chat(context.Background(), []Message{{Role: "user", Content: "hi"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !strings.Contains(err.Error(), "longer than the 1s limit") {
+		t.Errorf("expected the rate limit error, got %v", err)
+	}
+	if *calls != 1 {
+		t.Errorf("should give up without retrying, got %d calls", *calls)
+	}
+}
+
+// flakyStream is a provider whose first streams fail before sending a chunk.
+type flakyStream struct {
+	failures int
+	calls    int
+}
+
+func (p *flakyStream) Chat(ctx context.Context, messages []Message) (*ChatResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *flakyStream) ChatWithTools(ctx context.Context, messages []Message, tools []ToolDef) (*ChatResponse, error) {
+	return nil, errors.New("not implemented")
+}
+
+func (p *flakyStream) ChatStream(ctx context.Context, messages []Message) (<-chan ChatResponse, <-chan error) {
+	return p.ChatStreamWithTools(ctx, messages, nil)
+}
+
+func (p *flakyStream) ChatStreamWithTools(ctx context.Context, messages []Message, tools []ToolDef) (<-chan ChatResponse, <-chan error) {
+	p.calls++
+	chunks := make(chan ChatResponse, 1)
+	errs := make(chan error, 1)
+	if p.calls <= p.failures {
+		errs <- &APIError{StatusCode: 529, Message: "overloaded"}
+	} else {
+		var chunk ChatResponse
+		chunk.Choices = append(chunk.Choices, struct {
+			Index        int     `json:"index"`
+			Message      Message `json:"message"`
+			Delta        Message `json:"delta"`
+			FinishReason string  `json:"finish_reason"`
+		}{Delta: Message{Content: "ok"}, FinishReason: "stop"})
+		chunks <- chunk
+		errs <- nil
+	}
+	close(chunks)
+	close(errs)
+	return chunks, errs
+}
+
+func TestRetryableClient_StreamRetriesBeforeFirstChunk(t *testing.T) {
+	inner := &flakyStream{failures: 2}
+	client := NewRetryableClient(inner, testRetryConfig(), nil)
+
+	var events []RetryEvent
+	ctx := WithRetryNotifier(context.Background(), func(e RetryEvent) {
+		events = append(events, e)
+	})
+	chunks, errs := client.ChatStream(ctx, []Message{{Role: "user", Content: "hi"}})
+	acc := NewStreamAccumulator()
+	for chunk := range chunks {
+		acc.Add(chunk)
+	}
+	if err := <-errs; err != nil {
+		t.Fatalf("stream failed: %v", err)
+	}
+	if acc.Message().Content != "ok" || inner.calls != 3 {
+		t.Errorf("expected %q after 3 calls, got %q after %d", "ok", acc.Message().Content, inner.calls)
+	}
+	if len(events) != 2 || events[1].Attempt != 2 || events[1].Reason() != "overloaded" {
+		t.Errorf("unexpected retry events: %+v", events)
+	}
+}
+
+func TestRetryableClient_RateLimiterNotifies(t *testing.T) {
+	inner, calls := retryServer(t, 0, nil)
+	client := NewRetryableClient(inner, testRetryConfig(), nil)
+	limiter := NewRateLimiter(1, 0)
+	limiter.requests.available = 0 // The next request waits a minute
+	client.SetRateLimiter(limiter)
+
+	// Give up once told about the wait
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var events []RetryEvent
+	ctx = WithRetryNotifier(ctx, func(e RetryEvent) {
+		events = append(events, e)
+		cancel()
+	})
+	if _, err := client.Chat(ctx, []Message{{Role: "user", Content: "hi"}}); !errors.Is(err, context.Canceled) {
+		t.Fatalf("expected the wait to be cancelled, got %v", err)
+	}
+	if len(events) != 1 || events[0].Attempt != 0 || events[0].Wait < 59*time.Second ||
+		events[0].Reason() != "client rate limit reached" {
+		t.Errorf("unexpected events: %+v", events)
+	}
+	if *calls != 0 || limiter.requests.available < 0 {
+		t.Errorf("a cancelled request should be refunded without being sent: %d calls, %v available",
+			*calls, limiter.requests.available)
+	}
+}
@@ -389,6 +389,11 @@ func TestIsRetryableError(t *testing.T) {
 			err:      &APIError{StatusCode: 404, Message: "not found"},
 			expected: false,
 		},
+		{
+			name:     "non-retryable safety block",
+			err:      &SafetyError{Reason: "SAFETY"},
+			expected: false,
+		},
 		{
 			name:     "generic error",
 			err:      errors.New("some error"),
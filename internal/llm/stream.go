@@ -0,0 +1,101 @@
+package llm
+
+import "sort"
+
+// StreamAccumulator assembles streaming chunks into a complete assistant message.
+// Tool calls arrive as fragments keyed by index: the first fragment carries the
+// id and function name, later fragments append to the arguments.
+type StreamAccumulator struct {
+	content      []byte
+	toolCalls    map[int]*ToolCallInfo
+	finishReason string
+	usage        Usage
+}
+
+// NewStreamAccumulator creates an empty accumulator.
+func NewStreamAccumulator() *StreamAccumulator {
+	return &StreamAccumulator{
+		toolCalls: make(map[int]*ToolCallInfo),
+	}
+}
+
+// Add merges a streaming chunk and returns the text delta it carried, if any.
+func (a *StreamAccumulator) Add(chunk ChatResponse) string {
+	if chunk.Usage.TotalTokens > 0 || chunk.Usage.PromptTokens > 0 {
+		a.usage = chunk.Usage
+	}
+	if len(chunk.Choices) == 0 {
+		return ""
+	}
+
+	choice := chunk.Choices[0]
+	delta := choice.Delta
+	a.content = append(a.content, delta.Content...)
+
+	for _, tc := range delta.ToolCalls {
+		// Providers that omit the index send complete calls in order
+		index := len(a.toolCalls)
+		if tc.Index != nil {
+			index = *tc.Index
+		}
+
+		call, ok := a.toolCalls[index]
+		if !ok {
+			call = &ToolCallInfo{Type: "function"}
+			a.toolCalls[index] = call
+		}
+		if tc.ID != "" {
+			call.ID = tc.ID
+		}
+		if tc.Type != "" {
+			call.Type = tc.Type
+		}
+		if tc.Function.Name != "" {
+			call.Function.Name = tc.Function.Name
+		}
+		call.Function.Arguments += tc.Function.Arguments
+	}
+
+	if choice.FinishReason != "" {
+		a.finishReason = choice.FinishReason
+	}
+	return delta.Content
+}
+
+// Content returns the text accumulated so far.
+func (a *StreamAccumulator) Content() string {
+	return string(a.content)
+}
+
+// FinishReason returns the finish reason of the stream, if one was received.
+func (a *StreamAccumulator) FinishReason() string {
+	return a.finishReason
+}
+
+// Usage returns the token usage reported by the stream, if any.
+func (a *StreamAccumulator) Usage() Usage {
+	return a.usage
+}
+
+// Message returns the assistant message assembled from all chunks.
+func (a *StreamAccumulator) Message() Message {
+	msg := Message{
+		Role:    "assistant",
+		Content: string(a.content),
+	}
+	if len(a.toolCalls) == 0 {
+		return msg
+	}
+
+	indices := make([]int, 0, len(a.toolCalls))
+	for index := range a.toolCalls {
+		indices = append(indices, index)
+	}
+	sort.Ints(indices)
+
+	msg.ToolCalls = make([]ToolCallInfo, 0, len(indices))
+	for _, index := range indices {
+		msg.ToolCalls = append(msg.ToolCalls, *a.toolCalls[index])
+	}
+	return msg
+}
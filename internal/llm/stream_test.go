@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func parseChunk(t *testing.T, data string) ChatResponse {
+	t.Helper()
+	var chunk ChatResponse
+	if err := json.Unmarshal([]byte(data), &chunk); err != nil {
+		t.Fatalf("invalid chunk %s: %v", data, err)
+	}
+	return chunk
+}
+
+func TestStreamAccumulator_Text(t *testing.T) {
+	acc := NewStreamAccumulator()
+	for _, data := range []string{
+		`{"choices":[{"delta":{"role":"assistant","content":"Hel"}}]}`,
+		`{"choices":[{"delta":{"content":"lo"}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"stop"}]}`,
+	} {
+		acc.Add(parseChunk(t, data))
+	}
+
+	msg := acc.Message()
+	if msg.Role != "assistant" || msg.Content != "Hello" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	if len(msg.ToolCalls) != 0 {
+		t.Errorf("expected no tool calls, got %d", len(msg.ToolCalls))
+	}
+	if acc.FinishReason() != "stop" {
+		t.Errorf("expected finish reason 'stop', got %q", acc.FinishReason())
+	}
+}
+
+func TestStreamAccumulator_ReturnsTextDelta(t *testing.T) {
+	acc := NewStreamAccumulator()
+	if got := acc.Add(parseChunk(t, `{"choices":[{"delta":{"content":"abc"}}]}`)); got != "abc" {
+		t.Errorf("expected delta 'abc', got %q", got)
+	}
+	if got := acc.Add(parseChunk(t, `{"choices":[]}`)); got != "" {
+		t.Errorf("expected empty delta, got %q", got)
+	}
+}
+
+func TestStreamAccumulator_ToolCallFragments(t *testing.T) {
+	acc := NewStreamAccumulator()
+	for _, data := range []string{
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_b","type":"function","function":{"name":"file","arguments":""}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_a","type":"function","function":{"name":"shell","arguments":"{\"comm"}}]}}]}`,
+		`{"choices":[{"delta":{"content":"working"}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":1,"function":{"arguments":"{\"path\":\"a\"}"}}]}}]}`,
+		`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"and\":\"ls\"}"}}]}}]}`,
+		`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+	} {
+		acc.Add(parseChunk(t, data))
+	}
+
+	msg := acc.Message()
+	if msg.Content != "working" {
+		t.Errorf("expected content 'working', got %q", msg.Content)
+	}
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(msg.ToolCalls))
+	}
+
+	first, second := msg.ToolCalls[0], msg.ToolCalls[1]
+	if first.ID != "call_a" || first.Function.Name != "shell" || first.Function.Arguments != `{"command":"ls"}` {
+		t.Errorf("unexpected first call: %+v", first)
+	}
+	if second.ID != "call_b" || second.Function.Name != "file" || second.Function.Arguments != `{"path":"a"}` {
+		t.Errorf("unexpected second call: %+v", second)
+	}
+	if first.Index != nil || second.Index != nil {
+		t.Error("assembled tool calls should not carry stream indices")
+	}
+}
+
+func TestStreamAccumulator_ToolCallsWithoutIndex(t *testing.T) {
+	acc := NewStreamAccumulator()
+	acc.Add(parseChunk(t, `{"choices":[{"delta":{"tool_calls":[
+		{"id":"call_1","type":"function","function":{"name":"shell","arguments":"{}"}},
+		{"id":"call_2","type":"function","function":{"name":"file","arguments":"{}"}}
+	]}}]}`))
+
+	msg := acc.Message()
+	if len(msg.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(msg.ToolCalls))
+	}
+	if msg.ToolCalls[0].ID != "call_1" || msg.ToolCalls[1].ID != "call_2" {
+		t.Errorf("tool calls should keep their order: %+v", msg.ToolCalls)
+	}
+}
+
+func TestStreamAccumulator_Usage(t *testing.T) {
+	acc := NewStreamAccumulator()
+	acc.Add(parseChunk(t, `{"choices":[{"delta":{"content":"x"}}]}`))
+	acc.Add(parseChunk(t, `{"choices":[],"usage":{"prompt_tokens":10,"completion_tokens":2,"total_tokens":12}}`))
+
+	if acc.Usage().TotalTokens != 12 {
+		t.Errorf("expected usage total 12, got %+v", acc.Usage())
+	}
+}
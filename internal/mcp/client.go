@@ -0,0 +1,311 @@
+package mcp
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultTimeout bounds each request to a server unless configured otherwise.
+const DefaultTimeout = 60 * time.Second
+
+// clientInfo identifies this client to servers.
+var clientInfo = Implementation{Name: "kimi-go", Version: "0.1.0"}
+
+// ServerConfig describes how to reach a server: a command to run with the
+// stdio transport, or the URL of a streamable HTTP endpoint.
+type ServerConfig struct {
+	Command string
+	Args    []string
+	Env     map[string]string // Added to the environment of the command
+	Dir     string            // Working directory of the command
+
+	URL     string
+	Headers map[string]string // Sent with every HTTP request
+
+	Timeout time.Duration // Per request; zero means DefaultTimeout
+}
+
+// transport carries JSON-RPC messages to and from a server.
+type transport interface {
+	// call sends a request and waits for its response.
+	call(ctx context.Context, req *Request) (*Response, error)
+	// notify sends a notification.
+	notify(ctx context.Context, req *Request) error
+	// done is closed when the connection to the server is lost, after which
+	// err reports why. It is nil for transports that cannot be lost.
+	done() <-chan struct{}
+	err() error
+	close() error
+}
+
+// Client is a connection to an MCP server. A stdio server that crashes is
+// started again on the next call.
+type Client struct {
+	name    string
+	cfg     ServerConfig
+	nextID  atomic.Int64
+	mu      sync.Mutex // Guards t and info, and serializes reconnects
+	t       transport
+	info    InitializeResult
+	tools   []ToolInfo
+	closed  bool
+	timeout time.Duration
+}
+
+// Connect starts or connects to the server, runs the initialize handshake
+// and lists its tools.
+func Connect(ctx context.Context, name string, cfg ServerConfig) (*Client, error) {
+	if (cfg.Command == "") == (cfg.URL == "") {
+		return nil, fmt.Errorf("MCP server %s: exactly one of command and url must be set", name)
+	}
+	c := &Client{name: name, cfg: cfg, timeout: cfg.Timeout}
+	if c.timeout <= 0 {
+		c.timeout = DefaultTimeout
+	}
+
+	c.mu.Lock()
+	_, err := c.connect(ctx)
+	c.mu.Unlock()
+	if err != nil {
+		return nil, fmt.Errorf("MCP server %s: %w", name, err)
+	}
+	if err := c.listTools(ctx); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("MCP server %s: list tools: %w", name, err)
+	}
+	return c, nil
+}
+
+// ConnectAll connects to the servers concurrently. It returns the clients in
+// name order, and the errors of the servers that failed.
+func ConnectAll(ctx context.Context, servers map[string]ServerConfig) ([]*Client, []error) {
+	var (
+		mu      sync.Mutex
+		wg      sync.WaitGroup
+		clients []*Client
+		errs    []error
+	)
+	for name, cfg := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			c, err := Connect(ctx, name, cfg)
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, err)
+			} else {
+				clients = append(clients, c)
+			}
+		}()
+	}
+	wg.Wait()
+	sort.Slice(clients, func(i, j int) bool { return clients[i].name < clients[j].name })
+	sort.Slice(errs, func(i, j int) bool { return errs[i].Error() < errs[j].Error() })
+	return clients, errs
+}
+
+// connect returns the transport, first connecting when there is none or the
+// server has crashed. c.mu must be held.
+func (c *Client) connect(ctx context.Context) (transport, error) {
+	if c.closed {
+		return nil, errors.New("client is closed")
+	}
+	if c.t != nil {
+		select {
+		case <-c.t.done():
+			c.t = nil
+		default:
+			return c.t, nil
+		}
+	}
+
+	var t transport
+	if c.cfg.Command != "" {
+		st, err := startStdio(c.cfg)
+		if err != nil {
+			return nil, fmt.Errorf("start %s: %w", c.cfg.Command, err)
+		}
+		t = st
+	} else {
+		t = newHTTP(c.cfg)
+	}
+
+	var info InitializeResult
+	err := c.request(ctx, t, "initialize", InitializeParams{
+		ProtocolVersion: ProtocolVersion,
+		Capabilities:    map[string]any{},
+		ClientInfo:      clientInfo,
+	}, &info)
+	if err == nil {
+		var n *Request
+		if n, err = newRequest(nil, "notifications/initialized", nil); err == nil {
+			err = t.notify(ctx, n)
+		}
+	}
+	if err != nil {
+		t.close()
+		return nil, fmt.Errorf("initialize: %w", err)
+	}
+	c.t, c.info = t, info
+	return t, nil
+}
+
+// reset drops the transport t, so the next call connects again.
+func (c *Client) reset(t transport) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.t == t {
+		c.t = nil
+		go t.close()
+	}
+}
+
+// request sends a request over t and decodes its result into result. It
+// gives up after the client's timeout, telling the server to cancel.
+func (c *Client) request(ctx context.Context, t transport, method string, params, result any) error {
+	id := c.nextID.Add(1)
+	req, err := newRequest(&id, method, params)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.timeout)
+	defer cancel()
+
+	resp, err := t.call(ctx, req)
+	if err != nil {
+		if ctx.Err() != nil {
+			c.cancelRequest(t, id, ctx.Err())
+		}
+		if errors.Is(err, context.DeadlineExceeded) {
+			return fmt.Errorf("%s timed out after %s", method, c.timeout)
+		}
+		return err
+	}
+	if resp.Error != nil {
+		return resp.Error
+	}
+	if result == nil {
+		return nil
+	}
+	if err := json.Unmarshal(resp.Result, result); err != nil {
+		return fmt.Errorf("invalid %s result: %w", method, err)
+	}
+	return nil
+}
+
+// cancelRequest tells the server a request was abandoned.
+func (c *Client) cancelRequest(t transport, id int64, reason error) {
+	n, err := newRequest(nil, "notifications/cancelled", map[string]any{
+		"requestId": id,
+		"reason":    reason.Error(),
+	})
+	if err != nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	_ = t.notify(ctx, n)
+}
+
+// listTools fetches every page of the server's tools.
+func (c *Client) listTools(ctx context.Context) error {
+	var all []ToolInfo
+	cursor := ""
+	for {
+		var params any
+		if cursor != "" {
+			params = map[string]string{"cursor": cursor}
+		}
+		var page ListToolsResult
+		if err := c.do(ctx, "tools/list", params, &page); err != nil {
+			return err
+		}
+		all = append(all, page.Tools...)
+		if page.NextCursor == "" || page.NextCursor == cursor {
+			break
+		}
+		cursor = page.NextCursor
+	}
+	c.tools = all
+	return nil
+}
+
+// do sends a request, connecting first if needed. A request the server
+// could not have processed, because its HTTP session expired, is sent again
+// on a new session.
+func (c *Client) do(ctx context.Context, method string, params, result any) error {
+	for attempt := 0; ; attempt++ {
+		c.mu.Lock()
+		t, err := c.connect(ctx)
+		c.mu.Unlock()
+		if err != nil {
+			return err
+		}
+
+		err = c.request(ctx, t, method, params, result)
+		switch {
+		case err == nil:
+			return nil
+		case errors.Is(err, errSessionExpired) && attempt == 0:
+			c.reset(t)
+			continue
+		}
+		select {
+		case <-t.done():
+			// The call may have had effects, so it is not repeated
+			c.reset(t)
+			return fmt.Errorf("%w; the server is restarted on the next call", err)
+		default:
+		}
+		return err
+	}
+}
+
+// CallTool calls a tool of the server.
+func (c *Client) CallTool(ctx context.Context, name string, args json.RawMessage) (*CallToolResult, error) {
+	var result CallToolResult
+	if err := c.do(ctx, "tools/call", CallToolParams{Name: name, Arguments: args}, &result); err != nil {
+		return nil, err
+	}
+	return &result, nil
+}
+
+// Name returns the server's name in the config.
+func (c *Client) Name() string {
+	return c.name
+}
+
+// ServerInfo returns what the server reported about itself when the client
+// last connected.
+func (c *Client) ServerInfo() InitializeResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.info
+}
+
+// ToolInfos returns the tools the server listed when the client connected.
+func (c *Client) ToolInfos() []ToolInfo {
+	return c.tools
+}
+
+// Close disconnects from the server, stopping it if the client started it.
+func (c *Client) Close() error {
+	c.mu.Lock()
+	c.closed = true
+	t := c.t
+	c.t = nil
+	c.mu.Unlock()
+
+	// Stopping a server takes a while; other calls fail right away meanwhile
+	if t == nil {
+		return nil
+	}
+	return t.close()
+}
@@ -0,0 +1,280 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"image"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeServerEnv makes the test binary run fakeServer on stdin and stdout.
+// With "detached" it first starts a child in another session that holds
+// stdout open.
+const fakeServerEnv = "KIMI_FAKE_MCP_SERVER"
+
+func TestMain(m *testing.M) {
+	if mode := os.Getenv(fakeServerEnv); mode != "" {
+		if mode == "detached" {
+			child := exec.Command("setsid", "sleep", "5")
+			child.Stdout = os.Stdout
+			child.Start()
+		}
+		w := bufio.NewWriter(os.Stdout)
+		sc := bufio.NewScanner(os.Stdin)
+		for sc.Scan() {
+			var req Request
+			if json.Unmarshal(sc.Bytes(), &req) != nil {
+				continue
+			}
+			if req.Method == "tools/call" && strings.Contains(string(req.Params), `"crash"`) {
+				fmt.Fprintln(os.Stderr, "fake server crashed")
+				os.Exit(3)
+			}
+			if resp := fakeServer(req); resp != nil {
+				data, _ := json.Marshal(resp)
+				w.Write(append(data, '\n'))
+				w.Flush()
+			}
+		}
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeServer answers a request like an MCP server with the tools echo,
+// fail, sleep and image, listed on two pages. Notifications and sleep get
+// no response.
+func fakeServer(req Request) *Response {
+	if req.ID == nil {
+		return nil
+	}
+	resp := &Response{JSONRPC: "2.0", ID: *req.ID}
+	var result any
+	switch req.Method {
+	case "initialize":
+		result = InitializeResult{
+			ProtocolVersion: ProtocolVersion,
+			ServerInfo:      Implementation{Name: "fake", Version: "1"},
+			Instructions:    "Use echo to repeat things.",
+		}
+	case "tools/list":
+		schema := json.RawMessage(`{"type": "object", "properties": {"text": {"type": "string"}}}`)
+		if strings.Contains(string(req.Params), "page2") {
+			result = ListToolsResult{Tools: []ToolInfo{{Name: "sleep"}, {Name: "image"}, {Name: "crash"}}}
+		} else {
+			result = ListToolsResult{
+				Tools:      []ToolInfo{{Name: "echo", Description: "Repeat text", InputSchema: schema}, {Name: "fail"}},
+				NextCursor: "page2",
+			}
+		}
+	case "tools/call":
+		var params struct {
+			Name      string `json:"name"`
+			Arguments struct {
+				Text string `json:"text"`
+			} `json:"arguments"`
+		}
+		json.Unmarshal(req.Params, &params)
+		switch params.Name {
+		case "echo":
+			result = CallToolResult{Content: []Content{{Type: "text", Text: "echo: " + params.Arguments.Text}}}
+		case "fail":
+			result = CallToolResult{Content: []Content{{Type: "text", Text: "no such thing"}}, IsError: true}
+		case "image":
+			var buf bytes.Buffer
+			png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 2)))
+			result = CallToolResult{Content: []Content{
+				{Type: "text", Text: "a picture"},
+				{Type: "image", MimeType: "image/png", Data: base64.StdEncoding.EncodeToString(buf.Bytes())},
+			}}
+		case "sleep":
+			return nil
+		default:
+			resp.Error = &RPCError{Code: CodeInvalidParams, Message: "unknown tool " + params.Name}
+			return resp
+		}
+	default:
+		resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not found"}
+		return resp
+	}
+	resp.Result, _ = json.Marshal(result)
+	return resp
+}
+
+// callTool runs the registered tool with the given name.
+func callTool(t *testing.T, c *Client, name, args string) CallResult {
+	t.Helper()
+	for _, tool := range c.Tools() {
+		if tool.Name() == ToolName(c.Name(), name) {
+			result, err := tool.Execute(context.Background(), json.RawMessage(args))
+			if err != nil {
+				t.Fatalf("Execute(%s) failed: %v", name, err)
+			}
+			return result.(CallResult)
+		}
+	}
+	t.Fatalf("tool %s not registered", name)
+	return CallResult{}
+}
+
+func TestClient_Stdio(t *testing.T) {
+	c, err := Connect(context.Background(), "fake", ServerConfig{
+		Command: os.Args[0],
+		Env:     map[string]string{fakeServerEnv: "1"},
+		Timeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	if n := len(c.ToolInfos()); n != 5 {
+		t.Fatalf("expected 5 tools from both pages, got %d", n)
+	}
+	if c.ServerInfo().Instructions == "" {
+		t.Error("the server's instructions should be kept")
+	}
+	tool := c.Tools()[0]
+	if tool.Name() != "mcp__fake__echo" || !strings.Contains(string(tool.Parameters()), `"text"`) {
+		t.Errorf("unexpected tool %s %s", tool.Name(), tool.Parameters())
+	}
+
+	if r := callTool(t, c, "echo", `{"text": "hi"}`); !r.Success || r.ModelText() != "echo: hi" {
+		t.Errorf("unexpected echo result: %+v", r)
+	}
+	if r := callTool(t, c, "fail", `{}`); r.Success || r.Error != "no such thing" {
+		t.Errorf("a tool error should fail the call: %+v", r)
+	}
+	if r := callTool(t, c, "image", `{}`); !r.Success || len(r.Images()) != 1 || r.Images()[0].Width != 4 {
+		t.Errorf("the image should be passed on: %+v", r)
+	}
+	if r := callTool(t, c, "sleep", `{}`); r.Success || !strings.Contains(r.Error, "timed out") {
+		t.Errorf("the call should time out: %+v", r)
+	}
+
+	r := callTool(t, c, "crash", `{}`)
+	if r.Success || !strings.Contains(r.Error, "exit status 3") || !strings.Contains(r.Error, "fake server crashed") {
+		t.Errorf("the crash should be reported with stderr: %+v", r)
+	}
+	if r := callTool(t, c, "echo", `{"text": "again"}`); !r.Success || r.Content != "echo: again" {
+		t.Errorf("the server should be restarted after a crash: %+v", r)
+	}
+}
+
+func TestClient_Stdio_DetachedChild(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid not available")
+	}
+	c, err := Connect(context.Background(), "fake", ServerConfig{
+		Command: os.Args[0],
+		Env:     map[string]string{fakeServerEnv: "detached"},
+		Timeout: 500 * time.Millisecond,
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	if r := callTool(t, c, "echo", `{"text": "hi"}`); !r.Success {
+		t.Fatalf("unexpected echo result: %+v", r)
+	}
+
+	// The child keeps stdout open after the server exits
+	start := time.Now()
+	c.Close()
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("Close took %v", elapsed)
+	}
+}
+
+func TestClient_HTTP(t *testing.T) {
+	var (
+		mu       sync.Mutex
+		sessions = map[string]bool{}
+		nextID   int
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer token" {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+		var req Request
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		defer mu.Unlock()
+		if req.Method == "initialize" {
+			nextID++
+			id := fmt.Sprint(nextID)
+			sessions[id] = true
+			w.Header().Set(sessionHeader, id)
+		} else if !sessions[r.Header.Get(sessionHeader)] {
+			http.Error(w, "unknown session", http.StatusNotFound)
+			return
+		}
+
+		resp := fakeServer(req)
+		if resp == nil {
+			w.WriteHeader(http.StatusAccepted)
+			return
+		}
+		data, _ := json.Marshal(resp)
+		if req.Method != "tools/call" {
+			w.Header().Set("Content-Type", "application/json")
+			w.Write(data)
+			return
+		}
+		// Tool calls answer on an event stream, after a notification
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprintf(w, "event: message\ndata: {\"jsonrpc\":\"2.0\",\"method\":\"notifications/progress\"}\n\n")
+		fmt.Fprintf(w, "event: message\ndata: %s\n\n", data)
+	}))
+	defer server.Close()
+
+	c, err := Connect(context.Background(), "remote", ServerConfig{
+		URL:     server.URL,
+		Headers: map[string]string{"Authorization": "Bearer token"},
+	})
+	if err != nil {
+		t.Fatalf("Connect failed: %v", err)
+	}
+	defer c.Close()
+
+	if r := callTool(t, c, "echo", `{"text": "hi"}`); !r.Success || r.Content != "echo: hi" {
+		t.Errorf("unexpected echo result: %+v", r)
+	}
+
+	// An expired session is replaced and the call sent again
+	mu.Lock()
+	clear(sessions)
+	mu.Unlock()
+	if r := callTool(t, c, "echo", `{"text": "again"}`); !r.Success || r.Content != "echo: again" {
+		t.Errorf("the call should succeed on a new session: %+v", r)
+	}
+	if nextID != 2 {
+		t.Errorf("expected a second session, got %d", nextID)
+	}
+
+	if _, err := Connect(context.Background(), "remote", ServerConfig{URL: server.URL}); err == nil ||
+		!strings.Contains(err.Error(), "HTTP 401") {
+		t.Errorf("a rejected connection should fail, got %v", err)
+	}
+}
+
+func TestToolName(t *testing.T) {
+	if name := ToolName("my server", "get.file"); name != "mcp__my_server__get_file" {
+		t.Errorf("unexpected name %q", name)
+	}
+	if name := ToolName("s", strings.Repeat("x", 100)); len(name) != maxToolName {
+		t.Errorf("long names should be cut to %d characters, got %d", maxToolName, len(name))
+	}
+}
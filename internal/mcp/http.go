@@ -0,0 +1,176 @@
+package mcp
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// sessionHeader carries the session ID of the streamable HTTP transport.
+const sessionHeader = "Mcp-Session-Id"
+
+// errSessionExpired is returned when the server no longer knows the session;
+// the client connects again.
+var errSessionExpired = errors.New("MCP session expired")
+
+// httpTransport talks to a server over the streamable HTTP transport: every
+// message is POSTed, and the server answers with JSON or an event stream.
+type httpTransport struct {
+	url     string
+	headers map[string]string
+	client  *http.Client
+
+	mu        sync.Mutex
+	sessionID string
+}
+
+// newHTTP creates the transport for the server at cfg.URL.
+func newHTTP(cfg ServerConfig) *httpTransport {
+	return &httpTransport{url: cfg.URL, headers: cfg.Headers, client: &http.Client{}}
+}
+
+// post sends a message and returns the server's reply.
+func (t *httpTransport) post(ctx context.Context, req *Request) (*http.Response, error) {
+	data, err := json.Marshal(req)
+	if err != nil {
+		return nil, err
+	}
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, t.url, bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+	httpReq.Header.Set("Accept", "application/json, text/event-stream")
+	t.setHeaders(httpReq)
+
+	resp, err := t.client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	if id := resp.Header.Get(sessionHeader); id != "" {
+		t.mu.Lock()
+		t.sessionID = id
+		t.mu.Unlock()
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound && httpReq.Header.Get(sessionHeader) != "":
+		resp.Body.Close()
+		return nil, errSessionExpired
+	case resp.StatusCode >= 300:
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		resp.Body.Close()
+		return nil, fmt.Errorf("HTTP %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return resp, nil
+}
+
+// setHeaders adds the configured headers and the session ID.
+func (t *httpTransport) setHeaders(req *http.Request) {
+	for k, v := range t.headers {
+		req.Header.Set(k, v)
+	}
+	t.mu.Lock()
+	if t.sessionID != "" {
+		req.Header.Set(sessionHeader, t.sessionID)
+	}
+	t.mu.Unlock()
+}
+
+func (t *httpTransport) call(ctx context.Context, req *Request) (*Response, error) {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if mediaType != "text/event-stream" {
+		var r Response
+		if err := json.NewDecoder(resp.Body).Decode(&r); err != nil {
+			return nil, fmt.Errorf("invalid response: %w", err)
+		}
+		return &r, nil
+	}
+
+	// The stream may carry requests and notifications before the response
+	id := string(*req.ID)
+	var data strings.Builder
+	sc := bufio.NewScanner(resp.Body)
+	sc.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for {
+		more, line := sc.Scan(), ""
+		if more {
+			line = sc.Text()
+		}
+		if value, ok := strings.CutPrefix(line, "data:"); ok {
+			data.WriteString(strings.TrimPrefix(value, " "))
+			continue
+		}
+		// A blank line, or the end of the stream, ends an event
+		if (line == "" || !more) && data.Len() > 0 {
+			var r Response
+			if err := json.Unmarshal([]byte(data.String()), &r); err == nil && string(r.ID) == id {
+				return &r, nil
+			}
+			data.Reset()
+		}
+		if !more {
+			break
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("the event stream ended without a response")
+}
+
+func (t *httpTransport) notify(ctx context.Context, req *Request) error {
+	resp, err := t.post(ctx, req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
+
+// done returns nil: requests fail one at a time, there is no connection to
+// lose.
+func (t *httpTransport) done() <-chan struct{} {
+	return nil
+}
+
+func (t *httpTransport) err() error {
+	return nil
+}
+
+// close ends the session, if the server started one.
+func (t *httpTransport) close() error {
+	t.mu.Lock()
+	id := t.sessionID
+	t.mu.Unlock()
+	if id == "" {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	req, err := http.NewRequestWithContext(ctx, http.MethodDelete, t.url, nil)
+	if err != nil {
+		return err
+	}
+	t.setHeaders(req)
+	resp, err := t.client.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	return nil
+}
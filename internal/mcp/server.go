@@ -0,0 +1,383 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"kimi-go/internal/tools"
+	"kimi-go/internal/wire"
+)
+
+// supportedVersions are the MCP revisions the server accepts, newest first.
+var supportedVersions = []string{"2025-06-18", ProtocolVersion, "2024-11-05"}
+
+// Server serves a tool set to an MCP client over stdio. Calls are approved
+// like in the CLI: read-only calls run right away, and other calls need
+// YOLO, an earlier approval for the session, or the user's consent, which
+// is asked for through the client's elicitation support.
+type Server struct {
+	tools        *tools.ToolSet
+	YOLO         bool
+	Instructions string // Sent to the client on initialize
+
+	w       io.Writer
+	eof     chan struct{} // Closed when the client stops sending
+	writeMu sync.Mutex
+	nextID  atomic.Int64
+	calls   sync.WaitGroup
+
+	mu       sync.Mutex
+	running  map[string]context.CancelFunc // Tool calls by request ID
+	pending  map[string]chan *Response     // Requests to the client by ID
+	approved map[string]bool               // Actions approved for the session
+	elicit   bool                          // The client can ask the user
+}
+
+// NewServer creates a server for the tools of ts.
+func NewServer(ts *tools.ToolSet) *Server {
+	return &Server{
+		tools:    ts,
+		running:  make(map[string]context.CancelFunc),
+		pending:  make(map[string]chan *Response),
+		approved: make(map[string]bool),
+	}
+}
+
+// incoming is any message read from the client.
+type incoming struct {
+	ID     json.RawMessage `json:"id,omitempty"`
+	Method string          `json:"method,omitempty"`
+	Params json.RawMessage `json:"params,omitempty"`
+	Result json.RawMessage `json:"result,omitempty"`
+	Error  *RPCError       `json:"error,omitempty"`
+}
+
+// Serve reads messages from r and writes replies to w until r ends or ctx
+// is cancelled. Tool calls run concurrently. When r ends, the calls still
+// running are finished and answered; when ctx is cancelled, they are
+// cancelled.
+func (s *Server) Serve(ctx context.Context, r io.Reader, w io.Writer) error {
+	s.w = w
+	s.eof = make(chan struct{})
+	ctx, cancel := context.WithCancel(ctx)
+	defer func() {
+		close(s.eof) // The client can no longer answer questions
+		s.calls.Wait()
+		cancel()
+	}()
+
+	lines := make(chan []byte)
+	readErr := make(chan error, 1)
+	go func() {
+		sc := bufio.NewScanner(r)
+		sc.Buffer(make([]byte, 64*1024), maxMessageSize)
+		for sc.Scan() {
+			select {
+			case lines <- append([]byte(nil), sc.Bytes()...):
+			case <-ctx.Done():
+				return
+			}
+		}
+		readErr <- sc.Err()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-readErr:
+			return err
+		case line := <-lines:
+			s.handle(ctx, line)
+		}
+	}
+}
+
+// handle dispatches one message.
+func (s *Server) handle(ctx context.Context, line []byte) {
+	var msg incoming
+	if err := json.Unmarshal(line, &msg); err != nil {
+		s.reply(json.RawMessage("null"), nil, &RPCError{Code: CodeParseError, Message: err.Error()})
+		return
+	}
+	switch {
+	case msg.Method == "" && msg.ID != nil:
+		s.mu.Lock()
+		ch := s.pending[string(msg.ID)]
+		delete(s.pending, string(msg.ID))
+		s.mu.Unlock()
+		if ch != nil {
+			ch <- &Response{ID: msg.ID, Result: msg.Result, Error: msg.Error}
+		}
+	case msg.ID == nil:
+		s.notification(msg)
+	case msg.Method == "tools/call":
+		callCtx, cancel := context.WithCancel(ctx)
+		s.mu.Lock()
+		s.running[string(msg.ID)] = cancel
+		s.mu.Unlock()
+		s.calls.Add(1)
+		go func() {
+			defer s.calls.Done()
+			result, err := s.callTool(callCtx, msg.Params)
+			s.mu.Lock()
+			delete(s.running, string(msg.ID))
+			s.mu.Unlock()
+			// Cancelled requests get no response
+			if callCtx.Err() == nil {
+				s.reply(msg.ID, result, err)
+			}
+			cancel()
+		}()
+	default:
+		result, err := s.request(msg)
+		s.reply(msg.ID, result, err)
+	}
+}
+
+// notification handles a notification from the client.
+func (s *Server) notification(msg incoming) {
+	if msg.Method != "notifications/cancelled" {
+		return
+	}
+	var params struct {
+		RequestID json.RawMessage `json:"requestId"`
+	}
+	if json.Unmarshal(msg.Params, &params) != nil {
+		return
+	}
+	s.mu.Lock()
+	cancel := s.running[string(params.RequestID)]
+	s.mu.Unlock()
+	if cancel != nil {
+		cancel()
+	}
+}
+
+// request answers the requests other than tool calls.
+func (s *Server) request(msg incoming) (any, *RPCError) {
+	switch msg.Method {
+	case "initialize":
+		var params InitializeParams
+		if err := json.Unmarshal(msg.Params, &params); err != nil {
+			return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+		}
+		version := ProtocolVersion
+		if slices.Contains(supportedVersions, params.ProtocolVersion) {
+			version = params.ProtocolVersion
+		}
+		_, elicit := params.Capabilities["elicitation"]
+		s.mu.Lock()
+		s.elicit = elicit
+		s.mu.Unlock()
+		return InitializeResult{
+			ProtocolVersion: version,
+			Capabilities:    map[string]any{"tools": map[string]any{}},
+			ServerInfo:      clientInfo,
+			Instructions:    s.Instructions,
+		}, nil
+	case "ping":
+		return struct{}{}, nil
+	case "tools/list":
+		list := s.tools.List()
+		sort.Slice(list, func(i, j int) bool { return list[i].Name() < list[j].Name() })
+		result := ListToolsResult{Tools: make([]ToolInfo, len(list))}
+		for i, tool := range list {
+			result.Tools[i] = ToolInfo{Name: tool.Name(), Description: tool.Description(), InputSchema: tool.Parameters()}
+		}
+		return result, nil
+	}
+	return nil, &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+}
+
+// callTool runs a tool call once it is approved. Failures of the tool are
+// reported in the result; only unknown tools are protocol errors.
+func (s *Server) callTool(ctx context.Context, raw json.RawMessage) (any, *RPCError) {
+	var params CallToolParams
+	if err := json.Unmarshal(raw, &params); err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	tool, err := s.tools.Get(params.Name)
+	if err != nil {
+		return nil, &RPCError{Code: CodeInvalidParams, Message: err.Error()}
+	}
+	if len(params.Arguments) == 0 {
+		params.Arguments = json.RawMessage("{}")
+	}
+
+	if ok, reason := s.approve(ctx, tool, params.Arguments); !ok {
+		return errorResult("the call was not approved: " + reason), nil
+	}
+	v, err := tool.Execute(ctx, params.Arguments)
+	if err != nil {
+		return errorResult(err.Error()), nil
+	}
+	return toolResult(tool, v), nil
+}
+
+// approve decides whether a call may run.
+func (s *Server) approve(ctx context.Context, tool tools.Tool, args json.RawMessage) (bool, string) {
+	if s.YOLO {
+		return true, ""
+	}
+	action, description := tool.Name(), fmt.Sprintf("call tool `%s`", tool.Name())
+	if a, ok := tool.(tools.Approvable); ok {
+		var needed bool
+		action, description, needed = a.ApprovalAction(args)
+		if !needed {
+			return true, ""
+		}
+	}
+
+	s.mu.Lock()
+	approved, elicit := s.approved[action], s.elicit
+	s.mu.Unlock()
+	if approved {
+		return true, ""
+	}
+	if !elicit {
+		return false, "the client cannot ask the user; start the server with -yolo to allow such calls"
+	}
+
+	var answer struct {
+		Action  string `json:"action"`
+		Content struct {
+			Decision wire.ApprovalDecision `json:"decision"`
+		} `json:"content"`
+	}
+	err := s.ask(ctx, "elicitation/create", map[string]any{
+		"message": "kimi-go wants to " + description + ". Allow it?",
+		"requestedSchema": map[string]any{
+			"type": "object",
+			"properties": map[string]any{
+				"decision": map[string]any{
+					"type": "string",
+					"enum": []wire.ApprovalDecision{wire.ApprovalApprove, wire.ApprovalApproveForSession, wire.ApprovalReject},
+				},
+			},
+			"required": []string{"decision"},
+		},
+	}, &answer)
+	switch {
+	case err != nil:
+		return false, err.Error()
+	case answer.Action != "accept" || answer.Content.Decision == wire.ApprovalReject:
+		return false, "the user rejected the call"
+	case answer.Content.Decision == wire.ApprovalApproveForSession:
+		s.mu.Lock()
+		s.approved[action] = true
+		s.mu.Unlock()
+	}
+	return true, ""
+}
+
+// ask sends a request to the client and decodes its result.
+func (s *Server) ask(ctx context.Context, method string, params, result any) error {
+	id := s.nextID.Add(1)
+	req, err := newRequest(&id, method, params)
+	if err != nil {
+		return err
+	}
+	ch := make(chan *Response, 1)
+	s.mu.Lock()
+	s.pending[string(*req.ID)] = ch
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		delete(s.pending, string(*req.ID))
+		s.mu.Unlock()
+	}()
+
+	if err := s.write(req); err != nil {
+		return err
+	}
+	select {
+	case <-ctx.Done():
+		return errors.New("the call was cancelled")
+	case <-s.eof:
+		return errors.New("the client disconnected")
+	case resp := <-ch:
+		if resp.Error != nil {
+			return resp.Error
+		}
+		return json.Unmarshal(resp.Result, result)
+	}
+}
+
+// toolResult converts a tool's result like the CLI does for the model,
+// within the same output limits.
+func toolResult(tool tools.Tool, v any) CallToolResult {
+	limits := tools.DefaultOutputLimits
+	if l, ok := tool.(tools.OutputLimiter); ok {
+		limits = limits.Override(l.OutputLimits())
+	}
+	text, truncated := tools.TruncateOutput(tools.ResultText(v), limits)
+	if truncated {
+		text += "\n[Output truncated.]"
+	}
+
+	result := CallToolResult{Content: []Content{{Type: "text", Text: text}}, IsError: failed(v)}
+	if c, ok := v.(tools.ImageCarrier); ok {
+		for _, img := range c.Images() {
+			result.Content = append(result.Content, Content{
+				Type:     "image",
+				MimeType: img.MimeType,
+				Data:     base64.StdEncoding.EncodeToString(img.Data),
+			})
+		}
+	}
+	return result
+}
+
+// failed reports whether a tool result says it failed: results are structs
+// with a success field.
+func failed(v any) bool {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return false
+	}
+	var r struct {
+		Success *bool `json:"success"`
+	}
+	return json.Unmarshal(data, &r) == nil && r.Success != nil && !*r.Success
+}
+
+// errorResult is the result of a call that did not run or failed.
+func errorResult(text string) CallToolResult {
+	return CallToolResult{Content: []Content{{Type: "text", Text: text}}, IsError: true}
+}
+
+// reply sends the response to a request.
+func (s *Server) reply(id json.RawMessage, result any, rpcErr *RPCError) {
+	resp := Response{JSONRPC: "2.0", ID: id, Error: rpcErr}
+	if rpcErr == nil {
+		data, err := json.Marshal(result)
+		if err != nil {
+			resp.Error = &RPCError{Code: CodeInternalError, Message: err.Error()}
+		} else {
+			resp.Result = data
+		}
+	}
+	_ = s.write(resp)
+}
+
+// write sends one message.
+func (s *Server) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	s.writeMu.Lock()
+	defer s.writeMu.Unlock()
+	_, err = s.w.Write(append(data, '\n'))
+	return err
+}
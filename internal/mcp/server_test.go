@@ -0,0 +1,184 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"kimi-go/internal/tools"
+)
+
+// testSession is a client talking to a Server over pipes.
+type testSession struct {
+	t    *testing.T
+	in   *io.PipeWriter
+	out  *bufio.Scanner
+	done chan error
+}
+
+// startServer serves the file and shell tools of a work directory holding
+// a.txt, confined to it.
+func startServer(t *testing.T, yolo bool, capabilities string) (*testSession, string) {
+	t.Helper()
+	workDir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(workDir, "a.txt"), []byte("hello\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	ts := tools.NewToolSet()
+	ts.Register(tools.NewFileTool(workDir))
+	ts.Register(tools.NewShellTool(workDir, 0))
+	ts.SetWorkspacePolicy(&tools.WorkspacePolicy{})
+	server := NewServer(ts)
+	server.YOLO = yolo
+
+	inR, inW := io.Pipe()
+	outR, outW := io.Pipe()
+	s := &testSession{t: t, in: inW, out: bufio.NewScanner(outR), done: make(chan error, 1)}
+	go func() {
+		s.done <- server.Serve(context.Background(), inR, outW)
+		outW.Close()
+	}()
+	t.Cleanup(func() { inW.Close() })
+
+	s.send(`{"jsonrpc":"2.0","id":0,"method":"initialize","params":{"protocolVersion":"2025-06-18","capabilities":` +
+		capabilities + `,"clientInfo":{"name":"test","version":"1"}}}`)
+	if resp := s.read(); !strings.Contains(resp, `"protocolVersion":"2025-06-18"`) {
+		t.Fatalf("unexpected initialize response: %s", resp)
+	}
+	s.send(`{"jsonrpc":"2.0","method":"notifications/initialized"}`)
+	return s, workDir
+}
+
+func (s *testSession) send(line string) {
+	s.t.Helper()
+	if _, err := fmt.Fprintln(s.in, line); err != nil {
+		s.t.Fatalf("send failed: %v", err)
+	}
+}
+
+func (s *testSession) read() string {
+	s.t.Helper()
+	if !s.out.Scan() {
+		s.t.Fatal("the server closed its output")
+	}
+	return s.out.Text()
+}
+
+// call calls a tool and returns its result.
+func (s *testSession) call(id int, name, args string) CallToolResult {
+	s.t.Helper()
+	s.send(fmt.Sprintf(`{"jsonrpc":"2.0","id":%d,"method":"tools/call","params":{"name":%q,"arguments":%s}}`, id, name, args))
+	return s.result(s.read())
+}
+
+func (s *testSession) result(line string) CallToolResult {
+	s.t.Helper()
+	var resp struct {
+		Result CallToolResult `json:"result"`
+		Error  *RPCError      `json:"error"`
+	}
+	if err := json.Unmarshal([]byte(line), &resp); err != nil || resp.Error != nil {
+		s.t.Fatalf("unexpected response %s", line)
+	}
+	return resp.Result
+}
+
+func TestServer_ListAndCall(t *testing.T) {
+	s, workDir := startServer(t, false, `{}`)
+
+	s.send(`{"jsonrpc":"2.0","id":1,"method":"tools/list"}`)
+	var list struct {
+		Result ListToolsResult `json:"result"`
+	}
+	json.Unmarshal([]byte(s.read()), &list)
+	if len(list.Result.Tools) != 2 || list.Result.Tools[0].Name != "file" || len(list.Result.Tools[1].InputSchema) == 0 {
+		t.Fatalf("unexpected tools: %+v", list.Result.Tools)
+	}
+
+	if r := s.call(2, "file", `{"operation":"read","path":"a.txt"}`); r.IsError || !strings.Contains(r.Content[0].Text, "hello") {
+		t.Errorf("reading should need no approval: %+v", r)
+	}
+	if r := s.call(3, "file", `{"operation":"read","path":"../x"}`); !r.IsError || !strings.Contains(r.Content[0].Text, "denied") {
+		t.Errorf("the workspace policy should apply: %+v", r)
+	}
+	r := s.call(4, "file", `{"operation":"write","path":"b.txt","content":"x"}`)
+	if !r.IsError || !strings.Contains(r.Content[0].Text, "not approved") {
+		t.Errorf("writing should need approval: %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "b.txt")); err == nil {
+		t.Error("the rejected write happened")
+	}
+
+	s.send(`{"jsonrpc":"2.0","id":5,"method":"tools/call","params":{"name":"nope"}}`)
+	if resp := s.read(); !strings.Contains(resp, `"code":-32602`) {
+		t.Errorf("unknown tools should be a protocol error: %s", resp)
+	}
+}
+
+func TestServer_Elicitation(t *testing.T) {
+	s, workDir := startServer(t, false, `{"elicitation":{}}`)
+
+	s.send(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"file","arguments":{"operation":"write","path":"b.txt","content":"x"}}}`)
+	var ask struct {
+		ID     json.RawMessage `json:"id"`
+		Method string          `json:"method"`
+		Params struct {
+			Message string `json:"message"`
+		} `json:"params"`
+	}
+	json.Unmarshal([]byte(s.read()), &ask)
+	if ask.Method != "elicitation/create" || !strings.Contains(ask.Params.Message, "b.txt") {
+		t.Fatalf("expected the user to be asked, got %+v", ask)
+	}
+	s.send(`{"jsonrpc":"2.0","id":` + string(ask.ID) + `,"result":{"action":"accept","content":{"decision":"approve_for_session"}}}`)
+	if r := s.result(s.read()); r.IsError {
+		t.Errorf("the approved write failed: %+v", r)
+	}
+
+	// The session approval covers the next write
+	if r := s.call(2, "file", `{"operation":"write","path":"c.txt","content":"y"}`); r.IsError {
+		t.Errorf("the second write failed: %+v", r)
+	}
+	for _, name := range []string{"b.txt", "c.txt"} {
+		if _, err := os.Stat(filepath.Join(workDir, name)); err != nil {
+			t.Errorf("%s was not written: %v", name, err)
+		}
+	}
+}
+
+func TestServer_Cancel(t *testing.T) {
+	s, _ := startServer(t, true, `{}`)
+
+	start := time.Now()
+	s.send(`{"jsonrpc":"2.0","id":"slow","method":"tools/call","params":{"name":"shell","arguments":{"command":"sleep 30"}}}`)
+	time.Sleep(100 * time.Millisecond)
+	s.send(`{"jsonrpc":"2.0","method":"notifications/cancelled","params":{"requestId":"slow","reason":"test"}}`)
+
+	// Cancelled calls get no response, so the next one is the ping's
+	s.send(`{"jsonrpc":"2.0","id":1,"method":"ping"}`)
+	if resp := s.read(); !strings.Contains(resp, `"id":1`) {
+		t.Errorf("expected the ping response, got %s", resp)
+	}
+	s.in.Close()
+	select {
+	case err := <-s.done:
+		if err != nil {
+			t.Errorf("Serve failed: %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("the cancelled call kept running")
+	}
+	if s.out.Scan() {
+		t.Errorf("unexpected output %s", s.out.Text())
+	}
+	if time.Since(start) > 10*time.Second {
+		t.Error("the call was not cancelled")
+	}
+}
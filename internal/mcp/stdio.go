@@ -0,0 +1,248 @@
+package mcp
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+	"time"
+
+	"kimi-go/internal/tools"
+)
+
+const (
+	stderrTail     = 4 << 10         // Bytes of a server's stderr kept for error messages
+	stopGrace      = 2 * time.Second // Time a server gets to exit after its stdin is closed
+	killGrace      = time.Second     // Time a server gets to exit after SIGTERM
+	pipeDelay      = time.Second     // Time the output pipes may stay open after a server exited
+	maxMessageSize = 64 << 20        // Longest message line read from a server
+)
+
+// stdioTransport talks to a server process over its stdin and stdout, one
+// JSON message per line.
+type stdioTransport struct {
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	stderr *tailBuffer
+
+	writeMu  sync.Mutex
+	mu       sync.Mutex
+	pending  map[string]chan *Response
+	readDone chan struct{} // Closed when readLoop has returned
+	exited   chan struct{} // Closed when the process has exited
+	exitErr  error
+}
+
+// startStdio starts the server process of cfg in a process group of its own,
+// so stopping it stops the processes it spawned as well.
+func startStdio(cfg ServerConfig) (*stdioTransport, error) {
+	cmd := exec.Command(cfg.Command, cfg.Args...)
+	cmd.Dir = cfg.Dir
+	cmd.Env = os.Environ()
+	for k, v := range cfg.Env {
+		cmd.Env = append(cmd.Env, k+"="+v)
+	}
+	tools.SetProcessGroup(cmd)
+	// Children in another session that keep stderr open do not keep Wait waiting
+	cmd.WaitDelay = pipeDelay
+	t := &stdioTransport{
+		cmd:      cmd,
+		stderr:   &tailBuffer{max: stderrTail},
+		pending:  make(map[string]chan *Response),
+		readDone: make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	cmd.Stderr = t.stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	// Unlike StdoutPipe, the read end stays open until readLoop is done with it
+	stdout, w, err := os.Pipe()
+	if err != nil {
+		stdin.Close()
+		return nil, err
+	}
+	cmd.Stdout = w
+	err = cmd.Start()
+	w.Close()
+	if err != nil {
+		stdin.Close()
+		stdout.Close()
+		return nil, err
+	}
+	t.stdin = stdin
+	go t.readLoop(stdout)
+	go t.wait(stdout)
+	return t, nil
+}
+
+// readLoop dispatches the server's messages until its stdout closes.
+func (t *stdioTransport) readLoop(stdout io.Reader) {
+	defer close(t.readDone)
+	r := bufio.NewScanner(stdout)
+	r.Buffer(make([]byte, 64*1024), maxMessageSize)
+	for r.Scan() {
+		line := r.Bytes()
+		var msg message
+		if err := json.Unmarshal(line, &msg); err != nil {
+			continue // Servers may log to stdout by mistake
+		}
+		switch {
+		case msg.Method != "" && msg.ID != nil:
+			t.answer(msg)
+		case msg.Method != "":
+			// Notifications such as progress and log messages are not used
+		default:
+			var resp Response
+			if json.Unmarshal(line, &resp) != nil {
+				continue
+			}
+			t.mu.Lock()
+			ch := t.pending[string(resp.ID)]
+			delete(t.pending, string(resp.ID))
+			t.mu.Unlock()
+			if ch != nil {
+				ch <- &resp
+			}
+		}
+	}
+	if err := r.Err(); err != nil && !errors.Is(err, os.ErrClosed) {
+		// The server can no longer be understood; it would block writing
+		go tools.TerminateProcessGroup(t.cmd, t.exited, 0)
+	}
+}
+
+// wait waits for the process and fails the pending calls. Children that
+// inherited stdout may keep it open after the server exited; it is closed
+// once they had pipeDelay to finish writing.
+func (t *stdioTransport) wait(stdout *os.File) {
+	err := t.cmd.Wait()
+	select {
+	case <-t.readDone:
+	case <-time.After(pipeDelay):
+	}
+	stdout.Close()
+	<-t.readDone
+
+	if err == nil {
+		err = errors.New("exited")
+	}
+	if tail := strings.TrimSpace(t.stderr.String()); tail != "" {
+		err = fmt.Errorf("%w; stderr: %s", err, tail)
+	}
+	t.mu.Lock()
+	t.exitErr = fmt.Errorf("server process %w", err)
+	t.mu.Unlock()
+	close(t.exited)
+}
+
+// answer replies to a request from the server. Only ping is supported.
+func (t *stdioTransport) answer(msg message) {
+	resp := Response{JSONRPC: "2.0", ID: msg.ID}
+	if msg.Method == "ping" {
+		resp.Result = json.RawMessage("{}")
+	} else {
+		resp.Error = &RPCError{Code: CodeMethodNotFound, Message: "method not found: " + msg.Method}
+	}
+	_ = t.write(resp)
+}
+
+// write sends one message.
+func (t *stdioTransport) write(v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	t.writeMu.Lock()
+	defer t.writeMu.Unlock()
+	_, err = t.stdin.Write(append(data, '\n'))
+	return err
+}
+
+func (t *stdioTransport) call(ctx context.Context, req *Request) (*Response, error) {
+	id := string(*req.ID)
+	ch := make(chan *Response, 1)
+	t.mu.Lock()
+	t.pending[id] = ch
+	t.mu.Unlock()
+	defer func() {
+		t.mu.Lock()
+		delete(t.pending, id)
+		t.mu.Unlock()
+	}()
+
+	if err := t.write(req); err != nil {
+		select {
+		case <-t.exited:
+			return nil, t.err()
+		default:
+			return nil, err
+		}
+	}
+	select {
+	case resp := <-ch:
+		return resp, nil
+	case <-t.exited:
+		return nil, t.err()
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func (t *stdioTransport) notify(ctx context.Context, req *Request) error {
+	return t.write(req)
+}
+
+func (t *stdioTransport) done() <-chan struct{} {
+	return t.exited
+}
+
+func (t *stdioTransport) err() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.exitErr
+}
+
+// close closes the server's stdin, which asks it to exit, and stops its
+// process group if it is still running after stopGrace.
+func (t *stdioTransport) close() error {
+	_ = t.stdin.Close()
+	select {
+	case <-t.exited:
+	case <-time.After(stopGrace):
+		tools.TerminateProcessGroup(t.cmd, t.exited, killGrace)
+	}
+	return nil
+}
+
+// tailBuffer keeps the last max bytes written to it.
+type tailBuffer struct {
+	mu  sync.Mutex
+	max int
+	buf []byte
+}
+
+// Write implements io.Writer.
+func (b *tailBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.buf = append(b.buf, p...)
+	if len(b.buf) > b.max {
+		b.buf = b.buf[len(b.buf)-b.max:]
+	}
+	return len(p), nil
+}
+
+// String returns the bytes kept.
+func (b *tailBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return string(b.buf)
+}
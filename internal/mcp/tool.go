@@ -0,0 +1,169 @@
+package mcp
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"kimi-go/internal/tools"
+)
+
+const (
+	// ToolPrefix starts the names of MCP tools, which are "mcp__<server>__<tool>".
+	ToolPrefix = "mcp__"
+
+	maxToolName = 64 // Longest function name models accept
+)
+
+// unsafeNameChars matches characters not allowed in function names.
+var unsafeNameChars = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+// ToolName returns the name under which a server's tool is registered.
+func ToolName(server, tool string) string {
+	name := unsafeNameChars.ReplaceAllString(ToolPrefix+server+"__"+tool, "_")
+	if len(name) > maxToolName {
+		name = name[:maxToolName]
+	}
+	return name
+}
+
+// Tool is a tool of an MCP server, registered like a built-in tool. Calls
+// are proxied to the server.
+type Tool struct {
+	client *Client
+	info   ToolInfo
+}
+
+// CallResult represents the result of an MCP tool call.
+type CallResult struct {
+	Success bool   `json:"success"`
+	Server  string `json:"server"`
+	Tool    string `json:"tool"`
+	Content string `json:"content,omitempty"`
+	Error   string `json:"error,omitempty"`
+	images  []tools.Image
+}
+
+// ModelText implements tools.ModelTexter.
+func (r CallResult) ModelText() string {
+	if !r.Success {
+		return ""
+	}
+	if r.Content == "" && len(r.images) == 0 {
+		return "(no output)"
+	}
+	return r.Content
+}
+
+// Images implements tools.ImageCarrier.
+func (r CallResult) Images() []tools.Image {
+	return r.images
+}
+
+// Tools returns the server's tools.
+func (c *Client) Tools() []tools.Tool {
+	result := make([]tools.Tool, len(c.tools))
+	for i, info := range c.tools {
+		result[i] = &Tool{client: c, info: info}
+	}
+	return result
+}
+
+// Name returns the tool name.
+func (t *Tool) Name() string {
+	return ToolName(t.client.name, t.info.Name)
+}
+
+// Description returns the tool description.
+func (t *Tool) Description() string {
+	desc := t.info.Description
+	if desc == "" {
+		desc = fmt.Sprintf("The %s tool.", t.info.Name)
+	}
+	return fmt.Sprintf("[MCP server %s] %s", t.client.name, desc)
+}
+
+// Parameters returns the JSON schema for tool parameters.
+func (t *Tool) Parameters() json.RawMessage {
+	if len(t.info.InputSchema) == 0 {
+		return json.RawMessage(`{"type": "object", "properties": {}}`)
+	}
+	return t.info.InputSchema
+}
+
+// ApprovalAction implements tools.Approvable. The tool's read-only hint is
+// not trusted, so every call needs approval.
+func (t *Tool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	shown := string(args)
+	if len(shown) > 200 {
+		shown = shown[:200] + "..."
+	}
+	return t.Name(), fmt.Sprintf("call `%s` on the MCP server %s with %s", t.info.Name, t.client.name, shown), true
+}
+
+// Execute calls the tool on the server.
+func (t *Tool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	if len(args) == 0 {
+		args = json.RawMessage("{}")
+	}
+	if !json.Valid(args) {
+		return nil, fmt.Errorf("invalid parameters: arguments are not valid JSON")
+	}
+
+	result := CallResult{Server: t.client.name, Tool: t.info.Name}
+	res, err := t.client.CallTool(ctx, t.info.Name, args)
+	if err != nil {
+		result.Error = err.Error()
+		return result, nil
+	}
+	result.Content, result.images = convertContent(res.Content)
+	if res.IsError {
+		result.Error, result.Content = result.Content, ""
+		if result.Error == "" {
+			result.Error = "the tool failed without a message"
+		}
+		return result, nil
+	}
+	result.Success = true
+	return result, nil
+}
+
+// convertContent turns a tool result's content into text and images for the
+// model. Content that cannot be shown is described instead.
+func convertContent(content []Content) (string, []tools.Image) {
+	var (
+		parts  []string
+		images []tools.Image
+	)
+	for i, c := range content {
+		switch c.Type {
+		case "text":
+			parts = append(parts, c.Text)
+		case "image":
+			data, err := base64.StdEncoding.DecodeString(c.Data)
+			if err != nil {
+				parts = append(parts, fmt.Sprintf("[image %d omitted: invalid base64 data]", i+1))
+				continue
+			}
+			img, err := tools.NewImage(fmt.Sprintf("image %d", i+1), data)
+			if err != nil {
+				parts = append(parts, fmt.Sprintf("[image %d omitted: it %v]", i+1, err))
+				continue
+			}
+			images = append(images, img)
+			parts = append(parts, fmt.Sprintf("[%s follows in the next message]", img.Describe()))
+		case "resource":
+			if r := c.Resource; r != nil && r.Text != "" {
+				parts = append(parts, fmt.Sprintf("[resource %s]\n%s", r.URI, r.Text))
+			} else if r != nil {
+				parts = append(parts, fmt.Sprintf("[resource %s (%s) omitted: binary content]", r.URI, r.MimeType))
+			}
+		default:
+			parts = append(parts, fmt.Sprintf("[%s content omitted]", c.Type))
+		}
+	}
+	return strings.Join(parts, "\n"), images
+}
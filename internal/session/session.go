@@ -120,7 +120,10 @@ func Create(workDir string) (*Session, error) {
 	}
 
 	sessionsDir := filepath.Join(homeDir, ".kimi", "sessions")
-	contextsDir := filepath.Join(homeDir, ".kimi", "contexts")
+	contextsDir, err := ContextsDir()
+	if err != nil {
+		return nil, err
+	}
 
 	for _, dir := range []string{sessionsDir, contextsDir} {
 		if err := os.MkdirAll(dir, 0755); err != nil {
@@ -132,7 +135,7 @@ func Create(workDir string) (*Session, error) {
 	session := &Session{
 		ID:          id,
 		WorkDir:     workDir,
-		ContextFile: filepath.Join(contextsDir, id+".json"),
+		ContextFile: filepath.Join(contextsDir, id+".jsonl"),
 		CreatedAt:   time.Now(),
 		UpdatedAt:   time.Now(),
 	}
@@ -153,7 +156,39 @@ func Continue(id string) (*Session, error) {
 		return nil, err
 	}
 
-	return store.Load(id)
+	session, err := store.Load(id)
+	if err != nil {
+		return nil, err
+	}
+
+	// Sessions created before the JSONL context log point at a .json file,
+	// which is migrated when the context is restored
+	if strings.HasSuffix(session.ContextFile, ".json") {
+		session.ContextFile += "l"
+		if err := store.Save(session); err != nil {
+			return nil, err
+		}
+	}
+	return session, nil
+}
+
+// ContextsDir returns the directory that holds context logs.
+func ContextsDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".kimi", "contexts"), nil
+}
+
+// ToolOutputDir returns the directory that holds the full output of tool
+// calls whose output was truncated for the model.
+func ToolOutputDir(id string) (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".kimi", "tool-outputs", id), nil
 }
 
 // Save saves the session.
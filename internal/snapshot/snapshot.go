@@ -0,0 +1,277 @@
+// Package snapshot keeps restorable snapshots of a work directory.
+//
+// Snapshots are stored in a shadow git repository under ~/.kimi/snapshots,
+// one per work directory. The shadow repository has its own index and never
+// touches the user's .git directory, so the user's history, index and
+// branches are left alone. Files matched by the work directory's .gitignore
+// are not snapshotted.
+package snapshot
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// refPrefix is the namespace of snapshot refs in the shadow repository.
+const refPrefix = "refs/kimi/snapshots/"
+
+// Snapshot describes a saved state of the work directory.
+type Snapshot struct {
+	Turn   int       `json:"turn"`
+	Commit string    `json:"commit"`
+	Label  string    `json:"label"`
+	Time   time.Time `json:"time"`
+}
+
+// Store takes and restores snapshots of one work directory.
+type Store struct {
+	gitDir  string
+	workDir string
+}
+
+// DefaultDir returns the directory that holds shadow repositories.
+func DefaultDir() (string, error) {
+	homeDir, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to get home directory: %w", err)
+	}
+	return filepath.Join(homeDir, ".kimi", "snapshots"), nil
+}
+
+// Open opens the snapshot store for workDir, creating the shadow repository
+// under baseDir if needed.
+func Open(baseDir, workDir string) (*Store, error) {
+	if _, err := exec.LookPath("git"); err != nil {
+		return nil, fmt.Errorf("git is required for snapshots: %w", err)
+	}
+
+	absWorkDir, err := filepath.Abs(workDir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve work directory: %w", err)
+	}
+	sum := sha256.Sum256([]byte(absWorkDir))
+	s := &Store{
+		gitDir:  filepath.Join(baseDir, hex.EncodeToString(sum[:8])),
+		workDir: absWorkDir,
+	}
+
+	if _, err := os.Stat(filepath.Join(s.gitDir, "HEAD")); os.IsNotExist(err) {
+		if err := os.MkdirAll(s.gitDir, 0755); err != nil {
+			return nil, fmt.Errorf("failed to create snapshot directory: %w", err)
+		}
+		if _, err := run(context.Background(), baseDir, "init", "--quiet", "--bare", s.gitDir); err != nil {
+			return nil, err
+		}
+		// Remember which directory this repository belongs to
+		if _, err := s.git(context.Background(), "config", "kimi.workdir", absWorkDir); err != nil {
+			return nil, err
+		}
+	}
+	return s, nil
+}
+
+// WorkDir returns the work directory of the store.
+func (s *Store) WorkDir() string {
+	return s.workDir
+}
+
+// Take snapshots the current state of the work directory.
+func (s *Store) Take(ctx context.Context, label string) (Snapshot, error) {
+	tree, err := s.writeTree(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	commit, err := s.git(ctx, "commit-tree", tree, "-m", label)
+	if err != nil {
+		return Snapshot{}, err
+	}
+
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	turn := 1
+	if n := len(snapshots); n > 0 {
+		turn = snapshots[n-1].Turn + 1
+	}
+
+	if _, err := s.git(ctx, "update-ref", refPrefix+strconv.Itoa(turn), commit); err != nil {
+		return Snapshot{}, err
+	}
+	return Snapshot{Turn: turn, Commit: commit, Label: label, Time: time.Now()}, nil
+}
+
+// List returns all snapshots, oldest first.
+func (s *Store) List(ctx context.Context) ([]Snapshot, error) {
+	out, err := s.git(ctx, "for-each-ref",
+		"--format=%(refname)%00%(objectname)%00%(creatordate:unix)%00%(contents:subject)",
+		refPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	var snapshots []Snapshot
+	for _, line := range strings.Split(out, "\n") {
+		fields := strings.SplitN(line, "\x00", 4)
+		if len(fields) != 4 {
+			continue
+		}
+		turn, err := strconv.Atoi(strings.TrimPrefix(fields[0], refPrefix))
+		if err != nil {
+			continue
+		}
+		unix, _ := strconv.ParseInt(fields[2], 10, 64)
+		snapshots = append(snapshots, Snapshot{
+			Turn:   turn,
+			Commit: fields[1],
+			Label:  fields[3],
+			Time:   time.Unix(unix, 0),
+		})
+	}
+	sort.Slice(snapshots, func(i, j int) bool { return snapshots[i].Turn < snapshots[j].Turn })
+	return snapshots, nil
+}
+
+// Get returns the snapshot of the given turn.
+func (s *Store) Get(ctx context.Context, turn int) (Snapshot, error) {
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	for _, snap := range snapshots {
+		if snap.Turn == turn {
+			return snap, nil
+		}
+	}
+	return Snapshot{}, fmt.Errorf("snapshot %d does not exist", turn)
+}
+
+// Latest returns the most recent snapshot.
+func (s *Store) Latest(ctx context.Context) (Snapshot, error) {
+	snapshots, err := s.List(ctx)
+	if err != nil {
+		return Snapshot{}, err
+	}
+	if len(snapshots) == 0 {
+		return Snapshot{}, fmt.Errorf("no snapshots")
+	}
+	return snapshots[len(snapshots)-1], nil
+}
+
+// Restore makes the work directory match the snapshot of the given turn.
+// Files created since the snapshot are removed; ignored files are left alone.
+func (s *Store) Restore(ctx context.Context, turn int) error {
+	snap, err := s.Get(ctx, turn)
+	if err != nil {
+		return err
+	}
+
+	// Track the current files so those missing from the snapshot are removed
+	if _, err := s.writeTree(ctx); err != nil {
+		return err
+	}
+
+	empty, err := s.isEmptyTree(ctx, snap.Commit)
+	if err != nil {
+		return err
+	}
+	if empty {
+		// Nothing to restore from; remove every tracked file instead
+		_, err = s.git(ctx, "rm", "-r", "-f", "--quiet", "--ignore-unmatch", "--", ":/")
+		return err
+	}
+
+	_, err = s.git(ctx, "restore", "--source="+snap.Commit, "--staged", "--worktree", "--", ":/")
+	return err
+}
+
+// Drop deletes the snapshot of the given turn.
+func (s *Store) Drop(ctx context.Context, turn int) error {
+	if _, err := s.Get(ctx, turn); err != nil {
+		return err
+	}
+	_, err := s.git(ctx, "update-ref", "-d", refPrefix+strconv.Itoa(turn))
+	return err
+}
+
+// writeTree stages the whole work directory in the shadow index and returns the tree.
+func (s *Store) writeTree(ctx context.Context) (string, error) {
+	if _, err := s.git(ctx, "add", "--all", "--", ":/"); err != nil {
+		return "", err
+	}
+	return s.git(ctx, "write-tree")
+}
+
+// isEmptyTree reports whether the commit has no files.
+func (s *Store) isEmptyTree(ctx context.Context, commit string) (bool, error) {
+	out, err := s.git(ctx, "ls-tree", "--name-only", commit)
+	if err != nil {
+		return false, err
+	}
+	return out == "", nil
+}
+
+// git runs a git command against the shadow repository and returns its trimmed output.
+func (s *Store) git(ctx context.Context, args ...string) (string, error) {
+	base := []string{
+		"--git-dir=" + s.gitDir,
+		"--work-tree=" + s.workDir,
+		"-c", "core.autocrlf=false",
+		"-c", "core.safecrlf=false",
+		"-c", "user.name=kimi",
+		"-c", "user.email=kimi@localhost",
+		"-c", "commit.gpgsign=false",
+	}
+	return run(ctx, s.workDir, append(base, args...)...)
+}
+
+// run runs git in dir and returns its trimmed output.
+func run(ctx context.Context, dir string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = gitEnv()
+
+	var stdout, stderr bytes.Buffer
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return "", fmt.Errorf("git %s failed: %w: %s", gitCommand(args), err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
+
+// gitCommand returns the subcommand in args, skipping global options.
+func gitCommand(args []string) string {
+	for i := 0; i < len(args); i++ {
+		switch {
+		case args[i] == "-c":
+			i++
+		case !strings.HasPrefix(args[i], "-"):
+			return args[i]
+		}
+	}
+	return ""
+}
+
+// gitEnv returns the environment without GIT_* variables, which could point
+// git at the user's repository or index.
+func gitEnv() []string {
+	env := make([]string, 0, len(os.Environ()))
+	for _, kv := range os.Environ() {
+		if !strings.HasPrefix(kv, "GIT_") {
+			env = append(env, kv)
+		}
+	}
+	return env
+}
@@ -0,0 +1,187 @@
+package snapshot
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+// newTestStore opens a store for a fresh work directory.
+func newTestStore(t *testing.T) (*Store, string) {
+	t.Helper()
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	workDir := t.TempDir()
+	store, err := Open(t.TempDir(), workDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	return store, workDir
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func runGit(t *testing.T, dir string, args ...string) string {
+	t.Helper()
+	cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+	cmd.Dir = dir
+	out, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, out)
+	}
+	return string(out)
+}
+
+func TestStore_TakeAndRestore(t *testing.T) {
+	store, workDir := newTestStore(t)
+	ctx := context.Background()
+
+	writeFile(t, filepath.Join(workDir, "keep.txt"), "original")
+	writeFile(t, filepath.Join(workDir, "sub", "gone.txt"), "will be deleted")
+
+	snap, err := store.Take(ctx, "fix the bug")
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	if snap.Turn != 1 || snap.Label != "fix the bug" {
+		t.Errorf("unexpected snapshot: %+v", snap)
+	}
+
+	// Changes made by the agent
+	writeFile(t, filepath.Join(workDir, "keep.txt"), "edited")
+	os.RemoveAll(filepath.Join(workDir, "sub"))
+	writeFile(t, filepath.Join(workDir, "new.txt"), "created")
+
+	if err := store.Restore(ctx, snap.Turn); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if got := readFile(t, filepath.Join(workDir, "keep.txt")); got != "original" {
+		t.Errorf("modified file not restored, got %q", got)
+	}
+	if got := readFile(t, filepath.Join(workDir, "sub", "gone.txt")); got != "will be deleted" {
+		t.Errorf("deleted file not restored, got %q", got)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "new.txt")); !os.IsNotExist(err) {
+		t.Error("file created after the snapshot should be removed")
+	}
+}
+
+func TestStore_RestoreEmptySnapshot(t *testing.T) {
+	store, workDir := newTestStore(t)
+	ctx := context.Background()
+
+	snap, err := store.Take(ctx, "empty")
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	writeFile(t, filepath.Join(workDir, "new.txt"), "created")
+
+	if err := store.Restore(ctx, snap.Turn); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(workDir, "new.txt")); !os.IsNotExist(err) {
+		t.Error("file created after the snapshot should be removed")
+	}
+}
+
+func TestStore_ListAndDrop(t *testing.T) {
+	store, workDir := newTestStore(t)
+	ctx := context.Background()
+
+	for i, label := range []string{"one", "two", "three"} {
+		writeFile(t, filepath.Join(workDir, "f.txt"), label)
+		snap, err := store.Take(ctx, label)
+		if err != nil {
+			t.Fatalf("Take failed: %v", err)
+		}
+		if snap.Turn != i+1 {
+			t.Errorf("expected turn %d, got %d", i+1, snap.Turn)
+		}
+	}
+
+	if err := store.Drop(ctx, 3); err != nil {
+		t.Fatalf("Drop failed: %v", err)
+	}
+	snapshots, err := store.List(ctx)
+	if err != nil {
+		t.Fatalf("List failed: %v", err)
+	}
+	if len(snapshots) != 2 || snapshots[0].Label != "one" || snapshots[1].Label != "two" {
+		t.Errorf("unexpected snapshots: %+v", snapshots)
+	}
+	latest, err := store.Latest(ctx)
+	if err != nil || latest.Turn != 2 {
+		t.Errorf("expected latest turn 2, got %+v (err=%v)", latest, err)
+	}
+
+	// Numbering continues after the latest remaining snapshot
+	snap, _ := store.Take(ctx, "four")
+	if snap.Turn != 3 {
+		t.Errorf("expected turn 3, got %d", snap.Turn)
+	}
+
+	if err := store.Restore(ctx, 9); err == nil {
+		t.Error("expected error for unknown snapshot")
+	}
+}
+
+func TestStore_LeavesUserRepositoryAlone(t *testing.T) {
+	store, workDir := newTestStore(t)
+	ctx := context.Background()
+
+	runGit(t, workDir, "init", "--quiet")
+	writeFile(t, filepath.Join(workDir, ".gitignore"), "build/\n")
+	writeFile(t, filepath.Join(workDir, "main.go"), "package main")
+	runGit(t, workDir, "add", "-A")
+	runGit(t, workDir, "commit", "--quiet", "-m", "initial")
+	writeFile(t, filepath.Join(workDir, "staged.go"), "package main")
+	runGit(t, workDir, "add", "staged.go")
+	writeFile(t, filepath.Join(workDir, "build", "out.bin"), "artifact")
+
+	statusBefore := runGit(t, workDir, "status", "--porcelain")
+	logBefore := runGit(t, workDir, "log", "--oneline")
+
+	snap, err := store.Take(ctx, "turn")
+	if err != nil {
+		t.Fatalf("Take failed: %v", err)
+	}
+	writeFile(t, filepath.Join(workDir, "main.go"), "package broken")
+	writeFile(t, filepath.Join(workDir, "build", "out.bin"), "rebuilt")
+	if err := store.Restore(ctx, snap.Turn); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	if got := readFile(t, filepath.Join(workDir, "main.go")); got != "package main" {
+		t.Errorf("file not restored, got %q", got)
+	}
+	// Ignored files are neither snapshotted nor restored
+	if got := readFile(t, filepath.Join(workDir, "build", "out.bin")); got != "rebuilt" {
+		t.Errorf("ignored file should be left alone, got %q", got)
+	}
+	if got := runGit(t, workDir, "status", "--porcelain"); got != statusBefore {
+		t.Errorf("user index changed:\nbefore: %q\nafter:  %q", statusBefore, got)
+	}
+	if got := runGit(t, workDir, "log", "--oneline"); got != logBefore {
+		t.Errorf("user history changed:\nbefore: %q\nafter:  %q", logBefore, got)
+	}
+}
@@ -0,0 +1,145 @@
+package soul
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/google/uuid"
+
+	"kimi-go/internal/tools"
+	"kimi-go/internal/wire"
+)
+
+// Approval tracks pending approval requests and actions approved for the session.
+type Approval struct {
+	mu              sync.Mutex
+	sessionApproved map[string]bool
+	pending         map[string]chan wire.ApprovalResponse
+}
+
+// NewApproval creates an empty approval state.
+func NewApproval() *Approval {
+	return &Approval{
+		sessionApproved: make(map[string]bool),
+		pending:         make(map[string]chan wire.ApprovalResponse),
+	}
+}
+
+// IsApprovedForSession reports whether action was approved for the rest of the session.
+func (a *Approval) IsApprovedForSession(action string) bool {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.sessionApproved[action]
+}
+
+// Resolve delivers the front-end's answer to a pending request.
+func (a *Approval) Resolve(resp wire.ApprovalResponse) error {
+	a.mu.Lock()
+	ch, ok := a.pending[resp.RequestID]
+	if ok {
+		delete(a.pending, resp.RequestID)
+	}
+	a.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("no pending approval request: %s", resp.RequestID)
+	}
+	ch <- resp
+	return nil
+}
+
+// register adds a pending request and returns the channel its answer arrives on.
+func (a *Approval) register(id string) chan wire.ApprovalResponse {
+	ch := make(chan wire.ApprovalResponse, 1)
+	a.mu.Lock()
+	a.pending[id] = ch
+	a.mu.Unlock()
+	return ch
+}
+
+// cancel drops a pending request that will no longer be waited on.
+func (a *Approval) cancel(id string) {
+	a.mu.Lock()
+	delete(a.pending, id)
+	a.mu.Unlock()
+}
+
+// approveForSession auto-approves future calls with the same action.
+func (a *Approval) approveForSession(action string) {
+	a.mu.Lock()
+	a.sessionApproved[action] = true
+	a.mu.Unlock()
+}
+
+// ResolveApproval answers an approval request emitted through OnMessage.
+// It is safe to call from any goroutine while the soul waits for the answer.
+func (s *Soul) ResolveApproval(resp wire.ApprovalResponse) error {
+	return s.runtime.Approval.Resolve(resp)
+}
+
+// requestApproval asks the front-end whether a tool call may run.
+// It returns whether the call is approved and, if not, the user's reason.
+func (s *Soul) requestApproval(ctx context.Context, call tools.ToolCall) (bool, string) {
+	if s.runtime.YOLO {
+		return true, ""
+	}
+
+	tool, err := s.runtime.Tools.Get(call.Name)
+	if err != nil {
+		// Unknown tools fail on execution
+		return true, ""
+	}
+
+	action, description := call.Name, fmt.Sprintf("call tool `%s`", call.Name)
+	if a, ok := tool.(tools.Approvable); ok {
+		var needed bool
+		action, description, needed = a.ApprovalAction(call.Arguments)
+		if !needed {
+			return true, ""
+		}
+	}
+
+	approval := s.runtime.Approval
+	if approval.IsApprovedForSession(action) {
+		return true, ""
+	}
+	if s.OnMessage == nil {
+		return false, "no front-end is available to approve the call"
+	}
+
+	req := wire.ApprovalRequest{
+		ID:          uuid.New().String(),
+		ToolCallID:  call.ID,
+		ToolName:    call.Name,
+		Action:      action,
+		Description: description,
+	}
+	// Register before emitting so the front-end may answer from the callback
+	ch := approval.register(req.ID)
+	reqMsg := wire.NewApprovalRequestMessage(req)
+	s.Context.AddMessage(*reqMsg)
+	s.OnMessage(*reqMsg)
+
+	var resp wire.ApprovalResponse
+	select {
+	case <-ctx.Done():
+		approval.cancel(req.ID)
+		return false, "the request was cancelled"
+	case resp = <-ch:
+	}
+
+	respMsg := wire.NewApprovalResponseMessage(resp)
+	s.Context.AddMessage(*respMsg)
+	s.OnMessage(*respMsg)
+
+	switch resp.Decision {
+	case wire.ApprovalApproveForSession:
+		approval.approveForSession(action)
+		return true, ""
+	case wire.ApprovalApprove:
+		return true, ""
+	default:
+		return false, resp.Reason
+	}
+}
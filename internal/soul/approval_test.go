@@ -0,0 +1,160 @@
+package soul
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/tools"
+	"kimi-go/internal/wire"
+)
+
+// setupApprovalSoul creates a non-YOLO soul whose front-end answers every
+// approval request with the given decision.
+func setupApprovalSoul(t *testing.T, decision wire.ApprovalDecision, reason string) (*Soul, *[]wire.ApprovalRequest) {
+	t.Helper()
+	rt := NewRuntime(t.TempDir(), false)
+	rt.RegisterTool(tools.NewShellTool(rt.WorkDir, 5*time.Second))
+	rt.RegisterTool(tools.NewFileTool(rt.WorkDir))
+	s := NewSoul(NewAgent("test", "", rt), NewContext(""))
+
+	var requests []wire.ApprovalRequest
+	s.OnMessage = func(msg wire.Message) {
+		req, ok := msg.ApprovalRequest()
+		if !ok {
+			return
+		}
+		requests = append(requests, req)
+		// Answer asynchronously like a real front-end
+		go s.ResolveApproval(wire.ApprovalResponse{
+			RequestID: req.ID,
+			Decision:  decision,
+			Reason:    reason,
+		})
+	}
+	return s, &requests
+}
+
+func shellCall(id, command string) llm.ToolCallInfo {
+	return llm.ToolCallInfo{
+		ID:   id,
+		Type: "function",
+		Function: llm.FunctionCall{
+			Name:      "shell",
+			Arguments: `{"command":"` + command + `"}`,
+		},
+	}
+}
+
+func TestSoul_Approval_ApproveOnce(t *testing.T) {
+	s, requests := setupApprovalSoul(t, wire.ApprovalApprove, "")
+
+	for i := 0; i < 2; i++ {
+		results := s.executeToolCallsParallel(context.Background(), []llm.ToolCallInfo{shellCall("call_1", "echo hi")})
+		if !results[0].Success {
+			t.Fatalf("approved call should succeed: %s", results[0].Error)
+		}
+	}
+	if len(*requests) != 2 {
+		t.Errorf("each call should be approved separately, got %d requests", len(*requests))
+	}
+	if (*requests)[0].ToolCallID != "call_1" || (*requests)[0].ToolName != "shell" {
+		t.Errorf("unexpected request: %+v", (*requests)[0])
+	}
+}
+
+func TestSoul_Approval_ApproveForSession(t *testing.T) {
+	s, requests := setupApprovalSoul(t, wire.ApprovalApproveForSession, "")
+
+	calls := []llm.ToolCallInfo{shellCall("call_1", "echo one"), shellCall("call_2", "echo two")}
+	results := s.executeToolCallsParallel(context.Background(), calls)
+	for _, r := range results {
+		if !r.Success {
+			t.Errorf("call %s should succeed: %s", r.CallID, r.Error)
+		}
+	}
+	if len(*requests) != 1 {
+		t.Errorf("expected 1 approval request for the session, got %d", len(*requests))
+	}
+}
+
+func TestSoul_Approval_RejectWithReason(t *testing.T) {
+	s, _ := setupApprovalSoul(t, wire.ApprovalReject, "use ls instead")
+
+	results := s.executeToolCallsParallel(context.Background(), []llm.ToolCallInfo{shellCall("call_1", "touch created")})
+	if results[0].Success {
+		t.Fatal("rejected call should fail")
+	}
+	if !strings.Contains(results[0].Error, "use ls instead") {
+		t.Errorf("reason should be passed to the LLM, got %q", results[0].Error)
+	}
+
+	var sawResponse bool
+	for _, msg := range s.Context.GetMessages() {
+		if resp, ok := msg.ApprovalResponse(); ok && resp.Decision == wire.ApprovalReject {
+			sawResponse = true
+		}
+	}
+	if !sawResponse {
+		t.Error("rejection should be recorded in context")
+	}
+}
+
+func TestSoul_Approval_ReadOnlyFileOperation(t *testing.T) {
+	s, requests := setupApprovalSoul(t, wire.ApprovalReject, "")
+
+	results := s.executeToolCallsParallel(context.Background(), []llm.ToolCallInfo{{
+		ID:       "call_1",
+		Type:     "function",
+		Function: llm.FunctionCall{Name: "file", Arguments: `{"operation":"exists","path":"x"}`},
+	}})
+	if !results[0].Success {
+		t.Errorf("read-only operation should not need approval: %s", results[0].Error)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("expected no approval requests, got %d", len(*requests))
+	}
+}
+
+func TestSoul_Approval_YOLO(t *testing.T) {
+	s, requests := setupApprovalSoul(t, wire.ApprovalReject, "")
+	s.runtime.YOLO = true
+
+	results := s.executeToolCallsParallel(context.Background(), []llm.ToolCallInfo{shellCall("call_1", "echo hi")})
+	if !results[0].Success {
+		t.Errorf("YOLO should skip approval: %s", results[0].Error)
+	}
+	if len(*requests) != 0 {
+		t.Errorf("expected no approval requests, got %d", len(*requests))
+	}
+}
+
+func TestSoul_Approval_Cancelled(t *testing.T) {
+	rt := NewRuntime(t.TempDir(), false)
+	rt.RegisterTool(tools.NewShellTool(rt.WorkDir, 5*time.Second))
+	s := NewSoul(NewAgent("test", "", rt), NewContext(""))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	s.OnMessage = func(msg wire.Message) {
+		if msg.Type == wire.MessageTypeApprovalRequest {
+			cancel()
+		}
+	}
+
+	results := s.executeToolCallsParallel(ctx, []llm.ToolCallInfo{shellCall("call_1", "echo hi")})
+	if results[0].Success {
+		t.Error("call should not run after cancellation")
+	}
+	if len(rt.Approval.pending) != 0 {
+		t.Error("cancelled request should not stay pending")
+	}
+}
+
+func TestApproval_ResolveUnknown(t *testing.T) {
+	a := NewApproval()
+	if err := a.Resolve(wire.ApprovalResponse{RequestID: "missing", Decision: wire.ApprovalApprove}); err == nil {
+		t.Error("expected error for unknown request")
+	}
+}
@@ -0,0 +1,36 @@
+package soul
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kimi-go/internal/tools"
+	"kimi-go/internal/wire"
+)
+
+// ImageCommand attaches an image file to the next user message.
+const ImageCommand = "/image"
+
+// ParseImageCommand reads the image named by an /image command, relative to
+// workDir, and returns it as a content part for NewUserInputMessage.
+func ParseImageCommand(input, workDir string) (wire.ContentPart, error) {
+	path := strings.TrimSpace(strings.TrimPrefix(input, ImageCommand))
+	if path == "" {
+		return wire.ContentPart{}, fmt.Errorf("usage: %s <path>", ImageCommand)
+	}
+	if rest, ok := strings.CutPrefix(path, "~/"); ok {
+		if home, err := os.UserHomeDir(); err == nil {
+			path = filepath.Join(home, rest)
+		}
+	}
+	if !filepath.IsAbs(path) && workDir != "" {
+		path = filepath.Join(workDir, path)
+	}
+	img, err := tools.LoadImage(path)
+	if err != nil {
+		return wire.ContentPart{}, err
+	}
+	return wire.ImagePart(img.Describe(), img.MimeType, img.Data), nil
+}
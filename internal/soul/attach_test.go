@@ -0,0 +1,33 @@
+package soul
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestParseImageCommand(t *testing.T) {
+	dir := t.TempDir()
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 2, 3)))
+	os.WriteFile(filepath.Join(dir, "diagram.png"), buf.Bytes(), 0644)
+
+	part, err := ParseImageCommand("/image diagram.png", dir)
+	if err != nil {
+		t.Fatalf("ParseImageCommand failed: %v", err)
+	}
+	if part.Type != "image" || part.MimeType != "image/png" || !strings.HasPrefix(part.Text, "diagram.png (image/png, 2x3") {
+		t.Errorf("unexpected part: %+v", part)
+	}
+
+	if _, err := ParseImageCommand("/image", dir); err == nil || !strings.Contains(err.Error(), "usage") {
+		t.Errorf("missing path should print the usage, got %v", err)
+	}
+	if _, err := ParseImageCommand("/image missing.png", dir); err == nil {
+		t.Error("missing file should fail")
+	}
+}
@@ -0,0 +1,244 @@
+package soul
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+// checkpointMarker tells the agent the ID of a checkpoint it can send a D-Mail to.
+const checkpointMarker = "<system>CHECKPOINT %d</system>"
+
+// dmailPrefix precedes a D-Mail delivered to the agent after a rewind.
+const dmailPrefix = "You just got a D-Mail from your future self. It is sent back to this checkpoint, so you do not remember what happened after it:\n\n"
+
+// CheckpointInfo describes a numbered point in the conversation that the
+// context can be rolled back to.
+type CheckpointInfo struct {
+	ID        int       `json:"id"`
+	Label     string    `json:"label"`
+	Messages  int       `json:"messages"` // Wire messages before the checkpoint
+	History   int       `json:"history"`  // LLM history messages before the checkpoint
+	Timestamp time.Time `json:"timestamp"`
+}
+
+// AddCheckpoint records a checkpoint at the current end of the context.
+// IDs increase by one and are never reused, even after compaction or a
+// revert drops earlier checkpoints: the history may still hold markers with
+// their IDs, and a D-Mail to one of them must not reach a newer checkpoint.
+func (c *Context) AddCheckpoint(label string) CheckpointInfo {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	cp := CheckpointInfo{
+		ID:        c.nextID,
+		Label:     label,
+		Messages:  len(c.messages),
+		History:   len(c.history),
+		Timestamp: time.Now(),
+	}
+	c.nextID++
+	c.checkpoints = append(c.checkpoints, cp)
+	c.append(logRecord{Kind: recordCheckpoint, Checkpoint: &cp})
+	return cp
+}
+
+// Checkpoints returns the checkpoints that can be rewound to, oldest first.
+func (c *Context) Checkpoints() []CheckpointInfo {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]CheckpointInfo, len(c.checkpoints))
+	copy(result, c.checkpoints)
+	return result
+}
+
+// RevertToCheckpoint drops all messages, history and checkpoints recorded
+// after the checkpoint with the given ID.
+func (c *Context) RevertToCheckpoint(id int) (CheckpointInfo, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	for _, cp := range c.checkpoints {
+		if cp.ID == id {
+			c.messages, c.history, c.checkpoints = revertState(c.messages, c.history, c.checkpoints, id)
+			c.append(logRecord{Kind: recordRevert, Checkpoint: &cp})
+			return cp, nil
+		}
+	}
+	return CheckpointInfo{}, fmt.Errorf("checkpoint %d does not exist", id)
+}
+
+// revertState truncates the state to checkpoint id. The checkpoint itself is kept.
+func revertState(messages []wire.Message, history []llm.Message, checkpoints []CheckpointInfo, id int) ([]wire.Message, []llm.Message, []CheckpointInfo) {
+	for i, cp := range checkpoints {
+		if cp.ID != id {
+			continue
+		}
+		if cp.Messages <= len(messages) {
+			messages = messages[:cp.Messages:cp.Messages]
+		}
+		if cp.History <= len(history) {
+			history = history[:cp.History:cp.History]
+		}
+		return messages, history, checkpoints[: i+1 : i+1]
+	}
+	return messages, history, checkpoints
+}
+
+// compactState replaces the first n history messages with summary and keeps
+// the checkpoints recorded after them, pointing into the new history.
+func compactState(history []llm.Message, checkpoints []CheckpointInfo, summary llm.Message, n int) ([]llm.Message, []CheckpointInfo) {
+	n = min(n, len(history))
+	compacted := make([]llm.Message, 0, len(history)-n+1)
+	compacted = append(compacted, summary)
+	compacted = append(compacted, history[n:]...)
+
+	var kept []CheckpointInfo
+	for _, cp := range checkpoints {
+		if cp.History >= n {
+			cp.History = cp.History - n + 1
+			kept = append(kept, cp)
+		}
+	}
+	return compacted, kept
+}
+
+// Checkpoints returns the checkpoints of the conversation.
+func (s *Soul) Checkpoints() []CheckpointInfo {
+	return s.Context.Checkpoints()
+}
+
+// isCheckpointMarker reports whether msg only tells the agent a checkpoint ID.
+func isCheckpointMarker(msg llm.Message) bool {
+	var id int
+	if msg.Role != "user" {
+		return false
+	}
+	_, err := fmt.Sscanf(msg.Content, checkpointMarker, &id)
+	return err == nil && msg.Content == fmt.Sprintf(checkpointMarker, id)
+}
+
+// checkpoint records a checkpoint. For agent steps the ID is also added to
+// the LLM history when the D-Mail tool is available, so the agent can name it.
+func (s *Soul) checkpoint(label string, agentStep bool) {
+	cp := s.Context.AddCheckpoint(label)
+	if agentStep && s.dmailTool() != nil {
+		s.appendHistory(llm.Message{
+			Role:    "user",
+			Content: fmt.Sprintf(checkpointMarker, cp.ID),
+		})
+	}
+}
+
+// rewindTo rolls the wire context and the LLM history back to a checkpoint.
+func (s *Soul) rewindTo(id int) error {
+	if _, err := s.Context.RevertToCheckpoint(id); err != nil {
+		return err
+	}
+	s.llmHistory = s.Context.History()
+
+	tokens := llm.EstimateTokens(s.buildLLMMessages())
+	s.mu.Lock()
+	s.tokenCount = tokens
+	s.mu.Unlock()
+	return nil
+}
+
+// handleRewind handles a rewind request from the front-end.
+// A note is processed as the next user message after the rewind.
+func (s *Soul) handleRewind(ctx context.Context, msg wire.Message) error {
+	req, ok := msg.RewindRequest()
+	if !ok {
+		return fmt.Errorf("invalid rewind request")
+	}
+	if err := s.rewindTo(req.CheckpointID); err != nil {
+		return err
+	}
+	s.emitRewind(req)
+
+	if req.Note == "" {
+		return nil
+	}
+	return s.handleUserInput(ctx, *wire.NewTextMessage(wire.MessageTypeUserInput, req.Note))
+}
+
+// emitRewind records a rewind notice. Front-ends reload the conversation from
+// the context when they receive it.
+func (s *Soul) emitRewind(req wire.RewindRequest) {
+	notice := wire.NewRewindMessage(req)
+	s.Context.AddMessage(*notice)
+	if s.OnMessage != nil {
+		s.OnMessage(*notice)
+	}
+}
+
+// deliverDMail applies a D-Mail sent by the agent during the last tool step.
+func (s *Soul) deliverDMail(dmail DMail) {
+	if err := s.rewindTo(dmail.CheckpointID); err != nil {
+		s.appendHistory(llm.Message{
+			Role:    "user",
+			Content: fmt.Sprintf("<system>The D-Mail could not be delivered: %v</system>", err),
+		})
+		return
+	}
+	s.emitRewind(wire.RewindRequest{CheckpointID: dmail.CheckpointID, Note: dmail.Message})
+	s.appendHistory(llm.Message{
+		Role:    "user",
+		Content: dmailPrefix + dmail.Message,
+	})
+}
+
+// ParseRewindCommand parses a "/rewind [checkpoint] [note]" command.
+// list is true when no checkpoint is given.
+func ParseRewindCommand(input string) (req wire.RewindRequest, list bool, err error) {
+	fields := strings.Fields(input)
+	if len(fields) == 0 || fields[0] != "/rewind" {
+		return req, false, fmt.Errorf("not a rewind command")
+	}
+	if len(fields) == 1 {
+		return req, true, nil
+	}
+
+	id, err := strconv.Atoi(fields[1])
+	if err != nil || id < 0 {
+		return req, false, fmt.Errorf("invalid checkpoint: %s", fields[1])
+	}
+	req.CheckpointID = id
+
+	// Keep the note as typed after the checkpoint number
+	rest := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(input), "/rewind"))
+	req.Note = strings.TrimSpace(strings.TrimPrefix(rest, fields[1]))
+	return req, false, nil
+}
+
+// FormatCheckpoints renders checkpoints for display, one per line.
+func FormatCheckpoints(checkpoints []CheckpointInfo) string {
+	if len(checkpoints) == 0 {
+		return "No checkpoints yet."
+	}
+	var b strings.Builder
+	b.WriteString("Checkpoints (use /rewind <id> [note]):")
+	for _, cp := range checkpoints {
+		fmt.Fprintf(&b, "\n  [%d] %s  %s", cp.ID, cp.Timestamp.Format("15:04:05"), cp.Label)
+	}
+	return b.String()
+}
+
+// checkpointLabel shortens user input for use as a checkpoint label.
+func checkpointLabel(text string) string {
+	return "before: " + shortenLabel(text, 40)
+}
+
+// shortenLabel collapses whitespace and cuts text to at most n runes.
+func shortenLabel(text string, n int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	if r := []rune(text); len(r) > n {
+		text = string(r[:n]) + "..."
+	}
+	return text
+}
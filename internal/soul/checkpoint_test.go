@@ -0,0 +1,307 @@
+package soul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+// capturingLLMServer returns responses in order and records every request.
+func capturingLLMServer(t *testing.T, responses []llm.ChatResponse) (*httptest.Server, func() []llm.ChatRequest) {
+	t.Helper()
+	var mu sync.Mutex
+	var requests []llm.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llm.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		idx := len(requests) - 1
+		mu.Unlock()
+		if idx >= len(responses) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(responses[idx])
+	}))
+	return server, func() []llm.ChatRequest {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]llm.ChatRequest(nil), requests...)
+	}
+}
+
+func TestContext_Checkpoints_Revert(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AddMessage(testMsg(wire.MessageTypeUserInput, "one"))
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "one"})
+	cp := ctx.AddCheckpoint("after one")
+	ctx.AddMessage(testMsg(wire.MessageTypeUserInput, "two"))
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "two"})
+	ctx.AddCheckpoint("after two")
+
+	if cp.ID != 0 || len(ctx.Checkpoints()) != 2 || ctx.Checkpoints()[1].ID != 1 {
+		t.Fatalf("unexpected checkpoints: %+v", ctx.Checkpoints())
+	}
+
+	if _, err := ctx.RevertToCheckpoint(cp.ID); err != nil {
+		t.Fatalf("RevertToCheckpoint failed: %v", err)
+	}
+	if len(ctx.GetMessages()) != 1 || len(ctx.History()) != 1 {
+		t.Errorf("expected 1 message and 1 history entry, got %d and %d", len(ctx.GetMessages()), len(ctx.History()))
+	}
+	if len(ctx.Checkpoints()) != 1 {
+		t.Errorf("later checkpoints should be dropped, got %+v", ctx.Checkpoints())
+	}
+	if _, err := ctx.RevertToCheckpoint(5); err == nil {
+		t.Error("expected error for unknown checkpoint")
+	}
+	ctx.Close()
+
+	// The revert is replayed from the log
+	restored := restoredContext(t, path)
+	if len(restored.GetMessages()) != 1 || len(restored.History()) != 1 || len(restored.Checkpoints()) != 1 {
+		t.Errorf("unexpected restored state: %d messages, %d history, %d checkpoints",
+			len(restored.GetMessages()), len(restored.History()), len(restored.Checkpoints()))
+	}
+}
+
+func TestContext_SetHistory_DropsCheckpoints(t *testing.T) {
+	ctx := NewContext("")
+	ctx.AddCheckpoint("start")
+	ctx.SetHistory([]llm.Message{{Role: "user", Content: "summary"}})
+	if len(ctx.Checkpoints()) != 0 {
+		t.Errorf("checkpoints should be dropped after the history is replaced")
+	}
+}
+
+func TestContext_CompactHistory_KeepsLaterCheckpoints(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AddCheckpoint("one")
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "a"}, llm.Message{Role: "assistant", Content: "b"})
+	ctx.AddCheckpoint("two")
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "c"}, llm.Message{Role: "assistant", Content: "d"})
+	ctx.AddCheckpoint("three")
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "e"})
+	ctx.CompactHistory(llm.Message{Role: "user", Content: "summary"}, 3)
+	ctx.Close()
+
+	for name, c := range map[string]*Context{"live": ctx, "restored": restoredContext(t, path)} {
+		cps := c.Checkpoints()
+		if len(cps) != 1 || cps[0].ID != 2 || cps[0].History != 2 {
+			t.Errorf("%s: expected checkpoint 2 at history 2, got %+v", name, cps)
+			continue
+		}
+		if _, err := c.RevertToCheckpoint(2); err != nil {
+			t.Fatalf("%s: RevertToCheckpoint failed: %v", name, err)
+		}
+		if h := c.History(); len(h) != 2 || h[0].Content != "summary" || h[1].Content != "d" {
+			t.Errorf("%s: unexpected history after revert: %+v", name, h)
+		}
+	}
+}
+
+func TestContext_CheckpointIDsNotReused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AddCheckpoint("one")
+	ctx.AddCheckpoint("two")
+	ctx.SetHistory([]llm.Message{{Role: "user", Content: fmt.Sprintf(checkpointMarker, 1)}})
+
+	// The compacted history still names checkpoint 1
+	if cp := ctx.AddCheckpoint("after compaction"); cp.ID != 2 {
+		t.Errorf("expected ID 2 after compaction, got %d", cp.ID)
+	}
+	if _, err := ctx.RevertToCheckpoint(1); err == nil {
+		t.Error("a checkpoint dropped by compaction should not be found")
+	}
+	ctx.Close()
+
+	restored := restoredContext(t, path)
+	if cp := restored.AddCheckpoint("resumed"); cp.ID != 3 {
+		t.Errorf("expected ID 3 after resuming, got %d", cp.ID)
+	}
+}
+
+func TestSoul_Rewind(t *testing.T) {
+	server, _ := capturingLLMServer(t, []llm.ChatResponse{
+		textResponse("first answer"),
+		textResponse("second answer"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	var notices []wire.Message
+	s.OnMessage = func(msg wire.Message) {
+		if msg.Type == wire.MessageTypeRewind {
+			notices = append(notices, msg)
+		}
+	}
+
+	for _, text := range []string{"one", "two"} {
+		if err := s.processMessage(context.Background(), testMsg(wire.MessageTypeUserInput, text)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Each turn records a checkpoint before the user message and one per step
+	checkpoints := s.Checkpoints()
+	if len(checkpoints) != 4 {
+		t.Fatalf("expected 4 checkpoints, got %d: %+v", len(checkpoints), checkpoints)
+	}
+	if !strings.Contains(checkpoints[2].Label, "two") {
+		t.Errorf("turn checkpoint should mention the input, got %q", checkpoints[2].Label)
+	}
+
+	rewind := wire.NewRewindMessage(wire.RewindRequest{CheckpointID: checkpoints[2].ID})
+	if err := s.processMessage(context.Background(), *rewind); err != nil {
+		t.Fatalf("rewind failed: %v", err)
+	}
+
+	if len(s.llmHistory) != 2 || s.llmHistory[1].Content != "first answer" {
+		t.Errorf("LLM history should end with the first turn, got %+v", s.llmHistory)
+	}
+	msgs := s.Context.GetMessages()
+	if last := msgs[len(msgs)-1]; last.Type != wire.MessageTypeRewind {
+		t.Errorf("expected rewind notice last, got %s", last.Type)
+	}
+	for _, msg := range msgs {
+		if extractText(msg) == "two" {
+			t.Error("rewound user message should be removed from context")
+		}
+	}
+	if len(notices) != 1 {
+		t.Errorf("expected 1 rewind notice, got %d", len(notices))
+	}
+}
+
+func TestSoul_Rewind_WithNote(t *testing.T) {
+	server, requests := capturingLLMServer(t, []llm.ChatResponse{
+		textResponse("tried X"),
+		textResponse("trying Y"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	if err := s.processMessage(context.Background(), testMsg(wire.MessageTypeUserInput, "do it")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	rewind := wire.NewRewindMessage(wire.RewindRequest{CheckpointID: 0, Note: "X failed, try Y"})
+	if err := s.processMessage(context.Background(), *rewind); err != nil {
+		t.Fatalf("rewind failed: %v", err)
+	}
+
+	// The note is the only user message of the new attempt
+	last := requests()[1]
+	if len(last.Messages) != 2 || last.Messages[1].Content != "X failed, try Y" {
+		t.Errorf("unexpected request after rewind: %+v", last.Messages)
+	}
+}
+
+func TestSoul_Rewind_UnknownCheckpoint(t *testing.T) {
+	s := NewSoul(NewAgent("test", "", NewRuntime(t.TempDir(), true)), NewContext(""))
+	rewind := wire.NewRewindMessage(wire.RewindRequest{CheckpointID: 3})
+	if err := s.processMessage(context.Background(), *rewind); err == nil {
+		t.Error("expected error for unknown checkpoint")
+	}
+}
+
+func TestSoul_DMail(t *testing.T) {
+	server, requests := capturingLLMServer(t, []llm.ChatResponse{
+		toolCallResponse("call_1", DMailToolName, `{"checkpoint_id":1,"message":"the file does not exist"}`),
+		textResponse("ok"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.runtime.RegisterTool(NewDMailTool())
+
+	if err := s.processMessage(context.Background(), testMsg(wire.MessageTypeUserInput, "read the file")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	reqs := requests()
+	if len(reqs) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(reqs))
+	}
+	// The first step shows the agent its checkpoint
+	first := reqs[0].Messages
+	if got := first[len(first)-1].Content; got != "<system>CHECKPOINT 1</system>" {
+		t.Errorf("expected checkpoint marker, got %q", got)
+	}
+
+	// After the D-Mail the tool call is gone and the message is delivered
+	second := reqs[1].Messages
+	for _, msg := range second {
+		if len(msg.ToolCalls) > 0 || msg.Role == "tool" {
+			t.Errorf("rewound tool call should not be sent again: %+v", msg)
+		}
+	}
+	var delivered bool
+	for _, msg := range second {
+		if strings.HasPrefix(msg.Content, dmailPrefix) && strings.HasSuffix(msg.Content, "the file does not exist") {
+			delivered = true
+		}
+	}
+	if !delivered {
+		t.Errorf("D-Mail should be delivered, got %+v", second)
+	}
+}
+
+func TestDMailTool_OnePerStep(t *testing.T) {
+	tool := NewDMailTool()
+	args := json.RawMessage(`{"checkpoint_id":0,"message":"hi"}`)
+	if _, err := tool.Execute(context.Background(), args); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if _, err := tool.Execute(context.Background(), args); err == nil {
+		t.Error("second D-Mail in the same step should fail")
+	}
+	if _, ok := tool.take(); !ok {
+		t.Error("expected a pending D-Mail")
+	}
+	if _, ok := tool.take(); ok {
+		t.Error("pending D-Mail should be cleared")
+	}
+}
+
+func TestParseRewindCommand(t *testing.T) {
+	tests := []struct {
+		input string
+		list  bool
+		id    int
+		note  string
+		err   bool
+	}{
+		{"/rewind", true, 0, "", false},
+		{"/rewind 3", false, 3, "", false},
+		{"/rewind 2 you tried X,  it failed", false, 2, "you tried X,  it failed", false},
+		{"/rewind abc", false, 0, "", true},
+		{"/rewind -1", false, 0, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			req, list, err := ParseRewindCommand(tt.input)
+			if (err != nil) != tt.err {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if list != tt.list || req.CheckpointID != tt.id || req.Note != tt.note {
+				t.Errorf("got list=%v req=%+v", list, req)
+			}
+		})
+	}
+}
@@ -0,0 +1,220 @@
+package soul
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+// compactionPreservedMessages is the number of most recent user/assistant
+// messages that are kept verbatim when the history is compacted.
+const compactionPreservedMessages = 2
+
+// compactionSystemPrompt instructs the LLM how to summarize the history.
+const compactionSystemPrompt = `You are a helpful assistant that compacts conversation context.
+
+You will be given the earlier part of a conversation between a user and an AI coding agent, including tool calls and tool results. Write a concise summary that preserves everything the agent needs to continue the task:
+
+- The user's goals, requirements and constraints
+- Important decisions made and the reasons for them
+- Files, commands and code locations that were inspected or changed
+- Errors encountered and how they were resolved
+- Work that is still pending
+
+Drop redundant tool output and small talk. Reply with the summary only.`
+
+// compactionSummaryPrefix precedes the summary inserted into the LLM history.
+const compactionSummaryPrefix = "Previous context has been compacted. Here is a summary of the conversation so far:\n\n"
+
+// TokenUsage holds token counts reported by the LLM.
+type TokenUsage struct {
+	PromptTokens     int `json:"prompt_tokens"`
+	CompletionTokens int `json:"completion_tokens"`
+}
+
+// Total returns the sum of prompt and completion tokens.
+func (u TokenUsage) Total() int {
+	return u.PromptTokens + u.CompletionTokens
+}
+
+// Usage returns the cumulative token usage of this soul.
+func (s *Soul) Usage() TokenUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.usage
+}
+
+// LastUsage returns the token usage of the most recent LLM step.
+func (s *Soul) LastUsage() TokenUsage {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.lastUsage
+}
+
+// ContextTokens returns the estimated size of the current LLM context in tokens.
+func (s *Soul) ContextTokens() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.tokenCount
+}
+
+// recordUsage updates token accounting after an LLM step.
+// If the step reported no usage, the context size is estimated from messages.
+func (s *Soul) recordUsage(usage llm.Usage, messages []llm.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	step := TokenUsage{
+		PromptTokens:     usage.PromptTokens,
+		CompletionTokens: usage.CompletionTokens,
+	}
+	s.lastUsage = step
+	s.usage.PromptTokens += step.PromptTokens
+	s.usage.CompletionTokens += step.CompletionTokens
+
+	if step.Total() > 0 {
+		s.tokenCount = step.Total()
+	} else {
+		s.tokenCount = llm.EstimateTokens(messages)
+	}
+}
+
+// addContextTokens grows the context estimate by messages appended after the last step.
+func (s *Soul) addContextTokens(messages ...llm.Message) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokenCount += llm.EstimateTokens(messages)
+}
+
+// shouldCompact reports whether the context is about to exceed the model's window.
+func (s *Soul) shouldCompact() bool {
+	if s.runtime.MaxContextSize <= 0 {
+		return false
+	}
+	return s.ContextTokens()+s.runtime.ReservedContextSize >= s.runtime.MaxContextSize
+}
+
+// compactContext summarizes older LLM history with an LLM call, keeping the
+// most recent exchanges intact. The system prompt is not part of llmHistory and
+// is therefore always preserved. It fails when compacting cannot bring the
+// context below the threshold, rather than summarizing again on every step.
+func (s *Soul) compactContext(ctx context.Context, client LLMClient) error {
+	toCompact, _ := splitForCompaction(s.llmHistory, compactionPreservedMessages)
+	if len(toCompact) == 0 || (len(toCompact) == 1 && isCompactionSummary(toCompact[0])) {
+		return fmt.Errorf("nothing left to compact: the most recent messages alone take ~%d tokens of the %d-token context window (%d reserved)",
+			s.ContextTokens(), s.runtime.MaxContextSize, s.runtime.ReservedContextSize)
+	}
+
+	resp, err := client.Chat(ctx, []llm.Message{
+		{Role: "system", Content: compactionSystemPrompt},
+		{Role: "user", Content: renderHistoryForCompaction(toCompact)},
+	})
+	if err != nil {
+		return err
+	}
+	if len(resp.Choices) == 0 {
+		return fmt.Errorf("LLM returned no choices")
+	}
+	summary := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if summary == "" {
+		return fmt.Errorf("LLM returned an empty summary")
+	}
+
+	// Checkpoints within the preserved messages can still be rewound to
+	s.Context.CompactHistory(llm.Message{
+		Role:    "user",
+		Content: compactionSummaryPrefix + summary,
+	}, len(toCompact))
+	s.llmHistory = s.Context.History()
+
+	tokensBefore := s.ContextTokens()
+	tokensAfter := llm.EstimateTokens(s.buildLLMMessages())
+
+	s.mu.Lock()
+	s.usage.PromptTokens += resp.Usage.PromptTokens
+	s.usage.CompletionTokens += resp.Usage.CompletionTokens
+	s.tokenCount = tokensAfter
+	s.mu.Unlock()
+
+	notice := wire.Message{
+		Type: wire.MessageTypeCompaction,
+		Content: []wire.ContentPart{{
+			Type: "text",
+			Text: fmt.Sprintf("Context compacted: %d messages summarized (~%d → ~%d tokens)",
+				len(toCompact), tokensBefore, tokensAfter),
+		}},
+		Metadata: map[string]any{
+			"compacted_messages": len(toCompact),
+			"tokens_before":      tokensBefore,
+			"tokens_after":       tokensAfter,
+		},
+		Timestamp: time.Now(),
+	}
+	s.Context.AddMessage(notice)
+	if s.OnMessage != nil {
+		s.OnMessage(notice)
+	}
+	if s.shouldCompact() {
+		return fmt.Errorf("the context still takes ~%d tokens after compaction, too many for the %d-token context window (%d reserved)",
+			tokensAfter, s.runtime.MaxContextSize, s.runtime.ReservedContextSize)
+	}
+	return nil
+}
+
+// isCompactionSummary reports whether msg is the summary of an earlier compaction.
+func isCompactionSummary(msg llm.Message) bool {
+	return msg.Role == "user" && strings.HasPrefix(msg.Content, compactionSummaryPrefix)
+}
+
+// splitForCompaction splits history into the part to summarize and the part
+// to keep. The kept part starts at the n-th most recent user/assistant
+// message, so an assistant message always stays together with its tool results.
+// Checkpoint markers are not counted, so they never push the user's prompt out.
+func splitForCompaction(history []llm.Message, n int) (toCompact, preserved []llm.Message) {
+	if n <= 0 {
+		return history, nil
+	}
+	count := 0
+	for i := len(history) - 1; i >= 0; i-- {
+		role := history[i].Role
+		if role != "user" && role != "assistant" || isCheckpointMarker(history[i]) {
+			continue
+		}
+		count++
+		if count == n {
+			return history[:i], history[i:]
+		}
+	}
+	return nil, history
+}
+
+// renderHistoryForCompaction formats messages as plain text for summarization.
+func renderHistoryForCompaction(messages []llm.Message) string {
+	var b strings.Builder
+	for i, msg := range messages {
+		fmt.Fprintf(&b, "## Message %d (%s)\n\n", i+1, msg.Role)
+		// Multimodal messages are rendered from their parts, images as placeholders
+		for _, part := range msg.Parts {
+			switch {
+			case part.Type == "text" && part.Text != "":
+				b.WriteString(part.Text)
+				b.WriteString("\n")
+			case part.ImageURL != nil:
+				b.WriteString("[image]\n")
+			}
+		}
+		if len(msg.Parts) == 0 && msg.Content != "" {
+			b.WriteString(msg.Content)
+			b.WriteString("\n")
+		}
+		for _, tc := range msg.ToolCalls {
+			fmt.Fprintf(&b, "[tool call] %s(%s)\n", tc.Function.Name, tc.Function.Arguments)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
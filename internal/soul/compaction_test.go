@@ -0,0 +1,285 @@
+package soul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+func usageResponse(content string, prompt, completion int) llm.ChatResponse {
+	resp := textResponse(content)
+	resp.Usage.PromptTokens = prompt
+	resp.Usage.CompletionTokens = completion
+	resp.Usage.TotalTokens = prompt + completion
+	return resp
+}
+
+func TestSplitForCompaction(t *testing.T) {
+	history := []llm.Message{
+		{Role: "user", Content: "first"},
+		{Role: "assistant", Content: "answer"},
+		{Role: "user", Content: "second"},
+		{Role: "assistant", ToolCalls: []llm.ToolCallInfo{{ID: "call_1"}}},
+		{Role: "tool", Content: "result", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "done"},
+	}
+
+	toCompact, preserved := splitForCompaction(history, 2)
+	if len(toCompact) != 3 {
+		t.Fatalf("expected 3 messages to compact, got %d", len(toCompact))
+	}
+	if len(preserved) != 3 {
+		t.Fatalf("expected 3 preserved messages, got %d", len(preserved))
+	}
+	// The assistant tool call must stay together with its tool result
+	if len(preserved[0].ToolCalls) != 1 || preserved[1].ToolCallID != "call_1" {
+		t.Errorf("tool call and result should be preserved together: %+v", preserved)
+	}
+}
+
+func TestSplitForCompaction_SkipsCheckpointMarkers(t *testing.T) {
+	history := []llm.Message{
+		{Role: "user", Content: "old question"},
+		{Role: "assistant", Content: "old answer"},
+		{Role: "user", Content: "fix the build"},
+		{Role: "user", Content: fmt.Sprintf(checkpointMarker, 1)},
+		{Role: "assistant", Content: "looking"},
+		{Role: "user", Content: fmt.Sprintf(checkpointMarker, 2)},
+	}
+	toCompact, preserved := splitForCompaction(history, 2)
+	if len(toCompact) != 2 || len(preserved) != 4 || preserved[0].Content != "fix the build" {
+		t.Errorf("the prompt should be preserved with the markers after it, got %+v", preserved)
+	}
+}
+
+func TestSplitForCompaction_ShortHistory(t *testing.T) {
+	history := []llm.Message{{Role: "user", Content: "only"}}
+	toCompact, preserved := splitForCompaction(history, 2)
+	if len(toCompact) != 0 {
+		t.Errorf("nothing should be compacted, got %d", len(toCompact))
+	}
+	if len(preserved) != 1 {
+		t.Errorf("expected 1 preserved message, got %d", len(preserved))
+	}
+}
+
+func TestRenderHistoryForCompaction_Multipart(t *testing.T) {
+	text := renderHistoryForCompaction([]llm.Message{
+		{Role: "user", Parts: []llm.ContentPart{llm.TextPart("what is in this screenshot?"), llm.ImagePart("image/png", []byte("png"))}},
+		{Role: "assistant", Content: "a login form"},
+	})
+	for _, want := range []string{"what is in this screenshot?\n[image]\n", "a login form"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("expected %q in:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "base64") {
+		t.Errorf("image data should not be rendered:\n%s", text)
+	}
+}
+
+func TestSoul_RecordUsage(t *testing.T) {
+	rt := NewRuntime(t.TempDir(), false)
+	s := NewSoul(NewAgent("test", "", rt), NewContext(""))
+
+	resp := usageResponse("ok", 100, 20)
+	s.recordUsage(resp.Usage, nil)
+	resp = usageResponse("ok", 150, 30)
+	s.recordUsage(resp.Usage, nil)
+
+	if got := s.LastUsage(); got.PromptTokens != 150 || got.CompletionTokens != 30 {
+		t.Errorf("unexpected last usage: %+v", got)
+	}
+	if got := s.Usage(); got.PromptTokens != 250 || got.CompletionTokens != 50 {
+		t.Errorf("unexpected cumulative usage: %+v", got)
+	}
+	if s.ContextTokens() != 180 {
+		t.Errorf("expected context tokens 180, got %d", s.ContextTokens())
+	}
+}
+
+func TestSoul_RecordUsage_EstimatesWithoutUsage(t *testing.T) {
+	rt := NewRuntime(t.TempDir(), false)
+	s := NewSoul(NewAgent("test", "", rt), NewContext(""))
+
+	s.recordUsage(llm.Usage{}, []llm.Message{{Role: "user", Content: strings.Repeat("a", 400)}})
+	if s.ContextTokens() != 100 {
+		t.Errorf("expected estimated 100 tokens, got %d", s.ContextTokens())
+	}
+}
+
+func TestSoul_ShouldCompact(t *testing.T) {
+	rt := NewRuntime(t.TempDir(), false)
+	s := NewSoul(NewAgent("test", "", rt), NewContext(""))
+	s.tokenCount = 900
+
+	if s.shouldCompact() {
+		t.Error("compaction should be disabled without MaxContextSize")
+	}
+
+	rt.MaxContextSize = 1000
+	rt.ReservedContextSize = 50
+	if s.shouldCompact() {
+		t.Error("should not compact below threshold")
+	}
+
+	rt.ReservedContextSize = 100
+	if !s.shouldCompact() {
+		t.Error("should compact when threshold is reached")
+	}
+}
+
+func TestSoul_ProcessWithLLM_CompactsContext(t *testing.T) {
+	responses := []llm.ChatResponse{
+		usageResponse("first answer", 800, 50),
+		usageResponse("second answer", 850, 50),
+		usageResponse("summary of earlier turns", 500, 20),
+		usageResponse("third answer", 100, 10),
+	}
+
+	var mu sync.Mutex
+	var requests []llm.ChatRequest
+	callIndex := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llm.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		requests = append(requests, req)
+		idx := callIndex
+		callIndex++
+		mu.Unlock()
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(responses[idx])
+	}))
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.runtime.MaxContextSize = 1000
+	s.runtime.ReservedContextSize = 100
+
+	var compactions []wire.Message
+	s.OnMessage = func(msg wire.Message) {
+		if msg.Type == wire.MessageTypeCompaction {
+			compactions = append(compactions, msg)
+		}
+	}
+
+	for _, text := range []string{"one", "two", "three"} {
+		if err := s.processWithLLM(context.Background(), testMsg(wire.MessageTypeUserInput, text)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if len(compactions) != 1 {
+		t.Fatalf("expected 1 compaction message, got %d", len(compactions))
+	}
+
+	// The compaction request summarizes the older history
+	compactReq := requests[2]
+	if compactReq.Messages[0].Role != "system" || compactReq.Messages[0].Content != compactionSystemPrompt {
+		t.Error("compaction request should use the compaction prompt")
+	}
+	if !strings.Contains(compactReq.Messages[1].Content, "first answer") {
+		t.Error("compaction request should contain the older history")
+	}
+
+	// The next request keeps the system prompt, the summary and the recent exchanges
+	finalReq := requests[3]
+	if finalReq.Messages[0].Role != "system" || finalReq.Messages[0].Content != "You are a test assistant." {
+		t.Errorf("system prompt should be preserved, got %+v", finalReq.Messages[0])
+	}
+	if !strings.Contains(finalReq.Messages[1].Content, "summary of earlier turns") {
+		t.Errorf("expected summary message, got %q", finalReq.Messages[1].Content)
+	}
+	last := finalReq.Messages[len(finalReq.Messages)-1]
+	if last.Role != "user" || last.Content != "three" {
+		t.Errorf("latest user message should be preserved, got %+v", last)
+	}
+	for _, msg := range finalReq.Messages {
+		if msg.Content == "one" {
+			t.Error("compacted message should not be sent again")
+		}
+	}
+
+	if got := s.Usage(); got.PromptTokens != 2250 {
+		t.Errorf("expected cumulative prompt tokens 2250, got %d", got.PromptTokens)
+	}
+	if len(s.Context.GetMessages()) == 0 {
+		t.Error("compaction notice should be recorded in context")
+	}
+}
+
+func TestSoul_CompactContext_LLMError(t *testing.T) {
+	server := mockLLMServer(t, nil)
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.llmHistory = []llm.Message{
+		{Role: "user", Content: "a"},
+		{Role: "assistant", Content: "b"},
+		{Role: "user", Content: "c"},
+		{Role: "assistant", Content: "d"},
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := s.compactContext(ctx, s.runtime.LLMClient); err == nil {
+		t.Fatal("expected error when summarization fails")
+	}
+	if len(s.llmHistory) != 4 {
+		t.Error("history should be unchanged after a failed compaction")
+	}
+}
+
+func TestSoul_CompactContext_NoProgress(t *testing.T) {
+	server, requests := capturingLLMServer(t, []llm.ChatResponse{textResponse("summary")})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.runtime.MaxContextSize = 1000
+	s.runtime.ReservedContextSize = 100
+	s.tokenCount = 2000
+
+	setHistory := func(history []llm.Message) {
+		s.Context.SetHistory(history)
+		s.llmHistory = s.Context.History()
+	}
+
+	// Only the previous summary is left to compact
+	setHistory([]llm.Message{
+		{Role: "user", Content: compactionSummaryPrefix + "earlier work"},
+		{Role: "user", Content: "read the log"},
+		{Role: "assistant", Content: strings.Repeat("log line\n", 1000)},
+	})
+	if err := s.compactContext(context.Background(), s.runtime.LLMClient); err == nil || !strings.Contains(err.Error(), "nothing left to compact") {
+		t.Errorf("expected a no-progress error, got %v", err)
+	}
+	if n := len(requests()); n != 0 {
+		t.Errorf("the summary should not be summarized again, got %d requests", n)
+	}
+
+	// Compacting older messages still leaves too large a context
+	setHistory([]llm.Message{
+		{Role: "user", Content: "a"},
+		{Role: "assistant", Content: "b"},
+		{Role: "user", Content: "read the log"},
+		{Role: "assistant", Content: strings.Repeat("log line\n", 1000)},
+	})
+	if err := s.compactContext(context.Background(), s.runtime.LLMClient); err == nil || !strings.Contains(err.Error(), "after compaction") {
+		t.Errorf("expected an error for a context that is still too large, got %v", err)
+	}
+	if n := len(requests()); n != 1 || len(s.llmHistory) != 3 {
+		t.Errorf("expected one summarization and a compacted history, got %d requests and %d messages", n, len(s.llmHistory))
+	}
+}
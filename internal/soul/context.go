@@ -7,23 +7,33 @@ import (
 	"sync"
 	"time"
 
+	"kimi-go/internal/llm"
 	"kimi-go/internal/wire"
 )
 
 // Context manages conversation history and state.
+//
+// When a file path is set, every change is appended to a JSONL log and
+// fsynced before the call returns, so a crash loses at most the record being
+// written. The LLM-level history, including tool calls and results, is logged
+// next to the wire messages so a resumed session continues the conversation.
 type Context struct {
-	mu       sync.RWMutex
-	messages []wire.Message
-	filePath string
-	modified bool
+	mu          sync.RWMutex
+	messages    []wire.Message
+	history     []llm.Message
+	checkpoints []CheckpointInfo
+	nextID      int // ID of the next checkpoint; never reused, see AddCheckpoint
+	filePath    string
+	file        *os.File // Append handle, opened on first write
+	err         error    // First write error, reported by Save
 }
 
 // NewContext creates a new context.
+// An empty filePath keeps the context in memory only.
 func NewContext(filePath string) *Context {
 	return &Context{
 		messages: make([]wire.Message, 0),
 		filePath: filePath,
-		modified: false,
 	}
 }
 
@@ -32,7 +42,7 @@ func (c *Context) AddMessage(msg wire.Message) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.messages = append(c.messages, msg)
-	c.modified = true
+	c.append(logRecord{Kind: recordMessage, Message: &msg})
 }
 
 // AddMessages adds multiple messages to the context.
@@ -40,7 +50,9 @@ func (c *Context) AddMessages(msgs ...wire.Message) {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.messages = append(c.messages, msgs...)
-	c.modified = true
+	for i := range msgs {
+		c.append(logRecord{Kind: recordMessage, Message: &msgs[i]})
+	}
 }
 
 // GetMessages returns all messages in the context.
@@ -66,43 +78,113 @@ func (c *Context) GetLastNMessages(n int) []wire.Message {
 	return result
 }
 
+// History returns a copy of the LLM-level history.
+func (c *Context) History() []llm.Message {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	result := make([]llm.Message, len(c.history))
+	copy(result, c.history)
+	return result
+}
+
+// AppendHistory appends messages to the LLM-level history.
+func (c *Context) AppendHistory(msgs ...llm.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = append(c.history, msgs...)
+	for i := range msgs {
+		c.append(logRecord{Kind: recordLLM, LLM: &msgs[i]})
+	}
+}
+
+// SetHistory replaces the LLM-level history.
+// Existing checkpoints are dropped because they point into the old history;
+// their IDs are not handed out again.
+func (c *Context) SetHistory(history []llm.Message) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history = make([]llm.Message, len(history))
+	copy(c.history, history)
+	c.checkpoints = nil
+	c.append(logRecord{Kind: recordSetHistory, History: c.history})
+}
+
+// CompactHistory replaces the first n messages of the LLM-level history with
+// a summary. Checkpoints within the summarized messages are dropped; later
+// ones are moved along with the messages they follow.
+func (c *Context) CompactHistory(summary llm.Message, n int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.history, c.checkpoints = compactState(c.history, c.checkpoints, summary, n)
+	c.append(logRecord{Kind: recordCompact, LLM: &summary, Compacted: n})
+}
+
 // Clear clears all messages.
 func (c *Context) Clear() {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 	c.messages = make([]wire.Message, 0)
-	c.modified = true
+	c.history = nil
+	c.checkpoints = nil
+	c.append(logRecord{Kind: recordReset})
 }
 
-// Save saves the context to file.
+// Save flushes the context log to disk.
+// Changes are written as they happen; Save reports the first write error.
 func (c *Context) Save() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	if !c.modified {
+	if c.err != nil {
+		return c.err
+	}
+	if c.file == nil {
 		return nil
 	}
-
-	data, err := json.MarshalIndent(c.messages, "", "  ")
-	if err != nil {
-		return fmt.Errorf("failed to marshal context: %w", err)
+	if err := c.file.Sync(); err != nil {
+		return fmt.Errorf("failed to sync context file: %w", err)
 	}
+	return nil
+}
 
-	if err := os.WriteFile(c.filePath, data, 0644); err != nil {
-		return fmt.Errorf("failed to write context file: %w", err)
-	}
+// Close closes the context log.
+func (c *Context) Close() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
 
-	c.modified = false
-	return nil
+	if c.file == nil {
+		return nil
+	}
+	err := c.file.Close()
+	c.file = nil
+	return err
 }
 
 // Restore loads the context from file.
+// A truncated last line left by a crash is dropped, and context files in the
+// old single-JSON formats are migrated to the log format in place.
 func (c *Context) Restore() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
+	// The file may be rewritten below; reopen it on the next append
+	if c.file != nil {
+		c.file.Close()
+		c.file = nil
+	}
+
 	if _, err := os.Stat(c.filePath); os.IsNotExist(err) {
-		return nil // No existing context
+		// A session created before the log format may still have a .json file
+		if legacy := legacyContextPath(c.filePath); legacy != "" {
+			if _, err := os.Stat(legacy); err == nil {
+				if err := migrateContextFile(legacy, c.filePath); err != nil {
+					return err
+				}
+			}
+		}
+		if _, err := os.Stat(c.filePath); os.IsNotExist(err) {
+			return nil // No existing context
+		}
 	}
 
 	data, err := os.ReadFile(c.filePath)
@@ -110,14 +192,33 @@ func (c *Context) Restore() error {
 		return fmt.Errorf("failed to read context file: %w", err)
 	}
 
-	var messages []wire.Message
-	if err := json.Unmarshal(data, &messages); err != nil {
-		return fmt.Errorf("failed to unmarshal context: %w", err)
+	if messages, history, ok, err := parseLegacyContext(data); ok {
+		if err != nil {
+			return fmt.Errorf("failed to unmarshal context: %w", err)
+		}
+		if err := writeContextLog(c.filePath, messages, history); err != nil {
+			return err
+		}
+		c.messages = messages
+		c.history = history
+		return nil
 	}
 
-	c.messages = messages
-	c.modified = false
-	return nil
+	state, err := replayContextLog(c.filePath, data)
+	if err != nil {
+		return err
+	}
+	c.messages = state.messages
+	c.history = state.history
+	c.checkpoints = state.checkpoints
+	c.nextID = state.nextID
+
+	// Answer tool calls that were cut off by a crash
+	for _, msg := range interruptedToolResults(c.history) {
+		c.history = append(c.history, msg)
+		c.append(logRecord{Kind: recordLLM, LLM: &msg})
+	}
+	return c.err
 }
 
 // Checkpoint creates a checkpoint of the current context.
@@ -144,7 +245,8 @@ func (c *Context) RestoreCheckpoint(cp wire.Checkpoint) error {
 	}
 
 	c.messages = messages
-	c.modified = true
+	c.checkpoints = nil
+	c.append(logRecord{Kind: recordReset, Messages: c.messages, History: c.history})
 	return nil
 }
 
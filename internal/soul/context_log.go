@@ -0,0 +1,372 @@
+package soul
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+// Record kinds of the context log.
+const (
+	recordMessage    = "message"     // Appends a wire message
+	recordLLM        = "llm"         // Appends an LLM history message
+	recordSetHistory = "set_history" // Replaces the LLM history
+	recordCompact    = "compact"     // Replaces the start of the LLM history with a summary
+	recordReset      = "reset"       // Replaces both messages and history
+	recordCheckpoint = "checkpoint"  // Records a checkpoint
+	recordRevert     = "revert"      // Rolls back to a checkpoint
+)
+
+// logRecord is one line of the JSONL context log.
+type logRecord struct {
+	Kind     string         `json:"kind"`
+	Message  *wire.Message  `json:"message,omitempty"`
+	LLM      *llm.Message   `json:"llm,omitempty"`
+	Messages []wire.Message `json:"messages,omitempty"`
+	History  []llm.Message  `json:"history,omitempty"`
+
+	Checkpoint *CheckpointInfo `json:"checkpoint,omitempty"`
+	Compacted  int             `json:"compacted,omitempty"` // History messages replaced by a compact record
+}
+
+// contextState is the result of replaying a context log.
+type contextState struct {
+	messages    []wire.Message
+	history     []llm.Message
+	checkpoints []CheckpointInfo
+	nextID      int // One past the highest checkpoint ID recorded
+}
+
+// apply applies a record to the state.
+func (s *contextState) apply(rec logRecord) error {
+	switch rec.Kind {
+	case recordMessage:
+		if rec.Message != nil {
+			s.messages = append(s.messages, *rec.Message)
+		}
+	case recordLLM:
+		if rec.LLM != nil {
+			s.history = append(s.history, *rec.LLM)
+		}
+	case recordSetHistory:
+		s.history = rec.History
+		s.checkpoints = nil
+	case recordCompact:
+		if rec.LLM == nil {
+			return fmt.Errorf("compact record without summary")
+		}
+		s.history, s.checkpoints = compactState(s.history, s.checkpoints, *rec.LLM, rec.Compacted)
+	case recordReset:
+		s.messages = rec.Messages
+		s.history = rec.History
+		s.checkpoints = nil
+	case recordCheckpoint:
+		if rec.Checkpoint != nil {
+			s.checkpoints = append(s.checkpoints, *rec.Checkpoint)
+			s.nextID = max(s.nextID, rec.Checkpoint.ID+1)
+		}
+	case recordRevert:
+		if rec.Checkpoint == nil {
+			return fmt.Errorf("revert record without checkpoint")
+		}
+		s.messages, s.history, s.checkpoints = revertState(s.messages, s.history, s.checkpoints, rec.Checkpoint.ID)
+	default:
+		return fmt.Errorf("unknown record kind %q", rec.Kind)
+	}
+	return nil
+}
+
+// append writes a record to the log and fsyncs it. The caller holds c.mu.
+// Write errors are kept and reported by the next Save.
+func (c *Context) append(rec logRecord) {
+	if c.filePath == "" || c.err != nil {
+		return
+	}
+
+	if c.file == nil {
+		f, err := os.OpenFile(c.filePath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+		if err != nil {
+			c.err = fmt.Errorf("failed to open context file: %w", err)
+			return
+		}
+		c.file = f
+	}
+
+	data, err := json.Marshal(rec)
+	if err != nil {
+		c.err = fmt.Errorf("failed to marshal context record: %w", err)
+		return
+	}
+	data = append(data, '\n')
+
+	if _, err := c.file.Write(data); err != nil {
+		c.err = fmt.Errorf("failed to write context file: %w", err)
+		return
+	}
+	if err := c.file.Sync(); err != nil {
+		c.err = fmt.Errorf("failed to sync context file: %w", err)
+	}
+}
+
+// replayContextLog rebuilds the state from the log in data.
+// A truncated last line is removed from the file so later appends start on a
+// clean line; any other malformed line is an error.
+func replayContextLog(path string, data []byte) (*contextState, error) {
+	state := &contextState{messages: make([]wire.Message, 0)}
+
+	lineNo := 0
+	for offset := 0; offset < len(data); {
+		lineNo++
+		line := data[offset:]
+		complete := false
+		if end := bytes.IndexByte(line, '\n'); end >= 0 {
+			line = line[:end]
+			complete = true
+		}
+		next := offset + len(line) + 1
+
+		if len(bytes.TrimSpace(line)) == 0 {
+			offset = next
+			continue
+		}
+
+		var rec logRecord
+		if err := json.Unmarshal(line, &rec); err != nil {
+			if !complete && isTruncatedJSON(err, line) {
+				// The process died while writing this record
+				if err := os.Truncate(path, int64(offset)); err != nil {
+					return nil, fmt.Errorf("failed to truncate context file: %w", err)
+				}
+				break
+			}
+			return nil, fmt.Errorf("failed to unmarshal context line %d: %w", lineNo, err)
+		}
+		if err := state.apply(rec); err != nil {
+			return nil, fmt.Errorf("context line %d: %w", lineNo, err)
+		}
+
+		if !complete {
+			// The record is whole but its newline was never written
+			if err := appendNewline(path); err != nil {
+				return nil, err
+			}
+		}
+		offset = next
+	}
+	return state, nil
+}
+
+// isTruncatedJSON reports whether err means line ended in the middle of a JSON value.
+func isTruncatedJSON(err error, line []byte) bool {
+	var syntaxErr *json.SyntaxError
+	return errors.As(err, &syntaxErr) && syntaxErr.Offset >= int64(len(line))
+}
+
+// appendNewline terminates the last line of the file.
+func appendNewline(path string) error {
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to open context file: %w", err)
+	}
+	defer f.Close()
+	if _, err := f.Write([]byte{'\n'}); err != nil {
+		return fmt.Errorf("failed to write context file: %w", err)
+	}
+	return f.Sync()
+}
+
+// writeContextLog atomically replaces path with a log holding messages and history.
+func writeContextLog(path string, messages []wire.Message, history []llm.Message) error {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	for i := range messages {
+		if err := enc.Encode(logRecord{Kind: recordMessage, Message: &messages[i]}); err != nil {
+			return fmt.Errorf("failed to marshal context record: %w", err)
+		}
+	}
+	for i := range history {
+		if err := enc.Encode(logRecord{Kind: recordLLM, LLM: &history[i]}); err != nil {
+			return fmt.Errorf("failed to marshal context record: %w", err)
+		}
+	}
+
+	tmp := path + ".tmp"
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("failed to create context file: %w", err)
+	}
+	if _, err := f.Write(buf.Bytes()); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to write context file: %w", err)
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return fmt.Errorf("failed to sync context file: %w", err)
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to close context file: %w", err)
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		os.Remove(tmp)
+		return fmt.Errorf("failed to replace context file: %w", err)
+	}
+	return nil
+}
+
+// legacyContextFile is the single-JSON context format used before the log.
+// Version 1 files are a bare JSON array of wire messages instead.
+type legacyContextFile struct {
+	Version  int            `json:"version"`
+	Messages []wire.Message `json:"messages"`
+	History  []llm.Message  `json:"llm_history"`
+}
+
+// parseLegacyContext parses data if it is in a legacy format.
+// ok is false when data is not a legacy context file.
+func parseLegacyContext(data []byte) (messages []wire.Message, history []llm.Message, ok bool, err error) {
+	trimmed := bytes.TrimSpace(data)
+	if len(trimmed) > 0 && trimmed[0] == '[' {
+		if err := json.Unmarshal(trimmed, &messages); err != nil {
+			return nil, nil, true, err
+		}
+		return messages, historyFromWire(messages), true, nil
+	}
+
+	var file legacyContextFile
+	if err := json.Unmarshal(trimmed, &file); err != nil || file.Version == 0 {
+		return nil, nil, false, nil
+	}
+	if file.Version > 2 {
+		return nil, nil, true, fmt.Errorf("unsupported context file version: %d", file.Version)
+	}
+	return file.Messages, file.History, true, nil
+}
+
+// historyFromWire rebuilds an approximate LLM history from wire messages.
+// Tool calls cannot be recovered, so only user and final assistant text is kept.
+func historyFromWire(messages []wire.Message) []llm.Message {
+	history := make([]llm.Message, 0, len(messages))
+	for _, msg := range messages {
+		var role string
+		switch msg.Type {
+		case wire.MessageTypeUserInput:
+			role = "user"
+		case wire.MessageTypeAssistant:
+			if msg.IsStreaming() {
+				continue
+			}
+			role = "assistant"
+		default:
+			continue
+		}
+		history = append(history, llm.Message{
+			Role:    role,
+			Content: extractText(msg),
+		})
+	}
+	return history
+}
+
+// interruptedToolResults returns error results for tool calls at the end of
+// history that never got one, which happens when the process dies while tools
+// are running. The API rejects histories with unanswered tool calls.
+func interruptedToolResults(history []llm.Message) []llm.Message {
+	i := len(history) - 1
+	for i >= 0 && history[i].Role == "tool" {
+		i--
+	}
+	if i < 0 || history[i].Role != "assistant" || len(history[i].ToolCalls) == 0 {
+		return nil
+	}
+
+	answered := make(map[string]bool)
+	for _, msg := range history[i+1:] {
+		answered[msg.ToolCallID] = true
+	}
+	var results []llm.Message
+	for _, tc := range history[i].ToolCalls {
+		if !answered[tc.ID] {
+			results = append(results, llm.Message{
+				Role:       "tool",
+				Content:    "Error: the tool call was interrupted",
+				ToolCallID: tc.ID,
+				IsError:    true,
+			})
+		}
+	}
+	return results
+}
+
+// legacyContextPath returns the .json path that preceded a .jsonl context path.
+func legacyContextPath(path string) string {
+	if !strings.HasSuffix(path, ".jsonl") {
+		return ""
+	}
+	return strings.TrimSuffix(path, "l")
+}
+
+// migrateContextFile converts the legacy context file src into a log at dst.
+// The original is kept with a .bak suffix.
+func migrateContextFile(src, dst string) error {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return fmt.Errorf("failed to read context file: %w", err)
+	}
+
+	messages, history, ok, err := parseLegacyContext(data)
+	if err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", src, err)
+	}
+	if ok {
+		err = writeContextLog(dst, messages, history)
+	} else {
+		// Already a log, only the name is outdated
+		err = os.WriteFile(dst, data, 0644)
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(src, src+".bak")
+}
+
+// MigrateLegacyContexts converts every .json context file in dir to the JSONL
+// log format. Files that already have a .jsonl counterpart are skipped, so the
+// migration runs once. It returns the number of migrated files.
+func MigrateLegacyContexts(dir string) (int, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, fmt.Errorf("failed to read contexts directory: %w", err)
+	}
+
+	migrated := 0
+	var errs []error
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		src := filepath.Join(dir, entry.Name())
+		dst := src + "l"
+		if _, err := os.Stat(dst); err == nil {
+			continue
+		}
+		if err := migrateContextFile(src, dst); err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		migrated++
+	}
+	return migrated, errors.Join(errs...)
+}
@@ -0,0 +1,240 @@
+package soul
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+// restoredContext opens the log at path in a fresh context.
+func restoredContext(t *testing.T, path string) *Context {
+	t.Helper()
+	ctx := NewContext(path)
+	if err := ctx.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	t.Cleanup(func() { ctx.Close() })
+	return ctx
+}
+
+func TestContext_AppendsEachMessage(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	defer ctx.Close()
+
+	ctx.AddMessage(testMsg(wire.MessageTypeUserInput, "hello"))
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "hello"})
+
+	// Written without an explicit Save
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("context file not written: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 log lines, got %d: %q", len(lines), data)
+	}
+	var rec logRecord
+	if err := json.Unmarshal([]byte(lines[0]), &rec); err != nil {
+		t.Fatalf("invalid log line: %v", err)
+	}
+	if rec.Kind != recordMessage || rec.Message == nil {
+		t.Errorf("unexpected record: %+v", rec)
+	}
+}
+
+func TestContext_Restore_TruncatedLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AddMessages(
+		testMsg(wire.MessageTypeUserInput, "one"),
+		testMsg(wire.MessageTypeAssistant, "two"),
+	)
+	ctx.Close()
+
+	// Simulate a crash in the middle of writing a record
+	f, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	f.WriteString(`{"kind":"message","message":{"type":"user_in`)
+	f.Close()
+
+	restored := restoredContext(t, path)
+	if n := len(restored.GetMessages()); n != 2 {
+		t.Fatalf("expected 2 messages, got %d", n)
+	}
+
+	// New records must start on a clean line
+	restored.AddMessage(testMsg(wire.MessageTypeUserInput, "three"))
+	restored.Close()
+	if n := len(restoredContext(t, path).GetMessages()); n != 3 {
+		t.Errorf("expected 3 messages after append, got %d", n)
+	}
+}
+
+func TestContext_Restore_UnterminatedLastLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AddMessage(testMsg(wire.MessageTypeUserInput, "one"))
+	ctx.Close()
+
+	// The record was written but its newline was not
+	data, _ := os.ReadFile(path)
+	os.WriteFile(path, bytes.TrimSuffix(data, []byte("\n")), 0644)
+
+	restored := restoredContext(t, path)
+	if n := len(restored.GetMessages()); n != 1 {
+		t.Fatalf("expected 1 message, got %d", n)
+	}
+	restored.AddMessage(testMsg(wire.MessageTypeAssistant, "two"))
+	restored.Close()
+	if n := len(restoredContext(t, path).GetMessages()); n != 2 {
+		t.Errorf("expected 2 messages after append, got %d", n)
+	}
+}
+
+func TestContext_Restore_CorruptedMiddleLine(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	content := `{"kind":"message","message":{"type":"user_input"}}` + "\n" +
+		`{"kind":"mess` + "\n" +
+		`{"kind":"message","message":{"type":"assistant"}}` + "\n"
+	os.WriteFile(path, []byte(content), 0644)
+
+	if err := NewContext(path).Restore(); err == nil {
+		t.Error("Restore should fail on a corrupted line that is not the last")
+	}
+}
+
+func TestContext_Restore_ReplaysHistoryChanges(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AppendHistory(
+		llm.Message{Role: "user", Content: "old"},
+		llm.Message{Role: "assistant", Content: "old answer"},
+	)
+	ctx.SetHistory([]llm.Message{{Role: "user", Content: "summary"}})
+	ctx.AppendHistory(llm.Message{Role: "assistant", Content: "new answer"})
+	ctx.Close()
+
+	history := restoredContext(t, path).History()
+	if len(history) != 2 || history[0].Content != "summary" || history[1].Content != "new answer" {
+		t.Errorf("unexpected history: %+v", history)
+	}
+}
+
+func TestContext_Restore_ClearedLog(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AddMessage(testMsg(wire.MessageTypeUserInput, "before"))
+	ctx.AppendHistory(llm.Message{Role: "user", Content: "before"})
+	ctx.Clear()
+	ctx.AddMessage(testMsg(wire.MessageTypeUserInput, "after"))
+	ctx.Close()
+
+	restored := restoredContext(t, path)
+	msgs := restored.GetMessages()
+	if len(msgs) != 1 || msgs[0].Content[0].Text != "after" {
+		t.Errorf("unexpected messages: %+v", msgs)
+	}
+	if len(restored.History()) != 0 {
+		t.Errorf("history should be cleared, got %+v", restored.History())
+	}
+}
+
+func TestContext_Restore_MigratesLegacyPath(t *testing.T) {
+	dir := t.TempDir()
+	legacy := filepath.Join(dir, "session.json")
+	data, _ := json.Marshal([]wire.Message{testMsg(wire.MessageTypeUserInput, "hello")})
+	os.WriteFile(legacy, data, 0644)
+
+	restored := restoredContext(t, filepath.Join(dir, "session.jsonl"))
+	if n := len(restored.GetMessages()); n != 1 {
+		t.Errorf("expected 1 migrated message, got %d", n)
+	}
+	if _, err := os.Stat(legacy + ".bak"); err != nil {
+		t.Errorf("legacy file should be kept as a backup: %v", err)
+	}
+}
+
+func TestMigrateLegacyContexts(t *testing.T) {
+	dir := t.TempDir()
+
+	v1, _ := json.Marshal([]wire.Message{
+		testMsg(wire.MessageTypeUserInput, "hi"),
+		testMsg(wire.MessageTypeAssistant, "hello"),
+	})
+	os.WriteFile(filepath.Join(dir, "a.json"), v1, 0644)
+
+	v2, _ := json.Marshal(legacyContextFile{
+		Version:  2,
+		Messages: []wire.Message{testMsg(wire.MessageTypeUserInput, "run ls")},
+		History: []llm.Message{
+			{Role: "user", Content: "run ls"},
+			{Role: "assistant", ToolCalls: []llm.ToolCallInfo{{ID: "call_1", Type: "function"}}},
+			{Role: "tool", Content: "a.go", ToolCallID: "call_1"},
+		},
+	})
+	os.WriteFile(filepath.Join(dir, "b.json"), v2, 0644)
+
+	n, err := MigrateLegacyContexts(dir)
+	if err != nil {
+		t.Fatalf("migration failed: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected 2 migrated files, got %d", n)
+	}
+
+	a := restoredContext(t, filepath.Join(dir, "a.jsonl"))
+	if len(a.GetMessages()) != 2 || len(a.History()) != 2 {
+		t.Errorf("unexpected v1 migration: %d messages, %d history", len(a.GetMessages()), len(a.History()))
+	}
+	b := restoredContext(t, filepath.Join(dir, "b.jsonl"))
+	if h := b.History(); len(h) != 3 || h[2].ToolCallID != "call_1" {
+		t.Errorf("unexpected v2 migration: %+v", h)
+	}
+
+	// The migration runs only once
+	n, err = MigrateLegacyContexts(dir)
+	if err != nil || n != 0 {
+		t.Errorf("second migration should do nothing, got n=%d err=%v", n, err)
+	}
+}
+
+func TestContext_Restore_InterruptedToolCalls(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "ctx.jsonl")
+	ctx := NewContext(path)
+	ctx.AppendHistory(
+		llm.Message{Role: "user", Content: "run two commands"},
+		llm.Message{Role: "assistant", ToolCalls: []llm.ToolCallInfo{{ID: "call_1"}, {ID: "call_2"}}},
+		llm.Message{Role: "tool", Content: "ok", ToolCallID: "call_1"},
+	)
+	ctx.Close()
+
+	history := restoredContext(t, path).History()
+	if len(history) != 4 {
+		t.Fatalf("expected 4 messages, got %d", len(history))
+	}
+	if history[3].Role != "tool" || history[3].ToolCallID != "call_2" {
+		t.Errorf("missing tool result should be added, got %+v", history[3])
+	}
+
+	// The added result is logged, so it is not added twice
+	if n := len(restoredContext(t, path).History()); n != 4 {
+		t.Errorf("expected 4 messages after second restore, got %d", n)
+	}
+}
+
+func TestInterruptedToolResults_Complete(t *testing.T) {
+	history := []llm.Message{
+		{Role: "assistant", ToolCalls: []llm.ToolCallInfo{{ID: "call_1"}}},
+		{Role: "tool", Content: "ok", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "done"},
+	}
+	if results := interruptedToolResults(history); len(results) != 0 {
+		t.Errorf("expected no results, got %+v", results)
+	}
+}
@@ -1,12 +1,14 @@
 package soul
 
 import (
+	"encoding/json"
 	"os"
 	"path/filepath"
 	"sync"
 	"testing"
 	"time"
 
+	"kimi-go/internal/llm"
 	"kimi-go/internal/wire"
 )
 
@@ -174,6 +176,89 @@ func TestContext_SaveRestore(t *testing.T) {
 	}
 }
 
+func TestContext_SaveRestore_History(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ctx.json")
+
+	history := []llm.Message{
+		{Role: "user", Content: "list files"},
+		{Role: "assistant", ToolCalls: []llm.ToolCallInfo{{
+			ID:       "call_1",
+			Type:     "function",
+			Function: llm.FunctionCall{Name: "shell", Arguments: `{"command":"ls"}`},
+		}}},
+		{Role: "tool", Content: "a.go", ToolCallID: "call_1"},
+		{Role: "assistant", Content: "There is a.go"},
+	}
+
+	ctx1 := NewContext(filePath)
+	ctx1.AddMessage(testMsg(wire.MessageTypeUserInput, "list files"))
+	ctx1.SetHistory(history)
+	if err := ctx1.Save(); err != nil {
+		t.Fatalf("Save failed: %v", err)
+	}
+
+	ctx2 := NewContext(filePath)
+	if err := ctx2.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+
+	got := ctx2.History()
+	if len(got) != len(history) {
+		t.Fatalf("expected %d history messages, got %d", len(history), len(got))
+	}
+	if len(got[1].ToolCalls) != 1 || got[1].ToolCalls[0].ID != "call_1" {
+		t.Errorf("tool call should be restored, got %+v", got[1])
+	}
+	if got[2].ToolCallID != "call_1" {
+		t.Errorf("tool_call_id should be restored, got %q", got[2].ToolCallID)
+	}
+	if len(ctx2.GetMessages()) != 1 {
+		t.Errorf("expected 1 wire message, got %d", len(ctx2.GetMessages()))
+	}
+}
+
+func TestContext_Restore_LegacyFormat(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ctx.json")
+
+	// Version 1 files are a bare array of wire messages
+	legacy := []wire.Message{
+		testMsg(wire.MessageTypeUserInput, "hello"),
+		testMsg(wire.MessageTypeToolCall, "Calling tool: shell({})"),
+		testMsg(wire.MessageTypeToolResult, "ok"),
+		testMsg(wire.MessageTypeAssistant, "hi there"),
+	}
+	data, _ := json.Marshal(legacy)
+	os.WriteFile(filePath, data, 0644)
+
+	ctx := NewContext(filePath)
+	if err := ctx.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	if len(ctx.GetMessages()) != 4 {
+		t.Errorf("expected 4 messages, got %d", len(ctx.GetMessages()))
+	}
+
+	history := ctx.History()
+	if len(history) != 2 {
+		t.Fatalf("expected 2 history messages, got %d", len(history))
+	}
+	if history[0].Role != "user" || history[0].Content != "hello" {
+		t.Errorf("unexpected user message: %+v", history[0])
+	}
+	if history[1].Role != "assistant" || history[1].Content != "hi there" {
+		t.Errorf("unexpected assistant message: %+v", history[1])
+	}
+}
+
+func TestContext_Restore_UnsupportedVersion(t *testing.T) {
+	filePath := filepath.Join(t.TempDir(), "ctx.json")
+	os.WriteFile(filePath, []byte(`{"version": 99, "messages": []}`), 0644)
+
+	if err := NewContext(filePath).Restore(); err == nil {
+		t.Error("Restore should fail on an unsupported version")
+	}
+}
+
 func TestContext_Save_NotModified(t *testing.T) {
 	dir := t.TempDir()
 	filePath := filepath.Join(dir, "ctx.json")
@@ -0,0 +1,113 @@
+package soul
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
+)
+
+// DMailToolName is the name of the D-Mail tool.
+const DMailToolName = "send_dmail"
+
+// DMail is a message the agent sends back to an earlier checkpoint.
+type DMail struct {
+	CheckpointID int    `json:"checkpoint_id"`
+	Message      string `json:"message"`
+}
+
+// DMailTool lets the agent roll the conversation back to a checkpoint and
+// leave a message for itself there. The rewind happens after the current
+// tool step finishes.
+type DMailTool struct {
+	mu      sync.Mutex
+	pending *DMail
+}
+
+// NewDMailTool creates a new D-Mail tool.
+func NewDMailTool() *DMailTool {
+	return &DMailTool{}
+}
+
+// Name returns the tool name.
+func (t *DMailTool) Name() string {
+	return DMailToolName
+}
+
+// Description returns the tool description.
+func (t *DMailTool) Description() string {
+	return "Send a message back to an earlier checkpoint of this conversation. " +
+		"Checkpoints appear in the conversation as <system>CHECKPOINT N</system>. " +
+		"Everything after the checkpoint is discarded and you continue from there with only the message, " +
+		"so use it when an approach turned out to be wrong: describe what you tried, what you learned and what to do instead. " +
+		"File changes made in the meantime are NOT reverted."
+}
+
+// Parameters returns the JSON schema for the tool parameters.
+func (t *DMailTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"checkpoint_id": {
+				"type": "integer",
+				"description": "The checkpoint to send the message to"
+			},
+			"message": {
+				"type": "string",
+				"description": "The message for your past self"
+			}
+		},
+		"required": ["checkpoint_id", "message"]
+	}`)
+}
+
+// ApprovalAction implements tools.Approvable. Sending a D-Mail only changes
+// the conversation, so it needs no approval.
+func (t *DMailTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	return "", "", false
+}
+
+// Execute queues the D-Mail for delivery after the current step.
+func (t *DMailTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var dmail DMail
+	if err := json.Unmarshal(args, &dmail); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if dmail.CheckpointID < 0 {
+		return nil, fmt.Errorf("invalid checkpoint: %d", dmail.CheckpointID)
+	}
+	if strings.TrimSpace(dmail.Message) == "" {
+		return nil, fmt.Errorf("message is required")
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending != nil {
+		return nil, fmt.Errorf("only one D-Mail can be sent per step")
+	}
+	t.pending = &dmail
+	return "D-Mail sent. The conversation will be rewound to the checkpoint.", nil
+}
+
+// take returns and clears the pending D-Mail.
+func (t *DMailTool) take() (DMail, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.pending == nil {
+		return DMail{}, false
+	}
+	dmail := *t.pending
+	t.pending = nil
+	return dmail, true
+}
+
+// dmailTool returns the registered D-Mail tool, if any.
+func (s *Soul) dmailTool() *DMailTool {
+	tool, err := s.runtime.Tools.Get(DMailToolName)
+	if err != nil {
+		return nil
+	}
+	d, _ := tool.(*DMailTool)
+	return d
+}
@@ -0,0 +1,68 @@
+package soul
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"kimi-go/internal/tools"
+)
+
+// unsafeFileChars matches characters not used in saved output file names.
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9._-]`)
+
+// toolResult builds the result of a successful tool call. Strings and
+// ModelTexter results are sent to the model as text and other values as
+// JSON; the output limits of the runtime and the tool apply, and truncated
+// output is saved in full.
+func (s *Soul) toolResult(call tools.ToolCall, tool tools.Tool, v any) *tools.ToolResult {
+	result := &tools.ToolResult{CallID: call.ID, Success: true, Result: tools.ResultText(v)}
+	if d, ok := v.(tools.Displayable); ok {
+		result.Display = d.Display()
+	}
+	if c, ok := v.(tools.ImageCarrier); ok {
+		result.Images = c.Images()
+	}
+
+	limits := s.runtime.OutputLimits
+	if l, ok := tool.(tools.OutputLimiter); ok {
+		limits = limits.Override(l.OutputLimits())
+	}
+	text, truncated := tools.TruncateOutput(result.Result, limits)
+	if !truncated {
+		return result
+	}
+
+	note := "[Output truncated.]"
+	if path, err := s.saveToolOutput(call.ID, result.Result); err == nil {
+		result.OutputPath = path
+		note = fmt.Sprintf("[Output truncated. The full output (%d lines) is saved at %s; "+
+			"read it with the file tool, using offset and limit to page through it.]",
+			strings.Count(result.Result, "\n")+1, path)
+	}
+	result.Result = text + "\n" + note
+	result.Truncated = true
+	return result
+}
+
+// saveToolOutput writes the full output of a tool call to the runtime's
+// output directory and returns the file's path.
+func (s *Soul) saveToolOutput(callID, output string) (string, error) {
+	if s.runtime.OutputDir == "" {
+		return "", fmt.Errorf("no output directory")
+	}
+	if err := os.MkdirAll(s.runtime.OutputDir, 0755); err != nil {
+		return "", err
+	}
+	name := unsafeFileChars.ReplaceAllString(callID, "_")
+	if name == "" {
+		name = "output"
+	}
+	path := filepath.Join(s.runtime.OutputDir, name+".txt")
+	if err := os.WriteFile(path, []byte(output), 0644); err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,122 @@
+package soul
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/tools"
+	"kimi-go/internal/wire"
+)
+
+// limitedTool is a tool with its own output limits.
+type limitedTool struct{ limits tools.OutputLimits }
+
+func (t limitedTool) Name() string                { return "limited" }
+func (t limitedTool) Description() string         { return "test tool" }
+func (t limitedTool) Parameters() json.RawMessage { return json.RawMessage(`{}`) }
+func (t limitedTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	return "", nil
+}
+func (t limitedTool) OutputLimits() tools.OutputLimits { return t.limits }
+
+func TestSoul_ToolOutputTruncated(t *testing.T) {
+	server := mockLLMServer(t, []llm.ChatResponse{
+		toolCallResponse("call_1", "shell", `{"command":"seq 1 1000"}`),
+		textResponse("done"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.runtime.OutputLimits = tools.OutputLimits{MaxChars: 200, MaxLineLength: 50}
+	s.runtime.OutputDir = t.TempDir()
+	var results []tools.ToolResult
+	s.OnToolResult = func(tr tools.ToolResult) {
+		results = append(results, tr)
+	}
+
+	if err := s.processWithLLM(context.Background(), testMsg(wire.MessageTypeUserInput, "count")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(results) != 1 || !results[0].Truncated {
+		t.Fatalf("expected a truncated result, got %+v", results)
+	}
+
+	r := results[0]
+	if !strings.HasPrefix(r.Result, "1\n2\n3\n") || !strings.Contains(r.Result, "999\n1000\n") {
+		t.Errorf("head and tail should be kept:\n%s", r.Result)
+	}
+	if !strings.Contains(r.Result, "characters omitted") || !strings.Contains(r.Result, r.OutputPath) {
+		t.Errorf("result should note the truncation and the saved output:\n%s", r.Result)
+	}
+	if filepath.Dir(r.OutputPath) != s.runtime.OutputDir {
+		t.Errorf("output saved outside the output directory: %s", r.OutputPath)
+	}
+	if data, err := os.ReadFile(r.OutputPath); err != nil || strings.Count(string(data), "\n") != 1000 {
+		t.Errorf("full output not saved: %v", err)
+	}
+
+	// The model gets the truncated text
+	toolMsg := s.llmHistory[2]
+	if toolMsg.Role != "tool" || toolMsg.Content != r.Result {
+		t.Errorf("unexpected tool message: %+v", toolMsg)
+	}
+}
+
+func TestSoul_ToolOutputDisplay(t *testing.T) {
+	server := mockLLMServer(t, []llm.ChatResponse{
+		toolCallResponse("call_1", "file", `{"operation":"edit","path":"a.txt","old_string":"old","new_string":"new"}`),
+		textResponse("done"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.runtime.RegisterTool(tools.NewFileTool(s.runtime.WorkDir))
+	os.WriteFile(filepath.Join(s.runtime.WorkDir, "a.txt"), []byte("old\n"), 0644)
+	var display []string
+	s.OnMessage = func(msg wire.Message) {
+		if msg.Type == wire.MessageTypeToolResult {
+			display = append(display, extractText(msg))
+		}
+	}
+
+	if err := s.processWithLLM(context.Background(), testMsg(wire.MessageTypeUserInput, "edit")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// The user sees the diff, the model a short confirmation
+	if len(display) != 1 || !strings.Contains(display[0], "-old\n+new") {
+		t.Errorf("tool result display should be the diff, got %q", display)
+	}
+	if content := s.llmHistory[2].Content; !strings.HasPrefix(content, "Replaced 1 occurrence") || strings.Contains(content, "+new") {
+		t.Errorf("unexpected model output: %q", content)
+	}
+}
+
+func TestSoul_ToolResultPerToolLimits(t *testing.T) {
+	s := setupSoul(t, mockLLMServer(t, nil))
+	s.runtime.OutputLimits = tools.OutputLimits{MaxChars: 100, MaxLineLength: 10}
+	call := tools.ToolCall{ID: "call/1", Name: "limited"}
+
+	// Without an output directory the note has no path
+	r := s.toolResult(call, limitedTool{}, strings.Repeat("x", 20))
+	if !r.Truncated || r.OutputPath != "" || !strings.HasSuffix(r.Result, "[Output truncated.]") {
+		t.Errorf("expected truncation without a saved file, got %+v", r)
+	}
+
+	// The tool's own limit replaces the global one
+	r = s.toolResult(call, limitedTool{limits: tools.OutputLimits{MaxLineLength: 50}}, strings.Repeat("x", 20))
+	if r.Truncated || r.Result != strings.Repeat("x", 20) {
+		t.Errorf("per-tool limit not applied, got %+v", r)
+	}
+
+	s.runtime.OutputDir = t.TempDir()
+	r = s.toolResult(call, limitedTool{}, strings.Repeat("y", 20))
+	if filepath.Base(r.OutputPath) != "call_1.txt" {
+		t.Errorf("unexpected output path: %q", r.OutputPath)
+	}
+}
@@ -5,33 +5,45 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"strings"
 	"sync"
 	"time"
 
 	"kimi-go/internal/llm"
+	"kimi-go/internal/snapshot"
 	"kimi-go/internal/tools"
 	"kimi-go/internal/wire"
 )
 
-// LLMClient 定义 LLM 客户端接口
-type LLMClient interface {
-	Chat(ctx context.Context, messages []llm.Message) (*llm.ChatResponse, error)
-	ChatWithTools(ctx context.Context, messages []llm.Message, tools []llm.ToolDef) (*llm.ChatResponse, error)
-	ChatStream(ctx context.Context, messages []llm.Message) (<-chan llm.ChatResponse, <-chan error)
-	ChatStreamWithTools(ctx context.Context, messages []llm.Message, tools []llm.ToolDef) (<-chan llm.ChatResponse, <-chan error)
-}
+// toolOutputInterval is how often output of running tools is passed on.
+const toolOutputInterval = 100 * time.Millisecond
+
+// LLMClient 定义 LLM 客户端接口，由 llm.NewProvider 按 provider 类型创建
+type LLMClient = llm.Provider
 
 // Runtime provides the execution environment for the agent.
 type Runtime struct {
-	WorkDir     string
-	Config      map[string]any
-	Tools       *tools.ToolSet
-	LLMClient   LLMClient
-	YOLO        bool // Auto-approve mode
-	MaxSteps    int
-	MaxRetries  int
+	WorkDir      string
+	Config       map[string]any
+	Tools        *tools.ToolSet
+	LLMClient    LLMClient
+	YOLO         bool      // Auto-approve mode
+	Approval     *Approval // Approval state shared by the session
+	MaxSteps     int
+	MaxRetries   int
 	UseStreaming bool // Enable streaming mode for responses
+
+	// Snapshots of the work directory taken before turns that run tools;
+	// nil disables snapshots and /undo
+	Snapshots *snapshot.Store
+
+	// Limits on the tool output sent to the model; tools may override them.
+	// Truncated output is saved in full under OutputDir when it is set.
+	OutputLimits tools.OutputLimits
+	OutputDir    string
+
+	// Context window management; compaction is disabled when MaxContextSize is 0
+	MaxContextSize      int // Model context window in tokens
+	ReservedContextSize int // Tokens kept free for the next response
 }
 
 // NewRuntime creates a new runtime.
@@ -41,9 +53,11 @@ func NewRuntime(workDir string, yolo bool) *Runtime {
 		Config:       make(map[string]any),
 		Tools:        tools.NewToolSet(),
 		YOLO:         yolo,
+		Approval:     NewApproval(),
 		MaxSteps:     100,
 		MaxRetries:   3,
 		UseStreaming: true, // Enable streaming by default
+		OutputLimits: tools.DefaultOutputLimits,
 	}
 }
 
@@ -89,6 +103,15 @@ type Soul struct {
 	// LLM conversation history (separate from wire context)
 	llmHistory []llm.Message
 
+	// Current turn, for the workspace snapshot taken before its first tool step
+	turnLabel       string
+	turnSnapshotted bool
+
+	// Token accounting (guarded by mu)
+	tokenCount int        // Estimated size of the current LLM context
+	usage      TokenUsage // Cumulative usage reported by the LLM
+	lastUsage  TokenUsage // Usage of the most recent step
+
 	// DoneCh is closed after each message is fully processed
 	DoneCh chan struct{}
 
@@ -101,14 +124,17 @@ type Soul struct {
 }
 
 // NewSoul creates a new Soul instance.
+// The LLM history is taken from ctx, so a restored context resumes the conversation.
 func NewSoul(agent *Agent, ctx *Context) *Soul {
+	history := ctx.History()
 	return &Soul{
 		Agent:      agent,
 		Context:    ctx,
 		runtime:    agent.Runtime,
 		cancelCh:   make(chan struct{}),
 		msgCh:      make(chan wire.Message, 100),
-		llmHistory: make([]llm.Message, 0),
+		llmHistory: history,
+		tokenCount: llm.EstimateTokens(history),
 		DoneCh:     make(chan struct{}, 1),
 	}
 }
@@ -183,6 +209,10 @@ func (s *Soul) processMessage(ctx context.Context, msg wire.Message) error {
 	switch msg.Type {
 	case wire.MessageTypeUserInput:
 		return s.handleUserInput(ctx, msg)
+	case wire.MessageTypeRewind:
+		return s.handleRewind(ctx, msg)
+	case wire.MessageTypeUndo:
+		return s.handleUndo(ctx, msg)
 	case wire.MessageTypeCancel:
 		s.Cancel()
 		return nil
@@ -193,6 +223,11 @@ func (s *Soul) processMessage(ctx context.Context, msg wire.Message) error {
 
 // handleUserInput handles user input messages.
 func (s *Soul) handleUserInput(ctx context.Context, msg wire.Message) error {
+	// Rewinding to this checkpoint undoes the whole turn
+	s.checkpoint(checkpointLabel(extractText(msg)), false)
+	s.turnLabel = shortenLabel(extractText(msg), 60)
+	s.turnSnapshotted = false
+
 	// Add user message to context
 	s.Context.AddMessage(msg)
 
@@ -200,6 +235,12 @@ func (s *Soul) handleUserInput(ctx context.Context, msg wire.Message) error {
 	return s.processWithLLM(ctx, msg)
 }
 
+// appendHistory appends messages to the LLM history and logs them in the context.
+func (s *Soul) appendHistory(msgs ...llm.Message) {
+	s.llmHistory = append(s.llmHistory, msgs...)
+	s.Context.AppendHistory(msgs...)
+}
+
 // processWithLLM runs the agent loop: call LLM, execute tools, repeat.
 func (s *Soul) processWithLLM(ctx context.Context, userMsg wire.Message) error {
 	client := s.runtime.LLMClient
@@ -223,37 +264,55 @@ func (s *Soul) processWithLLM(ctx context.Context, userMsg wire.Message) error {
 	// Extract user text from wire message
 	userText := extractText(userMsg)
 
-	// Add user message to LLM history
-	s.llmHistory = append(s.llmHistory, llm.Message{
-		Role:    "user",
-		Content: userText,
-	})
-
-	// Build full message list with system prompt
-	messages := s.buildLLMMessages()
+	// Add user message to LLM history, with attached images as content parts
+	userLLMMsg := llm.Message{Role: "user", Content: userText}
+	if images := userMsg.Images(); len(images) > 0 {
+		parts := []llm.ContentPart{llm.TextPart(userText)}
+		for _, img := range images {
+			parts = append(parts, llm.ImagePart(img.MimeType, img.Data))
+		}
+		userLLMMsg = llm.NewMultipartMessage("user", parts...)
+	}
+	s.appendHistory(userLLMMsg)
 
 	// Build tool definitions
 	toolDefs := s.buildToolDefs()
 
+	// Report retried and rate-limited LLM requests as transient status
+	if s.OnMessage != nil {
+		ctx = llm.WithRetryNotifier(ctx, s.emitRetryStatus)
+	}
+
 	// Agent loop
 	for step := 0; step < s.runtime.MaxSteps; step++ {
-		// Use streaming for the final response (when no tools are registered)
-		// or fall back to non-streaming if streaming is disabled
-		useStreaming := s.runtime.UseStreaming && len(toolDefs) == 0
+		// Compact older history before the context window overflows
+		if s.shouldCompact() {
+			if err := s.compactContext(ctx, client); err != nil {
+				return fmt.Errorf("context compaction failed: %w", err)
+			}
+		}
+		s.checkpoint(fmt.Sprintf("step %d", step+1), true)
 
-		var assistantMsg llm.Message
-		var streamErr error
+		// Build full message list with system prompt
+		messages := s.buildLLMMessages()
 
-		if useStreaming {
-			assistantMsg, streamErr = s.processWithStreaming(ctx, client, messages)
-			if streamErr != nil {
-				// Fall back to non-streaming on error
-				useStreaming = false
+		var assistantMsg llm.Message
+		var usage llm.Usage
+		streamed := false
+
+		if s.runtime.UseStreaming {
+			msg, streamUsage, received, err := s.processWithStreaming(ctx, client, messages, toolDefs)
+			if err == nil {
+				assistantMsg, usage, streamed = msg, streamUsage, true
+			} else if ctx.Err() != nil || received {
+				// Repeating the request would show the streamed text twice
+				return fmt.Errorf("LLM request failed: %w", err)
 			}
+			// Otherwise fall back to non-streaming below
 		}
 
-		if !useStreaming {
-			// Non-streaming mode (for tool calls or fallback)
+		if !streamed {
+			// Non-streaming mode (streaming disabled or failed)
 			resp, err := client.ChatWithTools(ctx, messages, toolDefs)
 			if err != nil {
 				return fmt.Errorf("LLM request failed: %w", err)
@@ -264,46 +323,63 @@ func (s *Soul) processWithLLM(ctx context.Context, userMsg wire.Message) error {
 			}
 
 			assistantMsg = resp.Choices[0].Message
+			usage = resp.Usage
 		}
 
 		// Add assistant message to LLM history
-		s.llmHistory = append(s.llmHistory, assistantMsg)
-		// Also add to the messages list for next iteration
-		messages = append(messages, assistantMsg)
+		s.appendHistory(assistantMsg)
+		s.recordUsage(usage, append(messages, assistantMsg))
 
 		// Check if the LLM wants to call tools
 		if len(assistantMsg.ToolCalls) > 0 {
+			// Record any text the LLM produced alongside its tool calls
+			if assistantMsg.Content != "" {
+				s.emitAssistant(assistantMsg.Content)
+			}
+
 			// Execute tool calls in parallel
+			s.snapshotWorkspace(ctx)
 			toolResults := s.executeToolCallsParallel(ctx, assistantMsg.ToolCalls)
 
 			// Process results in order
+			var images []llm.ContentPart
 			for _, result := range toolResults {
 				// Emit tool result event
 				if s.OnToolResult != nil {
 					s.OnToolResult(result)
 				}
 
-				// Build result text
+				// Build result text; the user may see something other than the model
 				resultText := result.Result
 				if !result.Success {
 					resultText = fmt.Sprintf("Error: %s", result.Error)
 				}
+				displayText := resultText
+				if result.Display != "" {
+					displayText = result.Display
+				}
 
-				// Add tool result to LLM history and messages
+				// Add tool result to LLM history
 				toolResultMsg := llm.Message{
 					Role:       "tool",
 					Content:    resultText,
 					ToolCallID: result.CallID,
+					IsError:    !result.Success,
+				}
+				s.appendHistory(toolResultMsg)
+				s.addContextTokens(toolResultMsg)
+				for _, img := range result.Images {
+					images = append(images,
+						llm.TextPart(fmt.Sprintf("Image %s from tool call %s:", img.Describe(), result.CallID)),
+						llm.ImagePart(img.MimeType, img.Data))
 				}
-				s.llmHistory = append(s.llmHistory, toolResultMsg)
-				messages = append(messages, toolResultMsg)
 
 				// Emit wire message for tool result display
 				trMsg := wire.Message{
 					Type: wire.MessageTypeToolResult,
 					Content: []wire.ContentPart{{
 						Type: "text",
-						Text: resultText,
+						Text: displayText,
 					}},
 					Timestamp: time.Now(),
 				}
@@ -312,6 +388,19 @@ func (s *Soul) processWithLLM(ctx context.Context, userMsg wire.Message) error {
 					s.OnMessage(trMsg)
 				}
 			}
+			// Tool messages hold only text; images follow them in a user message
+			if len(images) > 0 {
+				imageMsg := llm.NewMultipartMessage("user", images...)
+				s.appendHistory(imageMsg)
+				s.addContextTokens(imageMsg)
+			}
+			// A D-Mail sent in this step rewinds the conversation before the next one
+			if d := s.dmailTool(); d != nil {
+				if dmail, ok := d.take(); ok {
+					s.deliverDMail(dmail)
+				}
+			}
+
 			// Continue the loop to let LLM process tool results
 			continue
 		}
@@ -322,18 +411,7 @@ func (s *Soul) processWithLLM(ctx context.Context, userMsg wire.Message) error {
 			responseText = "(empty response)"
 		}
 
-		response := wire.Message{
-			Type: wire.MessageTypeAssistant,
-			Content: []wire.ContentPart{{
-				Type: "text",
-				Text: responseText,
-			}},
-			Timestamp: time.Now(),
-		}
-		s.Context.AddMessage(response)
-		if s.OnMessage != nil {
-			s.OnMessage(response)
-		}
+		s.emitAssistant(responseText)
 
 		// Save context after successful response
 		_ = s.Context.Save()
@@ -343,78 +421,98 @@ func (s *Soul) processWithLLM(ctx context.Context, userMsg wire.Message) error {
 	return fmt.Errorf("agent loop exceeded maximum steps (%d)", s.runtime.MaxSteps)
 }
 
-// processWithStreaming handles streaming LLM responses for real-time display.
-// Returns the complete message when streaming is done.
-func (s *Soul) processWithStreaming(ctx context.Context, client LLMClient, messages []llm.Message) (llm.Message, error) {
-	var contentBuilder strings.Builder
-	var assistantMsg llm.Message
-	assistantMsg.Role = "assistant"
-
-	// Create a placeholder message for streaming display
-	streamingMsg := wire.Message{
+// emitAssistant records a final assistant message and sends it to the UI.
+// It supersedes any streaming updates for the same step.
+func (s *Soul) emitAssistant(text string) {
+	response := wire.Message{
 		Type: wire.MessageTypeAssistant,
 		Content: []wire.ContentPart{{
 			Type: "text",
-			Text: "",
+			Text: text,
 		}},
 		Timestamp: time.Now(),
 	}
-
-	// Send initial empty message to UI
+	s.Context.AddMessage(response)
 	if s.OnMessage != nil {
-		s.OnMessage(streamingMsg)
+		s.OnMessage(response)
 	}
+}
+
+// emitRetryStatus tells the UI that an LLM request is waiting to be retried
+// or for the rate limiter. Status messages are not recorded in the context.
+func (s *Soul) emitRetryStatus(e llm.RetryEvent) {
+	status := wire.Status{
+		Kind:       wire.StatusRetrying,
+		Reason:     e.Reason(),
+		Attempt:    e.Attempt,
+		MaxRetries: e.MaxRetries,
+		WaitMs:     e.Wait.Milliseconds(),
+	}
+	if e.Err != nil {
+		status.Error = e.Err.Error()
+	}
+	s.OnMessage(*wire.NewStatusMessage(status))
+}
+
+// processWithStreaming performs one streaming LLM call for real-time display.
+// Text deltas are forwarded to the UI as they arrive while tool call fragments
+// are accumulated. Returns the complete message and usage when the stream
+// ends, and whether any chunk arrived before it ended.
+func (s *Soul) processWithStreaming(ctx context.Context, client LLMClient, messages []llm.Message, toolDefs []llm.ToolDef) (llm.Message, llm.Usage, bool, error) {
+	acc := llm.NewStreamAccumulator()
+	startedAt := time.Now()
+	gotChoices, received := false, false
 
-	// Start streaming
-	respCh, errCh := client.ChatStream(ctx, messages)
+	respCh, errCh := client.ChatStreamWithTools(ctx, messages, toolDefs)
 
 	for {
 		select {
 		case <-ctx.Done():
-			return assistantMsg, ctx.Err()
-
-		case err, ok := <-errCh:
-			if !ok {
-				// errCh closed, ignore and continue waiting for respCh
-				continue
-			}
-			if err != nil {
-				return assistantMsg, err
-			}
+			return acc.Message(), acc.Usage(), received, ctx.Err()
 
 		case chunk, ok := <-respCh:
 			if !ok {
-				// Stream closed, finalize message
-				assistantMsg.Content = contentBuilder.String()
-				return assistantMsg, nil
+				// Stream closed; errors are reported before the channels close
+				select {
+				case err := <-errCh:
+					if err != nil {
+						return acc.Message(), acc.Usage(), received, err
+					}
+				case <-ctx.Done():
+					return acc.Message(), acc.Usage(), received, ctx.Err()
+				}
+				if !gotChoices {
+					return acc.Message(), acc.Usage(), received, fmt.Errorf("LLM returned no choices")
+				}
+				return acc.Message(), acc.Usage(), received, nil
 			}
 
-			if len(chunk.Choices) == 0 {
+			received = true
+			if len(chunk.Choices) > 0 {
+				gotChoices = true
+			}
+			text := acc.Add(chunk)
+			if text == "" {
 				continue
 			}
 
-			delta := chunk.Choices[0].Delta
-
-			// Handle content delta
-			if delta.Content != "" {
-				contentBuilder.WriteString(delta.Content)
-
-				// Emit streaming chunk callback
-				if s.OnStreamChunk != nil {
-					s.OnStreamChunk(delta.Content)
-				}
-
-				// Update streaming message with current content
-				streamingMsg.Content[0].Text = contentBuilder.String()
-				if s.OnMessage != nil {
-					s.OnMessage(streamingMsg)
-				}
+			// Emit streaming chunk callback
+			if s.OnStreamChunk != nil {
+				s.OnStreamChunk(text)
 			}
 
-			// Check for finish reason
-			if chunk.Choices[0].FinishReason != "" {
-				assistantMsg.Content = contentBuilder.String()
-				return assistantMsg, nil
+			// Update the in-progress message with the content so far; the
+			// final chunk is skipped because the final message follows it
+			if s.OnMessage != nil && acc.FinishReason() == "" {
+				s.OnMessage(wire.Message{
+					Type: wire.MessageTypeAssistant,
+					Content: []wire.ContentPart{{
+						Type: "text",
+						Text: acc.Content(),
+					}},
+					Metadata:  map[string]any{wire.MetaStreaming: true},
+					Timestamp: startedAt,
+				})
 			}
 		}
 	}
@@ -475,7 +573,6 @@ func (s *Soul) executeToolCallsParallel(ctx context.Context, toolCalls []llm.Too
 
 	results := make([]tools.ToolResult, len(toolCalls))
 	resultCh := make(chan indexedResult, len(toolCalls))
-	var wg sync.WaitGroup
 
 	// Precompute tool calls and emit events sequentially to keep callbacks single-threaded
 	calls := make([]tools.ToolCall, len(toolCalls))
@@ -506,14 +603,52 @@ func (s *Soul) executeToolCallsParallel(ctx context.Context, toolCalls []llm.Too
 		}
 	}
 
+	// Ask for approval one call at a time; rejected calls are not executed
+	approved := make([]bool, len(calls))
+	for i, call := range calls {
+		ok, reason := s.requestApproval(ctx, call)
+		approved[i] = ok
+		if !ok {
+			errText := "The user rejected this tool call."
+			if reason != "" {
+				errText += " Reason: " + reason
+			}
+			results[i] = tools.ToolResult{
+				CallID:  call.ID,
+				Success: false,
+				Error:   errText,
+			}
+		}
+	}
+
+	// Output reported by running tools is forwarded to the collecting loop
+	var outputCh chan wire.ToolOutput
+	finished := make(chan struct{})
+	defer close(finished)
+	if s.OnMessage != nil {
+		outputCh = make(chan wire.ToolOutput, 64)
+	}
+
 	// Execute tools concurrently, without invoking callbacks from goroutines
+	pending := 0
 	for i, call := range calls {
-		wg.Add(1)
+		if !approved[i] {
+			continue
+		}
+		pending++
+		callCtx := ctx
+		if outputCh != nil {
+			callID := call.ID
+			callCtx = tools.WithOutputFunc(ctx, func(chunk tools.OutputChunk) {
+				select {
+				case outputCh <- wire.ToolOutput{ToolCallID: callID, Stream: chunk.Stream, Text: chunk.Text}:
+				case <-finished:
+				}
+			})
+		}
 		go func(index int, c tools.ToolCall) {
-			defer wg.Done()
-
 			// Execute the tool
-			result, err := s.executeToolCall(ctx, c)
+			result, err := s.executeToolCall(callCtx, c)
 			if err != nil {
 				// Ensure a non-nil ToolResult is always sent
 				if result == nil {
@@ -530,15 +665,47 @@ func (s *Soul) executeToolCallsParallel(ctx context.Context, toolCalls []llm.Too
 		}(i, call)
 	}
 
-	// Close channel when all goroutines complete
-	go func() {
-		wg.Wait()
-		close(resultCh)
-	}()
-
-	// Collect results in order
-	for ir := range resultCh {
-		results[ir.index] = ir.result
+	// Collect results in order, passing on tool output in batches
+	var outputs []wire.ToolOutput
+	add := func(out wire.ToolOutput) {
+		if n := len(outputs); n > 0 && outputs[n-1].ToolCallID == out.ToolCallID && outputs[n-1].Stream == out.Stream {
+			outputs[n-1].Text += out.Text
+		} else {
+			outputs = append(outputs, out)
+		}
+	}
+	flush := func() {
+		for _, out := range outputs {
+			s.OnMessage(*wire.NewToolOutputMessage(out))
+		}
+		outputs = nil
+	}
+	ticker := time.NewTicker(toolOutputInterval)
+	defer ticker.Stop()
+	for pending > 0 {
+		select {
+		case ir := <-resultCh:
+			results[ir.index] = ir.result
+			pending--
+		case out := <-outputCh:
+			add(out)
+		case <-ticker.C:
+			if s.OnMessage != nil {
+				flush()
+			}
+		}
+	}
+	// Output sent before the last result may still be queued
+	for drained := false; !drained; {
+		select {
+		case out := <-outputCh:
+			add(out)
+		default:
+			drained = true
+		}
+	}
+	if s.OnMessage != nil {
+		flush()
 	}
 
 	return results
@@ -564,12 +731,7 @@ func (s *Soul) executeToolCall(ctx context.Context, call tools.ToolCall) (*tools
 		}, nil
 	}
 
-	resultJSON, _ := json.Marshal(result)
-	return &tools.ToolResult{
-		CallID:  call.ID,
-		Success: true,
-		Result:  string(resultJSON),
-	}, nil
+	return s.toolResult(call, tool, result), nil
 }
 
 // extractText extracts text content from a wire message.
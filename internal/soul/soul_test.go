@@ -1,11 +1,17 @@
 package soul
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"fmt"
+	"image"
+	"image/png"
 	"net/http"
 	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
 	"time"
@@ -407,6 +413,59 @@ func TestSoul_ProcessWithLLM_ToolCall(t *testing.T) {
 	}
 }
 
+func TestSoul_ResumeSession_RestoresLLMHistory(t *testing.T) {
+	responses := []llm.ChatResponse{
+		toolCallResponse("call_1", "shell", `{"command":"echo hello"}`),
+		textResponse("The command output: hello"),
+		textResponse("You ran echo hello"),
+	}
+	var mu sync.Mutex
+	var requests []llm.ChatRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llm.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		mu.Lock()
+		requests = append(requests, req)
+		idx := len(requests) - 1
+		mu.Unlock()
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(responses[idx])
+	}))
+	defer server.Close()
+
+	contextFile := filepath.Join(t.TempDir(), "context.json")
+	s := setupSoul(t, server)
+	s.Context = NewContext(contextFile)
+	if err := s.handleUserInput(context.Background(), testMsg(wire.MessageTypeUserInput, "run echo hello")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// Resume in a new soul from the saved context file
+	restored := NewContext(contextFile)
+	if err := restored.Restore(); err != nil {
+		t.Fatalf("Restore failed: %v", err)
+	}
+	resumed := NewSoul(s.Agent, restored)
+	if err := resumed.handleUserInput(context.Background(), testMsg(wire.MessageTypeUserInput, "what did I run?")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// system + user + assistant(tool call) + tool + assistant + user
+	last := requests[len(requests)-1]
+	if len(last.Messages) != 6 {
+		t.Fatalf("expected 6 messages after resume, got %d: %+v", len(last.Messages), last.Messages)
+	}
+	if len(last.Messages[2].ToolCalls) != 1 || last.Messages[2].ToolCalls[0].ID != "call_1" {
+		t.Errorf("tool call should survive resume, got %+v", last.Messages[2])
+	}
+	if last.Messages[3].Role != "tool" || last.Messages[3].ToolCallID != "call_1" {
+		t.Errorf("tool result should survive resume, got %+v", last.Messages[3])
+	}
+	if last.Messages[5].Content != "what did I run?" {
+		t.Errorf("unexpected last message: %+v", last.Messages[5])
+	}
+}
+
 func TestSoul_ProcessWithLLM_ToolNotFound(t *testing.T) {
 	// Call a non-existent tool
 	server := mockLLMServer(t, []llm.ChatResponse{
@@ -982,7 +1041,7 @@ func TestSoul_ExecuteToolCallsParallel_Empty(t *testing.T) {
 }
 
 func TestSoul_ExecuteToolCallsParallel_SingleTool(t *testing.T) {
-	rt := NewRuntime(t.TempDir(), false)
+	rt := NewRuntime(t.TempDir(), true)
 	rt.RegisterTool(tools.NewShellTool(rt.WorkDir, 5*time.Second))
 
 	agent := NewAgent("test", "", rt)
@@ -1012,6 +1071,42 @@ func TestSoul_ExecuteToolCallsParallel_SingleTool(t *testing.T) {
 		t.Errorf("tool should succeed: %s", results[0].Error)
 	}
 }
+
+// --- Streaming tests ---
+
+// mockStreamServer creates a test HTTP server that streams the given text chunks as SSE.
+func mockStreamServer(t *testing.T, chunks []string) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range chunks {
+			data, _ := json.Marshal(map[string]any{
+				"choices": []map[string]any{{"delta": map[string]any{"content": chunk}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", data)
+		}
+		fmt.Fprint(w, "data: {\"choices\":[{\"delta\":{},\"finish_reason\":\"stop\"}]}\n\n")
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
+func TestSoul_ProcessWithLLM_Streaming(t *testing.T) {
+	server := mockStreamServer(t, []string{"Hello", " from", " streaming!"})
+	defer server.Close()
+
+	rt := NewRuntime(t.TempDir(), true)
+	rt.LLMClient = llm.NewClient(llm.Config{
+		BaseURL: server.URL,
+		APIKey:  "test-key",
+		Model:   "test-model",
+		Timeout: 10 * time.Second,
+	})
+	agent := NewAgent("test", "You are a test assistant.", rt)
+	s := NewSoul(agent, NewContext(""))
+
+	var receivedContents []string
+	var streamChunks []string
+	s.OnMessage = func(msg wire.Message) {
 		if msg.Type == wire.MessageTypeAssistant {
 			for _, part := range msg.Content {
 				if part.Type == "text" {
@@ -1075,32 +1170,125 @@ func TestSoul_ProcessWithLLM_StreamingDisabled(t *testing.T) {
 	}
 }
 
+// sseToolStreamServer streams a turn that interleaves text with two tool calls
+// split into fragments, followed by a plain text turn.
+func sseToolStreamServer(t *testing.T, requests *[]llm.ChatRequest) *httptest.Server {
+	t.Helper()
+	var mu sync.Mutex
+	turns := [][]string{
+		{
+			`{"choices":[{"delta":{"role":"assistant","content":"Let me "}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"id":"call_1","type":"function","function":{"name":"shell","arguments":""}}]}}]}`,
+			`{"choices":[{"delta":{"content":"check."}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"{\"command\":"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":1,"id":"call_2","type":"function","function":{"name":"shell","arguments":"{\"command\":\"echo two\"}"}}]}}]}`,
+			`{"choices":[{"delta":{"tool_calls":[{"index":0,"function":{"arguments":"\"echo one\"}"}}]}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"tool_calls"}]}`,
+		},
+		{
+			`{"choices":[{"delta":{"content":"Both "}}]}`,
+			`{"choices":[{"delta":{"content":"done."}}]}`,
+			`{"choices":[{"delta":{},"finish_reason":"stop"}],"usage":{"prompt_tokens":42,"completion_tokens":7,"total_tokens":49}}`,
+		},
+	}
+
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req llm.ChatRequest
+		json.NewDecoder(r.Body).Decode(&req)
+
+		mu.Lock()
+		idx := len(*requests)
+		*requests = append(*requests, req)
+		mu.Unlock()
+
+		if idx >= len(turns) {
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, chunk := range turns[idx] {
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+}
+
 func TestSoul_ProcessWithLLM_StreamingWithTools(t *testing.T) {
-	// When tools are registered, streaming should be disabled (fallback to non-streaming)
-	server := mockLLMServer(t, []llm.ChatResponse{
-		textResponse("Response with tools available"),
-	})
+	var requests []llm.ChatRequest
+	server := sseToolStreamServer(t, &requests)
 	defer server.Close()
 
 	s := setupSoul(t, server)
-	// Tools are already registered by setupSoul
 
-	var received []wire.Message
+	var streamChunks []string
+	var finalTexts []string
+	var toolResults []tools.ToolResult
+	s.OnStreamChunk = func(chunk string) {
+		streamChunks = append(streamChunks, chunk)
+	}
 	s.OnMessage = func(msg wire.Message) {
-		received = append(received, msg)
+		if msg.Type == wire.MessageTypeAssistant && !msg.IsStreaming() {
+			finalTexts = append(finalTexts, msg.Content[0].Text)
+		}
+	}
+	s.OnToolResult = func(tr tools.ToolResult) {
+		toolResults = append(toolResults, tr)
 	}
 
-	userMsg := testMsg(wire.MessageTypeUserInput, "hello")
-	err := s.processWithLLM(context.Background(), userMsg)
+	err := s.processWithLLM(context.Background(), testMsg(wire.MessageTypeUserInput, "run both"))
 	if err != nil {
 		t.Fatalf("unexpected error: %v", err)
 	}
 
-	if len(received) != 1 {
-		t.Fatalf("expected 1 message when tools are registered, got %d", len(received))
+	if len(requests) != 2 {
+		t.Fatalf("expected 2 requests, got %d", len(requests))
+	}
+	if !requests[0].Stream || len(requests[0].Tools) == 0 {
+		t.Error("requests should stream and include tool definitions")
+	}
+
+	if got := strings.Join(streamChunks, ""); got != "Let me check.Both done." {
+		t.Errorf("unexpected streamed text: %q", got)
+	}
+
+	// Fragments are assembled into complete tool calls in index order
+	assistant := s.llmHistory[1]
+	if len(assistant.ToolCalls) != 2 {
+		t.Fatalf("expected 2 tool calls, got %d", len(assistant.ToolCalls))
+	}
+	if assistant.ToolCalls[0].ID != "call_1" || assistant.ToolCalls[0].Function.Arguments != `{"command":"echo one"}` {
+		t.Errorf("unexpected first tool call: %+v", assistant.ToolCalls[0])
+	}
+	if assistant.ToolCalls[1].ID != "call_2" || assistant.ToolCalls[1].Function.Arguments != `{"command":"echo two"}` {
+		t.Errorf("unexpected second tool call: %+v", assistant.ToolCalls[1])
+	}
+	if assistant.Content != "Let me check." {
+		t.Errorf("expected text alongside tool calls, got %q", assistant.Content)
 	}
-	if received[0].Content[0].Text != "Response with tools available" {
-		t.Errorf("unexpected response: %q", received[0].Content[0].Text)
+
+	if len(toolResults) != 2 || !toolResults[0].Success || !toolResults[1].Success {
+		t.Fatalf("expected 2 successful tool results, got %+v", toolResults)
+	}
+	if !strings.Contains(toolResults[0].Result, "one") || !strings.Contains(toolResults[1].Result, "two") {
+		t.Errorf("tool results should match their calls: %+v", toolResults)
+	}
+
+	// The second request carries the tool results back with matching IDs
+	var toolMsgIDs []string
+	for _, m := range requests[1].Messages {
+		if m.Role == "tool" {
+			toolMsgIDs = append(toolMsgIDs, m.ToolCallID)
+		}
+	}
+	if strings.Join(toolMsgIDs, ",") != "call_1,call_2" {
+		t.Errorf("unexpected tool_call_ids: %v", toolMsgIDs)
+	}
+
+	if len(finalTexts) != 2 || finalTexts[0] != "Let me check." || finalTexts[1] != "Both done." {
+		t.Errorf("unexpected final assistant messages: %q", finalTexts)
+	}
+	if s.LastUsage().PromptTokens != 42 {
+		t.Errorf("usage from the stream should be recorded, got %+v", s.LastUsage())
 	}
 }
 
@@ -1116,3 +1304,170 @@ func TestSoul_Runtime_UseStreaming(t *testing.T) {
 		t.Error("UseStreaming should be settable to false")
 	}
 }
+
+func TestSoul_ExecuteToolCallsParallel_StreamsOutput(t *testing.T) {
+	rt := NewRuntime(t.TempDir(), true)
+	rt.RegisterTool(tools.NewShellTool(rt.WorkDir, 5*time.Second))
+	s := NewSoul(NewAgent("test", "", rt), NewContext(""))
+
+	var outputs []wire.ToolOutput
+	s.OnMessage = func(msg wire.Message) {
+		if out, ok := msg.ToolOutput(); ok {
+			outputs = append(outputs, out)
+		}
+	}
+
+	results := s.executeToolCallsParallel(context.Background(), []llm.ToolCallInfo{{
+		ID:       "call_1",
+		Type:     "function",
+		Function: llm.FunctionCall{Name: "shell", Arguments: `{"command":"echo one; sleep 0.3; echo two"}`},
+	}})
+	if !results[0].Success {
+		t.Fatalf("tool should succeed: %s", results[0].Error)
+	}
+
+	// The output arrives in more than one batch, before the result
+	var text string
+	for _, out := range outputs {
+		if out.ToolCallID != "call_1" || out.Stream != tools.StreamStdout {
+			t.Errorf("unexpected output: %+v", out)
+		}
+		text += out.Text
+	}
+	if len(outputs) < 2 || text != "one\ntwo\n" {
+		t.Errorf("expected streamed output, got %+v", outputs)
+	}
+	for _, msg := range s.Context.GetMessages() {
+		if msg.Type == wire.MessageTypeToolOutput {
+			t.Error("tool output should not be added to the context")
+		}
+	}
+}
+
+func TestSoul_ProcessWithLLM_Images(t *testing.T) {
+	server := mockLLMServer(t, []llm.ChatResponse{
+		toolCallResponse("call_1", tools.ImageToolName, `{"path":"shot.png"}`),
+		textResponse("I see a blank image"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	var buf bytes.Buffer
+	png.Encode(&buf, image.NewGray(image.Rect(0, 0, 4, 4)))
+	os.WriteFile(filepath.Join(s.runtime.WorkDir, "shot.png"), buf.Bytes(), 0644)
+	s.runtime.RegisterTool(tools.NewImageTool(s.runtime.WorkDir))
+
+	userMsg := wire.NewUserInputMessage("compare these", wire.ImagePart("a.png", "image/png", buf.Bytes()))
+	if err := s.processWithLLM(context.Background(), *userMsg); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	// user (with image), assistant (tool call), tool, user (tool image), assistant
+	history := s.llmHistory
+	if len(history) != 5 {
+		t.Fatalf("expected 5 history messages, got %d: %+v", len(history), history)
+	}
+	if parts := history[0].Parts; len(parts) != 2 || parts[0].Text != "compare these" || parts[1].ImageURL == nil {
+		t.Errorf("user image should be a content part: %+v", history[0])
+	}
+	if history[2].Role != "tool" || !strings.Contains(history[2].Content, "shot.png") {
+		t.Errorf("tool result should describe the image: %+v", history[2])
+	}
+	if msg := history[3]; msg.Role != "user" || len(msg.Parts) != 2 ||
+		!strings.Contains(msg.Parts[0].Text, "call_1") || msg.Parts[1].ImageURL == nil {
+		t.Errorf("tool image should follow in a user message: %+v", msg)
+	}
+}
+
+func TestSoul_RetryStatus(t *testing.T) {
+	inner := mockLLMServer(t, []llm.ChatResponse{textResponse("hello")})
+	defer inner.Close()
+	limited := true
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if limited {
+			limited = false
+			w.Header().Set("Retry-After-Ms", "20")
+			w.WriteHeader(http.StatusTooManyRequests)
+			fmt.Fprint(w, `{"error":{"message":"slow down"}}`)
+			return
+		}
+		inner.Config.Handler.ServeHTTP(w, r)
+	}))
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	s.runtime.LLMClient = llm.NewRetryableClient(s.runtime.LLMClient, nil, nil)
+	var statuses []wire.Status
+	s.OnMessage = func(msg wire.Message) {
+		if st, ok := msg.Status(); ok {
+			statuses = append(statuses, st)
+		}
+	}
+
+	if err := s.processWithLLM(context.Background(), testMsg(wire.MessageTypeUserInput, "hi")); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(statuses) != 1 {
+		t.Fatalf("expected one status message, got %+v", statuses)
+	}
+	st := statuses[0]
+	if st.Kind != wire.StatusRetrying || st.Reason != "rate limited" || st.Attempt != 1 || st.WaitMs != 20 {
+		t.Errorf("unexpected status: %+v", st)
+	}
+	for _, msg := range s.Context.GetMessages() {
+		if msg.Type == wire.MessageTypeStatus {
+			t.Error("status messages should not be recorded in the context")
+		}
+	}
+}
+
+// brokenStream is an LLM client whose stream fails after its first chunk.
+type brokenStream struct {
+	calls int
+}
+
+func (c *brokenStream) Chat(ctx context.Context, messages []llm.Message) (*llm.ChatResponse, error) {
+	return c.ChatWithTools(ctx, messages, nil)
+}
+
+func (c *brokenStream) ChatWithTools(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (*llm.ChatResponse, error) {
+	c.calls++
+	resp := textResponse("again")
+	return &resp, nil
+}
+
+func (c *brokenStream) ChatStream(ctx context.Context, messages []llm.Message) (<-chan llm.ChatResponse, <-chan error) {
+	return c.ChatStreamWithTools(ctx, messages, nil)
+}
+
+func (c *brokenStream) ChatStreamWithTools(ctx context.Context, messages []llm.Message, toolDefs []llm.ToolDef) (<-chan llm.ChatResponse, <-chan error) {
+	c.calls++
+	chunks := make(chan llm.ChatResponse, 1)
+	errs := make(chan error, 1)
+	chunk := textResponse("")
+	chunk.Choices[0].Delta = llm.Message{Content: "partial"}
+	chunk.Choices[0].FinishReason = ""
+	chunks <- chunk
+	errs <- fmt.Errorf("connection reset")
+	close(chunks)
+	close(errs)
+	return chunks, errs
+}
+
+func TestSoul_StreamFailsAfterChunk(t *testing.T) {
+	s := setupSoul(t, mockLLMServer(t, nil))
+	client := &brokenStream{}
+	s.runtime.LLMClient = client
+	var streamed []string
+	s.OnStreamChunk = func(text string) {
+		streamed = append(streamed, text)
+	}
+
+	err := s.processWithLLM(context.Background(), testMsg(wire.MessageTypeUserInput, "hi"))
+	if err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Fatalf("expected the stream error, got %v", err)
+	}
+	if client.calls != 1 || len(streamed) != 1 {
+		t.Errorf("the request should not be repeated after text was shown: %d calls, chunks %q", client.calls, streamed)
+	}
+}
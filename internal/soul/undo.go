@@ -0,0 +1,67 @@
+package soul
+
+import (
+	"context"
+	"fmt"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/wire"
+)
+
+// snapshotWorkspace snapshots the work directory before the first tool step
+// of a turn, so the turn's file changes can be undone. A failed snapshot is
+// reported but does not stop the turn.
+func (s *Soul) snapshotWorkspace(ctx context.Context) {
+	store := s.runtime.Snapshots
+	if store == nil || s.turnSnapshotted {
+		return
+	}
+	s.turnSnapshotted = true
+
+	if _, err := store.Take(ctx, s.turnLabel); err != nil {
+		s.handleError(fmt.Errorf("workspace snapshot failed: %w", err))
+	}
+}
+
+// handleUndo restores the work directory from a snapshot. Without a turn the
+// latest snapshot is restored and removed, so repeated undos go further back.
+func (s *Soul) handleUndo(ctx context.Context, msg wire.Message) error {
+	store := s.runtime.Snapshots
+	if store == nil {
+		return fmt.Errorf("workspace snapshots are not enabled")
+	}
+	req, ok := msg.UndoRequest()
+	if !ok {
+		return fmt.Errorf("invalid undo request")
+	}
+
+	snap, err := store.Latest(ctx)
+	if req.Turn > 0 {
+		snap, err = store.Get(ctx, req.Turn)
+	}
+	if err != nil {
+		return fmt.Errorf("nothing to undo: %w", err)
+	}
+	if err := store.Restore(ctx, snap.Turn); err != nil {
+		return err
+	}
+	if req.Turn == 0 {
+		if err := store.Drop(ctx, snap.Turn); err != nil {
+			return err
+		}
+	}
+
+	// Tell the agent its earlier edits are gone
+	s.appendHistory(llm.Message{
+		Role: "user",
+		Content: fmt.Sprintf("<system>The user restored the work directory to how it was before the turn %q. "+
+			"File changes made since then were undone.</system>", snap.Label),
+	})
+
+	notice := wire.NewUndoMessage(wire.UndoRequest{Turn: snap.Turn, Label: snap.Label})
+	s.Context.AddMessage(*notice)
+	if s.OnMessage != nil {
+		s.OnMessage(*notice)
+	}
+	return nil
+}
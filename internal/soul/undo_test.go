@@ -0,0 +1,86 @@
+package soul
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"kimi-go/internal/llm"
+	"kimi-go/internal/snapshot"
+	"kimi-go/internal/wire"
+)
+
+func TestSoul_Undo(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git not installed")
+	}
+	server, _ := capturingLLMServer(t, []llm.ChatResponse{
+		textResponse("nothing to do"),
+		toolCallResponse("call_1", "shell", `{"command":"echo edited > a.txt"}`),
+		textResponse("done"),
+	})
+	defer server.Close()
+
+	s := setupSoul(t, server)
+	store, err := snapshot.Open(t.TempDir(), s.runtime.WorkDir)
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	}
+	s.runtime.Snapshots = store
+	path := filepath.Join(s.runtime.WorkDir, "a.txt")
+	os.WriteFile(path, []byte("original\n"), 0644)
+
+	var notices []wire.Message
+	s.OnMessage = func(msg wire.Message) {
+		if msg.Type == wire.MessageTypeUndo {
+			notices = append(notices, msg)
+		}
+	}
+
+	for _, text := range []string{"hello", "edit a.txt"} {
+		if err := s.processMessage(context.Background(), testMsg(wire.MessageTypeUserInput, text)); err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	// Only the turn that ran tools is snapshotted
+	snapshots, _ := store.List(context.Background())
+	if len(snapshots) != 1 || snapshots[0].Label != "edit a.txt" {
+		t.Fatalf("unexpected snapshots: %+v", snapshots)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "edited\n" {
+		t.Fatalf("tool did not run, a.txt = %q", data)
+	}
+
+	if err := s.processMessage(context.Background(), *wire.NewUndoMessage(wire.UndoRequest{})); err != nil {
+		t.Fatalf("undo failed: %v", err)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "original\n" {
+		t.Errorf("a.txt not restored, got %q", data)
+	}
+	if snapshots, _ := store.List(context.Background()); len(snapshots) != 0 {
+		t.Errorf("undone snapshot should be dropped, got %+v", snapshots)
+	}
+	if len(notices) != 1 {
+		t.Errorf("expected 1 undo notice, got %d", len(notices))
+	}
+	last := s.llmHistory[len(s.llmHistory)-1]
+	if last.Role != "user" || !strings.Contains(last.Content, "edit a.txt") {
+		t.Errorf("agent should be told about the undo, got %+v", last)
+	}
+
+	// Nothing left to undo
+	if err := s.processMessage(context.Background(), *wire.NewUndoMessage(wire.UndoRequest{})); err == nil {
+		t.Error("expected error when there is nothing to undo")
+	}
+}
+
+func TestSoul_Undo_Disabled(t *testing.T) {
+	s := NewSoul(NewAgent("test", "", NewRuntime(t.TempDir(), true)), NewContext(""))
+	if err := s.processMessage(context.Background(), *wire.NewUndoMessage(wire.UndoRequest{})); err == nil {
+		t.Error("expected error when snapshots are disabled")
+	}
+}
@@ -0,0 +1,459 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// BackgroundToolName is the name of the background process tool.
+const BackgroundToolName = "background"
+
+const (
+	maxProcessOutput   = 1 << 20         // Unread output kept per process
+	maxOutputWait      = 60              // Seconds an output call may wait
+	processKillGrace   = 3 * time.Second // Time between SIGTERM and SIGKILL
+	outputPollInterval = 50 * time.Millisecond
+)
+
+// Background tool operations.
+const (
+	BackgroundStart  = "start"
+	BackgroundOutput = "output"
+	BackgroundInput  = "input"
+	BackgroundStatus = "status"
+	BackgroundKill   = "kill"
+)
+
+// BackgroundTool runs long-lived commands, such as dev servers and watchers,
+// in the background. Each process gets a handle that later calls use to read
+// its new output, send input, check its status or kill it.
+type BackgroundTool struct {
+	workDir string
+	sandbox *SandboxPolicy // Nil runs commands unrestricted
+
+	// OnChange is called with all processes when one starts or exits. It may
+	// be called from any goroutine.
+	OnChange func([]ProcessInfo)
+
+	mu       sync.Mutex
+	procs    map[string]*backgroundProcess
+	nextID   int
+	closed   bool
+	notifyMu sync.Mutex     // Keeps OnChange calls in order
+	monitors sync.WaitGroup // Goroutines waiting for processes to exit
+}
+
+// BackgroundParams represents parameters for the background tool.
+type BackgroundParams struct {
+	Operation  string `json:"operation"`
+	Command    string `json:"command,omitempty"`
+	ID         string `json:"id,omitempty"`
+	Input      string `json:"input,omitempty"`
+	CloseStdin bool   `json:"close_stdin,omitempty"`
+	Wait       int    `json:"wait,omitempty"` // Seconds to wait for output or exit
+}
+
+// ProcessInfo describes a background process.
+type ProcessInfo struct {
+	ID        string    `json:"id"`
+	Command   string    `json:"command"`
+	PID       int       `json:"pid"`
+	Running   bool      `json:"running"`
+	ExitCode  int       `json:"exit_code,omitempty"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+// BackgroundResult represents the result of a background tool operation.
+type BackgroundResult struct {
+	Success   bool          `json:"success"`
+	Process   *ProcessInfo  `json:"process,omitempty"`
+	Output    string        `json:"output,omitempty"`  // Output since the previous read
+	Dropped   int64         `json:"dropped,omitempty"` // Unread bytes discarded because the buffer was full
+	Processes []ProcessInfo `json:"processes,omitempty"`
+	Error     string        `json:"error,omitempty"`
+}
+
+// ModelText implements ModelTexter for operations on a single process.
+func (r BackgroundResult) ModelText() string {
+	if !r.Success || r.Process == nil {
+		return ""
+	}
+	var b strings.Builder
+	if r.Dropped > 0 {
+		fmt.Fprintf(&b, "[%d bytes of earlier output were dropped]\n", r.Dropped)
+	}
+	b.WriteString(r.Output)
+	p := r.Process
+	if p.Running {
+		appendLine(&b, fmt.Sprintf("[%s running, pid %d: %s]", p.ID, p.PID, p.Command))
+	} else {
+		appendLine(&b, fmt.Sprintf("[%s exited with code %d: %s]", p.ID, p.ExitCode, p.Command))
+	}
+	return b.String()
+}
+
+// backgroundProcess is a command started by the background tool.
+type backgroundProcess struct {
+	id      string
+	command string
+	cmd     *exec.Cmd
+	stdin   io.WriteCloser
+	started time.Time
+	done    chan struct{} // Closed when the process has been waited for
+
+	mu       sync.Mutex
+	out      []byte // Unread output
+	dropped  int64  // Unread bytes discarded since the last read
+	exitCode int
+}
+
+// Write collects the process's output, keeping at most maxProcessOutput
+// unread bytes.
+func (p *backgroundProcess) Write(data []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.out = append(p.out, data...)
+	if over := len(p.out) - maxProcessOutput; over > 0 {
+		p.out = append([]byte(nil), p.out[over:]...)
+		p.dropped += int64(over)
+	}
+	return len(data), nil
+}
+
+// read returns the unread output and how much was dropped, and marks it read.
+func (p *backgroundProcess) read() (string, int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out, dropped := string(p.out), p.dropped
+	p.out, p.dropped = nil, 0
+	return out, dropped
+}
+
+// hasOutput reports whether there is unread output.
+func (p *backgroundProcess) hasOutput() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.out) > 0
+}
+
+// info describes the process.
+func (p *backgroundProcess) info() ProcessInfo {
+	info := ProcessInfo{ID: p.id, Command: p.command, PID: p.cmd.Process.Pid, StartedAt: p.started}
+	select {
+	case <-p.done:
+		p.mu.Lock()
+		info.ExitCode = p.exitCode
+		p.mu.Unlock()
+	default:
+		info.Running = true
+	}
+	return info
+}
+
+// NewBackgroundTool creates a new background process tool.
+func NewBackgroundTool(workDir string) *BackgroundTool {
+	return &BackgroundTool{workDir: workDir, procs: make(map[string]*backgroundProcess)}
+}
+
+// Name returns the tool name.
+func (t *BackgroundTool) Name() string {
+	return BackgroundToolName
+}
+
+// Description returns the tool description.
+func (t *BackgroundTool) Description() string {
+	desc := "Run long-lived commands in the background, such as dev servers, watchers and long test suites, " +
+		"which would time out in the shell tool. Operations: start (run command, returns an id such as bg_1), " +
+		"output (new output since the last read; wait up to wait seconds for output or exit), " +
+		"input (write input to the process's stdin, optionally closing it), " +
+		"status (one process, or all without an id) and kill (stop the process and its children). " +
+		"Background processes are killed when the session ends."
+	if t.sandbox != nil {
+		desc += " " + t.sandbox.describe()
+	}
+	return desc
+}
+
+// SetSandbox makes processes started later run in the sandbox described by
+// policy; nil turns the sandbox off.
+func (t *BackgroundTool) SetSandbox(policy *SandboxPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sandbox = policy
+}
+
+// Parameters returns the JSON schema for tool parameters.
+func (t *BackgroundTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"operation": {
+				"type": "string",
+				"enum": ["start", "output", "input", "status", "kill"],
+				"description": "The operation to perform"
+			},
+			"command": {
+				"type": "string",
+				"description": "The shell command to start (start)"
+			},
+			"id": {
+				"type": "string",
+				"description": "The process id returned by start (output, input, status, kill)"
+			},
+			"input": {
+				"type": "string",
+				"description": "Text to write to stdin; include a trailing newline to send a line (input)"
+			},
+			"close_stdin": {
+				"type": "boolean",
+				"description": "Close stdin after writing the input (input)"
+			},
+			"wait": {
+				"type": "integer",
+				"description": "Seconds to wait for output or exit before returning (start, output; max 60)",
+				"minimum": 0,
+				"maximum": 60
+			}
+		},
+		"required": ["operation"]
+	}`)
+}
+
+// ApprovalAction implements Approvable. Starting a process and writing to one
+// need approval; reading output, checking status and killing do not.
+func (t *BackgroundTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	var params BackgroundParams
+	_ = json.Unmarshal(args, &params)
+	switch params.Operation {
+	case BackgroundStart:
+		return "run background command", fmt.Sprintf("run command `%s` in the background", params.Command), true
+	case BackgroundInput:
+		return "send process input", fmt.Sprintf("send input to background process %s", params.ID), true
+	default:
+		return "", "", false
+	}
+}
+
+// Execute executes the background tool.
+func (t *BackgroundTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var params BackgroundParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	params.Wait = min(max(params.Wait, 0), maxOutputWait)
+
+	switch params.Operation {
+	case BackgroundStart:
+		if strings.TrimSpace(params.Command) == "" {
+			return nil, fmt.Errorf("command cannot be empty")
+		}
+		p, err := t.start(params.Command)
+		if err != nil {
+			return BackgroundResult{Success: false, Error: err.Error()}, nil
+		}
+		t.changed()
+		return t.output(ctx, p, params.Wait), nil
+	case BackgroundStatus:
+		if params.ID == "" {
+			return BackgroundResult{Success: true, Processes: t.List()}, nil
+		}
+	case BackgroundOutput, BackgroundInput, BackgroundKill:
+		if params.ID == "" {
+			return nil, fmt.Errorf("id is required for %s", params.Operation)
+		}
+	default:
+		return nil, fmt.Errorf("unknown operation: %s", params.Operation)
+	}
+
+	p := t.get(params.ID)
+	if p == nil {
+		return BackgroundResult{Success: false, Error: fmt.Sprintf("no background process %q", params.ID)}, nil
+	}
+	switch params.Operation {
+	case BackgroundOutput:
+		return t.output(ctx, p, params.Wait), nil
+	case BackgroundInput:
+		if err := t.input(p, params.Input, params.CloseStdin); err != nil {
+			return BackgroundResult{Success: false, Error: err.Error()}, nil
+		}
+	case BackgroundKill:
+		// The group of an exited process may have been reused
+		select {
+		case <-p.done:
+		default:
+			TerminateProcessGroup(p.cmd, p.done, processKillGrace)
+		}
+	}
+	info := p.info()
+	return BackgroundResult{Success: true, Process: &info}, nil
+}
+
+// start starts command in its own process group.
+func (t *BackgroundTool) start(command string) (*backgroundProcess, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closed {
+		return nil, errors.New("the session is ending")
+	}
+
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Dir = t.workDir
+	SetProcessGroup(cmd)
+	if t.sandbox != nil {
+		if err := t.sandbox.wrap(cmd); err != nil {
+			return nil, fmt.Errorf("failed to set up the sandbox: %w", err)
+		}
+	}
+	p := &backgroundProcess{command: command, cmd: cmd, started: time.Now(), done: make(chan struct{})}
+	cmd.Stdout = p
+	cmd.Stderr = p
+	// Children in another session that keep the output open do not keep the
+	// process running; they are out of reach of kill as well
+	cmd.WaitDelay = shellPipeDelay
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	p.stdin = stdin
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("failed to start command: %w", err)
+	}
+
+	t.nextID++
+	p.id = fmt.Sprintf("bg_%d", t.nextID)
+	t.procs[p.id] = p
+	t.monitors.Add(1)
+	go func() {
+		defer t.monitors.Done()
+		err := cmd.Wait()
+		code := 0
+		if err != nil {
+			code = -1
+			var exitErr *exec.ExitError
+			if errors.As(err, &exitErr) {
+				code = exitErr.ExitCode()
+			}
+		}
+		p.mu.Lock()
+		p.exitCode = code
+		p.mu.Unlock()
+		close(p.done)
+		t.changed()
+	}()
+	return p, nil
+}
+
+// output returns the process's unread output, waiting up to wait seconds for
+// some to arrive or for the process to exit.
+func (t *BackgroundTool) output(ctx context.Context, p *backgroundProcess, wait int) BackgroundResult {
+	if wait > 0 {
+		deadline := time.NewTimer(time.Duration(wait) * time.Second)
+		defer deadline.Stop()
+		poll := time.NewTicker(outputPollInterval)
+		defer poll.Stop()
+	waiting:
+		for !p.hasOutput() {
+			select {
+			case <-poll.C:
+			case <-p.done:
+				break waiting
+			case <-ctx.Done():
+				break waiting
+			case <-deadline.C:
+				break waiting
+			}
+		}
+	}
+	out, dropped := p.read()
+	info := p.info()
+	return BackgroundResult{Success: true, Process: &info, Output: out, Dropped: dropped}
+}
+
+// input writes text to the process's stdin.
+func (t *BackgroundTool) input(p *backgroundProcess, text string, closeStdin bool) error {
+	select {
+	case <-p.done:
+		return fmt.Errorf("process %s has exited", p.id)
+	default:
+	}
+	if text != "" {
+		if _, err := io.WriteString(p.stdin, text); err != nil {
+			return fmt.Errorf("failed to write input: %w", err)
+		}
+	}
+	if closeStdin {
+		return p.stdin.Close()
+	}
+	return nil
+}
+
+// get returns the process with the given id, or nil.
+func (t *BackgroundTool) get(id string) *backgroundProcess {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.procs[id]
+}
+
+// List returns all processes started in this session, oldest first.
+func (t *BackgroundTool) List() []ProcessInfo {
+	t.mu.Lock()
+	procs := make([]*backgroundProcess, 0, len(t.procs))
+	for _, p := range t.procs {
+		procs = append(procs, p)
+	}
+	t.mu.Unlock()
+
+	infos := make([]ProcessInfo, len(procs))
+	for i, p := range procs {
+		infos[i] = p.info()
+	}
+	sort.Slice(infos, func(i, j int) bool { return infos[i].StartedAt.Before(infos[j].StartedAt) })
+	return infos
+}
+
+// changed reports the current processes to OnChange.
+func (t *BackgroundTool) changed() {
+	if t.OnChange == nil {
+		return
+	}
+	t.notifyMu.Lock()
+	defer t.notifyMu.Unlock()
+	t.OnChange(t.List())
+}
+
+// Close kills all running processes and returns once their exits have been
+// reported; later starts fail.
+func (t *BackgroundTool) Close() error {
+	t.mu.Lock()
+	t.closed = true
+	procs := make([]*backgroundProcess, 0, len(t.procs))
+	for _, p := range t.procs {
+		procs = append(procs, p)
+	}
+	t.mu.Unlock()
+
+	var wg sync.WaitGroup
+	for _, p := range procs {
+		select {
+		case <-p.done:
+			continue
+		default:
+		}
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			TerminateProcessGroup(p.cmd, p.done, processKillGrace)
+		}()
+	}
+	wg.Wait()
+	t.monitors.Wait()
+	return nil
+}
@@ -0,0 +1,194 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os/exec"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// runBackground executes a background tool call and returns its result.
+func runBackground(t *testing.T, bt *BackgroundTool, params BackgroundParams) BackgroundResult {
+	t.Helper()
+	args, _ := json.Marshal(params)
+	result, err := bt.Execute(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Execute(%+v) failed: %v", params, err)
+	}
+	return result.(BackgroundResult)
+}
+
+func TestBackgroundTool_NameDescriptionParameters(t *testing.T) {
+	bt := NewBackgroundTool("/tmp")
+	if bt.Name() != "background" {
+		t.Errorf("expected name 'background', got %q", bt.Name())
+	}
+	if bt.Description() == "" {
+		t.Error("description should not be empty")
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(bt.Parameters(), &schema); err != nil {
+		t.Fatalf("Parameters() is not valid JSON: %v", err)
+	}
+}
+
+func TestBackgroundTool_IncrementalOutput(t *testing.T) {
+	bt := NewBackgroundTool(t.TempDir())
+	defer bt.Close()
+
+	r := runBackground(t, bt, BackgroundParams{Operation: "start", Command: "echo first; sleep 0.3; echo second", Wait: 5})
+	if !r.Success || r.Process == nil || r.Process.ID != "bg_1" || r.Output != "first\n" {
+		t.Fatalf("unexpected start result: %+v", r)
+	}
+
+	// Only new output is returned, then the exit is reported
+	r = runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_1", Wait: 5})
+	if r.Output != "second\n" {
+		t.Errorf("expected only new output, got %q", r.Output)
+	}
+	r = runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_1", Wait: 5})
+	if r.Process.Running || r.Process.ExitCode != 0 || r.Output != "" {
+		t.Errorf("expected a finished process, got %+v", r.Process)
+	}
+	if !strings.Contains(r.ModelText(), "[bg_1 exited with code 0") {
+		t.Errorf("unexpected model text: %q", r.ModelText())
+	}
+}
+
+func TestBackgroundTool_Input(t *testing.T) {
+	bt := NewBackgroundTool(t.TempDir())
+	defer bt.Close()
+
+	runBackground(t, bt, BackgroundParams{Operation: "start", Command: "while read line; do echo \"got $line\"; done; exit 3"})
+	runBackground(t, bt, BackgroundParams{Operation: "input", ID: "bg_1", Input: "ping\n"})
+	if r := runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_1", Wait: 5}); r.Output != "got ping\n" {
+		t.Errorf("unexpected output: %q", r.Output)
+	}
+
+	runBackground(t, bt, BackgroundParams{Operation: "input", ID: "bg_1", CloseStdin: true})
+	r := runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_1", Wait: 5})
+	if r.Process.Running || r.Process.ExitCode != 3 {
+		t.Errorf("process should exit after stdin closes: %+v", r.Process)
+	}
+	if r := runBackground(t, bt, BackgroundParams{Operation: "input", ID: "bg_1", Input: "x"}); r.Success {
+		t.Error("input to an exited process should fail")
+	}
+}
+
+func TestBackgroundTool_KillAndStatus(t *testing.T) {
+	bt := NewBackgroundTool(t.TempDir())
+	defer bt.Close()
+
+	var mu sync.Mutex
+	var changes [][]ProcessInfo
+	bt.OnChange = func(procs []ProcessInfo) {
+		mu.Lock()
+		changes = append(changes, procs)
+		mu.Unlock()
+	}
+
+	runBackground(t, bt, BackgroundParams{Operation: "start", Command: "sleep 30 & sleep 30; wait"})
+	runBackground(t, bt, BackgroundParams{Operation: "start", Command: "sleep 30"})
+
+	start := time.Now()
+	r := runBackground(t, bt, BackgroundParams{Operation: "kill", ID: "bg_1"})
+	if !r.Success || r.Process.Running {
+		t.Errorf("process should be killed: %+v", r)
+	}
+	if time.Since(start) > 2*time.Second {
+		t.Error("kill should not need SIGKILL for sleep")
+	}
+
+	r = runBackground(t, bt, BackgroundParams{Operation: "status"})
+	if len(r.Processes) != 2 || r.Processes[0].Running || !r.Processes[1].Running {
+		t.Errorf("unexpected status: %+v", r.Processes)
+	}
+
+	bt.Close()
+	if procs := bt.List(); procs[1].Running {
+		t.Error("Close should kill running processes")
+	}
+	if r := runBackground(t, bt, BackgroundParams{Operation: "start", Command: "true"}); r.Success {
+		t.Error("start after Close should fail")
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	last := changes[len(changes)-1]
+	if len(changes) < 4 || len(last) != 2 || last[0].Running || last[1].Running {
+		t.Errorf("OnChange should report starts and exits, got %+v", changes)
+	}
+}
+
+func TestBackgroundTool_DetachedChild(t *testing.T) {
+	if _, err := exec.LookPath("setsid"); err != nil {
+		t.Skip("setsid not available")
+	}
+	bt := NewBackgroundTool(t.TempDir())
+	defer bt.Close()
+
+	// The grandchild keeps the output open from a session of its own
+	start := time.Now()
+	runBackground(t, bt, BackgroundParams{Operation: "start", Command: "setsid sleep 5 & echo started"})
+	r := runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_1", Wait: 10})
+	for r.Process.Running && time.Since(start) < 10*time.Second {
+		r = runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_1", Wait: 10})
+	}
+	if r.Process.Running || time.Since(start) > 4*time.Second {
+		t.Errorf("the process should end with its shell, got %+v after %v", r.Process, time.Since(start))
+	}
+	if r := runBackground(t, bt, BackgroundParams{Operation: "status", ID: "bg_1"}); r.Process.Running {
+		t.Errorf("status should report the exit: %+v", r.Process)
+	}
+
+	start = time.Now()
+	if r := runBackground(t, bt, BackgroundParams{Operation: "kill", ID: "bg_1"}); !r.Success || r.Process.Running {
+		t.Errorf("unexpected kill result: %+v", r)
+	}
+	if time.Since(start) > time.Second {
+		t.Errorf("killing an exited process should return at once, took %v", time.Since(start))
+	}
+}
+
+func TestBackgroundTool_Errors(t *testing.T) {
+	bt := NewBackgroundTool(t.TempDir())
+	if r := runBackground(t, bt, BackgroundParams{Operation: "output", ID: "bg_9"}); r.Success || !strings.Contains(r.Error, "bg_9") {
+		t.Errorf("expected unknown id error, got %+v", r)
+	}
+	for _, params := range []string{`{"operation":"start"}`, `{"operation":"kill"}`, `{"operation":"restart"}`, `{invalid`} {
+		if _, err := bt.Execute(context.Background(), json.RawMessage(params)); err == nil {
+			t.Errorf("expected error for %s", params)
+		}
+	}
+}
+
+func TestBackgroundProcess_DropsOldOutput(t *testing.T) {
+	p := &backgroundProcess{}
+	p.Write([]byte("old"))
+	p.Write([]byte(strings.Repeat("x", maxProcessOutput)))
+	out, dropped := p.read()
+	if dropped != 3 || len(out) != maxProcessOutput || strings.HasPrefix(out, "old") {
+		t.Errorf("unexpected buffer: %d bytes, %d dropped", len(out), dropped)
+	}
+}
+
+func TestBackgroundTool_ApprovalAction(t *testing.T) {
+	bt := NewBackgroundTool("")
+	tests := []struct {
+		params string
+		needed bool
+	}{
+		{`{"operation":"start","command":"npm run dev"}`, true},
+		{`{"operation":"input","id":"bg_1","input":"y\n"}`, true},
+		{`{"operation":"output","id":"bg_1"}`, false},
+		{`{"operation":"kill","id":"bg_1"}`, false},
+	}
+	for _, tt := range tests {
+		if _, _, needed := bt.ApprovalAction(json.RawMessage(tt.params)); needed != tt.needed {
+			t.Errorf("ApprovalAction(%s) needed = %v, want %v", tt.params, needed, tt.needed)
+		}
+	}
+}
@@ -0,0 +1,307 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// interruptGrace is how long a timed-out command may take to stop after it
+// was interrupted before the shell is restarted.
+const interruptGrace = 2 * time.Second
+
+// errShellExited reports that the shell process ended while running a command,
+// for example because the command ran exit.
+var errShellExited = errors.New("shell exited")
+
+// BashSession is a long-lived bash process that runs commands one at a time,
+// so the working directory, environment variables and shell functions carry
+// over from one command to the next.
+//
+// Each command is followed by a line holding a random sentinel on both stdout
+// and stderr, which marks where its output ends; the stdout line also carries
+// the command's exit status and the shell's working directory. Commands read
+// from /dev/null rather than the shell's input.
+type BashSession struct {
+	workDir  string
+	cmd      *exec.Cmd
+	stdin    io.WriteCloser
+	sentinel string
+
+	mu     sync.Mutex // Guards stdout, stderr and emit
+	stdout sessionStream
+	stderr sessionStream
+	emit   func(OutputChunk) // Output function of the running command
+
+	notify chan struct{} // Signalled when output arrives
+	eof    chan struct{} // Closed when both output pipes are closed
+	exited chan struct{} // Closed when the shell process has exited
+}
+
+// sessionStream is the output of the running command on one stream.
+type sessionStream struct {
+	name    string
+	buf     []byte
+	emitted int // Bytes of buf passed to the output function
+}
+
+// BashOutput is the result of a command run in a BashSession.
+type BashOutput struct {
+	Stdout   string
+	Stderr   string
+	ExitCode int
+	Cwd      string // Working directory after the command
+}
+
+// StartBashSession starts bash in workDir, inside sandbox unless it is nil.
+func StartBashSession(workDir string, sandbox *SandboxPolicy) (*BashSession, error) {
+	nonce := make([]byte, 8)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+
+	cmd := exec.Command("bash", "--noprofile", "--norc")
+	cmd.Dir = workDir
+	cmd.Env = append(os.Environ(), "PS1=", "PS2=")
+	SetProcessGroup(cmd)
+	if sandbox != nil {
+		if err := sandbox.wrap(cmd); err != nil {
+			return nil, fmt.Errorf("failed to set up the sandbox: %w", err)
+		}
+	}
+
+	outR, outW, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	errR, errW, err := os.Pipe()
+	if err != nil {
+		closeFiles(outR, outW)
+		return nil, err
+	}
+	cmd.Stdout = outW
+	cmd.Stderr = errW
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		closeFiles(outR, outW, errR, errW)
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		closeFiles(outR, outW, errR, errW)
+		return nil, fmt.Errorf("failed to start bash: %w", err)
+	}
+	closeFiles(outW, errW)
+
+	s := &BashSession{
+		workDir:  workDir,
+		cmd:      cmd,
+		stdin:    stdin,
+		sentinel: "__KIMI_" + hex.EncodeToString(nonce) + "__",
+		stdout:   sessionStream{name: StreamStdout},
+		stderr:   sessionStream{name: StreamStderr},
+		notify:   make(chan struct{}, 1),
+		eof:      make(chan struct{}),
+		exited:   make(chan struct{}),
+	}
+	var readers sync.WaitGroup
+	readers.Add(2)
+	go s.readOutput(outR, &s.stdout, &readers)
+	go s.readOutput(errR, &s.stderr, &readers)
+	go func() {
+		readers.Wait()
+		close(s.eof)
+	}()
+	go func() {
+		_ = cmd.Wait()
+		close(s.exited)
+	}()
+
+	// Interrupts stop the running command, not the shell itself
+	if _, err := io.WriteString(stdin, "trap : INT\n"); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// closeFiles closes the given files.
+func closeFiles(files ...*os.File) {
+	for _, f := range files {
+		f.Close()
+	}
+}
+
+// readOutput collects one of the shell's output streams until its pipe closes.
+func (s *BashSession) readOutput(r *os.File, stream *sessionStream, wg *sync.WaitGroup) {
+	defer wg.Done()
+	defer r.Close()
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := r.Read(buf)
+		if n > 0 {
+			s.mu.Lock()
+			stream.buf = append(stream.buf, buf[:n]...)
+			s.mu.Unlock()
+			select {
+			case s.notify <- struct{}{}:
+			default:
+			}
+		}
+		if err != nil {
+			return
+		}
+	}
+}
+
+// Run runs command and waits for it to finish, passing its output to the
+// output function of ctx as it arrives. When ctx ends first, the command is
+// interrupted; the returned error is then ctx's error, or errShellExited if
+// the shell itself is gone. Output collected so far is returned in either
+// case. Run must not be called concurrently.
+func (s *BashSession) Run(ctx context.Context, command string) (BashOutput, error) {
+	s.mu.Lock()
+	s.stdout.buf, s.stdout.emitted = nil, 0
+	s.stderr.buf, s.stderr.emitted = nil, 0
+	s.emit = outputFunc(ctx)
+	s.mu.Unlock()
+
+	// The command is quoted in a here-document, so it is parsed only by eval
+	script := fmt.Sprintf("IFS= read -r -d '' __kimi_cmd <<'%[1]s'\n%[2]s\n%[1]s\n"+
+		"eval \"$__kimi_cmd\" </dev/null\n"+
+		"printf '\\n%[1]s %%d %%s\\n' \"$?\" \"$PWD\"\n"+
+		"printf '\\n%[1]s\\n' >&2\n", s.sentinel, command)
+	if _, err := io.WriteString(s.stdin, script); err != nil {
+		return BashOutput{}, errShellExited
+	}
+
+	var interrupted <-chan time.Time
+	done := ctx.Done()
+	for {
+		if out, ok := s.takeResult(); ok {
+			if interrupted != nil {
+				return out, ctx.Err()
+			}
+			return out, nil
+		}
+		s.report(false)
+		select {
+		case <-s.notify:
+		case <-s.exited:
+			// Background jobs may keep the pipes open; wait briefly for the rest
+			select {
+			case <-s.eof:
+			case <-time.After(100 * time.Millisecond):
+			}
+			if out, ok := s.takeResult(); ok {
+				return out, nil
+			}
+			return s.partialOutput(), errShellExited
+		case <-done:
+			// Interrupt the command and give it a moment to stop
+			done = nil
+			_ = signalProcessGroup(s.cmd, os.Interrupt)
+			interrupted = time.After(interruptGrace)
+		case <-interrupted:
+			out := s.partialOutput()
+			s.Close()
+			return out, errShellExited
+		}
+	}
+}
+
+// takeResult returns the command's result once both sentinel lines arrived.
+func (s *BashSession) takeResult() (BashOutput, bool) {
+	s.mu.Lock()
+	marker := "\n" + s.sentinel
+	outEnd := bytes.Index(s.stdout.buf, []byte(marker+" "))
+	errEnd := bytes.Index(s.stderr.buf, []byte(marker+"\n"))
+	if outEnd < 0 || errEnd < 0 {
+		s.mu.Unlock()
+		return BashOutput{}, false
+	}
+	rest := s.stdout.buf[outEnd+len(marker)+1:]
+	end := bytes.IndexByte(rest, '\n')
+	if end < 0 {
+		s.mu.Unlock()
+		return BashOutput{}, false
+	}
+	status, cwd, _ := strings.Cut(string(rest[:end]), " ")
+	code, _ := strconv.Atoi(status)
+	out := BashOutput{
+		Stdout:   string(s.stdout.buf[:outEnd]),
+		Stderr:   string(s.stderr.buf[:errEnd]),
+		ExitCode: code,
+		Cwd:      cwd,
+	}
+	s.mu.Unlock()
+
+	s.report(true)
+	return out, true
+}
+
+// report passes output not yet reported to the output function. Unless final
+// is set, a trailing part that may begin a sentinel line is held back.
+func (s *BashSession) report(final bool) {
+	s.mu.Lock()
+	emit := s.emit
+	if emit == nil {
+		s.mu.Unlock()
+		return
+	}
+	marker := []byte("\n" + s.sentinel)
+	var chunks []OutputChunk
+	for _, stream := range []*sessionStream{&s.stdout, &s.stderr} {
+		end := len(stream.buf)
+		if i := bytes.Index(stream.buf, marker); i >= 0 {
+			end = i
+		} else if !final {
+			end -= partialPrefix(stream.buf, marker)
+		}
+		if end > stream.emitted {
+			chunks = append(chunks, OutputChunk{Stream: stream.name, Text: string(stream.buf[stream.emitted:end])})
+			stream.emitted = end
+		}
+	}
+	s.mu.Unlock()
+
+	for _, chunk := range chunks {
+		emit(chunk)
+	}
+}
+
+// partialPrefix returns the length of the longest suffix of b that is a
+// proper prefix of marker.
+func partialPrefix(b, marker []byte) int {
+	for i := max(len(b)-len(marker)+1, 0); i < len(b); i++ {
+		if bytes.HasPrefix(marker, b[i:]) {
+			return len(b) - i
+		}
+	}
+	return 0
+}
+
+// partialOutput reports and returns the output of a command that did not
+// finish.
+func (s *BashSession) partialOutput() BashOutput {
+	s.report(true)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return BashOutput{Stdout: string(s.stdout.buf), Stderr: string(s.stderr.buf), ExitCode: -1}
+}
+
+// Close terminates the shell and everything it started in its process group.
+func (s *BashSession) Close() error {
+	s.stdin.Close()
+	TerminateProcessGroup(s.cmd, s.exited, time.Second)
+	return nil
+}
@@ -0,0 +1,241 @@
+package tools
+
+import (
+	"context"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// startTestSession starts a bash session in a temporary directory.
+func startTestSession(t *testing.T) (*BashSession, string) {
+	t.Helper()
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+	s, err := StartBashSession(dir, nil)
+	if err != nil {
+		t.Fatalf("StartBashSession failed: %v", err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s, dir
+}
+
+// runTest runs a command that is expected to complete.
+func runTest(t *testing.T, s *BashSession, command string) BashOutput {
+	t.Helper()
+	out, err := s.Run(context.Background(), command)
+	if err != nil {
+		t.Fatalf("Run(%q) failed: %v", command, err)
+	}
+	return out
+}
+
+func TestBashSession_KeepsState(t *testing.T) {
+	s, dir := startTestSession(t)
+
+	runTest(t, s, "mkdir sub && cd sub")
+	runTest(t, s, "export GREETING=hello; greet() { echo \"$GREETING $1\"; }")
+	out := runTest(t, s, "greet world; pwd")
+	if out.Stdout != "hello world\n"+filepath.Join(dir, "sub")+"\n" {
+		t.Errorf("state not kept, output %q", out.Stdout)
+	}
+	if out.Cwd != filepath.Join(dir, "sub") || out.ExitCode != 0 {
+		t.Errorf("unexpected result: %+v", out)
+	}
+}
+
+func TestBashSession_OutputAndExitCode(t *testing.T) {
+	s, _ := startTestSession(t)
+
+	tests := []struct {
+		command string
+		stdout  string
+		stderr  string
+		code    int
+	}{
+		{"printf 'no newline'", "no newline", "", 0},
+		{"true", "", "", 0},
+		{"echo out; echo err >&2; exit_code() { return 3; }; exit_code", "out\n", "err\n", 3},
+		{"printf 'no newline' >&2", "", "no newline", 0},
+		{"if then", "", "", 2}, // Syntax errors do not end the session
+		{"cat", "", "", 0},     // Commands do not read the session's input
+	}
+	for _, tt := range tests {
+		out := runTest(t, s, tt.command)
+		if tt.command == "if then" {
+			if !strings.Contains(out.Stderr, "syntax error") {
+				t.Errorf("syntax error should be reported on stderr, got %q", out.Stderr)
+			}
+			out.Stderr = "" // The message depends on the bash version
+		}
+		if out.Stdout != tt.stdout || out.Stderr != tt.stderr || out.ExitCode != tt.code {
+			t.Errorf("Run(%q) = %q, %q, %d; want %q, %q, %d", tt.command,
+				out.Stdout, out.Stderr, out.ExitCode, tt.stdout, tt.stderr, tt.code)
+		}
+	}
+}
+
+func TestBashSession_TimeoutInterruptsCommand(t *testing.T) {
+	s, _ := startTestSession(t)
+	runTest(t, s, "export KEPT=yes")
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	out, err := s.Run(ctx, "echo started; sleep 30")
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline error, got %v", err)
+	}
+	if time.Since(start) > 5*time.Second {
+		t.Error("command was not interrupted")
+	}
+	if !strings.HasPrefix(out.Stdout, "started\n") {
+		t.Errorf("partial output missing: %q", out.Stdout)
+	}
+
+	// The shell survives with its state
+	if out := runTest(t, s, "echo $KEPT"); out.Stdout != "yes\n" {
+		t.Errorf("session lost state after interrupt: %q", out.Stdout)
+	}
+}
+
+func TestBashSession_Exit(t *testing.T) {
+	s, _ := startTestSession(t)
+	out, err := s.Run(context.Background(), "echo bye; exit 4")
+	if err != errShellExited {
+		t.Fatalf("expected errShellExited, got %v", err)
+	}
+	if out.Stdout != "bye\n" {
+		t.Errorf("unexpected output: %q", out.Stdout)
+	}
+}
+
+func TestBashSession_StreamsOutput(t *testing.T) {
+	s, _ := startTestSession(t)
+
+	var mu sync.Mutex
+	var chunks []OutputChunk
+	ctx := WithOutputFunc(context.Background(), func(c OutputChunk) {
+		mu.Lock()
+		chunks = append(chunks, c)
+		mu.Unlock()
+	})
+	out, err := s.Run(ctx, "echo one; sleep 0.2; echo two >&2; printf three")
+	if err != nil {
+		t.Fatalf("Run failed: %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	streamed := map[string]string{}
+	for _, c := range chunks {
+		streamed[c.Stream] += c.Text
+	}
+	if streamed[StreamStdout] != out.Stdout || streamed[StreamStderr] != out.Stderr {
+		t.Errorf("streamed %q, want the result %+v", streamed, out)
+	}
+	// A trailing newline may be held back until the sentinel is ruled out
+	if len(chunks) < 2 || chunks[0].Stream != StreamStdout || !strings.HasPrefix(chunks[0].Text, "one") {
+		t.Errorf("output should arrive while the command runs, got %+v", chunks)
+	}
+	if strings.Contains(out.Stdout, s.sentinel) {
+		t.Errorf("sentinel leaked into output: %q", out.Stdout)
+	}
+}
+
+func TestPartialPrefix(t *testing.T) {
+	marker := []byte("\n__KIMI__")
+	tests := map[string]int{"abc": 0, "abc\n": 1, "abc\n__KI": 5, "__KI": 0, "": 0}
+	for in, want := range tests {
+		if got := partialPrefix([]byte(in), marker); got != want {
+			t.Errorf("partialPrefix(%q) = %d, want %d", in, got, want)
+		}
+	}
+}
+
+func TestBashSession_StuckCommandEndsSession(t *testing.T) {
+	s, _ := startTestSession(t)
+
+	// A command that ignores interrupts is killed along with the shell
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if _, err := s.Run(ctx, "trap '' INT; sleep 30"); err != errShellExited {
+		t.Fatalf("expected errShellExited, got %v", err)
+	}
+	select {
+	case <-s.exited:
+	default:
+		t.Error("shell should be stopped")
+	}
+}
+
+func TestShellTool_Persistent(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	dir, _ := filepath.EvalSymlinks(t.TempDir())
+	tool := NewShellTool(dir, 5*time.Second)
+	tool.SetPersistent(true)
+	defer tool.Close()
+	run := func(params string) ShellToolResult {
+		t.Helper()
+		result, err := tool.Execute(context.Background(), []byte(params))
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return result.(ShellToolResult)
+	}
+
+	run(`{"command":"mkdir -p a/b && cd a/b && export X=1"}`)
+	r := run(`{"command":"echo $X"}`)
+	if !r.Success || r.Stdout != "1\n" || r.Cwd != filepath.Join(dir, "a", "b") {
+		t.Errorf("state not kept: %+v", r)
+	}
+	if !strings.Contains(r.ModelText(), "[cwd: "+r.Cwd+"]") {
+		t.Errorf("model text should report the directory: %q", r.ModelText())
+	}
+
+	if r := run(`{"command":"false"}`); r.Success || r.ExitCode != 1 {
+		t.Errorf("expected failure, got %+v", r)
+	}
+
+	r = run(`{"command":"exit 0"}`)
+	if r.Success || !strings.Contains(r.Error, "shell exited") {
+		t.Errorf("expected shell exit, got %+v", r)
+	}
+
+	// A new shell starts in the work directory
+	if r := run(`{"command":"export X=2; pwd"}`); r.Stdout != dir+"\n" {
+		t.Errorf("unexpected directory after exit: %+v", r)
+	}
+	if r := run(`{"command":"echo ${X:-unset}","restart":true}`); r.Stdout != "unset\n" {
+		t.Errorf("restart should reset the environment: %+v", r)
+	}
+}
+
+func TestShellTool_PersistentTimeout(t *testing.T) {
+	if _, err := exec.LookPath("bash"); err != nil {
+		t.Skip("bash not installed")
+	}
+	tool := NewShellTool(t.TempDir(), 5*time.Second)
+	tool.SetPersistent(true)
+	defer tool.Close()
+
+	tool.timeout = 200 * time.Millisecond
+	result, _ := tool.Execute(context.Background(), []byte(`{"command":"export Y=1; sleep 30"}`))
+	r := result.(ShellToolResult)
+	if r.Success || !strings.Contains(r.Error, "timed out and was interrupted") {
+		t.Errorf("expected interrupted command, got %+v", r)
+	}
+
+	tool.timeout = 5 * time.Second
+	result, _ = tool.Execute(context.Background(), []byte(`{"command":"echo $Y"}`))
+	if r := result.(ShellToolResult); r.Stdout != "1\n" {
+		t.Errorf("shell should survive the timeout: %+v", r)
+	}
+}
@@ -0,0 +1,57 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff_Equal(t *testing.T) {
+	if diff := UnifiedDiff("a.txt", "same\n", "same\n"); diff != "" {
+		t.Errorf("expected empty diff, got %q", diff)
+	}
+}
+
+func TestUnifiedDiff_SingleChange(t *testing.T) {
+	before := "1\n2\n3\n4\n5\n6\n7\n8\n9\n"
+	after := "1\n2\n3\n4\nfive\n6\n7\n8\n9\n"
+	want := "--- a/n.txt\n+++ b/n.txt\n" +
+		"@@ -2,7 +2,7 @@\n" +
+		" 2\n 3\n 4\n-5\n+five\n 6\n 7\n 8\n"
+	if diff := UnifiedDiff("n.txt", before, after); diff != want {
+		t.Errorf("unexpected diff:\n%s\nwant:\n%s", diff, want)
+	}
+}
+
+func TestUnifiedDiff_SeparateHunks(t *testing.T) {
+	var before, after strings.Builder
+	for i := 0; i < 30; i++ {
+		line := string(rune('a'+i%26)) + "\n"
+		before.WriteString(line)
+		if i == 2 || i == 25 {
+			line = "changed\n"
+		}
+		after.WriteString(line)
+	}
+	diff := UnifiedDiff("x", before.String(), after.String())
+	if n := strings.Count(diff, "@@ -"); n != 2 {
+		t.Errorf("expected 2 hunks, got %d:\n%s", n, diff)
+	}
+	if !strings.Contains(diff, "@@ -1,6 +1,6 @@") || !strings.Contains(diff, "@@ -23,7 +23,7 @@") {
+		t.Errorf("unexpected hunk headers:\n%s", diff)
+	}
+}
+
+func TestUnifiedDiff_InsertAndNoTrailingNewline(t *testing.T) {
+	diff := UnifiedDiff("f", "", "new")
+	want := "--- a/f\n+++ b/f\n@@ -0,0 +1,1 @@\n+new\n\\ No newline at end of file\n"
+	if diff != want {
+		t.Errorf("unexpected diff:\n%q\nwant:\n%q", diff, want)
+	}
+}
+
+func TestUnifiedDiff_CRLF(t *testing.T) {
+	diff := UnifiedDiff("f", "a\r\nb\r\n", "a\r\nc\r\n")
+	if !strings.Contains(diff, "-b\n+c\n") {
+		t.Errorf("line endings should be stripped in the diff, got %q", diff)
+	}
+}
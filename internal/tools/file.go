@@ -12,6 +12,7 @@ import (
 // FileTool provides file operations.
 type FileTool struct {
 	workDir string
+	policy  *WorkspacePolicy
 }
 
 // FileReadParams represents parameters for file read operation.
@@ -28,6 +29,14 @@ type FileWriteParams struct {
 	Append  bool   `json:"append,omitempty"`
 }
 
+// FileEditParams represents parameters for file edit operation.
+type FileEditParams struct {
+	Path       string `json:"path"`
+	OldString  string `json:"old_string"`
+	NewString  string `json:"new_string"`
+	ReplaceAll bool   `json:"replace_all,omitempty"`
+}
+
 // FileListParams represents parameters for file list operation.
 type FileListParams struct {
 	Path    string `json:"path,omitempty"`
@@ -36,10 +45,36 @@ type FileListParams struct {
 
 // FileResult represents the result of a file operation.
 type FileResult struct {
-	Success bool       `json:"success"`
-	Content string     `json:"content,omitempty"`
-	Error   string     `json:"error,omitempty"`
-	Files   []FileInfo `json:"files,omitempty"`
+	Success    bool             `json:"success"`
+	Content    string           `json:"content,omitempty"`
+	Error      string           `json:"error,omitempty"`
+	Denied     *PathDeniedError `json:"denied,omitempty"` // Set when the workspace policy refused the path
+	Files      []FileInfo       `json:"files,omitempty"`
+	TotalLines int              `json:"total_lines,omitempty"` // Lines in a read file; 0 when too large to count
+	HasMore    bool             `json:"has_more,omitempty"`    // More lines follow the ones read
+	Encoding   string           `json:"encoding,omitempty"`    // Encoding of a read file that is not plain UTF-8
+	Note       string           `json:"note,omitempty"`
+	Diff       string           `json:"-"` // Unified diff of an edit, shown to the user only
+}
+
+// ModelText implements ModelTexter. File contents and messages are sent as
+// text; listings and errors as JSON.
+func (r FileResult) ModelText() string {
+	if !r.Success || r.Files != nil {
+		return ""
+	}
+	if r.Note == "" {
+		return r.Content
+	}
+	var b strings.Builder
+	b.WriteString(r.Content)
+	appendLine(&b, r.Note)
+	return b.String()
+}
+
+// Display implements Displayable. Edits show their diff.
+func (r FileResult) Display() string {
+	return r.Diff
 }
 
 // FileInfo represents file information.
@@ -63,7 +98,11 @@ func (t *FileTool) Name() string {
 
 // Description returns the tool description.
 func (t *FileTool) Description() string {
-	return "File operations including read, write, list, and search."
+	return "File operations including read, write, edit, list, and search. " +
+		fmt.Sprintf("read returns up to %d lines, each prefixed with its line number and a tab, which are not part of the file; ", defaultReadLines) +
+		"use offset and limit to page through large files. Binary files cannot be read. " +
+		"Use edit to change part of a file: it replaces old_string with new_string, " +
+		"which must match exactly once unless replace_all is set."
 }
 
 // Parameters returns the JSON schema for tool parameters.
@@ -73,7 +112,7 @@ func (t *FileTool) Parameters() json.RawMessage {
 		"properties": {
 			"operation": {
 				"type": "string",
-				"enum": ["read", "write", "list", "delete", "exists"],
+				"enum": ["read", "write", "edit", "list", "delete", "exists"],
 				"description": "The file operation to perform"
 			},
 			"path": {
@@ -84,27 +123,67 @@ func (t *FileTool) Parameters() json.RawMessage {
 				"type": "string",
 				"description": "Content to write (for write operation)"
 			},
+			"old_string": {
+				"type": "string",
+				"description": "Exact text to replace, including whitespace (for edit operation)"
+			},
+			"new_string": {
+				"type": "string",
+				"description": "Replacement text (for edit operation)"
+			},
+			"replace_all": {
+				"type": "boolean",
+				"description": "Replace every occurrence of old_string (for edit operation)"
+			},
+			"pattern": {
+				"type": "string",
+				"description": "Glob to filter entry names, e.g. *.go (for list operation)"
+			},
 			"offset": {
 				"type": "integer",
-				"description": "Offset to start reading from"
+				"description": "Number of lines to skip before reading (for read operation)"
 			},
 			"limit": {
 				"type": "integer",
-				"description": "Maximum number of lines to read"
+				"description": "Maximum number of lines to read (for read operation)"
 			}
 		},
 		"required": ["operation", "path"]
 	}`)
 }
 
-// Execute executes the file tool.
-func (t *FileTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+// ApprovalAction implements Approvable. Only operations that modify files need approval.
+func (t *FileTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
 	var params struct {
 		Operation string `json:"operation"`
 		Path      string `json:"path"`
-		Content   string `json:"content,omitempty"`
-		Offset    int    `json:"offset,omitempty"`
-		Limit     int    `json:"limit,omitempty"`
+	}
+	_ = json.Unmarshal(args, &params)
+
+	switch params.Operation {
+	case "write":
+		return "write file", fmt.Sprintf("write file `%s`", params.Path), true
+	case "edit":
+		return "edit file", fmt.Sprintf("edit file `%s`", params.Path), true
+	case "delete":
+		return "delete file", fmt.Sprintf("delete `%s`", params.Path), true
+	default:
+		return "", "", false
+	}
+}
+
+// Execute executes the file tool.
+func (t *FileTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Operation  string `json:"operation"`
+		Path       string `json:"path"`
+		Content    string `json:"content,omitempty"`
+		Offset     int    `json:"offset,omitempty"`
+		Limit      int    `json:"limit,omitempty"`
+		OldString  string `json:"old_string,omitempty"`
+		NewString  string `json:"new_string,omitempty"`
+		ReplaceAll bool   `json:"replace_all,omitempty"`
+		Pattern    string `json:"pattern,omitempty"`
 	}
 
 	if err := json.Unmarshal(args, &params); err != nil {
@@ -112,15 +191,30 @@ func (t *FileTool) Execute(ctx context.Context, args json.RawMessage) (any, erro
 	}
 
 	// Resolve path relative to work directory
-	path := t.resolvePath(params.Path)
+	access := AccessRead
+	switch params.Operation {
+	case "write", "edit", "delete":
+		access = AccessWrite
+	}
+	path, err := t.policy.Resolve(t.workDir, params.Path, access)
+	if err != nil {
+		return FileResult{Success: false, Error: err.Error(), Denied: asDenied(err)}, nil
+	}
 
 	switch params.Operation {
 	case "read":
 		return t.readFile(path, params.Offset, params.Limit)
 	case "write":
 		return t.writeFile(path, params.Content)
+	case "edit":
+		return t.editFile(path, FileEditParams{
+			Path:       params.Path,
+			OldString:  params.OldString,
+			NewString:  params.NewString,
+			ReplaceAll: params.ReplaceAll,
+		})
 	case "list":
-		return t.listDir(path)
+		return t.listDir(path, params.Pattern)
 	case "delete":
 		return t.deleteFile(path)
 	case "exists":
@@ -131,68 +225,116 @@ func (t *FileTool) Execute(ctx context.Context, args json.RawMessage) (any, erro
 }
 
 func (t *FileTool) resolvePath(path string) string {
+	return resolveWorkPath(t.workDir, path)
+}
+
+// resolveWorkPath resolves a tool path relative to the work directory.
+func resolveWorkPath(workDir, path string) string {
 	if filepath.IsAbs(path) {
 		return path
 	}
-	if t.workDir != "" {
-		return filepath.Join(t.workDir, path)
+	if workDir != "" {
+		return filepath.Join(workDir, path)
 	}
 	return path
 }
 
-func (t *FileTool) readFile(path string, offset, limit int) (FileResult, error) {
-	data, err := os.ReadFile(path)
-	if err != nil {
+func (t *FileTool) writeFile(path string, content string) (FileResult, error) {
+	// Ensure parent directory exists
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0755); err != nil {
 		return FileResult{
 			Success: false,
 			Error:   err.Error(),
 		}, nil
 	}
 
-	content := string(data)
-
-	// Handle offset and limit for line-based reading
-	if offset > 0 || limit > 0 {
-		lines := strings.Split(content, "\n")
-		if offset > len(lines) {
-			offset = len(lines)
-		}
-		end := len(lines)
-		if limit > 0 && offset+limit < end {
-			end = offset + limit
-		}
-		content = strings.Join(lines[offset:end], "\n")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		return FileResult{
+			Success: false,
+			Error:   err.Error(),
+		}, nil
 	}
 
 	return FileResult{
 		Success: true,
-		Content: content,
 	}, nil
 }
 
-func (t *FileTool) writeFile(path string, content string) (FileResult, error) {
-	// Ensure parent directory exists
-	dir := filepath.Dir(path)
-	if err := os.MkdirAll(dir, 0755); err != nil {
+// editFile replaces old_string with new_string. The file's line endings and
+// permissions are kept, and the result carries a unified diff of the change.
+func (t *FileTool) editFile(path string, params FileEditParams) (FileResult, error) {
+	if params.OldString == "" {
+		return FileResult{Success: false, Error: "old_string must not be empty"}, nil
+	}
+	if params.OldString == params.NewString {
+		return FileResult{Success: false, Error: "old_string and new_string are identical"}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return FileResult{Success: false, Error: err.Error()}, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return FileResult{Success: false, Error: err.Error()}, nil
+	}
+	content := string(data)
+
+	// Models write "\n"; match a CRLF file in its own line endings. Text in a
+	// file with mixed line endings is matched as written first
+	oldString, newString := params.OldString, params.NewString
+	if crlf := strings.Count(content, "\r\n"); crlf > 0 &&
+		(crlf == strings.Count(content, "\n") || !strings.Contains(content, oldString)) {
+		oldString, newString = toCRLF(oldString), toCRLF(newString)
+	}
+
+	count := strings.Count(content, oldString)
+	switch {
+	case count == 0:
 		return FileResult{
 			Success: false,
-			Error:   err.Error(),
+			Error:   fmt.Sprintf("old_string not found in %s; read the file and copy the text exactly, including whitespace", params.Path),
 		}, nil
-	}
-
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	case count > 1 && !params.ReplaceAll:
 		return FileResult{
 			Success: false,
-			Error:   err.Error(),
+			Error:   fmt.Sprintf("old_string matches %d times in %s; include more surrounding text to make it unique, or set replace_all", count, params.Path),
 		}, nil
 	}
 
+	updated := strings.Replace(content, oldString, newString, 1)
+	if params.ReplaceAll {
+		updated = strings.ReplaceAll(content, oldString, newString)
+	}
+
+	// Writing in place keeps the file's mode
+	if err := os.WriteFile(path, []byte(updated), info.Mode().Perm()); err != nil {
+		return FileResult{Success: false, Error: err.Error()}, nil
+	}
+
 	return FileResult{
 		Success: true,
+		Content: fmt.Sprintf("Replaced %d occurrence(s) in %s", count, params.Path),
+		Diff:    UnifiedDiff(params.Path, content, updated),
 	}, nil
 }
 
-func (t *FileTool) listDir(path string) (FileResult, error) {
+// toCRLF converts the line endings of s to CRLF.
+func toCRLF(s string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(s, "\r\n", "\n"), "\n", "\r\n")
+}
+
+// listDir lists a directory. A non-empty pattern keeps only entries whose
+// names match it.
+func (t *FileTool) listDir(path, pattern string) (FileResult, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return FileResult{
+			Success: false,
+			Error:   fmt.Sprintf("invalid pattern: %v", err),
+		}, nil
+	}
+
 	entries, err := os.ReadDir(path)
 	if err != nil {
 		return FileResult{
@@ -203,6 +345,15 @@ func (t *FileTool) listDir(path string) (FileResult, error) {
 
 	files := make([]FileInfo, 0, len(entries))
 	for _, entry := range entries {
+		if pattern != "" {
+			if ok, _ := filepath.Match(pattern, entry.Name()); !ok {
+				continue
+			}
+		}
+		// Entries the policy denies are left out
+		if !t.policy.allowsWalked(t.workDir, filepath.Join(path, entry.Name()), entry) {
+			continue
+		}
 		info, err := entry.Info()
 		if err != nil {
 			continue
@@ -244,3 +395,8 @@ func (t *FileTool) fileExists(path string) (FileResult, error) {
 func (t *FileTool) SetWorkDir(dir string) {
 	t.workDir = dir
 }
+
+// SetPolicy implements Confinable.
+func (t *FileTool) SetPolicy(p *WorkspacePolicy) {
+	t.policy = p
+}
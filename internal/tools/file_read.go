@@ -0,0 +1,255 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/charmap"
+	"golang.org/x/text/encoding/simplifiedchinese"
+	"golang.org/x/text/encoding/unicode"
+	"golang.org/x/text/transform"
+)
+
+const (
+	defaultReadLines = 2_000    // Lines returned when the read has no limit
+	maxReadBytes     = 25_000   // Bytes of numbered output per read, so it fits the tool output limit
+	maxReadLineLen   = 2_000    // Longer lines are cut
+	maxCountBytes    = 64 << 20 // Bytes scanned past the returned lines to count the rest
+	sniffLen         = 8_000    // Bytes inspected to detect binary files and the encoding
+)
+
+// Text encodings reported by reads of files that are not plain UTF-8.
+const (
+	EncodingUTF8BOM = "utf-8-bom"
+	EncodingUTF16LE = "utf-16le"
+	EncodingUTF16BE = "utf-16be"
+	EncodingGBK     = "gbk"
+	EncodingLatin1  = "latin-1"
+)
+
+// readFile reads up to limit lines after skipping offset lines. Lines are
+// numbered like cat -n. The file is streamed, so only the returned lines are
+// held in memory; binary files are refused and other encodings are decoded
+// to UTF-8.
+func (t *FileTool) readFile(path string, offset, limit int) (FileResult, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return FileResult{Success: false, Error: err.Error()}, nil
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return FileResult{Success: false, Error: err.Error()}, nil
+	}
+	if info.IsDir() {
+		return FileResult{Success: false, Error: fmt.Sprintf("%s is a directory; use the list operation", path)}, nil
+	}
+
+	br := bufio.NewReaderSize(f, 64*1024)
+	sniff, _ := br.Peek(sniffLen)
+	enc, name, binary := detectEncoding(sniff, info.Size() > int64(len(sniff)))
+	if binary {
+		return FileResult{
+			Success: false,
+			Error: fmt.Sprintf("%s is a binary file (%s, %d bytes) and cannot be read as text",
+				path, http.DetectContentType(sniff), info.Size()),
+		}, nil
+	}
+	var r io.Reader = br
+	if enc != nil {
+		r = transform.NewReader(br, enc.NewDecoder())
+	}
+	if name == EncodingUTF8BOM {
+		_, _ = br.Discard(3)
+	}
+
+	if offset < 0 {
+		offset = 0
+	}
+	if limit <= 0 {
+		limit = defaultReadLines
+	}
+	lr := &lineReader{r: bufio.NewReaderSize(r, 64*1024)}
+	result := FileResult{Success: true, Encoding: name}
+
+	var out strings.Builder
+	line, shown, cut := 0, 0, 0
+	for ; ; line++ {
+		text, ok, err := lr.next(line >= offset)
+		if err != nil {
+			return FileResult{Success: false, Error: err.Error()}, nil
+		}
+		if !ok {
+			break
+		}
+		if line < offset {
+			continue
+		}
+		if shown == limit {
+			result.HasMore = true
+			break
+		}
+		if len(text) > maxReadLineLen {
+			text = headBytes(text, maxReadLineLen) + " ... (line truncated)"
+			cut++
+		}
+		numbered := fmt.Sprintf("%6d\t%s\n", line+1, text)
+		if shown > 0 && out.Len()+len(numbered) > maxReadBytes {
+			result.HasMore = true
+			break
+		}
+		out.WriteString(numbered)
+		shown++
+	}
+	result.Content = out.String()
+
+	// Count the remaining lines, unless that means scanning a huge file
+	if result.HasMore {
+		rest, complete := lr.count(maxCountBytes)
+		if complete {
+			result.TotalLines = line + 1 + rest
+		}
+	} else {
+		result.TotalLines = line
+	}
+	result.Note = readNote(offset, shown, cut, result)
+	return result, nil
+}
+
+// readNote describes the range a read returned and how to continue.
+func readNote(offset, shown, cut int, r FileResult) string {
+	var notes []string
+	switch {
+	case shown == 0 && offset > 0:
+		notes = append(notes, fmt.Sprintf("The file has %d lines; offset %d is past the end.", r.TotalLines, offset))
+	case r.HasMore && r.TotalLines > 0:
+		notes = append(notes, fmt.Sprintf("Showing lines %d-%d of %d. Use offset %d to read more.",
+			offset+1, offset+shown, r.TotalLines, offset+shown))
+	case r.HasMore:
+		notes = append(notes, fmt.Sprintf("Showing lines %d-%d; more lines follow. Use offset %d to read more.",
+			offset+1, offset+shown, offset+shown))
+	}
+	if cut > 0 {
+		notes = append(notes, fmt.Sprintf("%d line(s) longer than %d bytes were cut.", cut, maxReadLineLen))
+	}
+	if r.Encoding != "" && r.Encoding != EncodingUTF8BOM {
+		notes = append(notes, fmt.Sprintf("Decoded from %s.", r.Encoding))
+	}
+	return strings.Join(notes, " ")
+}
+
+// detectEncoding inspects the start of a file. It returns the decoder and
+// name of a non-UTF-8 encoding, just the name for UTF-8 with a byte order
+// mark, or binary for files that are not text. truncated reports that the
+// file continues past sniff.
+func detectEncoding(sniff []byte, truncated bool) (enc encoding.Encoding, name string, binary bool) {
+	switch {
+	case bytes.HasPrefix(sniff, []byte{0xEF, 0xBB, 0xBF}):
+		return nil, EncodingUTF8BOM, false
+	case bytes.HasPrefix(sniff, []byte{0xFF, 0xFE}):
+		return unicode.UTF16(unicode.LittleEndian, unicode.ExpectBOM), EncodingUTF16LE, false
+	case bytes.HasPrefix(sniff, []byte{0xFE, 0xFF}):
+		return unicode.UTF16(unicode.BigEndian, unicode.ExpectBOM), EncodingUTF16BE, false
+	case isBinary(sniff):
+		return nil, "", true
+	}
+
+	if truncated {
+		sniff = trimPartialRune(sniff)
+	}
+	if utf8.Valid(sniff) {
+		return nil, "", false
+	}
+	// GBK is tried first: Latin-1 decodes any byte sequence
+	if decoded, err := simplifiedchinese.GBK.NewDecoder().Bytes(sniff); err == nil {
+		if truncated {
+			decoded = bytes.TrimSuffix(decoded, []byte(string(utf8.RuneError)))
+		}
+		if !bytes.ContainsRune(decoded, utf8.RuneError) {
+			return simplifiedchinese.GBK, EncodingGBK, false
+		}
+	}
+	return charmap.ISO8859_1, EncodingLatin1, false
+}
+
+// trimPartialRune drops an incomplete UTF-8 sequence from the end of b.
+func trimPartialRune(b []byte) []byte {
+	for i := 1; i < utf8.UTFMax && i <= len(b); i++ {
+		if utf8.RuneStart(b[len(b)-i]) {
+			if !utf8.FullRune(b[len(b)-i:]) {
+				return b[:len(b)-i]
+			}
+			break
+		}
+	}
+	return b
+}
+
+// headBytes returns at most n bytes of s, cut at a rune boundary.
+func headBytes(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	for n > 0 && !utf8.RuneStart(s[n]) {
+		n--
+	}
+	return s[:n]
+}
+
+// lineReader reads lines of any length while holding at most
+// maxReadLineLen bytes of each.
+type lineReader struct {
+	r *bufio.Reader
+}
+
+// next returns the next line without its line ending. Unless keep is set,
+// the line is skipped and "" returned. ok is false at the end of the file.
+func (lr *lineReader) next(keep bool) (line string, ok bool, err error) {
+	var b []byte
+	for {
+		chunk, more, err := lr.r.ReadLine()
+		if err == io.EOF {
+			return string(b), ok, nil
+		}
+		if err != nil {
+			return "", false, err
+		}
+		ok = true
+		// Past the cut, the rest of the line is read and dropped
+		if keep && len(b) <= maxReadLineLen {
+			b = append(b, chunk...)
+		}
+		if !more {
+			return string(b), true, nil
+		}
+	}
+}
+
+// count counts the lines left, scanning at most max bytes. complete is
+// false when the limit was reached first.
+func (lr *lineReader) count(max int) (lines int, complete bool) {
+	buf := make([]byte, 32*1024)
+	scanned, last := 0, byte('\n')
+	for scanned < max {
+		n, err := lr.r.Read(buf)
+		lines += bytes.Count(buf[:n], []byte{'\n'})
+		if n > 0 {
+			last = buf[n-1]
+		}
+		scanned += n
+		if err != nil {
+			if last != '\n' {
+				lines++ // A last line without a newline
+			}
+			return lines, err == io.EOF
+		}
+	}
+	return 0, false
+}
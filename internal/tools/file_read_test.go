@@ -0,0 +1,93 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// readTestFile writes data to a file and reads it with the file tool.
+func readTestFile(t *testing.T, data []byte, args string) FileResult {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "f"), data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	result, err := NewFileTool(dir).Execute(context.Background(),
+		json.RawMessage(`{"operation": "read", "path": "f"`+args+`}`))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	return result.(FileResult)
+}
+
+func TestFileTool_ReadFile_LineNumbers(t *testing.T) {
+	r := readTestFile(t, []byte("a\r\nb\nc\nd"), `, "offset": 1, "limit": 2`)
+	if r.Content != "     2\tb\n     3\tc\n" {
+		t.Errorf("unexpected content %q", r.Content)
+	}
+	if !r.HasMore || r.TotalLines != 4 {
+		t.Errorf("expected more lines of 4, got has_more=%v total=%d", r.HasMore, r.TotalLines)
+	}
+	if !strings.Contains(r.ModelText(), "Showing lines 2-3 of 4. Use offset 3 to read more.") {
+		t.Errorf("model text should say how to continue: %q", r.ModelText())
+	}
+
+	r = readTestFile(t, []byte("a\nb\n"), "")
+	if r.Content != "     1\ta\n     2\tb\n" || r.HasMore || r.TotalLines != 2 || r.Note != "" {
+		t.Errorf("whole file read: %+v", r)
+	}
+}
+
+func TestFileTool_ReadFile_Limits(t *testing.T) {
+	var b strings.Builder
+	for i := 0; i < 5000; i++ {
+		b.WriteString("some text on a line of a large file\n")
+	}
+	r := readTestFile(t, []byte(b.String()), "")
+	if len(r.Content) > maxReadBytes || !r.HasMore || r.TotalLines != 5000 {
+		t.Errorf("read should stop at %d bytes and count all lines: %d bytes, has_more=%v, total=%d",
+			maxReadBytes, len(r.Content), r.HasMore, r.TotalLines)
+	}
+
+	r = readTestFile(t, []byte(strings.Repeat("x", 3*maxReadLineLen)+"\nnext\n"), "")
+	lines := strings.Split(r.Content, "\n")
+	if len(lines[0]) > maxReadLineLen+50 || !strings.HasSuffix(lines[0], "(line truncated)") || lines[1] != "     2\tnext" {
+		t.Errorf("long line should be cut: %q", r.Content[:100])
+	}
+	if !strings.Contains(r.Note, "1 line(s) longer than") {
+		t.Errorf("note should report the cut line: %q", r.Note)
+	}
+}
+
+func TestFileTool_ReadFile_Binary(t *testing.T) {
+	r := readTestFile(t, []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR"), "")
+	if r.Success || !strings.Contains(r.Error, "binary file (image/png") {
+		t.Errorf("binary file should be refused: %+v", r)
+	}
+}
+
+func TestFileTool_ReadFile_Encodings(t *testing.T) {
+	tests := []struct {
+		name     string
+		data     []byte
+		content  string
+		encoding string
+	}{
+		{"utf-8", []byte("héllo\n"), "héllo", ""},
+		{"utf-8 bom", []byte("\xEF\xBB\xBFhello\n"), "hello", EncodingUTF8BOM},
+		{"utf-16le", []byte("\xFF\xFEh\x00i\x00\n\x00"), "hi", EncodingUTF16LE},
+		{"utf-16be", []byte("\xFE\xFF\x00h\x00i\x00\n"), "hi", EncodingUTF16BE},
+		{"gbk", []byte("\xC4\xE3\xBA\xC3\n"), "你好", EncodingGBK},
+		{"latin-1", []byte("caf\xE9\n"), "café", EncodingLatin1},
+	}
+	for _, tt := range tests {
+		r := readTestFile(t, tt.data, "")
+		if r.Content != "     1\t"+tt.content+"\n" || r.Encoding != tt.encoding {
+			t.Errorf("%s: got %q (%s), want %q (%s)", tt.name, r.Content, r.Encoding, tt.content, tt.encoding)
+		}
+	}
+}
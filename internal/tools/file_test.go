@@ -80,9 +80,9 @@ func TestFileTool_ReadFile_WithOffset(t *testing.T) {
 	if !r.Success {
 		t.Fatalf("read failed: %s", r.Error)
 	}
-	// offset=2 means skip first 2 lines, should start from "c"
-	if !strings.HasPrefix(r.Content, "c") {
-		t.Errorf("expected content to start with 'c', got %q", r.Content)
+	// offset=2 means skip first 2 lines, should start from line 3, "c"
+	if !strings.HasPrefix(r.Content, "     3\tc\n") {
+		t.Errorf("expected content to start with line 3, got %q", r.Content)
 	}
 }
 
@@ -223,6 +223,23 @@ func TestFileTool_ListDir_Success(t *testing.T) {
 	}
 }
 
+func TestFileTool_ListDir_Pattern(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.go"), []byte("a"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("b"), 0644)
+
+	ft := NewFileTool(dir)
+	result, _ := ft.Execute(context.Background(), json.RawMessage(`{
+		"operation": "list",
+		"path": ".",
+		"pattern": "*.go"
+	}`))
+	r := result.(FileResult)
+	if !r.Success || len(r.Files) != 1 || r.Files[0].Name != "a.go" {
+		t.Errorf("expected only a.go, got %+v", r)
+	}
+}
+
 func TestFileTool_ListDir_Empty(t *testing.T) {
 	dir := t.TempDir()
 	ft := NewFileTool(dir)
@@ -423,3 +440,152 @@ func TestFileTool_WriteFile_EmptyContent(t *testing.T) {
 		t.Errorf("expected empty file, got %d bytes", len(data))
 	}
 }
+
+func TestFileTool_EditFile_Success(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "main.go"), []byte("package main\n\nfunc main() {\n\tprintln(\"hi\")\n}\n"), 0644)
+
+	ft := NewFileTool(dir)
+	result, _ := ft.Execute(context.Background(), json.RawMessage(`{
+		"operation": "edit",
+		"path": "main.go",
+		"old_string": "println(\"hi\")",
+		"new_string": "println(\"hello\")"
+	}`))
+	r := result.(FileResult)
+	if !r.Success {
+		t.Fatalf("edit failed: %s", r.Error)
+	}
+
+	data, _ := os.ReadFile(filepath.Join(dir, "main.go"))
+	if !strings.Contains(string(data), `println("hello")`) {
+		t.Errorf("file not edited: %q", data)
+	}
+	if !strings.Contains(r.Diff, "-\tprintln(\"hi\")\n+\tprintln(\"hello\")\n") {
+		t.Errorf("unexpected diff:\n%s", r.Diff)
+	}
+}
+
+func TestFileTool_EditFile_NotFound(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello\n"), 0644)
+
+	ft := NewFileTool(dir)
+	result, _ := ft.Execute(context.Background(), json.RawMessage(`{
+		"operation": "edit",
+		"path": "a.txt",
+		"old_string": "goodbye",
+		"new_string": "hi"
+	}`))
+	r := result.(FileResult)
+	if r.Success || !strings.Contains(r.Error, "not found") {
+		t.Errorf("expected not found error, got %+v", r)
+	}
+}
+
+func TestFileTool_EditFile_Ambiguous(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	os.WriteFile(path, []byte("x = 1\ny = 1\n"), 0644)
+
+	ft := NewFileTool(dir)
+	result, _ := ft.Execute(context.Background(), json.RawMessage(`{
+		"operation": "edit",
+		"path": "a.txt",
+		"old_string": "= 1",
+		"new_string": "= 2"
+	}`))
+	r := result.(FileResult)
+	if r.Success || !strings.Contains(r.Error, "2 times") {
+		t.Errorf("expected ambiguous match error, got %+v", r)
+	}
+
+	result, _ = ft.Execute(context.Background(), json.RawMessage(`{
+		"operation": "edit",
+		"path": "a.txt",
+		"old_string": "= 1",
+		"new_string": "= 2",
+		"replace_all": true
+	}`))
+	r = result.(FileResult)
+	if !r.Success {
+		t.Fatalf("replace_all failed: %s", r.Error)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "x = 2\ny = 2\n" {
+		t.Errorf("unexpected content: %q", data)
+	}
+}
+
+func TestFileTool_EditFile_KeepsLineEndingsAndMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.sh")
+	os.WriteFile(path, []byte("echo one\r\necho two\r\n"), 0755)
+
+	ft := NewFileTool(dir)
+	result, _ := ft.Execute(context.Background(), json.RawMessage(`{
+		"operation": "edit",
+		"path": "run.sh",
+		"old_string": "echo one\necho two",
+		"new_string": "echo 1\necho 2"
+	}`))
+	r := result.(FileResult)
+	if !r.Success {
+		t.Fatalf("edit failed: %s", r.Error)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "echo 1\r\necho 2\r\n" {
+		t.Errorf("line endings not kept: %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0755 {
+		t.Errorf("mode not kept: %v", info.Mode().Perm())
+	}
+}
+
+func TestFileTool_EditFile_MixedLineEndings(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "notes.txt")
+	os.WriteFile(path, []byte("dos one\r\ndos two\r\nunix one\nunix two\n"), 0644)
+
+	ft := NewFileTool(dir)
+	for _, edit := range []struct{ old, new string }{
+		{"unix one\nunix two", "unix 1\nunix 2"},
+		{"dos one\ndos two", "dos 1\ndos 2"},
+	} {
+		args, _ := json.Marshal(map[string]string{
+			"operation": "edit", "path": "notes.txt", "old_string": edit.old, "new_string": edit.new,
+		})
+		result, _ := ft.Execute(context.Background(), args)
+		if r := result.(FileResult); !r.Success {
+			t.Fatalf("edit of %q failed: %s", edit.old, r.Error)
+		}
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "dos 1\r\ndos 2\r\nunix 1\nunix 2\n" {
+		t.Errorf("each region should keep its line endings: %q", data)
+	}
+}
+
+func TestFileTool_EditFile_InvalidParams(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("hello\n"), 0644)
+	ft := NewFileTool(dir)
+
+	for _, args := range []string{
+		`{"operation": "edit", "path": "a.txt", "old_string": "", "new_string": "x"}`,
+		`{"operation": "edit", "path": "a.txt", "old_string": "hello", "new_string": "hello"}`,
+		`{"operation": "edit", "path": "missing.txt", "old_string": "a", "new_string": "b"}`,
+	} {
+		result, _ := ft.Execute(context.Background(), json.RawMessage(args))
+		if r := result.(FileResult); r.Success || r.Error == "" {
+			t.Errorf("expected failure for %s, got %+v", args, r)
+		}
+	}
+}
+
+func TestFileTool_ApprovalAction_Edit(t *testing.T) {
+	ft := NewFileTool(t.TempDir())
+	action, desc, needed := ft.ApprovalAction(json.RawMessage(`{"operation": "edit", "path": "a.txt"}`))
+	if !needed || action != "edit file" || !strings.Contains(desc, "a.txt") {
+		t.Errorf("unexpected approval action: %q %q %v", action, desc, needed)
+	}
+}
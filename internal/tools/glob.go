@@ -0,0 +1,160 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+)
+
+// GlobToolName is the name of the glob tool.
+const GlobToolName = "glob"
+
+// maxGlobResults caps the number of paths returned by the glob tool.
+const maxGlobResults = 500
+
+// GlobTool finds files by name pattern.
+type GlobTool struct {
+	workDir string
+	policy  *WorkspacePolicy
+}
+
+// GlobParams represents parameters for the glob tool.
+type GlobParams struct {
+	Pattern     string `json:"pattern"`
+	Path        string `json:"path,omitempty"`
+	IncludeDirs bool   `json:"include_dirs,omitempty"`
+}
+
+// GlobResult represents the result of a glob search.
+type GlobResult struct {
+	Success   bool             `json:"success"`
+	Files     []string         `json:"files,omitempty"`
+	Truncated bool             `json:"truncated,omitempty"`
+	Note      string           `json:"note,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Denied    *PathDeniedError `json:"denied,omitempty"`
+}
+
+// ModelText implements ModelTexter.
+func (r GlobResult) ModelText() string {
+	if !r.Success {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(strings.Join(r.Files, "\n"))
+	if len(r.Files) == 0 {
+		b.WriteString("No files found.")
+	}
+	if r.Note != "" {
+		appendLine(&b, r.Note)
+	}
+	return b.String()
+}
+
+// NewGlobTool creates a new glob tool.
+func NewGlobTool(workDir string) *GlobTool {
+	return &GlobTool{workDir: workDir}
+}
+
+// SetPolicy implements Confinable.
+func (t *GlobTool) SetPolicy(p *WorkspacePolicy) {
+	t.policy = p
+}
+
+// Name returns the tool name.
+func (t *GlobTool) Name() string {
+	return GlobToolName
+}
+
+// Description returns the tool description.
+func (t *GlobTool) Description() string {
+	return "Find files by glob pattern, e.g. `**/*.go` or `src/**/test_*.py`. " +
+		"`**` matches any number of directories; a pattern without `/` matches file names at any depth. " +
+		"Files ignored by .gitignore are skipped. " +
+		fmt.Sprintf("At most %d paths are returned, relative to the working directory.", maxGlobResults)
+}
+
+// Parameters returns the JSON schema for tool parameters.
+func (t *GlobTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"pattern": {
+				"type": "string",
+				"description": "The glob pattern, relative to path"
+			},
+			"path": {
+				"type": "string",
+				"description": "Directory to search in (default: the working directory)"
+			},
+			"include_dirs": {
+				"type": "boolean",
+				"description": "Also return matching directories"
+			}
+		},
+		"required": ["pattern"]
+	}`)
+}
+
+// ApprovalAction implements Approvable. Searching is read-only.
+func (t *GlobTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	return "", "", false
+}
+
+// Execute runs the glob search.
+func (t *GlobTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var params GlobParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if params.Pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+
+	root, err := t.policy.Resolve(t.workDir, params.Path, AccessRead)
+	if err != nil {
+		return GlobResult{Success: false, Error: err.Error(), Denied: asDenied(err)}, nil
+	}
+	if info, err := os.Stat(root); err != nil {
+		return GlobResult{Success: false, Error: err.Error()}, nil
+	} else if !info.IsDir() {
+		return GlobResult{Success: false, Error: fmt.Sprintf("%s is not a directory", params.Path)}, nil
+	}
+
+	pattern := strings.TrimPrefix(params.Pattern, "./")
+	result := GlobResult{Success: true, Files: []string{}}
+	err = walkFiles(ctx, root, func(rel string, d fs.DirEntry) error {
+		if !t.policy.allowsWalked(t.workDir, joinRoot(root, rel), d) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.IsDir() && !params.IncludeDirs {
+			return nil
+		}
+		if !matchFileGlob(pattern, rel) {
+			return nil
+		}
+		if len(result.Files) == maxGlobResults {
+			result.Truncated = true
+			return errStopWalk
+		}
+		result.Files = append(result.Files, displayPath(t.workDir, joinRoot(root, rel)))
+		return nil
+	})
+
+	switch {
+	case err == errWalkLimit:
+		result.Truncated = true
+		result.Note = fmt.Sprintf("Search stopped after %d entries; use a narrower path.", maxWalkEntries)
+	case err != nil:
+		return GlobResult{Success: false, Error: err.Error()}, nil
+	case result.Truncated:
+		result.Note = fmt.Sprintf("Results truncated to the first %d matches; use a more specific pattern or path.", maxGlobResults)
+	}
+	return result, nil
+}
@@ -0,0 +1,317 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"os"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// GrepToolName is the name of the grep tool.
+const GrepToolName = "grep"
+
+const (
+	maxGrepOutputLines = 300              // Output lines returned by the grep tool
+	maxGrepLineLen     = 500              // Longer lines are cut
+	maxGrepFileSize    = 10 * 1024 * 1024 // Larger files are skipped
+)
+
+// Grep output modes.
+const (
+	GrepModeContent = "content"
+	GrepModeFiles   = "files_with_matches"
+	GrepModeCount   = "count"
+)
+
+// GrepTool searches file contents with a regular expression.
+type GrepTool struct {
+	workDir string
+	policy  *WorkspacePolicy
+}
+
+// GrepParams represents parameters for the grep tool.
+type GrepParams struct {
+	Pattern    string `json:"pattern"`
+	Path       string `json:"path,omitempty"`
+	Include    string `json:"include,omitempty"`
+	Exclude    string `json:"exclude,omitempty"`
+	IgnoreCase bool   `json:"ignore_case,omitempty"`
+	Context    int    `json:"context,omitempty"`
+	OutputMode string `json:"output_mode,omitempty"`
+}
+
+// GrepResult represents the result of a grep search.
+type GrepResult struct {
+	Success   bool             `json:"success"`
+	Content   string           `json:"content"`
+	Matches   int              `json:"matches"` // Matching lines found
+	Files     int              `json:"files"`   // Files with at least one match
+	Truncated bool             `json:"truncated,omitempty"`
+	Note      string           `json:"note,omitempty"`
+	Error     string           `json:"error,omitempty"`
+	Denied    *PathDeniedError `json:"denied,omitempty"`
+}
+
+// ModelText implements ModelTexter.
+func (r GrepResult) ModelText() string {
+	if !r.Success {
+		return ""
+	}
+	var b strings.Builder
+	b.WriteString(r.Content)
+	appendLine(&b, fmt.Sprintf("(%d matches in %d files)", r.Matches, r.Files))
+	if r.Note != "" {
+		appendLine(&b, r.Note)
+	}
+	return b.String()
+}
+
+// NewGrepTool creates a new grep tool.
+func NewGrepTool(workDir string) *GrepTool {
+	return &GrepTool{workDir: workDir}
+}
+
+// SetPolicy implements Confinable.
+func (t *GrepTool) SetPolicy(p *WorkspacePolicy) {
+	t.policy = p
+}
+
+// Name returns the tool name.
+func (t *GrepTool) Name() string {
+	return GrepToolName
+}
+
+// Description returns the tool description.
+func (t *GrepTool) Description() string {
+	return "Search file contents with a regular expression (Go RE2 syntax). " +
+		"Filter files with include/exclude globs such as `*.go` or `src/**/*.ts`. " +
+		"Output modes: content (matching lines as path:line:text, with optional context lines), " +
+		"files_with_matches (paths only) and count (matches per file). " +
+		"Files ignored by .gitignore and binary files are skipped. " +
+		fmt.Sprintf("Output is capped at %d lines.", maxGrepOutputLines)
+}
+
+// Parameters returns the JSON schema for tool parameters.
+func (t *GrepTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"pattern": {
+				"type": "string",
+				"description": "The regular expression to search for"
+			},
+			"path": {
+				"type": "string",
+				"description": "File or directory to search (default: the working directory)"
+			},
+			"include": {
+				"type": "string",
+				"description": "Only search files matching this glob"
+			},
+			"exclude": {
+				"type": "string",
+				"description": "Skip files matching this glob"
+			},
+			"ignore_case": {
+				"type": "boolean",
+				"description": "Case-insensitive search"
+			},
+			"context": {
+				"type": "integer",
+				"description": "Lines of context to show before and after each match (content mode)"
+			},
+			"output_mode": {
+				"type": "string",
+				"enum": ["content", "files_with_matches", "count"],
+				"description": "What to return (default: content)"
+			}
+		},
+		"required": ["pattern"]
+	}`)
+}
+
+// ApprovalAction implements Approvable. Searching is read-only.
+func (t *GrepTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	return "", "", false
+}
+
+// Execute runs the search.
+func (t *GrepTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var params GrepParams
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if params.Pattern == "" {
+		return nil, fmt.Errorf("pattern is required")
+	}
+	switch params.OutputMode {
+	case "":
+		params.OutputMode = GrepModeContent
+	case GrepModeContent, GrepModeFiles, GrepModeCount:
+	default:
+		return nil, fmt.Errorf("unknown output_mode: %s", params.OutputMode)
+	}
+	if params.Context < 0 {
+		params.Context = 0
+	}
+
+	expr := params.Pattern
+	if params.IgnoreCase {
+		expr = "(?i)" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid pattern: %w", err)
+	}
+
+	root, err := t.policy.Resolve(t.workDir, params.Path, AccessRead)
+	if err != nil {
+		return GrepResult{Success: false, Error: err.Error(), Denied: asDenied(err)}, nil
+	}
+	info, err := os.Stat(root)
+	if err != nil {
+		return GrepResult{Success: false, Error: err.Error()}, nil
+	}
+
+	s := &grepSearch{params: params, re: re, result: GrepResult{Success: true}}
+	if !info.IsDir() {
+		s.searchFile(root, displayPath(t.workDir, root))
+	} else {
+		err = walkFiles(ctx, root, func(rel string, d fs.DirEntry) error {
+			path := joinRoot(root, rel)
+			if !t.policy.allowsWalked(t.workDir, path, d) {
+				if d.IsDir() {
+					return fs.SkipDir
+				}
+				return nil
+			}
+			if d.IsDir() || !d.Type().IsRegular() {
+				return nil
+			}
+			if params.Include != "" && !matchFileGlob(params.Include, rel) {
+				return nil
+			}
+			if params.Exclude != "" && matchFileGlob(params.Exclude, rel) {
+				return nil
+			}
+			if !s.searchFile(path, displayPath(t.workDir, path)) {
+				return errStopWalk
+			}
+			return nil
+		})
+	}
+
+	result := s.result
+	result.Content = strings.Join(s.out, "\n")
+	switch {
+	case err == errWalkLimit:
+		result.Truncated = true
+		result.Note = fmt.Sprintf("Search stopped after %d entries; use a narrower path or include glob.", maxWalkEntries)
+	case err != nil:
+		return GrepResult{Success: false, Error: err.Error()}, nil
+	case result.Truncated:
+		result.Content += "\n... (truncated)"
+		result.Note = fmt.Sprintf("Output truncated after %d lines; counts cover only the files searched so far. "+
+			"Use a more specific pattern, path or include glob.", maxGrepOutputLines)
+	case result.Matches == 0:
+		result.Note = "No matches found."
+	}
+	return result, nil
+}
+
+// grepSearch accumulates the output of a search.
+type grepSearch struct {
+	params GrepParams
+	re     *regexp.Regexp
+	result GrepResult
+	out    []string
+}
+
+// emit adds an output line and reports false once the output is full.
+func (s *grepSearch) emit(line string) bool {
+	if len(s.out) == maxGrepOutputLines {
+		s.result.Truncated = true
+		return false
+	}
+	s.out = append(s.out, line)
+	return true
+}
+
+// searchFile searches one file and reports false when the output is full.
+// Unreadable, large and binary files are skipped.
+func (s *grepSearch) searchFile(path, display string) bool {
+	if info, err := os.Stat(path); err != nil || info.Size() > maxGrepFileSize {
+		return true
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || isBinary(data) {
+		return true
+	}
+
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	var matched []int
+	for i, line := range lines {
+		if s.re.MatchString(line) {
+			matched = append(matched, i)
+		}
+	}
+	if len(matched) == 0 {
+		return true
+	}
+	s.result.Files++
+	s.result.Matches += len(matched)
+
+	switch s.params.OutputMode {
+	case GrepModeFiles:
+		return s.emit(display)
+	case GrepModeCount:
+		return s.emit(fmt.Sprintf("%s:%d", display, len(matched)))
+	}
+
+	// Content mode: merge overlapping context windows; "--" separates groups
+	isMatch := make(map[int]bool, len(matched))
+	for _, i := range matched {
+		isMatch[i] = true
+	}
+	ctxLines := s.params.Context
+	for g := 0; g < len(matched); {
+		// Extend the window while the next match's context touches it
+		start := max(matched[g]-ctxLines, 0)
+		end := min(matched[g]+ctxLines, len(lines)-1)
+		for g++; g < len(matched) && matched[g]-ctxLines <= end+1; g++ {
+			end = min(max(end, matched[g]+ctxLines), len(lines)-1)
+		}
+		if ctxLines > 0 && len(s.out) > 0 {
+			if !s.emit("--") {
+				return false
+			}
+		}
+		for i := start; i <= end; i++ {
+			sep := "-"
+			if isMatch[i] {
+				sep = ":"
+			}
+			if !s.emit(fmt.Sprintf("%s%s%d%s%s", display, sep, i+1, sep, clipLine(lines[i]))) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// clipLine removes a trailing CR and shortens very long lines.
+func clipLine(line string) string {
+	line = strings.TrimSuffix(line, "\r")
+	if len(line) <= maxGrepLineLen {
+		return line
+	}
+	cut := maxGrepLineLen
+	for cut > 0 && !utf8.RuneStart(line[cut]) {
+		cut--
+	}
+	return line[:cut] + "..."
+}
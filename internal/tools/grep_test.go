@@ -0,0 +1,139 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+// grepTree runs the grep tool with args on a directory created from files.
+func grepTree(t *testing.T, files map[string]string, args string) GrepResult {
+	t.Helper()
+	dir := t.TempDir()
+	writeTree(t, dir, files)
+	result, err := NewGrepTool(dir).Execute(context.Background(), json.RawMessage(args))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return result.(GrepResult)
+}
+
+func TestGrepTool_Content(t *testing.T) {
+	r := grepTree(t, map[string]string{
+		"a.go":       "package a\n\nfunc Hello() {}\n",
+		"b/b.go":     "package b\n\nfunc hello() {}\n",
+		"c.txt":      "Hello text\n",
+		"bin.dat":    "Hello\x00binary",
+		".gitignore": "ignored/\n",
+		"ignored/x":  "Hello\n",
+	}, `{"pattern": "func [Hh]ello"}`)
+
+	want := "a.go:3:func Hello() {}\nb/b.go:3:func hello() {}"
+	if !r.Success || r.Content != want || r.Matches != 2 || r.Files != 2 {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
+
+func TestGrepTool_IncludeExcludeIgnoreCase(t *testing.T) {
+	files := map[string]string{
+		"a.go":      "TODO one\n",
+		"a_test.go": "todo two\n",
+		"notes.md":  "TODO three\n",
+	}
+	r := grepTree(t, files, `{"pattern": "todo", "ignore_case": true, "include": "*.go", "exclude": "*_test.go"}`)
+	if r.Content != "a.go:1:TODO one" {
+		t.Errorf("unexpected content: %q", r.Content)
+	}
+}
+
+func TestGrepTool_ContextLines(t *testing.T) {
+	r := grepTree(t, map[string]string{
+		"f.txt": "1\n2\nmatch\n4\n5\n6\n7\nmatch\n9\n",
+	}, `{"pattern": "match", "context": 1}`)
+
+	want := strings.Join([]string{
+		"f.txt-2-2",
+		"f.txt:3:match",
+		"f.txt-4-4",
+		"--",
+		"f.txt-7-7",
+		"f.txt:8:match",
+		"f.txt-9-9",
+	}, "\n")
+	if r.Content != want {
+		t.Errorf("got:\n%s\nwant:\n%s", r.Content, want)
+	}
+}
+
+func TestGrepTool_AdjacentMatches(t *testing.T) {
+	r := grepTree(t, map[string]string{
+		"f.txt": "1\n2\n3\n4\nmatch\nmatch\n7\n8\n9\n",
+	}, `{"pattern": "match", "context": 2}`)
+
+	// The second match extends the window of the first
+	want := strings.Join([]string{
+		"f.txt-3-3",
+		"f.txt-4-4",
+		"f.txt:5:match",
+		"f.txt:6:match",
+		"f.txt-7-7",
+		"f.txt-8-8",
+	}, "\n")
+	if r.Content != want || r.Matches != 2 {
+		t.Errorf("got:\n%s\nwant:\n%s", r.Content, want)
+	}
+}
+
+func TestGrepTool_FilesAndCountModes(t *testing.T) {
+	files := map[string]string{
+		"a.txt": "x\nx\n",
+		"b.txt": "x\n",
+		"c.txt": "y\n",
+	}
+	r := grepTree(t, files, `{"pattern": "x", "output_mode": "files_with_matches"}`)
+	if r.Content != "a.txt\nb.txt" {
+		t.Errorf("unexpected files output: %q", r.Content)
+	}
+	r = grepTree(t, files, `{"pattern": "x", "output_mode": "count"}`)
+	if r.Content != "a.txt:2\nb.txt:1" || r.Matches != 3 {
+		t.Errorf("unexpected count output: %+v", r)
+	}
+}
+
+func TestGrepTool_Truncated(t *testing.T) {
+	r := grepTree(t, map[string]string{
+		"big.txt": strings.Repeat("match\n", maxGrepOutputLines+10),
+	}, `{"pattern": "match"}`)
+
+	lines := strings.Split(r.Content, "\n")
+	if !r.Truncated || len(lines) != maxGrepOutputLines+1 || lines[len(lines)-1] != "... (truncated)" {
+		t.Errorf("expected truncated output, got %d lines, truncated=%v", len(lines), r.Truncated)
+	}
+}
+
+func TestGrepTool_SingleFileAndLongLines(t *testing.T) {
+	r := grepTree(t, map[string]string{
+		"long.txt": "start " + strings.Repeat("é", maxGrepLineLen) + "\n",
+	}, `{"pattern": "start", "path": "long.txt"}`)
+
+	if !strings.HasPrefix(r.Content, "long.txt:1:start ") || !strings.HasSuffix(r.Content, "...") {
+		t.Errorf("unexpected content: %q", r.Content)
+	}
+	if len(r.Content) > maxGrepLineLen+50 {
+		t.Errorf("long line should be cut, got %d bytes", len(r.Content))
+	}
+}
+
+func TestGrepTool_InvalidParams(t *testing.T) {
+	gt := NewGrepTool(t.TempDir())
+	for _, args := range []string{
+		`{}`,
+		`{"pattern": "("}`,
+		`{"pattern": "x", "output_mode": "lines"}`,
+	} {
+		if _, err := gt.Execute(context.Background(), json.RawMessage(args)); err == nil {
+			t.Errorf("expected error for %s", args)
+		}
+	}
+}
@@ -0,0 +1,253 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // Register the GIF decoder for image.DecodeConfig
+	_ "image/jpeg" // Register the JPEG decoder
+	_ "image/png"  // Register the PNG decoder
+	"net/http"
+	"os"
+	"path/filepath"
+)
+
+// ImageToolName is the name of the image tool.
+const ImageToolName = "read_image"
+
+// Limits on images sent to the model.
+const (
+	MaxImageBytes     = 5 << 20 // Larger files are refused
+	MaxImageDimension = 8000    // Pixels per side
+)
+
+// imageTypes are the image formats models accept.
+var imageTypes = map[string]bool{
+	"image/png":  true,
+	"image/jpeg": true,
+	"image/gif":  true,
+	"image/webp": true,
+}
+
+// Image is an image file read for the model.
+type Image struct {
+	Name     string // Base name of the file
+	MimeType string
+	Data     []byte
+	Width    int
+	Height   int
+}
+
+// Describe returns a short description such as "logo.png (image/png, 64x64, 2 KB)".
+func (img Image) Describe() string {
+	return fmt.Sprintf("%s (%s, %dx%d, %s)", img.Name, img.MimeType, img.Width, img.Height, formatSize(len(img.Data)))
+}
+
+// ImageCarrier is implemented by tool results that carry images for the
+// model. The images follow the tool results in a user message, since tool
+// messages can only hold text.
+type ImageCarrier interface {
+	Images() []Image
+}
+
+// LoadImage reads a PNG, JPEG, GIF or WebP file and checks it against the
+// size and resolution limits.
+func LoadImage(path string) (Image, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return Image{}, err
+	}
+	if info.IsDir() {
+		return Image{}, fmt.Errorf("%s is a directory", path)
+	}
+	if info.Size() > MaxImageBytes {
+		return Image{}, fmt.Errorf("%s is %s; images larger than %s are not supported",
+			path, formatSize(int(info.Size())), formatSize(MaxImageBytes))
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return Image{}, err
+	}
+	img, err := NewImage(filepath.Base(path), data)
+	if err != nil {
+		return Image{}, fmt.Errorf("%s %w", path, err)
+	}
+	return img, nil
+}
+
+// NewImage checks image data from any source, such as an MCP tool result,
+// against the format and resolution limits. Errors read after the image's
+// name.
+func NewImage(name string, data []byte) (Image, error) {
+	if len(data) > MaxImageBytes {
+		return Image{}, fmt.Errorf("is %s; images larger than %s are not supported",
+			formatSize(len(data)), formatSize(MaxImageBytes))
+	}
+	img := Image{Name: name, MimeType: http.DetectContentType(data), Data: data}
+	if !imageTypes[img.MimeType] {
+		return Image{}, fmt.Errorf("is %s, not a PNG, JPEG, GIF or WebP image", img.MimeType)
+	}
+	var err error
+	if img.MimeType == "image/webp" {
+		img.Width, img.Height, err = webpSize(data)
+	} else {
+		var cfg image.Config
+		cfg, _, err = image.DecodeConfig(bytes.NewReader(data))
+		img.Width, img.Height = cfg.Width, cfg.Height
+	}
+	if err != nil {
+		return Image{}, fmt.Errorf("is not a valid image: %w", err)
+	}
+	if img.Width > MaxImageDimension || img.Height > MaxImageDimension {
+		return Image{}, fmt.Errorf("is %dx%d pixels; images larger than %dx%d are not supported",
+			img.Width, img.Height, MaxImageDimension, MaxImageDimension)
+	}
+	return img, nil
+}
+
+// webpSize reads the dimensions from the header of a WebP image.
+func webpSize(data []byte) (width, height int, err error) {
+	if len(data) < 30 {
+		return 0, 0, errors.New("truncated WebP header")
+	}
+	switch string(data[12:16]) {
+	case "VP8 ": // Lossy: 14-bit sizes after the frame tag and start code
+		if !bytes.Equal(data[23:26], []byte{0x9d, 0x01, 0x2a}) {
+			return 0, 0, errors.New("bad VP8 start code")
+		}
+		return int(binary.LittleEndian.Uint16(data[26:]) & 0x3fff), int(binary.LittleEndian.Uint16(data[28:]) & 0x3fff), nil
+	case "VP8L": // Lossless: 14-bit sizes minus one after the signature
+		if data[20] != 0x2f {
+			return 0, 0, errors.New("bad VP8L signature")
+		}
+		bits := binary.LittleEndian.Uint32(data[21:])
+		return int(bits&0x3fff) + 1, int(bits>>14&0x3fff) + 1, nil
+	case "VP8X": // Extended: 24-bit canvas sizes minus one
+		w := uint32(data[24]) | uint32(data[25])<<8 | uint32(data[26])<<16
+		h := uint32(data[27]) | uint32(data[28])<<8 | uint32(data[29])<<16
+		return int(w) + 1, int(h) + 1, nil
+	}
+	return 0, 0, fmt.Errorf("unknown WebP chunk %q", data[12:16])
+}
+
+// formatSize formats a byte count for people.
+func formatSize(n int) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// ImageTool reads image files so multimodal models can see them.
+type ImageTool struct {
+	workDir string
+	policy  *WorkspacePolicy
+}
+
+// ImageResult represents the result of reading an image.
+type ImageResult struct {
+	Success  bool             `json:"success"`
+	Path     string           `json:"path,omitempty"`
+	MimeType string           `json:"mime_type,omitempty"`
+	Width    int              `json:"width,omitempty"`
+	Height   int              `json:"height,omitempty"`
+	Size     int              `json:"size,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Denied   *PathDeniedError `json:"denied,omitempty"`
+	image    Image
+}
+
+// ModelText implements ModelTexter.
+func (r ImageResult) ModelText() string {
+	if !r.Success {
+		return ""
+	}
+	return fmt.Sprintf("Read %s. The image follows in the next message.", r.image.Describe())
+}
+
+// Images implements ImageCarrier.
+func (r ImageResult) Images() []Image {
+	if !r.Success {
+		return nil
+	}
+	return []Image{r.image}
+}
+
+// NewImageTool creates a new image tool.
+func NewImageTool(workDir string) *ImageTool {
+	return &ImageTool{workDir: workDir}
+}
+
+// SetPolicy implements Confinable.
+func (t *ImageTool) SetPolicy(p *WorkspacePolicy) {
+	t.policy = p
+}
+
+// Name returns the tool name.
+func (t *ImageTool) Name() string {
+	return ImageToolName
+}
+
+// Description returns the tool description.
+func (t *ImageTool) Description() string {
+	return "Read a PNG, JPEG, GIF or WebP image file so you can see it, e.g. a screenshot, diagram or UI mockup. " +
+		fmt.Sprintf("Images must be at most %s and %dx%d pixels. ", formatSize(MaxImageBytes), MaxImageDimension, MaxImageDimension) +
+		"Only use this when the model supports image input."
+}
+
+// Parameters returns the JSON schema for tool parameters.
+func (t *ImageTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"path": {
+				"type": "string",
+				"description": "The image file path"
+			}
+		},
+		"required": ["path"]
+	}`)
+}
+
+// ApprovalAction implements Approvable. Reading is read-only.
+func (t *ImageTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	return "", "", false
+}
+
+// Execute reads the image.
+func (t *ImageTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Path string `json:"path"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+	if params.Path == "" {
+		return nil, fmt.Errorf("path is required")
+	}
+
+	path, err := t.policy.Resolve(t.workDir, params.Path, AccessRead)
+	if err != nil {
+		return ImageResult{Success: false, Error: err.Error(), Denied: asDenied(err)}, nil
+	}
+	img, err := LoadImage(path)
+	if err != nil {
+		return ImageResult{Success: false, Error: err.Error()}, nil
+	}
+	return ImageResult{
+		Success:  true,
+		Path:     params.Path,
+		MimeType: img.MimeType,
+		Width:    img.Width,
+		Height:   img.Height,
+		Size:     len(img.Data),
+		image:    img,
+	}, nil
+}
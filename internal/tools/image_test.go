@@ -0,0 +1,106 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"image"
+	"image/png"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// writePNG writes a blank PNG image of the given size.
+func writePNG(t *testing.T, path string, width, height int) {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, width, height))); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadImage(t *testing.T) {
+	dir := t.TempDir()
+	writePNG(t, filepath.Join(dir, "ok.png"), 40, 30)
+	writePNG(t, filepath.Join(dir, "wide.png"), MaxImageDimension+1, 1)
+	os.WriteFile(filepath.Join(dir, "notes.txt"), []byte("not an image"), 0644)
+
+	img, err := LoadImage(filepath.Join(dir, "ok.png"))
+	if err != nil {
+		t.Fatalf("LoadImage failed: %v", err)
+	}
+	if img.MimeType != "image/png" || img.Width != 40 || img.Height != 30 || img.Name != "ok.png" {
+		t.Errorf("unexpected image: %s", img.Describe())
+	}
+
+	for name, want := range map[string]string{
+		"wide.png":  "pixels",
+		"notes.txt": "not a PNG",
+		"none.png":  "no such file",
+	} {
+		if _, err := LoadImage(filepath.Join(dir, name)); err == nil || !strings.Contains(err.Error(), want) {
+			t.Errorf("LoadImage(%s) = %v, want an error containing %q", name, err, want)
+		}
+	}
+}
+
+func TestWebpSize(t *testing.T) {
+	header := func(chunk string, payload ...byte) []byte {
+		data := append([]byte("RIFF\x00\x00\x00\x00WEBP"+chunk+"\x00\x00\x00\x00"), payload...)
+		return append(data, make([]byte, 30)...)
+	}
+	tests := []struct {
+		name          string
+		data          []byte
+		width, height int
+	}{
+		// Lossy: frame tag, start code, then 14-bit width and height
+		{"VP8", header("VP8 ", 0, 0, 0, 0x9d, 0x01, 0x2a, 0x20, 0x03, 0x58, 0x02), 800, 600},
+		// Lossless: signature, then width-1 and height-1 in 14 bits each
+		{"VP8L", header("VP8L", 0x2f, 0x1f, 0xc0, 0x0f, 0x00), 32, 64},
+		// Extended: flags and reserved bytes, then 24-bit width-1 and height-1
+		{"VP8X", header("VP8X", 0, 0, 0, 0, 0x0f, 0x27, 0x00, 0xff, 0x00, 0x00), 10000, 256},
+	}
+	for _, tt := range tests {
+		w, h, err := webpSize(tt.data)
+		if err != nil || w != tt.width || h != tt.height {
+			t.Errorf("%s: got %dx%d, %v; want %dx%d", tt.name, w, h, err, tt.width, tt.height)
+		}
+	}
+	if _, _, err := webpSize([]byte("RIFF")); err == nil {
+		t.Error("truncated header should fail")
+	}
+}
+
+func TestImageTool_Execute(t *testing.T) {
+	dir, outside := t.TempDir(), t.TempDir()
+	writePNG(t, filepath.Join(dir, "shot.png"), 8, 8)
+	writePNG(t, filepath.Join(outside, "secret.png"), 8, 8)
+	tool := NewImageTool(dir)
+	tool.SetPolicy(&WorkspacePolicy{})
+
+	result, err := tool.Execute(context.Background(), json.RawMessage(`{"path": "shot.png"}`))
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	r := result.(ImageResult)
+	if !r.Success || r.Width != 8 || len(r.Images()) != 1 || len(r.Images()[0].Data) != r.Size {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if !strings.Contains(r.ModelText(), "shot.png (image/png, 8x8,") {
+		t.Errorf("unexpected model text: %q", r.ModelText())
+	}
+
+	result, _ = tool.Execute(context.Background(), json.RawMessage(`{"path": "`+filepath.Join(outside, "secret.png")+`"}`))
+	if r := result.(ImageResult); r.Success || r.Denied == nil || r.Images() != nil {
+		t.Errorf("image outside the workspace should be denied: %+v", r)
+	}
+	if _, err := tool.Execute(context.Background(), json.RawMessage(`{}`)); err == nil {
+		t.Error("missing path should be an error")
+	}
+}
@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// ModelTexter is implemented by tool results that the model reads as plain
+// text rather than JSON. Keeping long output line-oriented lets the limits
+// apply per line and the saved full output be paged by line. An empty
+// ModelText falls back to JSON.
+type ModelTexter interface {
+	ModelText() string
+}
+
+// ResultText returns the text of a tool result for the model: strings and
+// ModelTexter results as they are, other values as JSON.
+func ResultText(v any) string {
+	if text, ok := v.(string); ok {
+		return text
+	}
+	if t, ok := v.(ModelTexter); ok && t.ModelText() != "" {
+		return t.ModelText()
+	}
+	data, _ := json.Marshal(v)
+	return string(data)
+}
+
+// Displayable is implemented by tool results that show the user something
+// other than what the model sees, such as the diff of a file edit.
+type Displayable interface {
+	// Display returns the text shown to the user; empty means the model's view.
+	Display() string
+}
+
+// OutputLimits bound the tool output sent to the model. Zero fields are
+// unlimited.
+type OutputLimits struct {
+	MaxChars      int // Characters in the whole output
+	MaxLineLength int // Characters in a single line
+}
+
+// DefaultOutputLimits are the global limits used unless configured otherwise.
+var DefaultOutputLimits = OutputLimits{MaxChars: 30_000, MaxLineLength: 2_000}
+
+// OutputLimiter is implemented by tools whose output needs other limits than
+// the global ones. Non-zero fields override the global limits.
+type OutputLimiter interface {
+	OutputLimits() OutputLimits
+}
+
+// Override returns l with the non-zero fields of o.
+func (l OutputLimits) Override(o OutputLimits) OutputLimits {
+	if o.MaxChars > 0 {
+		l.MaxChars = o.MaxChars
+	}
+	if o.MaxLineLength > 0 {
+		l.MaxLineLength = o.MaxLineLength
+	}
+	return l
+}
+
+// TruncateOutput applies limits to a tool's output. Long lines are cut, and
+// when the output is still too long its middle is replaced by a marker so
+// both the beginning and the end survive. It reports whether anything was
+// removed.
+func TruncateOutput(text string, limits OutputLimits) (string, bool) {
+	truncated := false
+	if limits.MaxLineLength > 0 {
+		lines := strings.Split(text, "\n")
+		for i, line := range lines {
+			if n := utf8.RuneCountInString(line); n > limits.MaxLineLength {
+				lines[i] = fmt.Sprintf("%s ... [%d characters truncated]",
+					headRunes(line, limits.MaxLineLength), n-limits.MaxLineLength)
+				truncated = true
+			}
+		}
+		if truncated {
+			text = strings.Join(lines, "\n")
+		}
+	}
+
+	total := utf8.RuneCountInString(text)
+	if limits.MaxChars <= 0 || total <= limits.MaxChars {
+		return text, truncated
+	}
+
+	// Keep whole lines at both ends where that does not lose too much
+	head := headRunes(text, limits.MaxChars/2)
+	if i := strings.LastIndexByte(head, '\n'); i >= len(head)/2 {
+		head = head[:i+1]
+	}
+	tail := tailRunes(text, limits.MaxChars-utf8.RuneCountInString(head))
+	if i := strings.IndexByte(tail, '\n'); i >= 0 && i < len(tail)/2 {
+		tail = tail[i+1:]
+	}
+	omitted := text[len(head) : len(text)-len(tail)]
+	marker := fmt.Sprintf("\n... [%d lines, %d characters omitted] ...\n",
+		strings.Count(omitted, "\n"), utf8.RuneCountInString(omitted))
+	return head + marker + tail, true
+}
+
+// headRunes returns the first n runes of s.
+func headRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// tailRunes returns the last n runes of s.
+func tailRunes(s string, n int) string {
+	i := len(s)
+	for ; n > 0 && i > 0; n-- {
+		_, size := utf8.DecodeLastRuneInString(s[:i])
+		i -= size
+	}
+	return s[i:]
+}
+
+// appendLine writes line to b, starting a new line if b does not end with one.
+func appendLine(b *strings.Builder, line string) {
+	if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+		b.WriteByte('\n')
+	}
+	b.WriteString(line)
+}
+
+// Output streams of a running tool.
+const (
+	StreamStdout = "stdout"
+	StreamStderr = "stderr"
+)
+
+// OutputChunk is a piece of output produced by a tool while it runs.
+type OutputChunk struct {
+	Stream string // StreamStdout or StreamStderr
+	Text   string
+}
+
+type outputFuncKey struct{}
+
+// WithOutputFunc returns a context under which tools report output to fn
+// while they run, before returning their result. fn may be called from
+// several goroutines at once.
+func WithOutputFunc(ctx context.Context, fn func(OutputChunk)) context.Context {
+	return context.WithValue(ctx, outputFuncKey{}, fn)
+}
+
+// outputFunc returns the function set by WithOutputFunc, or nil.
+func outputFunc(ctx context.Context) func(OutputChunk) {
+	fn, _ := ctx.Value(outputFuncKey{}).(func(OutputChunk))
+	return fn
+}
+
+// streamWriter collects one output stream of a command and reports each write
+// to emit, when set.
+type streamWriter struct {
+	buf    bytes.Buffer
+	stream string
+	emit   func(OutputChunk)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.buf.Write(p)
+	if w.emit != nil {
+		w.emit(OutputChunk{Stream: w.stream, Text: string(p)})
+	}
+	return len(p), nil
+}
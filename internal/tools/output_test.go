@@ -0,0 +1,80 @@
+package tools
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestTruncateOutput_WithinLimits(t *testing.T) {
+	text := "line one\nline two\n"
+	got, truncated := TruncateOutput(text, DefaultOutputLimits)
+	if truncated || got != text {
+		t.Errorf("short output should be unchanged, got %q", got)
+	}
+	if got, truncated := TruncateOutput(strings.Repeat("x", 100_000), OutputLimits{}); truncated || len(got) != 100_000 {
+		t.Error("zero limits should not truncate")
+	}
+}
+
+func TestTruncateOutput_LongLines(t *testing.T) {
+	got, truncated := TruncateOutput("short\n"+strings.Repeat("é", 30)+"\nend", OutputLimits{MaxLineLength: 10})
+	if !truncated {
+		t.Fatal("expected truncation")
+	}
+	want := "short\n" + strings.Repeat("é", 10) + " ... [20 characters truncated]\nend"
+	if got != want {
+		t.Errorf("got %q, want %q", got, want)
+	}
+}
+
+func TestTruncateOutput_HeadAndTail(t *testing.T) {
+	var lines []string
+	for i := 0; i < 1000; i++ {
+		lines = append(lines, strings.Repeat("ab", 10)+"-"+string(rune('a'+i%26)))
+	}
+	text := strings.Join(lines, "\n")
+	got, truncated := TruncateOutput(text, OutputLimits{MaxChars: 1000})
+	if !truncated {
+		t.Fatal("expected truncation")
+	}
+	if !strings.HasPrefix(got, lines[0]+"\n") || !strings.HasSuffix(got, "\n"+lines[999]) {
+		t.Errorf("head and tail should be kept:\n%s", got)
+	}
+	if !strings.Contains(got, "characters omitted] ...") {
+		t.Errorf("missing truncation marker:\n%s", got)
+	}
+	if n := utf8.RuneCountInString(got); n > 1100 {
+		t.Errorf("output too long: %d characters", n)
+	}
+	// Whole lines are kept on both sides of the marker
+	for _, line := range strings.Split(got, "\n") {
+		if line != "" && !strings.HasPrefix(line, "...") && len(line) != len(lines[0]) {
+			t.Errorf("partial line kept: %q", line)
+		}
+	}
+}
+
+func TestOutputLimits_Override(t *testing.T) {
+	got := DefaultOutputLimits.Override(OutputLimits{MaxChars: 5})
+	if got.MaxChars != 5 || got.MaxLineLength != DefaultOutputLimits.MaxLineLength {
+		t.Errorf("unexpected limits: %+v", got)
+	}
+}
+
+func TestShellToolResult_ModelText(t *testing.T) {
+	tests := []struct {
+		result ShellToolResult
+		want   string
+	}{
+		{ShellToolResult{Success: true, Stdout: "hi\n"}, "hi\n"},
+		{ShellToolResult{Success: true}, "(no output)"},
+		{ShellToolResult{Stdout: "oops", ExitCode: 2}, "oops\n[exit code 2]"},
+		{ShellToolResult{Error: "command timed out", ExitCode: -1}, "[error: command timed out]"},
+	}
+	for _, tt := range tests {
+		if got := tt.result.ModelText(); got != tt.want {
+			t.Errorf("ModelText(%+v) = %q, want %q", tt.result, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,750 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// PatchToolName is the name of the patch tool.
+const PatchToolName = "apply_patch"
+
+// maxPatchFuzz is the number of context lines that may be ignored at each end
+// of a hunk when it does not apply as written.
+const maxPatchFuzz = 2
+
+// PatchTool applies unified diffs to files in the work directory.
+type PatchTool struct {
+	workDir string
+	policy  *WorkspacePolicy
+}
+
+// PatchResult represents the result of applying a patch.
+type PatchResult struct {
+	Success  bool             `json:"success"`
+	Files    []PatchedFile    `json:"files,omitempty"`
+	Rejected []RejectedHunk   `json:"rejected,omitempty"`
+	Error    string           `json:"error,omitempty"`
+	Denied   *PathDeniedError `json:"denied,omitempty"`
+	Diff     string           `json:"-"` // Applied changes, excluding deleted files; shown to the user only
+}
+
+// Display implements Displayable. Applied patches show their diff.
+func (r PatchResult) Display() string {
+	return r.Diff
+}
+
+// PatchedFile describes a file changed by a patch.
+type PatchedFile struct {
+	Path    string `json:"path"`
+	OldPath string `json:"old_path,omitempty"` // Set for renames
+	Action  string `json:"action"`             // created, modified, deleted or renamed
+}
+
+// RejectedHunk describes a hunk that could not be applied.
+type RejectedHunk struct {
+	Path   string `json:"path"`
+	Hunk   int    `json:"hunk"` // 1-based index within the file
+	Header string `json:"header"`
+	Reason string `json:"reason"`
+}
+
+// NewPatchTool creates a new patch tool.
+func NewPatchTool(workDir string) *PatchTool {
+	return &PatchTool{workDir: workDir}
+}
+
+// SetPolicy implements Confinable.
+func (t *PatchTool) SetPolicy(p *WorkspacePolicy) {
+	t.policy = p
+}
+
+// Name returns the tool name.
+func (t *PatchTool) Name() string {
+	return PatchToolName
+}
+
+// Description returns the tool description.
+func (t *PatchTool) Description() string {
+	return "Apply a unified diff to one or more files. Supports multiple hunks and files, " +
+		"file creation (--- /dev/null), deletion (+++ /dev/null) and renames (rename from/rename to). " +
+		"Hunks are located by their context, so line numbers may be approximate. " +
+		"The patch is atomic: if any hunk is rejected, no file is changed and the rejected hunks are reported."
+}
+
+// Parameters returns the JSON schema for tool parameters.
+func (t *PatchTool) Parameters() json.RawMessage {
+	return json.RawMessage(`{
+		"type": "object",
+		"properties": {
+			"patch": {
+				"type": "string",
+				"description": "The patch in unified diff format, with paths relative to the working directory"
+			}
+		},
+		"required": ["patch"]
+	}`)
+}
+
+// ApprovalAction implements Approvable.
+func (t *PatchTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	var params struct {
+		Patch string `json:"patch"`
+	}
+	_ = json.Unmarshal(args, &params)
+
+	patches, err := parsePatch(params.Patch)
+	if err != nil || len(patches) == 0 {
+		return "apply patch", "apply a patch", true
+	}
+	paths := make([]string, 0, len(patches))
+	for _, fp := range patches {
+		paths = append(paths, "`"+fp.path()+"`")
+	}
+	return "apply patch", "apply a patch to " + strings.Join(paths, ", "), true
+}
+
+// Execute applies the patch.
+func (t *PatchTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
+	var params struct {
+		Patch string `json:"patch"`
+	}
+	if err := json.Unmarshal(args, &params); err != nil {
+		return nil, fmt.Errorf("invalid parameters: %w", err)
+	}
+
+	patches, err := parsePatch(params.Patch)
+	if err != nil {
+		return nil, fmt.Errorf("invalid patch: %w", err)
+	}
+	if len(patches) == 0 {
+		return nil, fmt.Errorf("invalid patch: no file changes found")
+	}
+
+	return t.apply(patches), nil
+}
+
+// apply applies the patches in memory, then writes every changed file.
+// Nothing is written if any hunk is rejected or a path is denied.
+func (t *PatchTool) apply(patches []filePatch) PatchResult {
+	for _, fp := range patches {
+		for _, path := range []string{fp.oldPath, fp.newPath} {
+			if path == "" {
+				continue
+			}
+			if _, err := t.policy.Resolve(t.workDir, path, AccessWrite); err != nil {
+				return PatchResult{Error: err.Error() + "; no files were changed", Denied: asDenied(err)}
+			}
+		}
+	}
+
+	ws := newPatchWorkspace(t.workDir)
+	var result PatchResult
+
+	for _, fp := range patches {
+		file, rejected, err := ws.applyFilePatch(fp)
+		if err != nil {
+			result.Rejected = append(result.Rejected, RejectedHunk{Path: fp.path(), Reason: err.Error()})
+			continue
+		}
+		result.Rejected = append(result.Rejected, rejected...)
+		if len(rejected) == 0 {
+			result.Files = append(result.Files, file)
+		}
+	}
+
+	if len(result.Rejected) > 0 {
+		result.Files = nil
+		result.Error = fmt.Sprintf("%d hunk(s) rejected; no files were changed", len(result.Rejected))
+		return result
+	}
+
+	if err := ws.commit(); err != nil {
+		result.Files = nil
+		result.Error = fmt.Sprintf("failed to write files, all changes were rolled back: %v", err)
+		return result
+	}
+
+	result.Success = true
+	result.Diff = ws.diff()
+	return result
+}
+
+// filePatch is the part of a patch that changes one file.
+type filePatch struct {
+	oldPath string // "" for a created file
+	newPath string // "" for a deleted file
+	mode    os.FileMode
+	hunks   []patchHunk
+}
+
+// path returns the path the patch is about, preferring the new one.
+func (fp filePatch) path() string {
+	if fp.newPath != "" {
+		return fp.newPath
+	}
+	return fp.oldPath
+}
+
+// patchHunk is one @@ section of a file patch.
+type patchHunk struct {
+	header       string
+	oldStart     int // 1-based; 0 when unknown or for an insertion at the start
+	lines        []hunkLine
+	oldNoNewline bool // The old side lacks a final newline
+	newNoNewline bool // The new side lacks a final newline
+}
+
+// hunkLine is a context (' '), removed ('-') or added ('+') line.
+type hunkLine struct {
+	kind byte
+	text string
+}
+
+var hunkHeaderRe = regexp.MustCompile(`^@@ -(\d+)(?:,\d+)? \+\d+(?:,\d+)? @@`)
+
+// parsePatch parses a unified diff, with or without git extended headers.
+// It is lenient about what models produce: line counts in hunk headers are
+// ignored and text between file sections is skipped.
+func parsePatch(text string) ([]filePatch, error) {
+	lines := strings.Split(strings.ReplaceAll(text, "\r\n", "\n"), "\n")
+
+	var patches []*filePatch
+	var cur *filePatch
+	sawFileHeader := false // cur has its ---/+++ lines
+	start := func() {
+		cur = &filePatch{}
+		patches = append(patches, cur)
+		sawFileHeader = false
+	}
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		switch {
+		case strings.HasPrefix(line, "diff --git "):
+			start()
+			if a, b, ok := parseGitDiffPaths(strings.TrimPrefix(line, "diff --git ")); ok {
+				cur.oldPath, cur.newPath = a, b
+			}
+
+		case strings.HasPrefix(line, "--- ") && i+1 < len(lines) && strings.HasPrefix(lines[i+1], "+++ "):
+			if cur == nil || sawFileHeader || len(cur.hunks) > 0 {
+				start()
+			}
+			cur.oldPath, cur.newPath = parseFileHeaderPaths(line[4:], lines[i+1][4:])
+			sawFileHeader = true
+			i++
+
+		case cur == nil:
+			// Text before the first file section
+
+		case strings.HasPrefix(line, "new file mode "):
+			cur.oldPath = ""
+			cur.mode = parseFileMode(strings.TrimPrefix(line, "new file mode "))
+		case strings.HasPrefix(line, "deleted file mode "):
+			cur.newPath = ""
+		case strings.HasPrefix(line, "rename from "):
+			cur.oldPath = strings.TrimPrefix(line, "rename from ")
+		case strings.HasPrefix(line, "rename to "):
+			cur.newPath = strings.TrimPrefix(line, "rename to ")
+
+		case strings.HasPrefix(line, "@@"):
+			h, next := parseHunk(lines, i)
+			if len(h.lines) == 0 {
+				return nil, fmt.Errorf("empty hunk %q in %s", h.header, cur.path())
+			}
+			cur.hunks = append(cur.hunks, h)
+			i = next - 1
+		}
+	}
+
+	result := make([]filePatch, 0, len(patches))
+	for _, fp := range patches {
+		if fp.oldPath == "" && fp.newPath == "" {
+			return nil, fmt.Errorf("file section without a path")
+		}
+		if fp.oldPath != "" && fp.newPath == fp.oldPath && len(fp.hunks) == 0 {
+			return nil, fmt.Errorf("no hunks for %s", fp.path())
+		}
+		result = append(result, *fp)
+	}
+	return result, nil
+}
+
+// parseHunk parses the hunk starting at lines[i] and returns the index of the
+// first line after it.
+func parseHunk(lines []string, i int) (patchHunk, int) {
+	h := patchHunk{header: lines[i]}
+	if m := hunkHeaderRe.FindStringSubmatch(lines[i]); m != nil {
+		h.oldStart, _ = strconv.Atoi(m[1])
+	}
+
+	blank := 0 // Trailing blank lines that may be separators rather than context
+	j := i + 1
+	for ; j < len(lines); j++ {
+		line := lines[j]
+		if strings.HasPrefix(line, "@@") || strings.HasPrefix(line, "diff --git ") ||
+			(strings.HasPrefix(line, "--- ") && j+1 < len(lines) && strings.HasPrefix(lines[j+1], "+++ ")) {
+			break
+		}
+		if line == "" {
+			// Editors and models often strip the space of empty context lines
+			h.lines = append(h.lines, hunkLine{' ', ""})
+			blank++
+			continue
+		}
+
+		kind := line[0]
+		if kind == '\\' {
+			// "\ No newline at end of file" applies to the line before it
+			if n := len(h.lines); n > 0 {
+				switch h.lines[n-1].kind {
+				case '-':
+					h.oldNoNewline = true
+				case '+':
+					h.newNoNewline = true
+				default:
+					h.oldNoNewline, h.newNoNewline = true, true
+				}
+			}
+			continue
+		}
+		if kind != ' ' && kind != '-' && kind != '+' {
+			break
+		}
+		h.lines = append(h.lines, hunkLine{kind, line[1:]})
+		blank = 0
+	}
+	h.lines = h.lines[:len(h.lines)-blank]
+	return h, j
+}
+
+// parseGitDiffPaths parses the "a/x b/y" part of a "diff --git" line.
+func parseGitDiffPaths(s string) (string, string, bool) {
+	if !strings.HasPrefix(s, "a/") {
+		return "", "", false
+	}
+	idx := strings.Index(s, " b/")
+	if idx < 0 {
+		return "", "", false
+	}
+	return s[2:idx], s[idx+3:], true
+}
+
+// parseFileHeaderPaths parses the paths of "---" and "+++" lines. The a/ and
+// b/ prefixes of git diffs are removed.
+func parseFileHeaderPaths(oldHeader, newHeader string) (string, string) {
+	clean := func(s string) string {
+		if idx := strings.Index(s, "\t"); idx >= 0 {
+			s = s[:idx] // Timestamp
+		}
+		s = strings.TrimSpace(s)
+		if s == "/dev/null" {
+			return ""
+		}
+		return s
+	}
+	oldPath, newPath := clean(oldHeader), clean(newHeader)
+
+	hasPrefix := func(p, prefix string) bool { return p == "" || strings.HasPrefix(p, prefix) }
+	if hasPrefix(oldPath, "a/") && hasPrefix(newPath, "b/") && oldPath+newPath != "" {
+		if oldPath != "" {
+			oldPath = oldPath[2:]
+		}
+		if newPath != "" {
+			newPath = newPath[2:]
+		}
+	}
+	return oldPath, newPath
+}
+
+// parseFileMode parses a git file mode such as 100755.
+func parseFileMode(s string) os.FileMode {
+	mode, err := strconv.ParseUint(strings.TrimSpace(s), 8, 32)
+	if err != nil {
+		return 0
+	}
+	return os.FileMode(mode).Perm()
+}
+
+// patchWorkspace holds the files touched by a patch until they are written.
+type patchWorkspace struct {
+	workDir string
+	files   map[string]*patchFile
+	order   []string // Paths in the order they were first touched
+}
+
+// patchFile is the original and patched state of one file.
+type patchFile struct {
+	display     string
+	origExists  bool
+	origContent string
+	origMode    os.FileMode
+	exists      bool
+	content     string
+	mode        os.FileMode
+}
+
+func newPatchWorkspace(workDir string) *patchWorkspace {
+	return &patchWorkspace{workDir: workDir, files: make(map[string]*patchFile)}
+}
+
+// file returns the current state of a file, loading it from disk the first time.
+func (ws *patchWorkspace) file(display string) (*patchFile, error) {
+	path := resolveWorkPath(ws.workDir, display)
+	if f, ok := ws.files[path]; ok {
+		return f, nil
+	}
+
+	f := &patchFile{display: display, mode: 0644}
+	info, err := os.Stat(path)
+	switch {
+	case err == nil && info.IsDir():
+		return nil, fmt.Errorf("%s is a directory", display)
+	case err == nil:
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		f.origExists, f.origContent, f.origMode = true, string(data), info.Mode().Perm()
+		f.exists, f.content, f.mode = true, f.origContent, f.origMode
+	case !os.IsNotExist(err):
+		return nil, err
+	}
+	ws.files[path] = f
+	ws.order = append(ws.order, path)
+	return f, nil
+}
+
+// applyFilePatch applies one file section in memory.
+func (ws *patchWorkspace) applyFilePatch(fp filePatch) (PatchedFile, []RejectedHunk, error) {
+	src, err := ws.file(fp.path())
+	if fp.oldPath != "" {
+		src, err = ws.file(fp.oldPath)
+	}
+	if err != nil {
+		return PatchedFile{}, nil, err
+	}
+
+	result := PatchedFile{Path: fp.path()}
+	switch {
+	case fp.oldPath == "":
+		if src.exists {
+			return PatchedFile{}, nil, fmt.Errorf("cannot create %s: file already exists", fp.newPath)
+		}
+		result.Action = "created"
+	case !src.exists:
+		return PatchedFile{}, nil, fmt.Errorf("%s does not exist", fp.oldPath)
+	case fp.newPath == "":
+		result.Action = "deleted"
+	case fp.newPath != fp.oldPath:
+		result.Action = "renamed"
+		result.OldPath = fp.oldPath
+	default:
+		result.Action = "modified"
+	}
+
+	content := ""
+	if fp.oldPath != "" {
+		content = src.content
+	}
+	content, rejected := applyHunks(content, fp.hunks)
+	for i := range rejected {
+		rejected[i].Path = fp.path()
+	}
+	if len(rejected) > 0 {
+		return PatchedFile{}, rejected, nil
+	}
+
+	switch result.Action {
+	case "deleted":
+		src.exists, src.content = false, ""
+	case "created", "renamed":
+		dst, err := ws.file(fp.newPath)
+		if err != nil {
+			return PatchedFile{}, nil, err
+		}
+		if dst.exists && dst != src {
+			return PatchedFile{}, nil, fmt.Errorf("cannot rename to %s: file already exists", fp.newPath)
+		}
+		mode := src.mode
+		if fp.oldPath == "" {
+			mode = 0644
+		}
+		if fp.mode != 0 {
+			mode = fp.mode
+		}
+		if dst != src {
+			src.exists, src.content = false, ""
+		}
+		dst.exists, dst.content, dst.mode = true, content, mode
+	default:
+		src.content = content
+		if fp.mode != 0 {
+			src.mode = fp.mode
+		}
+	}
+	return result, nil, nil
+}
+
+// commit writes all changed files. If a write fails, files already written
+// are restored to their original state.
+func (ws *patchWorkspace) commit() error {
+	var done []string
+	for _, path := range ws.order {
+		f := ws.files[path]
+		if f.exists == f.origExists && f.content == f.origContent && f.mode == f.origMode {
+			continue
+		}
+		var err error
+		if f.exists {
+			err = writeFileAtomic(path, f.content, f.mode)
+		} else if f.origExists {
+			err = os.Remove(path)
+		}
+		if err != nil {
+			ws.rollback(done)
+			return err
+		}
+		done = append(done, path)
+	}
+	return nil
+}
+
+// rollback restores the original state of the given files.
+func (ws *patchWorkspace) rollback(paths []string) {
+	for _, path := range paths {
+		f := ws.files[path]
+		if f.origExists {
+			_ = writeFileAtomic(path, f.origContent, f.origMode)
+		} else {
+			_ = os.Remove(path)
+		}
+	}
+}
+
+// diff returns a unified diff of the created and modified files.
+func (ws *patchWorkspace) diff() string {
+	var b strings.Builder
+	for _, path := range ws.order {
+		f := ws.files[path]
+		if f.exists {
+			b.WriteString(UnifiedDiff(f.display, f.origContent, f.content))
+		}
+	}
+	return b.String()
+}
+
+// writeFileAtomic writes content to a temporary file and renames it into place.
+func writeFileAtomic(path, content string, mode os.FileMode) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".patch-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.WriteString(content); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmp.Name(), mode); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+// applyHunks applies the hunks to content in order. Line endings of the
+// original are kept; added lines use the file's predominant line ending.
+func applyHunks(content string, hunks []patchHunk) (string, []RejectedHunk) {
+	finalNewline := content == "" || strings.HasSuffix(content, "\n")
+	var lines []string
+	if content != "" {
+		lines = strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	}
+	crlf := strings.Count(content, "\r\n") > strings.Count(content, "\n")/2
+
+	var out []string
+	var rejected []RejectedHunk
+	pos := 0    // Next unconsumed line of the original
+	offset := 0 // Shift of the previous hunk from its stated position
+
+	for n, h := range hunks {
+		match, fuzzed, ok := locateHunk(lines, h, pos, offset)
+		if !ok {
+			rejected = append(rejected, RejectedHunk{
+				Hunk:   n + 1,
+				Header: h.header,
+				Reason: hunkRejectReason(lines, h),
+			})
+			continue
+		}
+		if fuzzed.oldStart > 0 {
+			offset = match - (fuzzed.oldStart - 1)
+		}
+
+		out = append(out, lines[pos:match]...)
+		i := match
+		for _, l := range fuzzed.lines {
+			switch l.kind {
+			case ' ':
+				out = append(out, lines[i])
+				i++
+			case '-':
+				i++
+			case '+':
+				if crlf {
+					out = append(out, l.text+"\r")
+				} else {
+					out = append(out, l.text)
+				}
+			}
+		}
+		pos = i
+
+		if h.newNoNewline {
+			finalNewline = false
+		} else if h.oldNoNewline {
+			finalNewline = true
+		}
+	}
+	if len(rejected) > 0 {
+		return content, rejected
+	}
+
+	out = append(out, lines[pos:]...)
+	if len(out) == 0 {
+		return "", nil
+	}
+	result := strings.Join(out, "\n")
+	if finalNewline {
+		result += "\n"
+	}
+	return result, nil
+}
+
+// locateHunk finds where the hunk applies at or after pos. If it does not
+// apply as written, up to maxPatchFuzz context lines are dropped from each
+// end. It returns the start line and the hunk as applied.
+func locateHunk(lines []string, h patchHunk, pos, offset int) (int, patchHunk, bool) {
+	prevLead, prevTrail := -1, -1
+	for fuzz := 0; fuzz <= maxPatchFuzz; fuzz++ {
+		lead, trail := contextToTrim(h, fuzz)
+		if lead == prevLead && trail == prevTrail {
+			break // Nothing more to drop
+		}
+		prevLead, prevTrail = lead, trail
+
+		fuzzed := h
+		fuzzed.lines = h.lines[lead : len(h.lines)-trail]
+		if h.oldStart > 0 {
+			fuzzed.oldStart += lead
+		}
+		var old []string
+		for _, l := range fuzzed.lines {
+			if l.kind != '+' {
+				old = append(old, l.text)
+			}
+		}
+
+		if len(old) == 0 {
+			if fuzz > 0 {
+				break // Never insert without the context that placed the hunk
+			}
+			// Pure insertion: "@@ -N,0" inserts after line N
+			at := pos
+			if h.oldStart > 0 {
+				at = min(max(h.oldStart+offset, pos), len(lines))
+			}
+			return at, fuzzed, true
+		}
+
+		hint := pos
+		if fuzzed.oldStart > 0 {
+			hint = max(fuzzed.oldStart-1+offset, pos)
+		}
+		for _, eq := range lineMatchers {
+			if at, ok := searchLines(lines, old, hint, pos, eq); ok {
+				return at, fuzzed, true
+			}
+		}
+	}
+	return 0, h, false
+}
+
+// contextToTrim returns how many context lines to drop from the start and end
+// of the hunk at the given fuzz level. Lines that are added or removed are
+// never dropped.
+func contextToTrim(h patchHunk, fuzz int) (lead, trail int) {
+	lines := h.lines
+	for lead < fuzz && lead < len(lines) && lines[lead].kind == ' ' {
+		lead++
+	}
+	for trail < fuzz && trail < len(lines)-lead && lines[len(lines)-1-trail].kind == ' ' {
+		trail++
+	}
+	if lead+trail == len(lines) {
+		// A hunk of only context lines keeps at least one
+		return 0, 0
+	}
+	return lead, trail
+}
+
+// lineMatchers compare a file line with a patch line, from strict to loose.
+var lineMatchers = []func(fileLine, patchLine string) bool{
+	func(a, b string) bool { return strings.TrimSuffix(a, "\r") == b },
+	func(a, b string) bool { return strings.TrimRight(a, " \t\r") == strings.TrimRight(b, " \t\r") },
+	func(a, b string) bool { return strings.TrimSpace(a) == strings.TrimSpace(b) },
+}
+
+// searchLines finds old in lines at or after from, trying positions nearest
+// to hint first.
+func searchLines(lines, old []string, hint, from int, eq func(a, b string) bool) (int, bool) {
+	last := len(lines) - len(old)
+	matches := func(at int) bool {
+		for i, l := range old {
+			if !eq(lines[at+i], l) {
+				return false
+			}
+		}
+		return true
+	}
+	for d := 0; hint-d >= from || hint+d <= last; d++ {
+		if at := hint + d; at >= from && at <= last && matches(at) {
+			return at, true
+		}
+		if at := hint - d; d > 0 && at >= from && at <= last && matches(at) {
+			return at, true
+		}
+	}
+	return 0, false
+}
+
+// hunkRejectReason explains why a hunk did not apply.
+func hunkRejectReason(lines []string, h patchHunk) string {
+	for _, l := range h.lines {
+		if l.kind == ' ' || l.kind == '-' {
+			found := false
+			for _, fl := range lines {
+				if strings.TrimSpace(fl) == strings.TrimSpace(l.text) {
+					found = true
+					break
+				}
+			}
+			if !found {
+				return fmt.Sprintf("line %q does not exist in the file", l.text)
+			}
+		}
+	}
+	return "the context and removed lines were not found together in the file; re-read the file and regenerate the hunk"
+}
@@ -0,0 +1,256 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// applyTestPatch runs the patch tool on dir and returns its result.
+func applyTestPatch(t *testing.T, dir, patch string) PatchResult {
+	t.Helper()
+	args, _ := json.Marshal(map[string]string{"patch": patch})
+	result, err := NewPatchTool(dir).Execute(context.Background(), args)
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	return result.(PatchResult)
+}
+
+func TestPatchTool_NameDescriptionParameters(t *testing.T) {
+	pt := NewPatchTool("/tmp")
+	if pt.Name() != "apply_patch" {
+		t.Errorf("expected name 'apply_patch', got %q", pt.Name())
+	}
+	if pt.Description() == "" {
+		t.Error("description should not be empty")
+	}
+	var schema map[string]any
+	if err := json.Unmarshal(pt.Parameters(), &schema); err != nil {
+		t.Fatalf("Parameters() is not valid JSON: %v", err)
+	}
+}
+
+func TestPatchTool_MultiHunkMultiFile(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("1\n2\n3\n4\n5\n6\n7\n8\n9\n10\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("hello\nworld\n"), 0644)
+
+	r := applyTestPatch(t, dir, `--- a/a.txt
++++ b/a.txt
+@@ -1,3 +1,3 @@
+ 1
+-2
++two
+ 3
+@@ -8,3 +8,3 @@
+ 8
+-9
++nine
+ 10
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+-hello
++goodbye
+ world
+`)
+	if !r.Success {
+		t.Fatalf("patch failed: %+v", r)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "1\ntwo\n3\n4\n5\n6\n7\n8\nnine\n10\n" {
+		t.Errorf("unexpected a.txt: %q", data)
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "b.txt")); string(data) != "goodbye\nworld\n" {
+		t.Errorf("unexpected b.txt: %q", data)
+	}
+	if len(r.Files) != 2 || r.Files[0].Action != "modified" {
+		t.Errorf("unexpected files: %+v", r.Files)
+	}
+	if !strings.Contains(r.Diff, "+nine") || !strings.Contains(r.Diff, "+goodbye") {
+		t.Errorf("diff should cover both files:\n%s", r.Diff)
+	}
+}
+
+func TestPatchTool_FuzzyContext(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "main.go")
+	os.WriteFile(path, []byte("package main\n\nimport \"fmt\"\n\nfunc main() {\n\tfmt.Println(\"hi\")   \n}\n"), 0644)
+
+	// Wrong line numbers, trailing whitespace lost and a stale first context line
+	r := applyTestPatch(t, dir, `--- a/main.go
++++ b/main.go
+@@ -40,4 +40,4 @@
+ import "os"
+ func main() {
+-	fmt.Println("hi")
++	fmt.Println("hello")
+ }
+`)
+	if !r.Success {
+		t.Fatalf("patch failed: %+v", r)
+	}
+	if data, _ := os.ReadFile(path); !strings.Contains(string(data), "\tfmt.Println(\"hello\")\n}\n") {
+		t.Errorf("unexpected content: %q", data)
+	}
+}
+
+func TestPatchTool_CreateDeleteRename(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "old.txt"), []byte("keep\nchange\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "gone.txt"), []byte("bye\n"), 0644)
+
+	r := applyTestPatch(t, dir, `diff --git a/new/file.sh b/new/file.sh
+new file mode 100755
+--- /dev/null
++++ b/new/file.sh
+@@ -0,0 +1,2 @@
++#!/bin/sh
++echo hi
+diff --git a/gone.txt b/gone.txt
+deleted file mode 100644
+--- a/gone.txt
++++ /dev/null
+@@ -1 +0,0 @@
+-bye
+diff --git a/old.txt b/renamed.txt
+similarity index 50%
+rename from old.txt
+rename to renamed.txt
+--- a/old.txt
++++ b/renamed.txt
+@@ -1,2 +1,2 @@
+ keep
+-change
++changed
+`)
+	if !r.Success {
+		t.Fatalf("patch failed: %+v", r)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "new", "file.sh")); string(data) != "#!/bin/sh\necho hi\n" {
+		t.Errorf("unexpected created file: %q", data)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "new", "file.sh")); err != nil || info.Mode().Perm() != 0755 {
+		t.Errorf("created file should be executable: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "gone.txt")); !os.IsNotExist(err) {
+		t.Error("gone.txt should be deleted")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "old.txt")); !os.IsNotExist(err) {
+		t.Error("old.txt should be renamed away")
+	}
+	if data, _ := os.ReadFile(filepath.Join(dir, "renamed.txt")); string(data) != "keep\nchanged\n" {
+		t.Errorf("unexpected renamed file: %q", data)
+	}
+
+	actions := map[string]string{}
+	for _, f := range r.Files {
+		actions[f.Path] = f.Action
+	}
+	if actions["new/file.sh"] != "created" || actions["gone.txt"] != "deleted" || actions["renamed.txt"] != "renamed" {
+		t.Errorf("unexpected actions: %+v", r.Files)
+	}
+}
+
+func TestPatchTool_AtomicOnRejectedHunk(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("one\ntwo\n"), 0644)
+	os.WriteFile(filepath.Join(dir, "b.txt"), []byte("three\nfour\n"), 0644)
+
+	r := applyTestPatch(t, dir, `--- a/a.txt
++++ b/a.txt
+@@ -1,2 +1,2 @@
+-one
++ONE
+ two
+--- a/b.txt
++++ b/b.txt
+@@ -1,2 +1,2 @@
+ three
+-five
++FIVE
+--- /dev/null
++++ b/c.txt
+@@ -0,0 +1 @@
++new
+`)
+	if r.Success {
+		t.Fatal("patch with a bad hunk should fail")
+	}
+	if len(r.Rejected) != 1 || r.Rejected[0].Path != "b.txt" || r.Rejected[0].Hunk != 1 {
+		t.Fatalf("unexpected rejections: %+v", r.Rejected)
+	}
+	if !strings.Contains(r.Rejected[0].Reason, `"five"`) {
+		t.Errorf("reason should name the missing line, got %q", r.Rejected[0].Reason)
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "a.txt")); string(data) != "one\ntwo\n" {
+		t.Errorf("a.txt should be unchanged, got %q", data)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "c.txt")); !os.IsNotExist(err) {
+		t.Error("c.txt should not be created")
+	}
+}
+
+func TestPatchTool_CreateExistingFileRejected(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, "a.txt"), []byte("x\n"), 0644)
+
+	r := applyTestPatch(t, dir, "--- /dev/null\n+++ b/a.txt\n@@ -0,0 +1 @@\n+y\n")
+	if r.Success || len(r.Rejected) != 1 || !strings.Contains(r.Rejected[0].Reason, "already exists") {
+		t.Errorf("expected rejection, got %+v", r)
+	}
+}
+
+func TestPatchTool_KeepsCRLFAndMode(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "run.bat")
+	os.WriteFile(path, []byte("@echo off\r\necho one\r\n"), 0755)
+
+	r := applyTestPatch(t, dir, "--- a/run.bat\n+++ b/run.bat\n@@ -1,2 +1,3 @@\n @echo off\n-echo one\n+echo 1\n+echo 2\n")
+	if !r.Success {
+		t.Fatalf("patch failed: %+v", r)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "@echo off\r\necho 1\r\necho 2\r\n" {
+		t.Errorf("line endings not kept: %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0755 {
+		t.Errorf("mode not kept: %v", info.Mode().Perm())
+	}
+}
+
+func TestPatchTool_NoNewlineAtEndOfFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "a.txt")
+	os.WriteFile(path, []byte("a\nb"), 0644)
+
+	r := applyTestPatch(t, dir, "--- a/a.txt\n+++ b/a.txt\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+c\n")
+	if !r.Success {
+		t.Fatalf("patch failed: %+v", r)
+	}
+	if data, _ := os.ReadFile(path); string(data) != "a\nc\n" {
+		t.Errorf("unexpected content: %q", data)
+	}
+}
+
+func TestPatchTool_InvalidPatch(t *testing.T) {
+	pt := NewPatchTool(t.TempDir())
+	for _, patch := range []string{"", "just some text", "--- a/x\n+++ b/x\n"} {
+		args, _ := json.Marshal(map[string]string{"patch": patch})
+		if _, err := pt.Execute(context.Background(), args); err == nil {
+			t.Errorf("expected error for patch %q", patch)
+		}
+	}
+}
+
+func TestPatchTool_ApprovalAction(t *testing.T) {
+	args, _ := json.Marshal(map[string]string{"patch": "--- a/x.go\n+++ b/x.go\n@@ -1 +1 @@\n-a\n+b\n"})
+	action, desc, needed := NewPatchTool("").ApprovalAction(args)
+	if !needed || action != "apply patch" || !strings.Contains(desc, "x.go") {
+		t.Errorf("unexpected approval action: %q %q %v", action, desc, needed)
+	}
+}
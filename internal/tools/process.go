@@ -0,0 +1,22 @@
+package tools
+
+import (
+	"os"
+	"os/exec"
+	"syscall"
+	"time"
+)
+
+// TerminateProcessGroup asks the process group of a started cmd to stop and
+// kills what is left of it after grace, or as soon as cmd has exited. done must
+// be closed once cmd has been waited for; TerminateProcessGroup returns after that.
+func TerminateProcessGroup(cmd *exec.Cmd, done <-chan struct{}, grace time.Duration) {
+	_ = signalProcessGroup(cmd, syscall.SIGTERM)
+	select {
+	case <-done:
+	case <-time.After(grace):
+	}
+	// Children may outlive the leader and keep its output pipes open
+	_ = signalProcessGroup(cmd, os.Kill)
+	<-done
+}
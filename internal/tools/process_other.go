@@ -0,0 +1,17 @@
+//go:build !unix
+
+package tools
+
+import (
+	"os"
+	"os/exec"
+)
+
+// SetProcessGroup is a no-op on systems without Unix process groups.
+func SetProcessGroup(cmd *exec.Cmd) {}
+
+// signalProcessGroup signals only the process itself on systems without Unix
+// process groups.
+func signalProcessGroup(cmd *exec.Cmd, sig os.Signal) error {
+	return cmd.Process.Signal(sig)
+}
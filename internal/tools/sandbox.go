@@ -0,0 +1,100 @@
+package tools
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SandboxHelperArg is the first argument of the sandbox helper. To run a
+// command in the sandbox, the kimi binary starts itself with this argument in
+// new namespaces; main must pass such invocations to RunSandboxHelper before
+// doing anything else.
+const SandboxHelperArg = "__kimi_sandbox"
+
+// SandboxPolicy restricts what shell commands may do: the work directory and
+// the temp directory are writable, the rest of the filesystem is read-only,
+// and only the loopback network is reachable unless Network is set.
+type SandboxPolicy struct {
+	WritablePaths []string // Writable in addition to the work and temp directories
+	Network       bool     // Allow network access
+}
+
+// sandboxSpec is what the helper needs to set up the sandbox.
+type sandboxSpec struct {
+	Writable []string `json:"writable"`
+	Network  bool     `json:"network"`
+}
+
+// spec resolves the writable paths of the policy for a command run in workDir.
+func (p *SandboxPolicy) spec(workDir string) (sandboxSpec, error) {
+	if workDir == "" {
+		wd, err := os.Getwd()
+		if err != nil {
+			return sandboxSpec{}, err
+		}
+		workDir = wd
+	}
+	spec := sandboxSpec{Network: p.Network}
+	seen := make(map[string]bool)
+	for _, path := range append([]string{workDir, os.TempDir()}, p.WritablePaths...) {
+		path, err := expandHome(path)
+		if err != nil {
+			return sandboxSpec{}, err
+		}
+		abs, err := filepath.Abs(path)
+		if err == nil {
+			abs, err = filepath.EvalSymlinks(abs)
+		}
+		if err != nil {
+			return sandboxSpec{}, fmt.Errorf("writable path %s: %w", path, err)
+		}
+		if !seen[abs] {
+			seen[abs] = true
+			spec.Writable = append(spec.Writable, abs)
+		}
+	}
+	return spec, nil
+}
+
+// describe explains the policy to the model.
+func (p *SandboxPolicy) describe() string {
+	s := "Commands run in a sandbox: only the work directory and the temp directory are writable"
+	if len(p.WritablePaths) > 0 {
+		s += " (and " + strings.Join(p.WritablePaths, ", ") + ")"
+	}
+	if !p.Network {
+		s += ", and network access is off except for localhost"
+	}
+	return s + "."
+}
+
+// Messages reporting operations the sandbox denied.
+const (
+	sandboxBlockedWrite   = "a write outside the writable directories was blocked by the sandbox"
+	sandboxBlockedNetwork = "network access was blocked by the sandbox"
+)
+
+// sandboxBlocked recognizes, from a sandboxed command's output, that the
+// sandbox denied one of its operations, and returns a note saying so.
+func sandboxBlocked(output string, policy *SandboxPolicy) string {
+	var notes []string
+	if strings.Contains(output, "Read-only file system") {
+		notes = append(notes, sandboxBlockedWrite)
+	}
+	if !policy.Network {
+		for _, msg := range []string{
+			"Network is unreachable",
+			"network is unreachable",
+			"Temporary failure in name resolution",
+			"Could not resolve host",
+		} {
+			if strings.Contains(output, msg) {
+				notes = append(notes, sandboxBlockedNetwork)
+				break
+			}
+		}
+	}
+	return strings.Join(notes, "; ")
+}
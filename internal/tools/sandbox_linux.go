@@ -0,0 +1,177 @@
+package tools
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// wrap makes cmd start in the sandbox. The kimi binary is started in new
+// user and mount namespaces, and a network namespace unless the policy allows
+// network access; there it sets up the sandbox and executes the command.
+func (p *SandboxPolicy) wrap(cmd *exec.Cmd) error {
+	if cmd.Err != nil {
+		return cmd.Err
+	}
+	spec, err := p.spec(cmd.Dir)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(spec)
+	if err != nil {
+		return err
+	}
+
+	cmd.Args = append([]string{"kimi", SandboxHelperArg, string(data), cmd.Path}, cmd.Args...)
+	cmd.Path = "/proc/self/exe"
+	if cmd.SysProcAttr == nil {
+		cmd.SysProcAttr = &syscall.SysProcAttr{}
+	}
+	attr := cmd.SysProcAttr
+	attr.Cloneflags = syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS
+	if !p.Network {
+		attr.Cloneflags |= syscall.CLONE_NEWNET
+	}
+	// The command keeps the user's uid and gid inside the namespace
+	attr.UidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getuid(), HostID: os.Getuid(), Size: 1}}
+	attr.GidMappings = []syscall.SysProcIDMap{{ContainerID: os.Getgid(), HostID: os.Getgid(), Size: 1}}
+	attr.GidMappingsEnableSetgroups = false
+	// The helper needs these to set up the sandbox, even when the uid is not 0
+	attr.AmbientCaps = []uintptr{unix.CAP_SYS_ADMIN, unix.CAP_SETPCAP}
+	return nil
+}
+
+// CheckSandbox reports whether commands can run in the sandbox, which needs
+// unprivileged user namespaces.
+func CheckSandbox() error {
+	cmd := exec.Command("sh", "-c", "exit 0")
+	if err := (&SandboxPolicy{}).wrap(cmd); err != nil {
+		return err
+	}
+	if out, err := cmd.CombinedOutput(); err != nil {
+		if msg := strings.TrimSpace(string(out)); msg != "" {
+			return errors.New(msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// RunSandboxHelper sets up the sandbox in the namespaces the process was
+// started in and executes the command. args are the arguments following
+// SandboxHelperArg. It does not return.
+func RunSandboxHelper(args []string) {
+	// Capabilities are per thread; the command must be executed from the
+	// thread that dropped them
+	runtime.LockOSThread()
+	err := enterSandbox(args)
+	fmt.Fprintf(os.Stderr, "kimi: sandbox setup failed: %v\n", err)
+	os.Exit(126)
+}
+
+// enterSandbox makes the filesystem read-only except for the writable paths,
+// drops all capabilities and executes the command. It only returns on error.
+func enterSandbox(args []string) error {
+	if len(args) < 3 {
+		return errors.New("missing command")
+	}
+	var spec sandboxSpec
+	if err := json.Unmarshal([]byte(args[0]), &spec); err != nil {
+		return err
+	}
+	// Run directly, the helper would change the host's mounts
+	if !inSandboxNamespace() {
+		return errors.New("not started in a new user namespace")
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return err
+	}
+
+	// Mounts in this namespace must not propagate back to the host
+	if err := unix.Mount("", "/", "", unix.MS_REC|unix.MS_PRIVATE, ""); err != nil {
+		return fmt.Errorf("make mounts private: %w", err)
+	}
+	// Writable paths become mounts of their own, so they can stay writable
+	for _, path := range spec.Writable {
+		if err := unix.Mount(path, path, "", unix.MS_BIND|unix.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s: %w", path, err)
+		}
+	}
+	if err := unix.MountSetattr(unix.AT_FDCWD, "/", unix.AT_RECURSIVE,
+		&unix.MountAttr{Attr_set: unix.MOUNT_ATTR_RDONLY}); err != nil {
+		return fmt.Errorf("make / read-only: %w", err)
+	}
+	for _, path := range spec.Writable {
+		if err := unix.MountSetattr(unix.AT_FDCWD, path, 0,
+			&unix.MountAttr{Attr_clr: unix.MOUNT_ATTR_RDONLY}); err != nil {
+			return fmt.Errorf("make %s writable: %w", path, err)
+		}
+	}
+	// The old working directory still refers to the read-only mount
+	if err := os.Chdir(cwd); err != nil {
+		return err
+	}
+	if !spec.Network {
+		// Servers started by tests can still be reached on localhost
+		_ = loopbackUp()
+	}
+
+	// Without capabilities the command cannot undo the mounts
+	if err := unix.Prctl(unix.PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0); err != nil {
+		return fmt.Errorf("set no_new_privs: %w", err)
+	}
+	for c := 0; ; c++ {
+		if err := unix.Prctl(unix.PR_CAPBSET_DROP, uintptr(c), 0, 0, 0); err != nil {
+			if errors.Is(err, unix.EINVAL) {
+				break
+			}
+			return fmt.Errorf("drop capability %d: %w", c, err)
+		}
+	}
+	if err := unix.Prctl(unix.PR_CAP_AMBIENT, unix.PR_CAP_AMBIENT_CLEAR_ALL, 0, 0, 0); err != nil {
+		return fmt.Errorf("clear ambient capabilities: %w", err)
+	}
+	data := [2]unix.CapUserData{}
+	if err := unix.Capset(&unix.CapUserHeader{Version: unix.LINUX_CAPABILITY_VERSION_3}, &data[0]); err != nil {
+		return fmt.Errorf("drop capabilities: %w", err)
+	}
+
+	return syscall.Exec(args[1], args[2:], os.Environ())
+}
+
+// inSandboxNamespace reports whether the process runs in a user namespace
+// created by wrap, which maps a single id.
+func inSandboxNamespace() bool {
+	uidMap, err := os.ReadFile("/proc/self/uid_map")
+	if err != nil {
+		return false
+	}
+	fields := strings.Fields(string(uidMap))
+	return len(fields) == 3 && fields[2] == "1"
+}
+
+// loopbackUp brings up the loopback interface of a new network namespace.
+func loopbackUp() error {
+	fd, err := unix.Socket(unix.AF_INET, unix.SOCK_DGRAM|unix.SOCK_CLOEXEC, 0)
+	if err != nil {
+		return err
+	}
+	defer unix.Close(fd)
+	ifr, err := unix.NewIfreq("lo")
+	if err != nil {
+		return err
+	}
+	if err := unix.IoctlIfreq(fd, unix.SIOCGIFFLAGS, ifr); err != nil {
+		return err
+	}
+	ifr.SetUint16(ifr.Uint16() | unix.IFF_UP)
+	return unix.IoctlIfreq(fd, unix.SIOCSIFFLAGS, ifr)
+}
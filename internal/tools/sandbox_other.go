@@ -0,0 +1,28 @@
+//go:build !linux
+
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+)
+
+var errSandboxUnsupported = errors.New("the sandbox is only supported on Linux")
+
+// wrap fails: the sandbox needs Linux namespaces.
+func (p *SandboxPolicy) wrap(cmd *exec.Cmd) error {
+	return errSandboxUnsupported
+}
+
+// CheckSandbox reports that the sandbox is not supported.
+func CheckSandbox() error {
+	return errSandboxUnsupported
+}
+
+// RunSandboxHelper exits with an error: the sandbox needs Linux namespaces.
+func RunSandboxHelper(args []string) {
+	fmt.Fprintf(os.Stderr, "kimi: %v\n", errSandboxUnsupported)
+	os.Exit(126)
+}
@@ -0,0 +1,109 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// Sandboxed commands start the test binary as the sandbox helper
+	if len(os.Args) > 1 && os.Args[1] == SandboxHelperArg {
+		RunSandboxHelper(os.Args[2:])
+	}
+	os.Exit(m.Run())
+}
+
+// sandboxDirs skips the test when the sandbox is unavailable, and returns a
+// work directory and a directory outside the sandbox's writable paths.
+func sandboxDirs(t *testing.T) (workDir, outside string) {
+	t.Helper()
+	if err := CheckSandbox(); err != nil {
+		t.Skipf("sandbox not available: %v", err)
+	}
+	// The temp directory is writable in the sandbox, so both live elsewhere
+	workDir, outside = t.TempDir(), t.TempDir()
+	t.Setenv("TMPDIR", t.TempDir())
+	return workDir, outside
+}
+
+func TestShellTool_Sandbox(t *testing.T) {
+	workDir, outside := sandboxDirs(t)
+	tool := NewShellTool(workDir, 10*time.Second)
+	tool.SetSandbox(&SandboxPolicy{})
+	run := func(command string) ShellToolResult {
+		t.Helper()
+		args, _ := json.Marshal(ShellToolParams{Command: command})
+		result, err := tool.Execute(context.Background(), args)
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return result.(ShellToolResult)
+	}
+
+	if r := run("echo hi > inside && cat inside && touch \"$TMPDIR/tmp\""); !r.Success || r.Stdout != "hi\n" {
+		t.Errorf("work and temp directories should be writable: %+v", r)
+	}
+
+	// Remounting needs capabilities the sandbox dropped
+	r := run("mount -o remount,rw / 2>/dev/null; touch " + filepath.Join(outside, "escaped"))
+	if r.Success || r.SandboxBlocked != sandboxBlockedWrite {
+		t.Errorf("write outside the work directory should be blocked: %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "escaped")); err == nil {
+		t.Error("file created outside the sandbox")
+	}
+	if !strings.Contains(r.ModelText(), "[sandbox: "+sandboxBlockedWrite+"]") {
+		t.Errorf("model text should report the sandbox: %q", r.ModelText())
+	}
+
+	// Only the loopback interface exists without network access
+	r = run("cat /proc/net/dev")
+	if !strings.Contains(r.Stdout, "lo:") || strings.Count(r.Stdout, ":") != 1 {
+		t.Errorf("expected only the loopback interface:\n%s", r.Stdout)
+	}
+}
+
+func TestShellTool_SandboxPersistent(t *testing.T) {
+	workDir, outside := sandboxDirs(t)
+	tool := NewShellTool(workDir, 10*time.Second)
+	tool.SetPersistent(true)
+	tool.SetSandbox(&SandboxPolicy{WritablePaths: []string{outside}})
+	defer tool.Close()
+
+	result, _ := tool.Execute(context.Background(), []byte(`{"command":"cd `+outside+` && touch allowed && pwd"}`))
+	if r := result.(ShellToolResult); !r.Success || r.Cwd != outside {
+		t.Errorf("extra writable path should be writable: %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "allowed")); err != nil {
+		t.Errorf("file not created: %v", err)
+	}
+	if !strings.Contains(tool.Description(), "sandbox") {
+		t.Error("description should mention the sandbox")
+	}
+}
+
+func TestSandboxBlocked(t *testing.T) {
+	policy := &SandboxPolicy{}
+	tests := []struct {
+		output string
+		want   string
+	}{
+		{"touch: cannot touch '/etc/x': Read-only file system\n", sandboxBlockedWrite},
+		{"curl: (6) Could not resolve host: example.com\n", sandboxBlockedNetwork},
+		{"connect: Network is unreachable\n", sandboxBlockedNetwork},
+		{"ok\n", ""},
+	}
+	for _, tt := range tests {
+		if got := sandboxBlocked(tt.output, policy); got != tt.want {
+			t.Errorf("sandboxBlocked(%q) = %q, want %q", tt.output, got, tt.want)
+		}
+	}
+	if got := sandboxBlocked("Network is unreachable", &SandboxPolicy{Network: true}); got != "" {
+		t.Errorf("network errors are not blocks when network is allowed, got %q", got)
+	}
+}
@@ -0,0 +1,265 @@
+package tools
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxWalkEntries bounds how many files and directories a search visits.
+const maxWalkEntries = 200_000
+
+// errWalkLimit stops a walk that visited maxWalkEntries entries.
+var errWalkLimit = errors.New("too many files")
+
+// errStopWalk lets a walk callback end the walk early without an error.
+var errStopWalk = errors.New("stop walk")
+
+// matchGlob reports whether the slash-separated name matches the glob pattern.
+// Besides path.Match syntax, a "**" segment matches any number of segments.
+func matchGlob(pattern, name string) bool {
+	return matchSegments(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchSegments(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			// Collapse repeated ** and try every split point
+			for len(pattern) > 0 && pattern[0] == "**" {
+				pattern = pattern[1:]
+			}
+			if len(pattern) == 0 {
+				return true
+			}
+			for i := 0; i <= len(name); i++ {
+				if matchSegments(pattern, name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, err := path.Match(pattern[0], name[0]); err != nil || !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// matchFileGlob matches a glob against a file's path relative to the search
+// root. Patterns without a slash match the base name at any depth.
+func matchFileGlob(pattern, rel string) bool {
+	if !strings.Contains(pattern, "/") {
+		return matchGlob(pattern, path.Base(rel))
+	}
+	return matchGlob(strings.TrimPrefix(pattern, "./"), rel)
+}
+
+// ignoreRule is one pattern from a .gitignore file.
+type ignoreRule struct {
+	base    string // Directory of the .gitignore, relative to the repository root
+	pattern string
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher applies .gitignore rules collected while walking down the tree.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// withGitignore returns the matcher extended by the .gitignore in dir, if any.
+// rel is dir relative to the repository root.
+func (m ignoreMatcher) withGitignore(dir, rel string) ignoreMatcher {
+	f, err := os.Open(filepath.Join(dir, ".gitignore"))
+	if err != nil {
+		return m
+	}
+	defer f.Close()
+
+	rules := append([]ignoreRule(nil), m.rules...)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{base: rel}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		line = strings.TrimPrefix(line, "\\")
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		// Patterns with a slash are relative to the .gitignore; others match at any depth
+		if strings.Contains(line, "/") {
+			line = strings.TrimPrefix(line, "/")
+		} else {
+			line = "**/" + line
+		}
+		if line == "" {
+			continue
+		}
+		rule.pattern = line
+		rules = append(rules, rule)
+	}
+	return ignoreMatcher{rules: rules}
+}
+
+// ignored reports whether the entry at rel (relative to the repository root)
+// is ignored. The last matching rule wins.
+func (m ignoreMatcher) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		sub := rel
+		if rule.base != "" {
+			if !strings.HasPrefix(rel, rule.base+"/") {
+				continue
+			}
+			sub = strings.TrimPrefix(rel, rule.base+"/")
+		}
+		if matchGlob(rule.pattern, sub) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// walkFiles calls fn for each file and directory under root in lexical order,
+// skipping .git directories and entries ignored by .gitignore files, including
+// those of parent directories up to the repository root. rel is
+// slash-separated and relative to root. fn may return fs.SkipDir for a
+// directory, or errStopWalk to end the walk.
+func walkFiles(ctx context.Context, root string, fn func(rel string, d fs.DirEntry) error) error {
+	// Ignore rules match paths relative to the repository root
+	m, prefix := parentIgnores(root)
+	join := func(a, b string) string {
+		if a == "" {
+			return b
+		}
+		return a + "/" + b
+	}
+
+	visited := 0
+	var walk func(dir, rel string, m ignoreMatcher) error
+	walk = func(dir, rel string, m ignoreMatcher) error {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		m = m.withGitignore(dir, join(prefix, rel))
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			// Unreadable directories are skipped, like permission errors in grep -r
+			return nil
+		}
+		for _, entry := range entries {
+			name := entry.Name()
+			entryRel := join(rel, name)
+			if entry.IsDir() && name == ".git" {
+				continue
+			}
+			if m.ignored(join(prefix, entryRel), entry.IsDir()) {
+				continue
+			}
+			if visited++; visited > maxWalkEntries {
+				return errWalkLimit
+			}
+
+			err := fn(entryRel, entry)
+			if entry.IsDir() {
+				if err == fs.SkipDir {
+					continue
+				}
+				if err == nil {
+					err = walk(filepath.Join(dir, name), entryRel, m)
+				}
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	err := walk(root, "", m)
+	if err == errStopWalk {
+		return nil
+	}
+	return err
+}
+
+// parentIgnores loads the .gitignore files above root, up to the enclosing
+// repository root. It returns the rules and root relative to the repository
+// root. Outside a repository only root's own .gitignore files apply.
+func parentIgnores(root string) (ignoreMatcher, string) {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return ignoreMatcher{}, ""
+	}
+	var dirs []string // From root upwards, excluding root
+	for dir := abs; ; {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return ignoreMatcher{}, "" // Not in a repository
+		}
+		dir = parent
+		dirs = append(dirs, dir)
+	}
+
+	var m ignoreMatcher
+	prefix := ""
+	for i := len(dirs) - 1; i >= 0; i-- {
+		m = m.withGitignore(dirs[i], prefix)
+		child := abs
+		if i > 0 {
+			child = dirs[i-1]
+		}
+		if prefix == "" {
+			prefix = filepath.Base(child)
+		} else {
+			prefix += "/" + filepath.Base(child)
+		}
+	}
+	return m, prefix
+}
+
+// isBinary reports whether data looks like a binary file.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// displayPath shows abs relative to the work directory when it is inside it.
+func displayPath(workDir, abs string) string {
+	if workDir != "" {
+		if rel, err := filepath.Rel(workDir, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return abs
+}
+
+// joinRoot joins a slash-separated walk path to its root.
+func joinRoot(root, rel string) string {
+	return filepath.Join(root, filepath.FromSlash(rel))
+}
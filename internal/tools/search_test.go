@@ -0,0 +1,154 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// writeTree creates files under dir from a map of slash paths to contents.
+func writeTree(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c.go", true},
+		{"src/**/test_*.py", "src/test_a.py", true},
+		{"src/**/test_*.py", "src/x/y/test_b.py", true},
+		{"src/**/test_*.py", "lib/test_b.py", false},
+		{"a/**", "a/b/c", true},
+		{"a/?.txt", "a/b.txt", true},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestWalkFiles_Gitignore(t *testing.T) {
+	dir := t.TempDir()
+	os.Mkdir(filepath.Join(dir, ".git"), 0755)
+	writeTree(t, dir, map[string]string{
+		".gitignore":           "*.log\nbuild/\n/root-only.txt\n!keep.log\n",
+		"a.go":                 "",
+		"debug.log":            "",
+		"keep.log":             "",
+		"root-only.txt":        "",
+		"build/out.bin":        "",
+		"sub/root-only.txt":    "",
+		"sub/.gitignore":       "local.txt\n",
+		"sub/local.txt":        "",
+		"sub/x.log":            "",
+		"other/local.txt":      "",
+		".git/HEAD":            "",
+		"sub/deeper/ok.txt":    "",
+		"sub/deeper/local.txt": "",
+	})
+
+	var got []string
+	err := walkFiles(context.Background(), dir, func(rel string, d os.DirEntry) error {
+		if !d.IsDir() {
+			got = append(got, rel)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("walk failed: %v", err)
+	}
+	want := []string{".gitignore", "a.go", "keep.log", "other/local.txt", "sub/.gitignore", "sub/deeper/ok.txt", "sub/root-only.txt"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v\nwant %v", got, want)
+	}
+
+	// Rules of parent directories apply when walking a subdirectory
+	got = nil
+	walkFiles(context.Background(), filepath.Join(dir, "sub"), func(rel string, d os.DirEntry) error {
+		got = append(got, rel)
+		return nil
+	})
+	if strings.Contains(strings.Join(got, " "), "x.log") {
+		t.Errorf("parent .gitignore should apply, got %v", got)
+	}
+}
+
+func TestGlobTool_Execute(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"main.go":           "",
+		"cmd/app/main.go":   "",
+		"cmd/app/README.md": "",
+		"internal/x/x.go":   "",
+		"vendor/dep/dep.go": "",
+		".gitignore":        "vendor/\n",
+	})
+
+	gt := NewGlobTool(dir)
+	result, err := gt.Execute(context.Background(), json.RawMessage(`{"pattern": "**/*.go"}`))
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	r := result.(GlobResult)
+	want := []string{"cmd/app/main.go", "internal/x/x.go", "main.go"}
+	if !r.Success || !reflect.DeepEqual(r.Files, want) {
+		t.Errorf("got %+v, want %v", r, want)
+	}
+
+	// Paths stay relative to the working directory when searching a subdirectory
+	result, _ = gt.Execute(context.Background(), json.RawMessage(`{"pattern": "*.md", "path": "cmd"}`))
+	if r := result.(GlobResult); len(r.Files) != 1 || r.Files[0] != "cmd/app/README.md" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+
+	result, _ = gt.Execute(context.Background(), json.RawMessage(`{"pattern": "cmd/*", "include_dirs": true}`))
+	if r := result.(GlobResult); len(r.Files) != 1 || r.Files[0] != "cmd/app" {
+		t.Errorf("expected the cmd/app directory, got %+v", r)
+	}
+}
+
+func TestGlobTool_Truncated(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{}
+	for i := 0; i < maxGlobResults+5; i++ {
+		files[fmt.Sprintf("d/f%04d.txt", i)] = ""
+	}
+	writeTree(t, dir, files)
+
+	result, _ := NewGlobTool(dir).Execute(context.Background(), json.RawMessage(`{"pattern": "**/*.txt"}`))
+	r := result.(GlobResult)
+	if !r.Truncated || len(r.Files) != maxGlobResults || !strings.Contains(r.Note, "truncated") {
+		t.Errorf("expected truncated result, got %d files, note %q", len(r.Files), r.Note)
+	}
+}
+
+func TestGlobTool_InvalidParams(t *testing.T) {
+	gt := NewGlobTool(t.TempDir())
+	if _, err := gt.Execute(context.Background(), json.RawMessage(`{}`)); err == nil {
+		t.Error("expected error without pattern")
+	}
+	result, _ := gt.Execute(context.Background(), json.RawMessage(`{"pattern": "*", "path": "missing"}`))
+	if r := result.(GlobResult); r.Success {
+		t.Error("expected failure for a missing directory")
+	}
+}
@@ -3,22 +3,37 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os/exec"
 	"strings"
+	"sync"
 	"time"
 )
 
+const (
+	shellKillGrace = 2 * time.Second // Time between SIGTERM and SIGKILL on timeout
+	shellPipeDelay = time.Second     // Wait for output after the shell exits
+)
+
 // ShellTool executes shell commands.
 type ShellTool struct {
 	workDir string
 	timeout time.Duration
+
+	// In persistent mode commands share one bash session, started lazily
+	persistent bool
+	mu         sync.Mutex // Serializes commands in the session
+	session    *BashSession
+
+	sandbox *SandboxPolicy // Nil runs commands unrestricted
 }
 
 // ShellToolParams represents parameters for shell tool.
 type ShellToolParams struct {
 	Command string `json:"command"`
 	Timeout int    `json:"timeout,omitempty"`
+	Restart bool   `json:"restart,omitempty"` // Start a fresh persistent shell first
 }
 
 // ShellToolResult represents the result of a shell execution.
@@ -27,7 +42,37 @@ type ShellToolResult struct {
 	Stdout   string `json:"stdout,omitempty"`
 	Stderr   string `json:"stderr,omitempty"`
 	ExitCode int    `json:"exit_code,omitempty"`
+	Cwd      string `json:"cwd,omitempty"` // Working directory of the persistent shell afterwards
 	Error    string `json:"error,omitempty"`
+
+	// SandboxBlocked notes operations of the command the sandbox denied
+	SandboxBlocked string `json:"sandbox_blocked,omitempty"`
+}
+
+// ModelText implements ModelTexter.
+func (r ShellToolResult) ModelText() string {
+	var b strings.Builder
+	b.WriteString(r.Stdout)
+	if r.Stderr != "" {
+		appendLine(&b, "[stderr]")
+		appendLine(&b, r.Stderr)
+	}
+	switch {
+	case r.Error != "":
+		appendLine(&b, "[error: "+r.Error+"]")
+	case r.ExitCode != 0:
+		appendLine(&b, fmt.Sprintf("[exit code %d]", r.ExitCode))
+	}
+	if b.Len() == 0 {
+		b.WriteString("(no output)")
+	}
+	if r.SandboxBlocked != "" {
+		appendLine(&b, "[sandbox: "+r.SandboxBlocked+"]")
+	}
+	if r.Cwd != "" {
+		appendLine(&b, "[cwd: "+r.Cwd+"]")
+	}
+	return b.String()
 }
 
 // NewShellTool creates a new shell tool.
@@ -48,7 +93,17 @@ func (t *ShellTool) Name() string {
 
 // Description returns the tool description.
 func (t *ShellTool) Description() string {
-	return "Execute shell commands. Use this tool to run commands in the shell."
+	desc := "Execute shell commands. Use this tool to run commands in the shell."
+	if t.persistent {
+		desc = "Execute shell commands. Commands run one at a time in a persistent bash session: " +
+			"the working directory, environment variables and shell functions carry over between calls, " +
+			"so cd and export work as in a terminal. Commands cannot read input. " +
+			"On timeout the command is interrupted. Set restart to start a fresh shell if it gets stuck."
+	}
+	if t.sandbox != nil {
+		desc += " " + t.sandbox.describe()
+	}
+	return desc
 }
 
 // Parameters returns the JSON schema for tool parameters.
@@ -65,12 +120,23 @@ func (t *ShellTool) Parameters() json.RawMessage {
 				"description": "Timeout in seconds (default: 60)",
 				"minimum": 1,
 				"maximum": 300
+			},
+			"restart": {
+				"type": "boolean",
+				"description": "Restart the persistent shell before running the command, resetting its working directory and environment"
 			}
 		},
 		"required": ["command"]
 	}`)
 }
 
+// ApprovalAction implements Approvable. Every shell command needs approval.
+func (t *ShellTool) ApprovalAction(args json.RawMessage) (string, string, bool) {
+	var params ShellToolParams
+	_ = json.Unmarshal(args, &params)
+	return "run shell command", fmt.Sprintf("run command `%s`", params.Command), true
+}
+
 // Execute executes the shell tool.
 func (t *ShellTool) Execute(ctx context.Context, args json.RawMessage) (any, error) {
 	var params ShellToolParams
@@ -91,33 +157,171 @@ func (t *ShellTool) Execute(ctx context.Context, args json.RawMessage) (any, err
 	execCtx, cancel := context.WithTimeout(ctx, timeout)
 	defer cancel()
 
-	// Execute command
-	cmd := exec.CommandContext(execCtx, "sh", "-c", params.Command)
+	if t.persistent {
+		return t.executeInSession(ctx, execCtx, params), nil
+	}
+
+	return t.executeOnce(ctx, execCtx, params.Command, timeout), nil
+}
+
+// executeOnce runs a command in a fresh sh process. The command gets a
+// process group of its own; when execCtx ends first the whole group is
+// terminated and the output collected until then is returned. Output is
+// reported to the output function of ctx as it arrives.
+func (t *ShellTool) executeOnce(ctx, execCtx context.Context, command string, timeout time.Duration) ShellToolResult {
+	cmd := exec.Command("sh", "-c", command)
 	if t.workDir != "" {
 		cmd.Dir = t.workDir
 	}
+	SetProcessGroup(cmd)
+	if t.sandbox != nil {
+		if err := t.sandbox.wrap(cmd); err != nil {
+			return ShellToolResult{Success: false, ExitCode: -1, Error: "failed to set up the sandbox: " + err.Error()}
+		}
+	}
+	// Background children that keep the output open do not hold up the result
+	cmd.WaitDelay = shellPipeDelay
+
+	emit := outputFunc(ctx)
+	stdout := &streamWriter{stream: StreamStdout, emit: emit}
+	stderr := &streamWriter{stream: StreamStderr, emit: emit}
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	if err := cmd.Start(); err != nil {
+		return ShellToolResult{Success: false, ExitCode: -1, Error: err.Error()}
+	}
 
-	output, err := cmd.CombinedOutput()
+	var err error
+	done := make(chan struct{})
+	go func() {
+		err = cmd.Wait()
+		close(done)
+	}()
+
+	stopped := false
+	select {
+	case <-done:
+	case <-execCtx.Done():
+		TerminateProcessGroup(cmd, done, shellKillGrace)
+		stopped = true
+	}
+	if errors.Is(err, exec.ErrWaitDelay) {
+		err = nil
+	}
 
 	result := ShellToolResult{
-		Success:  err == nil,
-		Stdout:   string(output),
+		Success:  err == nil && !stopped,
+		Stdout:   stdout.buf.String(),
+		Stderr:   stderr.buf.String(),
 		ExitCode: 0,
 	}
+	var exitErr *exec.ExitError
+	switch {
+	case stopped && ctx.Err() != nil:
+		result.Error = "command was cancelled; its processes were killed"
+		result.ExitCode = -1
+	case stopped:
+		result.Error = fmt.Sprintf("command timed out after %s; its processes were killed", timeout)
+		result.ExitCode = -1
+	case errors.As(err, &exitErr):
+		result.ExitCode = exitErr.ExitCode()
+	case err != nil:
+		result.Error = err.Error()
+		result.ExitCode = -1
+	}
+	if t.sandbox != nil {
+		result.SandboxBlocked = sandboxBlocked(result.Stdout+result.Stderr, t.sandbox)
+	}
+	return result
+}
+
+// executeInSession runs a command in the persistent shell. ctx is the call's
+// context and execCtx adds the timeout.
+func (t *ShellTool) executeInSession(ctx, execCtx context.Context, params ShellToolParams) ShellToolResult {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 
-	if err != nil {
-		if exitErr, ok := err.(*exec.ExitError); ok {
-			result.ExitCode = exitErr.ExitCode()
-			result.Stderr = string(exitErr.Stderr)
-		} else if execCtx.Err() == context.DeadlineExceeded {
-			result.Error = "command timed out"
-			result.ExitCode = -1
-		} else {
-			result.Error = err.Error()
+	if params.Restart && t.session != nil {
+		t.session.Close()
+		t.session = nil
+	}
+	if t.session == nil {
+		session, err := StartBashSession(t.workDir, t.sandbox)
+		if err != nil {
+			return ShellToolResult{Success: false, ExitCode: -1, Error: err.Error()}
 		}
+		t.session = session
+	}
+
+	out, err := t.session.Run(execCtx, params.Command)
+	result := ShellToolResult{
+		Success:  err == nil && out.ExitCode == 0,
+		Stdout:   out.Stdout,
+		Stderr:   out.Stderr,
+		ExitCode: out.ExitCode,
+		Cwd:      out.Cwd,
+	}
+	if t.sandbox != nil {
+		result.SandboxBlocked = sandboxBlocked(out.Stdout+out.Stderr, t.sandbox)
+	}
+	if err == nil {
+		return result
 	}
 
-	return result, nil
+	stopped := "timed out"
+	if ctx.Err() != nil {
+		stopped = "was cancelled"
+	}
+	if err == errShellExited {
+		t.session.Close()
+		t.session = nil
+	}
+	switch {
+	case err == errShellExited && execCtx.Err() != nil:
+		result.Error = fmt.Sprintf("command %s and did not stop when interrupted; "+
+			"the shell was restarted, so its working directory and environment were reset", stopped)
+	case err == errShellExited:
+		result.Error = "the shell exited; the next command starts a new shell"
+	default:
+		result.Error = fmt.Sprintf("command %s and was interrupted", stopped)
+	}
+	return result
+}
+
+// SetPersistent switches between a persistent bash session and a fresh
+// sh process per command.
+func (t *ShellTool) SetPersistent(persistent bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.persistent = persistent
+	if !persistent && t.session != nil {
+		t.session.Close()
+		t.session = nil
+	}
+}
+
+// SetSandbox makes later commands run in the sandbox described by policy;
+// nil turns the sandbox off. A running persistent shell is restarted.
+func (t *ShellTool) SetSandbox(policy *SandboxPolicy) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.sandbox = policy
+	if t.session != nil {
+		t.session.Close()
+		t.session = nil
+	}
+}
+
+// Close stops the persistent shell, if one is running.
+func (t *ShellTool) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.session == nil {
+		return nil
+	}
+	err := t.session.Close()
+	t.session = nil
+	return err
 }
 
 // SetWorkDir sets the working directory for shell commands.
@@ -3,10 +3,28 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
 	"testing"
 	"time"
 )
 
+// processGone waits briefly for the process with the given pid to end.
+// Zombies count as ended, since reaping orphans is up to init.
+func processGone(pid string) bool {
+	for i := 0; i < 40; i++ {
+		out, err := exec.Command("ps", "-o", "stat=", "-p", pid).Output()
+		if err != nil || strings.HasPrefix(strings.TrimSpace(string(out)), "Z") {
+			return true
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	return false
+}
+
 func TestNewShellTool(t *testing.T) {
 	tool := NewShellTool("/tmp", 30*time.Second)
 	if tool == nil {
@@ -197,3 +215,97 @@ func TestShellTool_Execute_InvalidParamsStructure(t *testing.T) {
 	// We just verify it doesn't panic
 	_ = err
 }
+
+func TestShellTool_Execute_TimeoutKillsProcessGroup(t *testing.T) {
+	dir := t.TempDir()
+	tool := NewShellTool(dir, 5*time.Second)
+
+	// The grandchild would outlive a kill of sh alone and keep the output open
+	args := []byte(`{"command":"sleep 30 & echo $! > child.pid; echo partial; sleep 30","timeout":1}`)
+	start := time.Now()
+	result, err := tool.Execute(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	r := result.(ShellToolResult)
+	if elapsed := time.Since(start); elapsed > 4*time.Second {
+		t.Errorf("timeout took %v", elapsed)
+	}
+	if r.Success || r.ExitCode != -1 || !strings.Contains(r.Error, "timed out") {
+		t.Errorf("expected a timeout, got %+v", r)
+	}
+	if r.Stdout != "partial\n" {
+		t.Errorf("partial output should be kept, got %q", r.Stdout)
+	}
+
+	pid, _ := os.ReadFile(filepath.Join(dir, "child.pid"))
+	if p := strings.TrimSpace(string(pid)); p == "" || !processGone(p) {
+		t.Errorf("grandchild %q should be killed", p)
+	}
+}
+
+func TestShellTool_Execute_Cancelled(t *testing.T) {
+	tool := NewShellTool(t.TempDir(), 30*time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+
+	result, _ := tool.Execute(ctx, []byte(`{"command":"sleep 30"}`))
+	if r := result.(ShellToolResult); r.Success || !strings.Contains(r.Error, "cancelled") {
+		t.Errorf("expected a cancelled command, got %+v", r)
+	}
+}
+
+func TestShellTool_Execute_BackgroundChildDoesNotBlock(t *testing.T) {
+	tool := NewShellTool(t.TempDir(), 30*time.Second)
+
+	start := time.Now()
+	result, _ := tool.Execute(context.Background(), []byte(`{"command":"sleep 30 & echo started"}`))
+	r := result.(ShellToolResult)
+	if !r.Success || r.Stdout != "started\n" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("command waited %v for its background child", elapsed)
+	}
+}
+
+func TestShellTool_Execute_ExitCode(t *testing.T) {
+	tool := NewShellTool(t.TempDir(), 5*time.Second)
+	result, _ := tool.Execute(context.Background(), []byte(`{"command":"echo out; echo err >&2; exit 3"}`))
+	r := result.(ShellToolResult)
+	if r.Success || r.ExitCode != 3 || r.Stdout != "out\n" || r.Stderr != "err\n" || r.Error != "" {
+		t.Errorf("unexpected result: %+v", r)
+	}
+}
+
+func TestShellTool_Execute_StreamsOutput(t *testing.T) {
+	tool := NewShellTool(t.TempDir(), 5*time.Second)
+
+	var mu sync.Mutex
+	var chunks []OutputChunk
+	first := make(chan time.Time, 1)
+	ctx := WithOutputFunc(context.Background(), func(c OutputChunk) {
+		mu.Lock()
+		defer mu.Unlock()
+		if len(chunks) == 0 {
+			first <- time.Now()
+		}
+		chunks = append(chunks, c)
+	})
+	result, _ := tool.Execute(ctx, []byte(`{"command":"echo one; sleep 0.3; echo two >&2"}`))
+	finished := time.Now()
+	r := result.(ShellToolResult)
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []OutputChunk{{StreamStdout, "one\n"}, {StreamStderr, "two\n"}}
+	if len(chunks) != 2 || chunks[0] != want[0] || chunks[1] != want[1] {
+		t.Errorf("unexpected chunks: %+v", chunks)
+	}
+	if finished.Sub(<-first) < 200*time.Millisecond {
+		t.Error("output should be reported before the command finishes")
+	}
+	if r.Stdout != "one\n" || r.Stderr != "two\n" {
+		t.Errorf("result should still hold the full output: %+v", r)
+	}
+}
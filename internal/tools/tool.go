@@ -4,7 +4,9 @@ package tools
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 )
 
 // Tool represents a tool that can be called by the agent.
@@ -19,6 +21,14 @@ type Tool interface {
 	Execute(ctx context.Context, args json.RawMessage) (any, error)
 }
 
+// Approvable is implemented by tools whose calls may need user approval.
+// Calls to tools that do not implement it always require approval.
+type Approvable interface {
+	// ApprovalAction returns the action key used for session-wide approval and a
+	// human-readable description of the call. needed is false for read-only calls.
+	ApprovalAction(args json.RawMessage) (action, description string, needed bool)
+}
+
 // ToolSet manages a collection of tools.
 type ToolSet struct {
 	tools map[string]Tool
@@ -59,6 +69,30 @@ func (ts *ToolSet) List() []Tool {
 	return result
 }
 
+// Close releases the resources of tools that hold any, such as a persistent
+// shell. Tools opt in by implementing io.Closer.
+func (ts *ToolSet) Close() error {
+	var errs []error
+	for _, tool := range ts.tools {
+		if c, ok := tool.(io.Closer); ok {
+			if err := c.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("close %s: %w", tool.Name(), err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// SetWorkspacePolicy confines the tools that access files to the workspace
+// described by p. Tools opt in by implementing Confinable.
+func (ts *ToolSet) SetWorkspacePolicy(p *WorkspacePolicy) {
+	for _, tool := range ts.tools {
+		if c, ok := tool.(Confinable); ok {
+			c.SetPolicy(p)
+		}
+	}
+}
+
 // Execute executes a tool by name.
 func (ts *ToolSet) Execute(ctx context.Context, name string, args json.RawMessage) (any, error) {
 	tool, err := ts.Get(name)
@@ -82,12 +116,17 @@ type ToolCall struct {
 	Arguments json.RawMessage `json:"arguments"`
 }
 
-// ToolResult represents a tool result.
+// ToolResult represents a tool result. Result is what the model sees, after
+// output limits were applied; Display is what the user sees when it differs.
 type ToolResult struct {
-	CallID  string `json:"call_id"`
-	Success bool   `json:"success"`
-	Result  string `json:"result,omitempty"`
-	Error   string `json:"error,omitempty"`
+	CallID     string  `json:"call_id"`
+	Success    bool    `json:"success"`
+	Result     string  `json:"result,omitempty"`
+	Display    string  `json:"display,omitempty"`
+	Error      string  `json:"error,omitempty"`
+	Truncated  bool    `json:"truncated,omitempty"`
+	OutputPath string  `json:"output_path,omitempty"` // Full output of a truncated result
+	Images     []Image `json:"-"`                     // Images for the model, sent after the tool results
 }
 
 // GetToolInfo returns tool information for all registered tools.
@@ -0,0 +1,267 @@
+package tools
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// maxSymlinkHops bounds how many dangling symlinks realPath follows.
+const maxSymlinkHops = 40
+
+// WorkspacePolicy confines the paths tools may access. The work directory and
+// ExtraRoots may be read and written, ReadOnlyRoots only read, and paths
+// matching a Deny pattern not accessed at all. Containment is checked after
+// resolving symlinks, so a link inside the workspace cannot lead out of it.
+//
+// A nil policy allows every path.
+type WorkspacePolicy struct {
+	ExtraRoots    []string // Directories accessible besides the work directory; "~/" is expanded
+	ReadOnlyRoots []string // Directories that may be read but not written
+	Deny          []string // Glob patterns of paths relative to a root, e.g. ".env", "*.pem" or ".git/"
+	ReadOnly      bool     // Deny every write
+}
+
+// Access is the kind of access a tool needs to a path.
+type Access int
+
+const (
+	AccessRead  Access = iota // Read a file or list a directory
+	AccessWrite               // Create, change or delete a path
+)
+
+// Reasons for denying access to a path.
+const (
+	deniedOutside  = "outside the workspace"
+	deniedReadOnly = "the workspace is read-only"
+	deniedRoot     = "a workspace root cannot be modified"
+)
+
+// PathDeniedError reports a path the workspace policy does not allow. Tools
+// return it in their results so the model can tell it from other failures.
+type PathDeniedError struct {
+	Path   string `json:"path"`
+	Reason string `json:"reason"`
+}
+
+func (e *PathDeniedError) Error() string {
+	return fmt.Sprintf("access to %s denied: %s", e.Path, e.Reason)
+}
+
+// asDenied returns err as a *PathDeniedError, or nil if it is not one.
+func asDenied(err error) *PathDeniedError {
+	var denied *PathDeniedError
+	if errors.As(err, &denied) {
+		return denied
+	}
+	return nil
+}
+
+// Confinable is implemented by tools that access files and follow a
+// WorkspacePolicy.
+type Confinable interface {
+	SetPolicy(p *WorkspacePolicy)
+}
+
+// workspaceRoot is a directory of the workspace, as given and with its
+// symlinks resolved.
+type workspaceRoot struct {
+	path     string
+	real     string
+	readOnly bool
+}
+
+// Resolve resolves a tool path relative to workDir and checks that the policy
+// allows the access. It returns the absolute path, with symlinks left in
+// place, or a *PathDeniedError.
+func (p *WorkspacePolicy) Resolve(workDir, path string, access Access) (string, error) {
+	resolved := resolveWorkPath(workDir, path)
+	if p == nil {
+		return resolved, nil
+	}
+	abs, err := filepath.Abs(resolved)
+	if err != nil {
+		return "", &PathDeniedError{Path: path, Reason: err.Error()}
+	}
+	real, err := realPath(abs)
+	if err != nil {
+		return "", &PathDeniedError{Path: path, Reason: err.Error()}
+	}
+
+	roots := p.roots(workDir)
+	if len(roots) == 0 {
+		return abs, nil
+	}
+	var root *workspaceRoot
+	for i := range roots {
+		if _, ok := within(roots[i].real, real); ok && (root == nil || len(roots[i].real) > len(root.real)) {
+			root = &roots[i]
+		}
+	}
+	switch {
+	case root == nil:
+		return "", &PathDeniedError{Path: path, Reason: deniedOutside}
+	case access == AccessWrite && p.ReadOnly:
+		return "", &PathDeniedError{Path: path, Reason: deniedReadOnly}
+	case access == AccessWrite && root.readOnly:
+		return "", &PathDeniedError{Path: path, Reason: fmt.Sprintf("%s is read-only", root.path)}
+	case access == AccessWrite && real == root.real:
+		return "", &PathDeniedError{Path: path, Reason: deniedRoot}
+	}
+	if pattern := p.denyPattern(roots, abs, real); pattern != "" {
+		return "", &PathDeniedError{Path: path, Reason: fmt.Sprintf("matches the deny pattern %q", pattern)}
+	}
+	return abs, nil
+}
+
+// allowsWalked reports whether an entry found while walking a directory that
+// passed Resolve may be read. Symlinks get a full check; other entries are
+// inside the directory, so only the deny patterns apply.
+func (p *WorkspacePolicy) allowsWalked(workDir, path string, d fs.DirEntry) bool {
+	if p == nil {
+		return true
+	}
+	if d.Type()&fs.ModeSymlink != 0 {
+		_, err := p.Resolve(workDir, path, AccessRead)
+		return err == nil
+	}
+	return p.denyPattern(p.roots(workDir), path, path) == ""
+}
+
+// roots returns the directories of the workspace. There are none, and every
+// path is allowed, when neither a work directory nor other roots are set.
+func (p *WorkspacePolicy) roots(workDir string) []workspaceRoot {
+	var roots []workspaceRoot
+	add := func(dir string, readOnly bool) {
+		dir, err := expandHome(dir)
+		if err != nil {
+			return
+		}
+		abs, err := filepath.Abs(resolveWorkPath(workDir, dir))
+		if err != nil {
+			return
+		}
+		real, err := realPath(abs)
+		if err != nil {
+			return
+		}
+		roots = append(roots, workspaceRoot{path: abs, real: real, readOnly: readOnly})
+	}
+	if workDir != "" {
+		add(workDir, false)
+	}
+	for _, dir := range p.ExtraRoots {
+		add(dir, false)
+	}
+	for _, dir := range p.ReadOnlyRoots {
+		add(dir, true)
+	}
+	return roots
+}
+
+// denyPattern returns the first deny pattern matching the path, relative to
+// any root containing it either as given (abs) or with symlinks resolved
+// (real), or "" if none does.
+func (p *WorkspacePolicy) denyPattern(roots []workspaceRoot, abs, real string) string {
+	if len(p.Deny) == 0 {
+		return ""
+	}
+	for _, root := range roots {
+		for _, candidate := range [][2]string{{root.path, abs}, {root.real, real}} {
+			if rel, ok := within(candidate[0], candidate[1]); ok {
+				if pattern := matchDeny(p.Deny, rel); pattern != "" {
+					return pattern
+				}
+			}
+		}
+	}
+	return ""
+}
+
+// matchDeny returns the first pattern matching the slash-separated relative
+// path rel or one of its parent directories. A pattern without a slash
+// matches a name at any depth; a trailing slash is ignored.
+func matchDeny(patterns []string, rel string) string {
+	if rel == "." {
+		return ""
+	}
+	parts := strings.Split(rel, "/")
+	for _, pattern := range patterns {
+		pat := strings.TrimPrefix(strings.TrimSuffix(pattern, "/"), "./")
+		if pat == "" {
+			continue
+		}
+		if !strings.Contains(pat, "/") {
+			for _, part := range parts {
+				if ok, _ := path.Match(pat, part); ok {
+					return pattern
+				}
+			}
+			continue
+		}
+		pat = strings.TrimPrefix(pat, "/")
+		for i := 1; i <= len(parts); i++ {
+			if matchGlob(pat, strings.Join(parts[:i], "/")) {
+				return pattern
+			}
+		}
+	}
+	return ""
+}
+
+// within returns path relative to root, slash-separated, if it is root or
+// inside it.
+func within(root, path string) (string, bool) {
+	rel, err := filepath.Rel(root, path)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// realPath resolves the symlinks of an absolute, clean path that need not
+// exist: its longest existing prefix is resolved and the rest appended.
+// Dangling symlinks are followed to where writing through them would create
+// a file.
+func realPath(path string) (string, error) {
+	var rest []string
+	hops := 0
+	for p := path; ; {
+		if real, err := filepath.EvalSymlinks(p); err == nil {
+			return filepath.Join(append([]string{real}, rest...)...), nil
+		}
+		if target, err := os.Readlink(p); err == nil {
+			if hops++; hops > maxSymlinkHops {
+				return "", fmt.Errorf("too many levels of symbolic links in %s", path)
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(p), target)
+			}
+			p = filepath.Clean(target)
+			continue
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return filepath.Join(append([]string{p}, rest...)...), nil
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
+// expandHome expands a leading "~/" to the user's home directory.
+func expandHome(path string) (string, error) {
+	rest, ok := strings.CutPrefix(path, "~/")
+	if !ok {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, rest), nil
+}
@@ -0,0 +1,201 @@
+package tools
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// newWorkspace creates a work directory holding a.txt, .env and .git/config,
+// and a directory outside it holding secret.txt.
+func newWorkspace(t *testing.T) (workDir, outside string) {
+	t.Helper()
+	workDir, outside = t.TempDir(), t.TempDir()
+	for path, content := range map[string]string{
+		filepath.Join(workDir, "a.txt"):       "hello\n",
+		filepath.Join(workDir, ".env"):        "TOKEN=x\n",
+		filepath.Join(workDir, ".git/config"): "[core]\n",
+		filepath.Join(outside, "secret.txt"):  "secret\n",
+	} {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return workDir, outside
+}
+
+func TestWorkspacePolicy_Resolve(t *testing.T) {
+	workDir, outside := newWorkspace(t)
+	extra := t.TempDir()
+	if err := os.Symlink(outside, filepath.Join(workDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(outside, "new.txt"), filepath.Join(workDir, "dangling")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(".env", filepath.Join(workDir, "config")); err != nil {
+		t.Fatal(err)
+	}
+	policy := &WorkspacePolicy{
+		ExtraRoots:    []string{extra},
+		ReadOnlyRoots: []string{outside},
+		Deny:          []string{".env", "*.pem", ".git/", "build/**/*.log"},
+	}
+
+	tests := []struct {
+		path   string
+		access Access
+		reason string // "" when allowed
+	}{
+		{"a.txt", AccessRead, ""},
+		{"a.txt", AccessWrite, ""},
+		{"new/dir/file.go", AccessWrite, ""},
+		{filepath.Join(extra, "notes.md"), AccessWrite, ""},
+		{filepath.Join(outside, "secret.txt"), AccessRead, ""},
+		{filepath.Join(outside, "secret.txt"), AccessWrite, "is read-only"},
+		{"escape/secret.txt", AccessWrite, "is read-only"},
+		{"dangling", AccessWrite, "is read-only"},
+		{"../" + filepath.Base(t.TempDir()), AccessRead, deniedOutside},
+		{"/", AccessRead, deniedOutside},
+		{".", AccessWrite, deniedRoot},
+		{".", AccessRead, ""},
+		{".env", AccessRead, `deny pattern ".env"`},
+		{"sub/.env", AccessRead, `deny pattern ".env"`},
+		{"config", AccessRead, `deny pattern ".env"`},
+		{"certs/server.pem", AccessWrite, `deny pattern "*.pem"`},
+		{".git/config", AccessRead, `deny pattern ".git/"`},
+		{"build/x/y/out.log", AccessRead, `deny pattern "build/**/*.log"`},
+		{"build/out.txt", AccessRead, ""},
+	}
+	for _, tt := range tests {
+		_, err := policy.Resolve(workDir, tt.path, tt.access)
+		switch {
+		case tt.reason == "" && err != nil:
+			t.Errorf("Resolve(%q, %d): unexpected error %v", tt.path, tt.access, err)
+		case tt.reason != "" && (err == nil || !strings.Contains(err.Error(), tt.reason)):
+			t.Errorf("Resolve(%q, %d) = %v, want an error containing %q", tt.path, tt.access, err, tt.reason)
+		case err != nil && asDenied(err) == nil:
+			t.Errorf("Resolve(%q, %d) returned %T, want *PathDeniedError", tt.path, tt.access, err)
+		}
+	}
+
+	if _, err := (&WorkspacePolicy{ReadOnly: true}).Resolve(workDir, "a.txt", AccessWrite); err == nil {
+		t.Error("writes should be denied in read-only mode")
+	}
+	if path, err := (*WorkspacePolicy)(nil).Resolve(workDir, "/etc/passwd", AccessWrite); err != nil || path != "/etc/passwd" {
+		t.Errorf("a nil policy should allow every path, got %q, %v", path, err)
+	}
+}
+
+func TestFileTool_Policy(t *testing.T) {
+	workDir, outside := newWorkspace(t)
+	ft := NewFileTool(workDir)
+	ft.SetPolicy(&WorkspacePolicy{Deny: []string{".env", ".git/"}})
+	run := func(args string) FileResult {
+		t.Helper()
+		result, err := ft.Execute(context.Background(), json.RawMessage(args))
+		if err != nil {
+			t.Fatalf("Execute failed: %v", err)
+		}
+		return result.(FileResult)
+	}
+
+	r := run(`{"operation": "read", "path": "` + filepath.Join(outside, "secret.txt") + `"}`)
+	if r.Success || r.Denied == nil || r.Denied.Reason != deniedOutside {
+		t.Errorf("reading outside the workspace should be denied: %+v", r)
+	}
+	r = run(`{"operation": "delete", "path": ".."}`)
+	if r.Success || r.Denied == nil {
+		t.Errorf("deleting the parent directory should be denied: %+v", r)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "secret.txt")); err != nil {
+		t.Errorf("file outside the workspace is gone: %v", err)
+	}
+	r = run(`{"operation": "delete", "path": "."}`)
+	if r.Success || r.Denied == nil || r.Denied.Reason != deniedRoot {
+		t.Errorf("deleting the work directory should be denied: %+v", r)
+	}
+
+	r = run(`{"operation": "list", "path": "."}`)
+	if !r.Success || len(r.Files) != 1 || r.Files[0].Name != "a.txt" {
+		t.Errorf("listing should leave out denied entries: %+v", r.Files)
+	}
+	data, _ := json.Marshal(run(`{"operation": "read", "path": ".env"}`))
+	if !strings.Contains(string(data), `"denied":{"path":".env","reason":"matches the deny pattern \".env\""}`) {
+		t.Errorf("denial should be structured: %s", data)
+	}
+}
+
+func TestSearchTools_Policy(t *testing.T) {
+	workDir, outside := newWorkspace(t)
+	if err := os.WriteFile(filepath.Join(workDir, "b.txt"), []byte("TOKEN\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(workDir, "escape")); err != nil {
+		t.Fatal(err)
+	}
+	policy := &WorkspacePolicy{Deny: []string{".env"}}
+	ctx := context.Background()
+
+	glob := NewGlobTool(workDir)
+	glob.SetPolicy(policy)
+	result, _ := glob.Execute(ctx, json.RawMessage(`{"pattern": "*", "include_dirs": true}`))
+	if r := result.(GlobResult); strings.Join(r.Files, ",") != "a.txt,b.txt" {
+		t.Errorf("glob should skip denied files and links out of the workspace: %v", r.Files)
+	}
+	result, _ = glob.Execute(ctx, json.RawMessage(`{"pattern": "*", "path": "escape"}`))
+	if r := result.(GlobResult); r.Success || r.Denied == nil {
+		t.Errorf("glob outside the workspace should be denied: %+v", r)
+	}
+
+	grep := NewGrepTool(workDir)
+	grep.SetPolicy(policy)
+	result, _ = grep.Execute(ctx, json.RawMessage(`{"pattern": "TOKEN", "output_mode": "files_with_matches"}`))
+	if r := result.(GrepResult); r.Content != "b.txt" {
+		t.Errorf("grep should skip denied files: %+v", r)
+	}
+	result, _ = grep.Execute(ctx, json.RawMessage(`{"pattern": "secret", "path": "escape/secret.txt"}`))
+	if r := result.(GrepResult); r.Success || r.Denied == nil {
+		t.Errorf("grep through a link out of the workspace should be denied: %+v", r)
+	}
+}
+
+func TestPatchTool_Policy(t *testing.T) {
+	workDir, outside := newWorkspace(t)
+	tool := NewPatchTool(workDir)
+	tool.SetPolicy(&WorkspacePolicy{})
+
+	target := filepath.Join(outside, "secret.txt")
+	patch := "--- a/a.txt\n+++ b/a.txt\n@@ -1 +1 @@\n-hello\n+bye\n" +
+		"--- " + target + "\n+++ " + target + "\n@@ -1 +1 @@\n-secret\n+leaked\n"
+	args, _ := json.Marshal(map[string]string{"patch": patch})
+	result, err := tool.Execute(context.Background(), args)
+	if err != nil {
+		t.Fatalf("Execute failed: %v", err)
+	}
+	if r := result.(PatchResult); r.Success || r.Denied == nil || r.Denied.Path != target {
+		t.Errorf("patching outside the workspace should be denied: %+v", r)
+	}
+	if data, _ := os.ReadFile(filepath.Join(workDir, "a.txt")); string(data) != "hello\n" {
+		t.Errorf("no file should change, a.txt is %q", data)
+	}
+}
+
+func TestToolSet_SetWorkspacePolicy(t *testing.T) {
+	ft := NewFileTool(t.TempDir())
+	ts := NewToolSet()
+	_ = ts.Register(ft)
+	_ = ts.Register(NewShellTool("", 0))
+
+	policy := &WorkspacePolicy{ReadOnly: true}
+	ts.SetWorkspacePolicy(policy)
+	if ft.policy != policy {
+		t.Error("the file tool should follow the policy")
+	}
+}
@@ -21,6 +21,11 @@ type SoulToolResultMsg struct {
 	ToolResult tools.ToolResult
 }
 
+// ProcessesMsg carries the background processes after one started or exited.
+type ProcessesMsg struct {
+	Processes []tools.ProcessInfo
+}
+
 // SoulErrorMsg carries an error from Soul's OnError callback.
 type SoulErrorMsg struct {
 	Err error
@@ -10,6 +10,7 @@ import (
 	tea "github.com/charmbracelet/bubbletea"
 
 	"kimi-go/internal/soul"
+	"kimi-go/internal/tools"
 	"kimi-go/internal/wire"
 )
 
@@ -33,6 +34,15 @@ type Model struct {
 	// Streaming state
 	streaming      bool
 	streamingIndex int // Index of the message being streamed
+
+	// Approval state
+	approval  *wire.ApprovalRequest // Pending approval request, if any
+	rejecting bool                  // Typing a reason for rejecting the request
+
+	processes   []tools.ProcessInfo // Background processes, shown in the header
+	live        []liveOutput        // Output of running tool calls
+	attachments []wire.ContentPart  // Images attached to the next message
+	status      string              // Retry notice shown instead of "Thinking..."
 }
 
 // NewModel creates a new TUI model.
@@ -106,10 +116,13 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.textarea.SetWidth(msg.Width - 2)
 
 		// Re-render conversation for new width
-		m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+		m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 		m.viewport.GotoBottom()
 
 	case tea.KeyMsg:
+		if msg.Type != tea.KeyCtrlC && m.approval != nil {
+			return m.handleApprovalKey(msg)
+		}
 		switch msg.Type {
 		case tea.KeyCtrlC:
 			m.quitting = true
@@ -127,12 +140,24 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				m.quitting = true
 				return m, tea.Quit
 			}
+			if strings.HasPrefix(text, "/rewind") {
+				return m.handleRewindCommand(text)
+			}
+			if strings.HasPrefix(text, soul.ImageCommand) {
+				return m.handleImageCommand(text)
+			}
+			if text == "/undo" {
+				m.textarea.Reset()
+				m.loading = true
+				m.textarea.Blur()
+				return m, sendUndoToSoul(m.soul)
+			}
 			// Add user message to display
 			m.messages = append(m.messages, chatMsg{
 				Role:    string(wire.MessageTypeUserInput),
-				Content: text,
+				Content: withImageLabels(text, m.attachments),
 			})
-			m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+			m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 			m.viewport.GotoBottom()
 
 			// Clear input
@@ -140,27 +165,66 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			m.loading = true
 			m.textarea.Blur()
 
-			// Send to Soul asynchronously
-			cmds = append(cmds, sendToSoul(m.soul, text))
+			// Send to Soul asynchronously, with the attached images
+			cmds = append(cmds, sendToSoul(m.soul, text, m.attachments))
+			m.attachments = nil
 			return m, tea.Batch(cmds...)
 		}
 
 	case SoulMessageMsg:
+		// A retry notice replaces the spinner text until the next message
+		if msg.Message.Type == wire.MessageTypeStatus {
+			m.status = newChatMsgFromWire(msg.Message).Content
+			cmds = append(cmds, waitForSoulEvent(m.eventCh))
+			break
+		}
+		m.status = ""
+
+		// Output of running tools is shown until their results arrive
+		if out, ok := msg.Message.ToolOutput(); ok {
+			m.live = appendLiveOutput(m.live, out.ToolCallID, out.Text)
+			m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
+			m.viewport.GotoBottom()
+			cmds = append(cmds, waitForSoulEvent(m.eventCh))
+			break
+		}
+
+		// Wait for the user's answer before the tool call runs
+		if req, ok := msg.Message.ApprovalRequest(); ok {
+			m.approval = &req
+		}
+
+		// After a rewind the conversation is reloaded from the soul's context
+		if msg.Message.Type == wire.MessageTypeRewind {
+			m.messages = chatMsgsFromContext(m.soul.Context.GetMessages())
+			m.streaming = false
+			m.streamingIndex = -1
+			m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
+			m.viewport.GotoBottom()
+			cmds = append(cmds, waitForSoulEvent(m.eventCh))
+			break
+		}
+
 		// Check if this is a streaming update (assistant message with existing content)
 		newMsg := newChatMsgFromWire(msg.Message)
-		if newMsg.Role == string(wire.MessageTypeAssistant) && m.streaming && m.streamingIndex >= 0 {
-			// Update existing streaming message
+		isAssistant := newMsg.Role == string(wire.MessageTypeAssistant)
+		if isAssistant && m.streaming && m.streamingIndex >= 0 {
+			// Update existing streaming message; a final message ends the stream
 			m.messages[m.streamingIndex] = newMsg
+			if !msg.Message.IsStreaming() {
+				m.streaming = false
+				m.streamingIndex = -1
+			}
 		} else {
 			// New message
 			m.messages = append(m.messages, newMsg)
-			// If it's an assistant message and we're loading, mark as streaming
-			if newMsg.Role == string(wire.MessageTypeAssistant) && m.loading {
+			// Streaming updates for this message will replace it in place
+			if isAssistant && msg.Message.IsStreaming() {
 				m.streaming = true
 				m.streamingIndex = len(m.messages) - 1
 			}
 		}
-		m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+		m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 		m.viewport.GotoBottom()
 		cmds = append(cmds, waitForSoulEvent(m.eventCh))
 
@@ -169,7 +233,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Role:    string(wire.MessageTypeToolCall),
 			Content: fmt.Sprintf("Calling %s: %s", msg.ToolCall.Name, string(msg.ToolCall.Arguments)),
 		})
-		m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+		m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 		m.viewport.GotoBottom()
 		cmds = append(cmds, waitForSoulEvent(m.eventCh))
 
@@ -177,29 +241,43 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		content := msg.ToolResult.Result
 		if !msg.ToolResult.Success {
 			content = "Error: " + msg.ToolResult.Error
+		} else if msg.ToolResult.Display != "" {
+			content = msg.ToolResult.Display
 		}
 		m.messages = append(m.messages, chatMsg{
 			Role:    string(wire.MessageTypeToolResult),
 			Content: content,
 		})
-		m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+		m.live = removeLiveOutput(m.live, msg.ToolResult.CallID)
+		m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 		m.viewport.GotoBottom()
 		cmds = append(cmds, waitForSoulEvent(m.eventCh))
 
+	case ProcessesMsg:
+		m.processes = msg.Processes
+		cmds = append(cmds, waitForSoulEvent(m.eventCh))
+
 	case SoulErrorMsg:
 		m.messages = append(m.messages, chatMsg{
 			Role:    string(wire.MessageTypeError),
 			Content: msg.Err.Error(),
 		})
+		m.live = nil
+		m.status = ""
 		m.loading = false
 		m.streaming = false
 		m.streamingIndex = -1
 		m.textarea.Focus()
-		m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+		m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 		m.viewport.GotoBottom()
 		cmds = append(cmds, waitForSoulEvent(m.eventCh))
 
 	case SoulDoneMsg:
+		if m.live != nil {
+			m.live = nil
+			m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
+		}
+		m.status = ""
 		m.loading = false
 		m.streaming = false
 		m.streamingIndex = -1
@@ -211,11 +289,12 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 			Role:    string(wire.MessageTypeError),
 			Content: msg.err.Error(),
 		})
+		m.status = ""
 		m.loading = false
 		m.streaming = false
 		m.streamingIndex = -1
 		m.textarea.Focus()
-		m.viewport.SetContent(renderConversation(m.messages, m.mdRenderer))
+		m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
 		m.viewport.GotoBottom()
 
 	case spinner.TickMsg:
@@ -225,7 +304,7 @@ func (m Model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 	}
 
 	// Update textarea (for non-enter keys)
-	if !m.loading {
+	if !m.loading || m.rejecting {
 		var taCmd tea.Cmd
 		m.textarea, taCmd = m.textarea.Update(msg)
 		cmds = append(cmds, taCmd)
@@ -250,14 +329,24 @@ func (m Model) View() string {
 
 	// Header
 	header := appTitleStyle.Render(" Kimi-Go ")
+	if status := processStatus(m.processes, m.width-10); status != "" {
+		header += " " + processStyle.Render(status)
+	}
 
 	// Divider
 	divider := dividerStyle.Render(strings.Repeat("─", m.width))
 
 	// Input area or spinner
 	var inputArea string
-	if m.loading {
-		if m.streaming {
+	if m.rejecting {
+		inputArea = m.textarea.View()
+	} else if m.approval != nil {
+		inputArea = approvalStyle.Render(fmt.Sprintf("  Allow %s to %s?", m.approval.ToolName, m.approval.Description)) +
+			"\n" + helpStyle.Render("  [y] approve once  [a] approve for this session  [n] reject")
+	} else if m.loading {
+		if m.status != "" {
+			inputArea = fmt.Sprintf("  %s %s", m.spinner.View(), processStyle.Render(m.status))
+		} else if m.streaming {
 			inputArea = fmt.Sprintf("  %s Receiving...", m.spinner.View())
 		} else {
 			inputArea = fmt.Sprintf("  %s Thinking...", m.spinner.View())
@@ -267,7 +356,11 @@ func (m Model) View() string {
 	}
 
 	// Footer help
-	footer := helpStyle.Render("  Enter: send | Alt+Enter: newline | Ctrl+C: quit")
+	help := "  Enter: send | Alt+Enter: newline | /rewind: checkpoints | /undo: revert files | /image: attach | Ctrl+C: quit"
+	if m.rejecting {
+		help = "  Enter: reject with reason | Esc: reject without reason | Ctrl+C: quit"
+	}
+	footer := helpStyle.Render(help)
 
 	return fmt.Sprintf(
 		"%s\n%s\n%s\n%s\n%s",
@@ -279,6 +372,94 @@ func (m Model) View() string {
 	)
 }
 
+// handleRewindCommand lists checkpoints or asks Soul to rewind to one.
+func (m Model) handleRewindCommand(text string) (tea.Model, tea.Cmd) {
+	m.textarea.Reset()
+
+	req, list, err := soul.ParseRewindCommand(text)
+	var notice chatMsg
+	switch {
+	case err != nil:
+		notice = chatMsg{Role: string(wire.MessageTypeError), Content: err.Error()}
+	case list:
+		notice = chatMsg{Role: string(wire.MessageTypeSystem), Content: soul.FormatCheckpoints(m.soul.Checkpoints())}
+	default:
+		m.loading = true
+		m.textarea.Blur()
+		return m, sendRewindToSoul(m.soul, req)
+	}
+
+	m.messages = append(m.messages, notice)
+	m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleImageCommand attaches an image to the next message.
+func (m Model) handleImageCommand(text string) (tea.Model, tea.Cmd) {
+	m.textarea.Reset()
+
+	var notice chatMsg
+	img, err := soul.ParseImageCommand(text, m.soul.Agent.Runtime.WorkDir)
+	if err != nil {
+		notice = chatMsg{Role: string(wire.MessageTypeError), Content: err.Error()}
+	} else {
+		m.attachments = append(m.attachments, img)
+		notice = chatMsg{Role: string(wire.MessageTypeSystem), Content: "Attached " + img.Text + "; it is sent with your next message."}
+	}
+
+	m.messages = append(m.messages, notice)
+	m.viewport.SetContent(renderConversation(m.messages, m.live, m.mdRenderer))
+	m.viewport.GotoBottom()
+	return m, nil
+}
+
+// handleApprovalKey answers the pending approval request.
+func (m Model) handleApprovalKey(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.rejecting {
+		switch msg.Type {
+		case tea.KeyEnter:
+			return m.answerApproval(wire.ApprovalReject, strings.TrimSpace(m.textarea.Value()))
+		case tea.KeyEsc:
+			return m.answerApproval(wire.ApprovalReject, "")
+		}
+		var cmd tea.Cmd
+		m.textarea, cmd = m.textarea.Update(msg)
+		return m, cmd
+	}
+
+	switch strings.ToLower(msg.String()) {
+	case "y":
+		return m.answerApproval(wire.ApprovalApprove, "")
+	case "a":
+		return m.answerApproval(wire.ApprovalApproveForSession, "")
+	case "n":
+		// Ask for an optional reason that is passed back to the LLM
+		m.rejecting = true
+		m.textarea.Reset()
+		m.textarea.Placeholder = "Why reject? (optional)"
+		m.textarea.Focus()
+	}
+	return m, nil
+}
+
+// answerApproval clears the pending approval and sends the decision to Soul.
+func (m Model) answerApproval(decision wire.ApprovalDecision, reason string) (tea.Model, tea.Cmd) {
+	resp := wire.ApprovalResponse{
+		RequestID: m.approval.ID,
+		Decision:  decision,
+		Reason:    reason,
+	}
+	m.approval = nil
+	if m.rejecting {
+		m.rejecting = false
+		m.textarea.Reset()
+		m.textarea.Placeholder = "Type a message..."
+		m.textarea.Blur()
+	}
+	return m, resolveApproval(m.soul, resp)
+}
+
 // waitForSoulEvent returns a command that waits for the next Soul event.
 func waitForSoulEvent(ch <-chan tea.Msg) tea.Cmd {
 	return func() tea.Msg {
@@ -290,13 +471,43 @@ func waitForSoulEvent(ch <-chan tea.Msg) tea.Cmd {
 	}
 }
 
-// sendToSoul sends a user message to Soul asynchronously.
-func sendToSoul(s *soul.Soul, text string) tea.Cmd {
+// sendToSoul sends a user message with its attached images to Soul asynchronously.
+func sendToSoul(s *soul.Soul, text string, images []wire.ContentPart) tea.Cmd {
 	return func() tea.Msg {
-		msg := wire.NewTextMessage(wire.MessageTypeUserInput, text)
+		msg := wire.NewUserInputMessage(text, images...)
 		if err := s.SendMessage(*msg); err != nil {
 			return errMsg{err: err}
 		}
 		return nil
 	}
 }
+
+// resolveApproval sends an approval decision to Soul asynchronously.
+func resolveApproval(s *soul.Soul, resp wire.ApprovalResponse) tea.Cmd {
+	return func() tea.Msg {
+		if err := s.ResolveApproval(resp); err != nil {
+			return errMsg{err: err}
+		}
+		return nil
+	}
+}
+
+// sendUndoToSoul asks Soul to revert the file changes of the last turn that ran tools.
+func sendUndoToSoul(s *soul.Soul) tea.Cmd {
+	return func() tea.Msg {
+		if err := s.SendMessage(*wire.NewUndoMessage(wire.UndoRequest{})); err != nil {
+			return errMsg{err: err}
+		}
+		return nil
+	}
+}
+
+// sendRewindToSoul sends a rewind request to Soul asynchronously.
+func sendRewindToSoul(s *soul.Soul, req wire.RewindRequest) tea.Cmd {
+	return func() tea.Msg {
+		if err := s.SendMessage(*wire.NewRewindMessage(req)); err != nil {
+			return errMsg{err: err}
+		}
+		return nil
+	}
+}
@@ -1,11 +1,13 @@
 package ui
 
 import (
+	"fmt"
 	"strings"
 	"time"
 
 	"github.com/charmbracelet/glamour"
 
+	"kimi-go/internal/tools"
 	"kimi-go/internal/wire"
 )
 
@@ -25,6 +27,9 @@ func newChatMsgFromWire(msg wire.Message) chatMsg {
 			break
 		}
 	}
+	if msg.Type == wire.MessageTypeUserInput {
+		content = withImageLabels(content, msg.Images())
+	}
 	return chatMsg{
 		Role:    string(msg.Type),
 		Content: content,
@@ -32,6 +37,23 @@ func newChatMsgFromWire(msg wire.Message) chatMsg {
 	}
 }
 
+// withImageLabels appends a line per attached image to the text of a user message.
+func withImageLabels(text string, images []wire.ContentPart) string {
+	for _, img := range images {
+		text += "\n[image: " + img.Text + "]"
+	}
+	return text
+}
+
+// chatMsgsFromContext converts the messages of a soul context for display.
+func chatMsgsFromContext(msgs []wire.Message) []chatMsg {
+	result := make([]chatMsg, 0, len(msgs))
+	for _, msg := range msgs {
+		result = append(result, newChatMsgFromWire(msg))
+	}
+	return result
+}
+
 // markdownRenderer wraps glamour for terminal markdown rendering.
 type markdownRenderer struct {
 	renderer *glamour.TermRenderer
@@ -88,22 +110,78 @@ func renderMessage(msg chatMsg, md *markdownRenderer) string {
 		return toolCallStyle.Render(">> " + msg.Content)
 
 	case string(wire.MessageTypeToolResult):
-		content := msg.Content
+		content := strings.TrimRight(msg.Content, "\n")
+		diff := isDiff(content)
 		if len(content) > maxToolResultLen {
 			content = content[:maxToolResultLen] + "\n... (truncated)"
 		}
+		if diff {
+			content = renderDiff(content)
+		}
 		return toolResultBorderStyle.Render(content)
 
 	case string(wire.MessageTypeError):
 		return errorStyle.Render("Error: " + msg.Content)
 
+	case string(wire.MessageTypeCompaction), string(wire.MessageTypeRewind), string(wire.MessageTypeUndo), string(wire.MessageTypeSystem):
+		return systemStyle.Render("~ " + msg.Content)
+
+	case string(wire.MessageTypeApprovalRequest):
+		return approvalStyle.Render("? " + msg.Content)
+
+	case string(wire.MessageTypeApprovalResponse):
+		return systemStyle.Render("~ " + msg.Content)
+
 	default:
 		return msg.Content
 	}
 }
 
+// isDiff reports whether a tool result shows a unified diff, such as the
+// display of a file edit.
+func isDiff(result string) bool {
+	return strings.HasPrefix(result, "--- ") && strings.Contains(result, "\n+++ ")
+}
+
+// renderDiff colors the lines of a unified diff.
+func renderDiff(diff string) string {
+	lines := strings.Split(diff, "\n")
+	for i, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "+++"), strings.HasPrefix(line, "---"):
+			lines[i] = helpStyle.Render(line)
+		case strings.HasPrefix(line, "@@"):
+			lines[i] = diffHunkStyle.Render(line)
+		case strings.HasPrefix(line, "+"):
+			lines[i] = diffAddStyle.Render(line)
+		case strings.HasPrefix(line, "-"):
+			lines[i] = diffRemoveStyle.Render(line)
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// processStatus summarizes the running background processes in at most width
+// characters.
+func processStatus(procs []tools.ProcessInfo, width int) string {
+	var running []string
+	for _, p := range procs {
+		if p.Running {
+			running = append(running, p.ID+": "+p.Command)
+		}
+	}
+	if len(running) == 0 || width <= 0 {
+		return ""
+	}
+	status := fmt.Sprintf("[%d running] %s", len(running), strings.Join(running, " · "))
+	if r := []rune(status); len(r) > width {
+		status = string(r[:max(width-1, 0)]) + "…"
+	}
+	return status
+}
+
 // renderConversation renders all messages into a single string.
-func renderConversation(msgs []chatMsg, md *markdownRenderer) string {
+func renderConversation(msgs []chatMsg, live []liveOutput, md *markdownRenderer) string {
 	if len(msgs) == 0 {
 		return helpStyle.Render("  Type a message and press Enter to start chatting.")
 	}
@@ -114,5 +192,61 @@ func renderConversation(msgs []chatMsg, md *markdownRenderer) string {
 		}
 		b.WriteString(renderMessage(msg, md))
 	}
+	for _, out := range live {
+		b.WriteString("\n\n")
+		b.WriteString(renderLiveOutput(out))
+	}
 	return b.String()
 }
+
+// liveOutput is the output of a tool call that is still running.
+type liveOutput struct {
+	callID string
+	text   string
+}
+
+// Live output keeps at most maxLiveOutputLen bytes and shows the last
+// maxLiveOutputLines lines.
+const (
+	maxLiveOutputLen   = 16 * 1024
+	maxLiveOutputLines = 12
+)
+
+// appendLiveOutput adds text to the live output of a tool call.
+func appendLiveOutput(live []liveOutput, callID, text string) []liveOutput {
+	i := 0
+	for i < len(live) && live[i].callID != callID {
+		i++
+	}
+	if i == len(live) {
+		live = append(live, liveOutput{callID: callID})
+	}
+	out := live[i].text + text
+	if len(out) > maxLiveOutputLen {
+		out = out[len(out)-maxLiveOutputLen:]
+		if nl := strings.IndexByte(out, '\n'); nl >= 0 {
+			out = out[nl+1:]
+		}
+	}
+	live[i].text = out
+	return live
+}
+
+// removeLiveOutput drops the live output of a finished tool call.
+func removeLiveOutput(live []liveOutput, callID string) []liveOutput {
+	for i, out := range live {
+		if out.callID == callID {
+			return append(live[:i:i], live[i+1:]...)
+		}
+	}
+	return live
+}
+
+// renderLiveOutput renders the last lines of a running tool call's output.
+func renderLiveOutput(out liveOutput) string {
+	lines := strings.Split(strings.TrimRight(out.text, "\n"), "\n")
+	if len(lines) > maxLiveOutputLines {
+		lines = lines[len(lines)-maxLiveOutputLines:]
+	}
+	return liveOutputStyle.Render(strings.Join(lines, "\n"))
+}
@@ -18,9 +18,27 @@ var (
 				BorderForeground(lipgloss.Color("8")).
 				Padding(0, 1)
 
+	// liveOutputStyle styles the output of running tool calls (gray, dim border).
+	liveOutputStyle = lipgloss.NewStyle().
+			Border(lipgloss.NormalBorder(), false, false, false, true).
+			BorderForeground(lipgloss.Color("8")).
+			Foreground(lipgloss.Color("8")).
+			PaddingLeft(1)
+
+	// diffAddStyle, diffRemoveStyle and diffHunkStyle style lines of a file diff.
+	diffAddStyle    = lipgloss.NewStyle().Foreground(lipgloss.Color("2"))
+	diffRemoveStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1"))
+	diffHunkStyle   = lipgloss.NewStyle().Foreground(lipgloss.Color("6"))
+
 	// errorStyle styles error messages (red bold).
 	errorStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("1")).Bold(true)
 
+	// systemStyle styles system notices such as context compaction (gray italic).
+	systemStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8")).Italic(true)
+
+	// approvalStyle styles approval prompts (magenta bold).
+	approvalStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5")).Bold(true)
+
 	// spinnerStyle styles the spinner (magenta).
 	spinnerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("5"))
 
@@ -30,6 +48,10 @@ var (
 	// appTitleStyle styles the app title (blue bold).
 	appTitleStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("4")).Bold(true)
 
+	// processStyle styles the background process status in the header and
+	// retry notices (yellow).
+	processStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("3"))
+
 	// dividerStyle styles the divider line (gray).
 	dividerStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("8"))
 )
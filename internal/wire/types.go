@@ -2,6 +2,8 @@
 package wire
 
 import (
+	"encoding/json"
+	"fmt"
 	"time"
 )
 
@@ -17,10 +19,18 @@ const (
 	MessageTypeAssistant  MessageType = "assistant"
 	MessageTypeToolCall   MessageType = "tool_call"
 	MessageTypeToolResult MessageType = "tool_result"
+	MessageTypeToolOutput MessageType = "tool_output"
 	MessageTypeError      MessageType = "error"
 	MessageTypeSystem     MessageType = "system"
 	MessageTypeCheckpoint MessageType = "checkpoint"
 	MessageTypeClear      MessageType = "clear"
+	MessageTypeCompaction MessageType = "compaction"
+	MessageTypeRewind     MessageType = "rewind"
+	MessageTypeUndo       MessageType = "undo"
+
+	// Approval messages
+	MessageTypeApprovalRequest  MessageType = "approval_request"
+	MessageTypeApprovalResponse MessageType = "approval_response"
 
 	// Status messages
 	MessageTypeStatus   MessageType = "status"
@@ -28,6 +38,10 @@ const (
 	MessageTypeDone     MessageType = "done"
 )
 
+// MetaStreaming is the metadata key marking an in-progress streaming update.
+// Such messages are superseded by a final message of the same type.
+const MetaStreaming = "streaming"
+
 // ContentPart represents a part of message content.
 type ContentPart struct {
 	Type     string `json:"type"`
@@ -47,6 +61,12 @@ type Message struct {
 	Timestamp time.Time      `json:"timestamp"`
 }
 
+// IsStreaming reports whether the message is an in-progress streaming update.
+func (m Message) IsStreaming() bool {
+	streaming, _ := m.Metadata[MetaStreaming].(bool)
+	return streaming
+}
+
 // NewMessage creates a new wire message.
 func NewMessage(msgType MessageType, content ...ContentPart) *Message {
 	return &Message{
@@ -64,6 +84,28 @@ func NewTextMessage(msgType MessageType, text string) *Message {
 	})
 }
 
+// NewUserInputMessage creates a user input message with images attached.
+func NewUserInputMessage(text string, images ...ContentPart) *Message {
+	return NewMessage(MessageTypeUserInput, append([]ContentPart{{Type: "text", Text: text}}, images...)...)
+}
+
+// ImagePart returns a content part holding an image. label is shown to the
+// user in place of the image.
+func ImagePart(label, mimeType string, data []byte) ContentPart {
+	return ContentPart{Type: "image", Text: label, MimeType: mimeType, Data: data}
+}
+
+// Images returns the image parts of the message.
+func (m Message) Images() []ContentPart {
+	var images []ContentPart
+	for _, part := range m.Content {
+		if part.Type == "image" {
+			images = append(images, part)
+		}
+	}
+	return images
+}
+
 // ToolCall represents a tool call.
 type ToolCall struct {
 	ID        string `json:"id"`
@@ -86,3 +128,208 @@ type Checkpoint struct {
 	Timestamp time.Time `json:"timestamp"`
 	Context   []byte    `json:"context,omitempty"`
 }
+
+// ApprovalDecision is the front-end's answer to an approval request.
+type ApprovalDecision string
+
+const (
+	ApprovalApprove           ApprovalDecision = "approve"
+	ApprovalApproveForSession ApprovalDecision = "approve_for_session"
+	ApprovalReject            ApprovalDecision = "reject"
+)
+
+// ApprovalRequest asks the front-end to approve a tool call.
+type ApprovalRequest struct {
+	ID          string `json:"id"`
+	ToolCallID  string `json:"tool_call_id"`
+	ToolName    string `json:"tool_name"`
+	Action      string `json:"action"`
+	Description string `json:"description"`
+}
+
+// ApprovalResponse answers an ApprovalRequest.
+type ApprovalResponse struct {
+	RequestID string           `json:"request_id"`
+	Decision  ApprovalDecision `json:"decision"`
+	Reason    string           `json:"reason,omitempty"`
+}
+
+// NewApprovalRequestMessage creates an approval request message.
+// The request is carried as a JSON part next to a human-readable text part.
+func NewApprovalRequestMessage(req ApprovalRequest) *Message {
+	data, _ := json.Marshal(req)
+	return NewMessage(MessageTypeApprovalRequest,
+		ContentPart{Type: "text", Text: fmt.Sprintf("%s wants to %s", req.ToolName, req.Description)},
+		ContentPart{Type: "json", JSON: data},
+	)
+}
+
+// NewApprovalResponseMessage creates an approval response message.
+func NewApprovalResponseMessage(resp ApprovalResponse) *Message {
+	data, _ := json.Marshal(resp)
+	text := string(resp.Decision)
+	if resp.Reason != "" {
+		text += ": " + resp.Reason
+	}
+	return NewMessage(MessageTypeApprovalResponse,
+		ContentPart{Type: "text", Text: text},
+		ContentPart{Type: "json", JSON: data},
+	)
+}
+
+// ApprovalRequest extracts the approval request carried by the message.
+func (m Message) ApprovalRequest() (ApprovalRequest, bool) {
+	var req ApprovalRequest
+	if m.Type != MessageTypeApprovalRequest || !m.decodeJSON(&req) {
+		return ApprovalRequest{}, false
+	}
+	return req, true
+}
+
+// ApprovalResponse extracts the approval response carried by the message.
+func (m Message) ApprovalResponse() (ApprovalResponse, bool) {
+	var resp ApprovalResponse
+	if m.Type != MessageTypeApprovalResponse || !m.decodeJSON(&resp) {
+		return ApprovalResponse{}, false
+	}
+	return resp, true
+}
+
+// decodeJSON decodes the first JSON content part into v.
+func (m Message) decodeJSON(v any) bool {
+	for _, part := range m.Content {
+		if part.Type == "json" {
+			return json.Unmarshal(part.JSON, v) == nil
+		}
+	}
+	return false
+}
+
+// RewindRequest asks the soul to roll the conversation back to a checkpoint.
+// A non-empty note is sent to the agent as the next user message.
+type RewindRequest struct {
+	CheckpointID int    `json:"checkpoint_id"`
+	Note         string `json:"note,omitempty"`
+}
+
+// NewRewindMessage creates a rewind message.
+func NewRewindMessage(req RewindRequest) *Message {
+	data, _ := json.Marshal(req)
+	text := fmt.Sprintf("Rewound to checkpoint %d", req.CheckpointID)
+	if req.Note != "" {
+		text += ": " + req.Note
+	}
+	return NewMessage(MessageTypeRewind,
+		ContentPart{Type: "text", Text: text},
+		ContentPart{Type: "json", JSON: data},
+	)
+}
+
+// RewindRequest extracts the rewind request carried by the message.
+func (m Message) RewindRequest() (RewindRequest, bool) {
+	var req RewindRequest
+	if m.Type != MessageTypeRewind || !m.decodeJSON(&req) {
+		return RewindRequest{}, false
+	}
+	return req, true
+}
+
+// UndoRequest asks the soul to restore the work directory from a snapshot.
+// Turn 0 restores the snapshot taken before the most recent turn that ran tools.
+type UndoRequest struct {
+	Turn  int    `json:"turn,omitempty"`
+	Label string `json:"label,omitempty"` // Set on the notice sent after restoring
+}
+
+// NewUndoMessage creates an undo message.
+func NewUndoMessage(req UndoRequest) *Message {
+	data, _ := json.Marshal(req)
+	text := "Undo file changes of the last turn"
+	if req.Turn > 0 {
+		text = fmt.Sprintf("Restored files to snapshot %d", req.Turn)
+		if req.Label != "" {
+			text += ": " + req.Label
+		}
+	}
+	return NewMessage(MessageTypeUndo,
+		ContentPart{Type: "text", Text: text},
+		ContentPart{Type: "json", JSON: data},
+	)
+}
+
+// UndoRequest extracts the undo request carried by the message.
+func (m Message) UndoRequest() (UndoRequest, bool) {
+	var req UndoRequest
+	if m.Type != MessageTypeUndo || !m.decodeJSON(&req) {
+		return UndoRequest{}, false
+	}
+	return req, true
+}
+
+// ToolOutput is output produced by a running tool call. It is transient: the
+// call's tool_result still carries the complete output.
+type ToolOutput struct {
+	ToolCallID string `json:"tool_call_id"`
+	Stream     string `json:"stream"` // "stdout" or "stderr"
+	Text       string `json:"text"`
+}
+
+// NewToolOutputMessage creates a tool output message.
+func NewToolOutputMessage(out ToolOutput) *Message {
+	data, _ := json.Marshal(out)
+	return NewMessage(MessageTypeToolOutput,
+		ContentPart{Type: "text", Text: out.Text},
+		ContentPart{Type: "json", JSON: data},
+	)
+}
+
+// ToolOutput extracts the tool output carried by the message.
+func (m Message) ToolOutput() (ToolOutput, bool) {
+	var out ToolOutput
+	if m.Type != MessageTypeToolOutput || !m.decodeJSON(&out) {
+		return ToolOutput{}, false
+	}
+	return out, true
+}
+
+// StatusRetrying marks a status message about a retried or delayed LLM
+// request.
+const StatusRetrying = "retrying"
+
+// Status is a transient notice about the soul's progress, such as an LLM
+// request waiting to be retried. It is not part of the conversation.
+type Status struct {
+	Kind       string `json:"kind"`
+	Reason     string `json:"reason,omitempty"`  // e.g. "rate limited"
+	Attempt    int    `json:"attempt,omitempty"` // Retry number; 0 when waiting for the rate limiter
+	MaxRetries int    `json:"max_retries,omitempty"`
+	WaitMs     int64  `json:"wait_ms,omitempty"`
+	Error      string `json:"error,omitempty"`
+}
+
+// NewStatusMessage creates a status message.
+func NewStatusMessage(s Status) *Message {
+	data, _ := json.Marshal(s)
+	text := s.Reason
+	if s.Kind == StatusRetrying {
+		wait := (time.Duration(s.WaitMs) * time.Millisecond).Round(time.Second)
+		if s.Attempt > 0 {
+			text = fmt.Sprintf("%s, retrying in %v (attempt %d/%d)", s.Reason, wait, s.Attempt, s.MaxRetries)
+		} else {
+			text = fmt.Sprintf("%s, sending in %v", s.Reason, wait)
+		}
+	}
+	return NewMessage(MessageTypeStatus,
+		ContentPart{Type: "text", Text: text},
+		ContentPart{Type: "json", JSON: data},
+	)
+}
+
+// Status extracts the status carried by the message.
+func (m Message) Status() (Status, bool) {
+	var s Status
+	if m.Type != MessageTypeStatus || !m.decodeJSON(&s) {
+		return Status{}, false
+	}
+	return s, true
+}
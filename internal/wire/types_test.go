@@ -18,10 +18,16 @@ func TestMessageTypeConstants(t *testing.T) {
 		{"Assistant", MessageTypeAssistant, "assistant"},
 		{"ToolCall", MessageTypeToolCall, "tool_call"},
 		{"ToolResult", MessageTypeToolResult, "tool_result"},
+		{"ToolOutput", MessageTypeToolOutput, "tool_output"},
 		{"Error", MessageTypeError, "error"},
 		{"System", MessageTypeSystem, "system"},
 		{"Checkpoint", MessageTypeCheckpoint, "checkpoint"},
 		{"Clear", MessageTypeClear, "clear"},
+		{"Compaction", MessageTypeCompaction, "compaction"},
+		{"Rewind", MessageTypeRewind, "rewind"},
+		{"Undo", MessageTypeUndo, "undo"},
+		{"ApprovalRequest", MessageTypeApprovalRequest, "approval_request"},
+		{"ApprovalResponse", MessageTypeApprovalResponse, "approval_response"},
 		{"Status", MessageTypeStatus, "status"},
 		{"Progress", MessageTypeProgress, "progress"},
 		{"Done", MessageTypeDone, "done"},
@@ -189,3 +195,128 @@ func TestCheckpoint(t *testing.T) {
 		t.Errorf("Expected Context %s, got %s", expectedContext, string(checkpoint.Context))
 	}
 }
+
+func TestMessage_IsStreaming(t *testing.T) {
+	msg := NewTextMessage(MessageTypeAssistant, "partial")
+	if msg.IsStreaming() {
+		t.Error("message without metadata should not be streaming")
+	}
+
+	msg.Metadata = map[string]any{MetaStreaming: true}
+	if !msg.IsStreaming() {
+		t.Error("message with streaming metadata should be streaming")
+	}
+}
+
+func TestApprovalMessages_RoundTrip(t *testing.T) {
+	req := ApprovalRequest{
+		ID:          "req-1",
+		ToolCallID:  "call_1",
+		ToolName:    "shell",
+		Action:      "run shell command",
+		Description: "run command `ls`",
+	}
+	msg := NewApprovalRequestMessage(req)
+	if msg.Content[0].Text != "shell wants to run command `ls`" {
+		t.Errorf("unexpected text: %q", msg.Content[0].Text)
+	}
+
+	// The request must survive JSON serialization
+	data, err := json.Marshal(msg)
+	if err != nil {
+		t.Fatalf("Failed to marshal: %v", err)
+	}
+	var decoded Message
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatalf("Failed to unmarshal: %v", err)
+	}
+	got, ok := decoded.ApprovalRequest()
+	if !ok || got != req {
+		t.Errorf("Expected %+v, got %+v (ok=%v)", req, got, ok)
+	}
+	if _, ok := decoded.ApprovalResponse(); ok {
+		t.Error("request message should not decode as a response")
+	}
+
+	resp := ApprovalResponse{RequestID: "req-1", Decision: ApprovalReject, Reason: "too risky"}
+	respMsg := NewApprovalResponseMessage(resp)
+	if respMsg.Content[0].Text != "reject: too risky" {
+		t.Errorf("unexpected text: %q", respMsg.Content[0].Text)
+	}
+	gotResp, ok := respMsg.ApprovalResponse()
+	if !ok || gotResp != resp {
+		t.Errorf("Expected %+v, got %+v (ok=%v)", resp, gotResp, ok)
+	}
+}
+
+func TestRewindMessage(t *testing.T) {
+	req := RewindRequest{CheckpointID: 3, Note: "that approach failed"}
+	msg := NewRewindMessage(req)
+	if msg.Type != MessageTypeRewind {
+		t.Errorf("Expected type %s, got %s", MessageTypeRewind, msg.Type)
+	}
+	got, ok := msg.RewindRequest()
+	if !ok || got != req {
+		t.Errorf("Expected %+v, got %+v (ok=%v)", req, got, ok)
+	}
+	if _, ok := NewTextMessage(MessageTypeUserInput, "hi").RewindRequest(); ok {
+		t.Error("user input should not decode as a rewind request")
+	}
+}
+
+func TestUndoMessage(t *testing.T) {
+	req := UndoRequest{Turn: 2, Label: "fix the parser"}
+	msg := NewUndoMessage(req)
+	if got := msg.Content[0].Text; got != "Restored files to snapshot 2: fix the parser" {
+		t.Errorf("unexpected text: %q", got)
+	}
+	got, ok := msg.UndoRequest()
+	if !ok || got != req {
+		t.Errorf("Expected %+v, got %+v (ok=%v)", req, got, ok)
+	}
+	if _, ok := NewUndoMessage(UndoRequest{}).UndoRequest(); !ok {
+		t.Error("empty undo request should decode")
+	}
+}
+
+func TestToolOutputMessage(t *testing.T) {
+	out := ToolOutput{ToolCallID: "call_1", Stream: "stderr", Text: "FAIL\n"}
+	msg := NewToolOutputMessage(out)
+	if msg.Type != MessageTypeToolOutput || msg.Content[0].Text != "FAIL\n" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	got, ok := msg.ToolOutput()
+	if !ok || got != out {
+		t.Errorf("Expected %+v, got %+v (ok=%v)", out, got, ok)
+	}
+}
+
+func TestUserInputMessage_Images(t *testing.T) {
+	msg := NewUserInputMessage("what is this?", ImagePart("a.png", "image/png", []byte{1, 2}))
+	if msg.Type != MessageTypeUserInput || msg.Content[0].Text != "what is this?" {
+		t.Errorf("unexpected message: %+v", msg)
+	}
+	images := msg.Images()
+	if len(images) != 1 || images[0].Text != "a.png" || images[0].MimeType != "image/png" {
+		t.Errorf("unexpected images: %+v", images)
+	}
+	if len(NewTextMessage(MessageTypeUserInput, "hi").Images()) != 0 {
+		t.Error("text message should have no images")
+	}
+}
+
+func TestStatusMessage(t *testing.T) {
+	s := Status{Kind: StatusRetrying, Reason: "rate limited", Attempt: 1, MaxRetries: 3, WaitMs: 12300}
+	msg := NewStatusMessage(s)
+	if got := msg.Content[0].Text; got != "rate limited, retrying in 12s (attempt 1/3)" {
+		t.Errorf("unexpected text: %q", got)
+	}
+	got, ok := msg.Status()
+	if !ok || got != s {
+		t.Errorf("Expected %+v, got %+v (ok=%v)", s, got, ok)
+	}
+	wait := NewStatusMessage(Status{Kind: StatusRetrying, Reason: "client rate limit reached", WaitMs: 4000})
+	if got := wait.Content[0].Text; got != "client rate limit reached, sending in 4s" {
+		t.Errorf("unexpected text: %q", got)
+	}
+}